@@ -0,0 +1,10 @@
+// Package assets holds the files that are built into the binary, so that a
+// plain `go install` works without copying anything to the share directory.
+package assets
+
+import _ "embed"
+
+// GlowStyle is the default markdown style for glow.
+//
+//go:embed ggpt_glow_style.json
+var GlowStyle []byte
@@ -1,26 +1,158 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"asc/internal/bundle"
+	"asc/internal/chat"
+	"asc/internal/clipboard"
 	"asc/internal/config"
 	"asc/internal/conversation"
+	"asc/internal/feed"
+	"asc/internal/history"
+	"asc/internal/importer"
+	"asc/internal/lint"
+	"asc/internal/pack"
+	"asc/internal/provider"
+	"asc/internal/remote"
+	"asc/internal/shell"
+	"asc/internal/stats"
+	"asc/internal/style"
+	"asc/internal/suite"
+	"asc/internal/tidy"
+	"asc/internal/timeutil"
 	"asc/internal/view"
 
 	"github.com/charmbracelet/bubbles/table"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/log"
+	"github.com/muesli/termenv"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 var (
 	// Global flags
-	verbose       bool
-	debug         bool
-	usePerplexity bool
+	verbose           bool
+	debug             bool
+	usePerplexity     bool
+	providerFlag      string
+	noCitation        bool
+	searchFocus       string
+	recency           string
+	modelName         string
+	contextFile       string
+	contextCommand    string
+	systemFile        string
+	since             string
+	until             string
+	showMeta          bool
+	autoRetry         bool
+	attachFiles       []string
+	imageFiles        []string
+	editID            string
+	appendID          string
+	redactStrings     []string
+	redactRegexps     []string
+	redactSecret      bool
+	dryRun            bool
+	encryptBundle     bool
+	streamJSON        bool
+	viewHeight        int
+	viewUnread        bool
+	viewArchived      bool
+	viewID            string
+	searchInteractive bool
+	searchReplay      bool
+	clipTemplate      string
+	clipInterval      time.Duration
+	fifoPath          string
+	nullSeparated     bool
+	forceExport       bool
+	exportOutput      string
+	exportFormat      string
+	rateNote          string
+	rateClear         bool
+	personaName       string
+	fewShot           int
+	private           bool
+	lintFix           bool
+	doYes             bool
+	dumpDir           string
+	recordSuite       string
+	streamInterval    time.Duration
+	minimalFlag       bool
+	minimalMode       string
+	accessible        bool
+	replayProvider    string
+	replayModel       string
+	dumpRetentionDays int
+	lintBefore        bool
+	normalizePrompt   bool
+	promptsLimit      int
+	rawOutput         bool
+	chatID            string
+	chatLine          bool
+	askSave           bool
+	metaFilters       []string
+	tagFilters        []string
+	queueNew          bool
+	queueAll          bool
+	queueInteractive  bool
+	profileName       string
+	answerLanguage    string
+	clearProfile      bool
+	noAutoContinue    bool
+	verifyMode        verifyModeFlag
+	verifyModel       string
+	quality           string
+	editTurn          int
+	warmEvery         time.Duration
+	noStdin           bool
+	checkpointName    string
+	splitMessage      bool
+	packName          string
+	packNamespace     string
+	packFlat          bool
+	packForce         bool
+	statsDashboard    bool
+	statsBy           string
+	statsMetric       string
+	topInterval       time.Duration
+	deleteForce       bool
+	pruneOlderThan    string
+	pruneKeep         int
+	pruneDryRun       bool
+	pruneForce        bool
+	tidyList          bool
+	renameAuto        bool
+	tidyHugeKB        int
+	statusFormat      string
+	statusWidth       int
+	statusRefresh     bool
+	personaForce      bool
+	templateName      string
+	templateVars      []string
+	templateForce     bool
+	templateTurn      int
+	templateLiteral   bool
+	templateEdit      bool
+	forkTurn          int
+	useCache          bool
 
 	// Version information
 	version = "dev"
@@ -73,21 +205,45 @@ Examples:
 				Level:           level,
 			})
 
+			// Load the config file; flags given on the command line win
+			cfg, err := config.Load()
+			if err != nil {
+				logger.Warn("Ignoring config file, run 'asc config doctor' for details", "error", err)
+			}
+			activateProfile(cmd, cfg)
+			applyCommandDefaults(cmd, cfg)
+			applyConfigDefaults(cmd, cfg)
+			if accessible {
+				// Colors and decorations only get in the way of screen readers
+				lipgloss.SetColorProfile(termenv.Ascii)
+				logger.SetColorProfile(termenv.Ascii)
+				logger.SetReportCaller(false)
+				logger.SetReportTimestamp(false)
+			}
+
+			// Stdin can only be read once, the second reader would get
+			// nothing
+			if contextFile == "-" && systemFile == "-" {
+				logger.Error("--context-file and --system-file cannot both read stdin, pass one of them as a file")
+				os.Exit(1)
+			}
+
+			// Install the embedded assets on first run
+			if err := style.Materialize(logger); err != nil {
+				logger.Warn("Failed to install the default style", "error", err)
+			}
+
 			// Check required commands
-			if cmd.Name() != "version" {
-				// Check glow command
-				if _, err := exec.LookPath("glow"); err != nil {
-					logger.Error("Required command not found", "command", "glow", "error", err)
+			if cmd.Name() != "version" && !skipsChecks(cmd) {
+				// Check the AI provider
+				name := selectedProvider()
+				p, err := provider.Get(name)
+				if err != nil {
+					logger.Error("Unknown provider", "provider", name, "known", strings.Join(provider.Names(), ", "))
 					os.Exit(1)
 				}
-
-				// Check AI provider command
-				aiCommand := "sgpt"
-				if usePerplexity {
-					aiCommand = "perplexity"
-				}
-				if _, err := exec.LookPath(aiCommand); err != nil {
-					logger.Error("Required command not found", "command", aiCommand, "error", err)
+				if err := p.Available(); err != nil {
+					logger.Error("Provider not available", "provider", name, "error", err)
 					os.Exit(1)
 				}
 
@@ -104,177 +260,4002 @@ Examples:
 	}
 )
 
+// skipChecksAnnotation marks commands that work without the external
+// commands of the AI providers being installed.
+const skipChecksAnnotation = "asc/skip-checks"
+
+// skipsChecks reports whether cmd or one of its parents is marked with
+// skipChecksAnnotation.
+func skipsChecks(cmd *cobra.Command) bool {
+	for c := cmd; c != nil; c = c.Parent() {
+		if c.Annotations[skipChecksAnnotation] == "true" {
+			return true
+		}
+	}
+	return false
+}
+
+// commandKey returns the name of the [command.<name>] config section of
+// cmd: its path without the root command, e.g. "new" or "bundle export".
+func commandKey(cmd *cobra.Command) string {
+	return strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" ")
+}
+
+// applyCommandDefaults sets the flags of cmd from its [command.<name>]
+// config section unless they were given on the command line. It runs before
+// applyConfigDefaults so that a section wins over the global settings.
+func applyCommandDefaults(cmd *cobra.Command, cfg *config.Config) {
+	name := commandKey(cmd)
+	for flagName, value := range cfg.Command[name] {
+		f := cmd.Flags().Lookup(flagName)
+		if f == nil {
+			logger.Warn("Ignoring unknown flag in config, run 'asc config doctor' for details", "command", name, "flag", flagName)
+			continue
+		}
+		if f.Changed {
+			continue
+		}
+		for _, v := range config.FlagValues(value) {
+			if err := cmd.Flags().Set(flagName, v); err != nil {
+				logger.Warn("Ignoring invalid flag value in config", "command", name, "flag", flagName, "error", err)
+			}
+		}
+	}
+}
+
+// activateProfile applies the profile given with --profile, or else the
+// selected one, to cfg. An unknown profile is fatal except for commands
+// that skip the checks, so that `asc profile use` can still fix it.
+func activateProfile(cmd *cobra.Command, cfg *config.Config) {
+	name := profileName
+	if name == "" {
+		var err error
+		if name, err = config.SelectedProfile(); err != nil {
+			logger.Warn("Ignoring the selected profile", "error", err)
+		}
+	}
+	if name == "" {
+		return
+	}
+	if err := cfg.ApplyProfile(name); err != nil {
+		if skipsChecks(cmd) {
+			logger.Warn("Not using profile", "error", err)
+			return
+		}
+		logger.Error("Failed to activate profile", "error", err)
+		os.Exit(1)
+	}
+	logger.Debug("Using profile", "profile", name)
+}
+
+// applyConfigDefaults sets the global options from the config file unless
+// the corresponding flag was given on the command line.
+func applyConfigDefaults(cmd *cobra.Command, cfg *config.Config) {
+	flags := cmd.Flags()
+	perplexityFlag, providerSet := flags.Lookup("perplexity"), flags.Lookup("provider")
+	if (perplexityFlag == nil || !perplexityFlag.Changed) && (providerSet == nil || !providerSet.Changed) {
+		providerFlag = cfg.Provider
+	}
+	if f := flags.Lookup("auto-retry-on-refusal"); f == nil || !f.Changed {
+		autoRetry = cfg.AutoRetryOnRefusal
+	}
+	if f := flags.Lookup("normalize"); f == nil || !f.Changed {
+		normalizePrompt = cfg.Normalize
+	}
+	if f := flags.Lookup("no-citation"); f == nil || !f.Changed {
+		noCitation = cfg.Perplexity.Citation != nil && !*cfg.Perplexity.Citation
+	}
+	if f := flags.Lookup("search-focus"); f == nil || !f.Changed {
+		searchFocus = cfg.Perplexity.Focus
+	}
+	if f := flags.Lookup("recency"); f == nil || !f.Changed {
+		recency = cfg.Perplexity.Recency
+	}
+	if f := flags.Lookup("language"); f == nil || !f.Changed {
+		answerLanguage = cfg.Language
+	}
+	if f := flags.Lookup("a11y"); f == nil || !f.Changed {
+		accessible = cfg.A11y
+	}
+	if f := flags.Lookup("stream-interval"); f == nil || !f.Changed {
+		streamInterval = cfg.StreamInterval
+	}
+	minimalMode = cfg.Minimal
+	if f := flags.Lookup("minimal"); f != nil && f.Changed {
+		minimalMode = "never"
+		if minimalFlag {
+			minimalMode = "always"
+		}
+	}
+	if f := flags.Lookup("dump-dir"); f == nil || !f.Changed {
+		dumpDir = cfg.DumpDir
+	}
+	dumpRetentionDays = cfg.DumpRetentionDays
+}
+
 func init() {
 	// Global flags configuration
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Show verbose output")
 	rootCmd.PersistentFlags().BoolVarP(&debug, "debug", "d", false, "Enable debug mode")
+	rootCmd.PersistentFlags().StringVar(&dumpDir, "dump-dir", "", "Write raw provider requests and responses to this directory (secrets redacted)")
+	rootCmd.PersistentFlags().BoolVar(&accessible, "a11y", false, "Accessibility mode: plain linear text without colors, borders or live re-rendering, for screen readers")
+	rootCmd.PersistentFlags().StringVar(&recordSuite, "record", "", "Append the prompts and answers of provider calls to this suite file for asc replay-suite")
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", "", "Use the settings of this profile from the config file")
 
 	// Add subcommands
 	rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(newCmd)
+	rootCmd.AddCommand(promptCmd)
+	rootCmd.AddCommand(askCmd)
+	rootCmd.AddCommand(chatCmd)
+	rootCmd.AddCommand(doCmd)
+	rootCmd.AddCommand(clipwatchCmd)
+	rootCmd.AddCommand(tailCmd)
+	rootCmd.AddCommand(warmCmd)
+	rootCmd.AddCommand(visibilityCmd)
+	rootCmd.AddCommand(lintPromptCmd)
 	rootCmd.AddCommand(viewCmd)
+	rootCmd.AddCommand(showCmd)
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(importCmd)
+	rootCmd.AddCommand(changedCmd)
+	rootCmd.AddCommand(searchCmd)
+	rootCmd.AddCommand(mergeCmd)
+	rootCmd.AddCommand(forkCmd)
+	rootCmd.AddCommand(deleteCmd)
+	rootCmd.AddCommand(archiveCmd)
+	rootCmd.AddCommand(unarchiveCmd)
+	rootCmd.AddCommand(renameCmd)
+	rootCmd.AddCommand(pinCmd)
+	rootCmd.AddCommand(unpinCmd)
+	rootCmd.AddCommand(pruneCmd)
+	rootCmd.AddCommand(tidyCmd)
+	rootCmd.AddCommand(statsCmd)
+	rootCmd.AddCommand(topCmd)
+	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(providersCmd)
+	rootCmd.AddCommand(modelsCmd)
+	rootCmd.AddCommand(costCmd)
+	rootCmd.AddCommand(statusLineCmd)
+	rootCmd.AddCommand(metaCmd)
+	metaCmd.AddCommand(metaSetCmd)
+	metaCmd.AddCommand(metaUnsetCmd)
+	rootCmd.AddCommand(queueCmd)
+	queueCmd.AddCommand(queueAddCmd)
+	queueCmd.AddCommand(queueDoneCmd)
+	queueCmd.AddCommand(queueRemoveCmd)
+	queueCmd.Flags().BoolVarP(&queueAll, "all", "a", false, "Also list conversations marked done")
+	queueCmd.Flags().BoolVarP(&queueInteractive, "interactive", "i", false, "Open the queued conversations in asc view")
+	queueCmd.Flags().IntVar(&viewHeight, "height", 15, "Number of table rows to show with --interactive")
+	rootCmd.AddCommand(rateCmd)
+	rateCmd.Flags().StringVarP(&rateNote, "note", "n", "", "Note why the answer was good or bad")
+	rateCmd.Flags().BoolVar(&rateClear, "clear", false, "Remove the rating")
+	rootCmd.AddCommand(examplesCmd)
+	examplesCmd.AddCommand(examplesBuildCmd)
+	examplesCmd.AddCommand(examplesListCmd)
+	rootCmd.AddCommand(personaCmd)
+	personaCmd.AddCommand(personaAddCmd)
+	personaCmd.AddCommand(personaEditCmd)
+	personaCmd.AddCommand(personaShowCmd)
+	personaCmd.AddCommand(personaRemoveCmd)
+	rootCmd.AddCommand(templateCmd)
+	templateCmd.AddCommand(templateAddCmd)
+	templateCmd.AddCommand(templateFromCmd)
+	templateCmd.AddCommand(templateEditCmd)
+	templateCmd.AddCommand(templateListCmd)
+	templateCmd.AddCommand(templateShowCmd)
+	templateCmd.AddCommand(templateUseCmd)
+	templateCmd.AddCommand(templateRemoveCmd)
+	personaAddCmd.Flags().BoolVar(&personaForce, "force", false, "Replace the system prompt of an existing persona")
+	templateAddCmd.Flags().BoolVar(&templateForce, "force", false, "Replace an existing template")
+	templateFromCmd.Flags().BoolVar(&templateForce, "force", false, "Replace an existing template")
+	templateFromCmd.Flags().IntVar(&templateTurn, "turn", 1, "Turn of the thread whose message is used (1-based)")
+	templateFromCmd.Flags().BoolVar(&templateLiteral, "literal", false, "Keep the message as is, without suggesting placeholders")
+	templateFromCmd.Flags().BoolVarP(&templateEdit, "edit", "e", false, "Open the template in the editor before saving it")
+	templateUseCmd.Flags().StringArrayVar(&templateVars, "var", nil, "Value of a placeholder as name=value (repeatable)")
+	examplesBuildCmd.Flags().StringVar(&personaName, "persona", "", "Only build the examples of this persona (default: every persona)")
+	examplesListCmd.Flags().StringVar(&personaName, "persona", "", "List the examples of this persona (default: "+conversation.DefaultPersona+")")
+	rootCmd.AddCommand(tagCmd)
+	tagCmd.AddCommand(tagAddCmd)
+	tagCmd.AddCommand(tagRemoveCmd)
+	tagCmd.AddCommand(tagListCmd)
+	modelsCmd.AddCommand(modelsUpdateCmd)
+	rootCmd.AddCommand(storageCmd)
+	rootCmd.AddCommand(replaySuiteCmd)
+	replaySuiteCmd.Flags().StringVar(&replayProvider, "provider", "", "Replay against this provider instead of the recorded one ("+strings.Join(provider.Names(), ", ")+")")
+	replaySuiteCmd.Flags().StringVarP(&replayModel, "model", "m", "", "Replay against this model instead of the recorded one")
+	storageCmd.AddCommand(storageMigrateCmd)
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheClearCmd)
+	rootCmd.AddCommand(redactCmd)
+	rootCmd.AddCommand(promptsCmd)
+	rootCmd.AddCommand(initCmd)
+	rootCmd.AddCommand(bundleCmd)
+	bundleCmd.AddCommand(bundleExportCmd)
+	bundleCmd.AddCommand(bundleImportCmd)
+	rootCmd.AddCommand(packCmd)
+	packCmd.AddCommand(packExportCmd)
+	packCmd.AddCommand(packImportCmd)
+	configCmd.AddCommand(configPathCmd)
+	rootCmd.AddCommand(styleCmd)
+	rootCmd.AddCommand(profileCmd)
+	profileCmd.AddCommand(profileListCmd)
+	profileCmd.AddCommand(profileUseCmd)
+	profileUseCmd.Flags().BoolVar(&clearProfile, "clear", false, "Go back to the top-level settings")
+	styleCmd.AddCommand(styleSetCmd)
+	styleCmd.AddCommand(styleListCmd)
+	styleCmd.AddCommand(stylePreviewCmd)
+	configCmd.AddCommand(configDoctorCmd)
 	rootCmd.AddCommand(appendCmd)
 	rootCmd.AddCommand(editCmd)
 	rootCmd.AddCommand(contextCmd)
+	contextCmd.AddCommand(contextHistoryCmd)
+	contextCmd.AddCommand(contextRollbackCmd)
+	contextCmd.AddCommand(contextExecCmd)
 	rootCmd.AddCommand(clearCmd)
 
-	// Add perplexity flag to commands that interact with AI
-	newCmd.Flags().BoolVarP(&usePerplexity, "perplexity", "p", false, "Use perplexity command instead of sgpt")
-	appendCmd.Flags().BoolVarP(&usePerplexity, "perplexity", "p", false, "Use perplexity command instead of sgpt")
-	editCmd.Flags().BoolVarP(&usePerplexity, "perplexity", "p", false, "Use perplexity command instead of sgpt")
+	// Add perplexity flag to commands that interact with AI
+	newCmd.Flags().BoolVarP(&usePerplexity, "perplexity", "p", false, "Use perplexity command instead of sgpt")
+	appendCmd.Flags().BoolVarP(&usePerplexity, "perplexity", "p", false, "Use perplexity command instead of sgpt")
+	editCmd.Flags().BoolVarP(&usePerplexity, "perplexity", "p", false, "Use perplexity command instead of sgpt")
+	promptCmd.Flags().BoolVarP(&usePerplexity, "perplexity", "p", false, "Use perplexity command instead of sgpt")
+	chatCmd.Flags().BoolVarP(&usePerplexity, "perplexity", "p", false, "Use perplexity command instead of sgpt")
+	doCmd.Flags().BoolVarP(&usePerplexity, "perplexity", "p", false, "Use perplexity command instead of sgpt")
+	doCmd.Flags().StringVar(&chatID, "id", "", "Continue this conversation, e.g. to fix a command that failed")
+	doCmd.Flags().BoolVarP(&doYes, "yes", "y", false, "Run the command without asking")
+	tailCmd.Flags().BoolVarP(&usePerplexity, "perplexity", "p", false, "Use perplexity command instead of sgpt")
+	tailCmd.Flags().StringVar(&fifoPath, "fifo", "", "FIFO to read prompts from (created if missing)")
+	tailCmd.Flags().StringVar(&chatID, "id", "", "Append the answers to this conversation instead of a new one")
+	tailCmd.Flags().BoolVarP(&nullSeparated, "null", "0", false, "Prompts are separated by NUL bytes instead of newlines")
+	tailCmd.MarkFlagRequired("fifo")
+	warmCmd.Flags().StringVar(&providerFlag, "provider", "", "AI provider to use ("+strings.Join(provider.Names(), ", ")+")")
+	warmCmd.Flags().StringVarP(&modelName, "model", "m", "", "Model to load")
+	warmCmd.Flags().DurationVar(&warmEvery, "every", 0, "Keep running and load the model again this often (e.g. 4m) until interrupted")
+	clipwatchCmd.Flags().BoolVarP(&usePerplexity, "perplexity", "p", false, "Use perplexity command instead of sgpt")
+	askCmd.Flags().BoolVarP(&usePerplexity, "perplexity", "p", false, "Use perplexity command instead of sgpt")
+	askCmd.Flags().BoolVarP(&askSave, "save", "s", false, "Save the conversation to the history")
+	for _, c := range []*cobra.Command{newCmd, appendCmd, promptCmd, askCmd} {
+		c.Flags().BoolVar(&noStdin, "no-stdin", false, "Do not attach text piped to stdin")
+	}
+	newCmd.Flags().BoolVar(&splitMessage, "split", false, `Send the questions of the message separated by ";;" at the same time, as separate conversations`)
+	for _, c := range []*cobra.Command{newCmd, appendCmd, editCmd, promptCmd, askCmd, chatCmd, doCmd, tailCmd, clipwatchCmd} {
+		c.Flags().StringVar(&providerFlag, "provider", "", "AI provider to use ("+strings.Join(provider.Names(), ", ")+")")
+		c.Flags().StringVarP(&modelName, "model", "m", "", "Model of the provider to use (reused by follow-ups)")
+		c.Flags().StringVar(&answerLanguage, "language", "", "Ask for answers in this language (e.g. Japanese), whatever the language of the question")
+		c.Flags().DurationVar(&streamInterval, "stream-interval", 0, "Print streamed answers at most this often, coalescing lines (e.g. 250ms for slow links)")
+		c.Flags().BoolVar(&minimalFlag, "minimal", false, "Stream answers as plain lines without re-rendering, for slow links (default: detected over SSH)")
+		c.MarkFlagsMutuallyExclusive("perplexity", "provider")
+		c.Flags().BoolVar(&noCitation, "no-citation", false, "Do not list sources under perplexity answers")
+		c.Flags().StringVar(&searchFocus, "search-focus", "", "Restrict the perplexity search (e.g. scholar, youtube)")
+		c.Flags().StringVar(&recency, "recency", "", "Only search recent pages with perplexity ("+strings.Join(config.Recencies, ", ")+")")
+	}
+	clipwatchCmd.Flags().StringVarP(&clipTemplate, "template", "t", "", "Template used when Enter is pressed ("+strings.Join(clipboard.TemplateNames(), ", ")+")")
+	clipwatchCmd.Flags().DurationVar(&clipInterval, "interval", 500*time.Millisecond, "How often to check the clipboard")
+
+	// Time range filters for commands that list conversations
+	viewCmd.Flags().StringVar(&since, "since", "", "Only show conversations since this time (e.g. 2025-07-01, yesterday, 7d, 3h)")
+	viewCmd.Flags().StringVar(&until, "until", "", "Only show conversations until this time (e.g. 2025-07-31, today, 1d)")
+	viewCmd.Flags().IntVar(&viewHeight, "height", 15, "Number of table rows to show")
+	viewCmd.Flags().BoolVar(&viewUnread, "unread", false, "Only show conversations whose answer has not been viewed")
+	viewCmd.Flags().BoolVar(&viewArchived, "archived", false, "Show the archived conversations instead of the others")
+	viewCmd.Flags().StringVar(&viewID, "id", "", "Select and open this conversation")
+	searchCmd.Flags().StringVar(&since, "since", "", "Only search conversations since this time (e.g. 2025-07-01, 7d)")
+	searchCmd.Flags().StringVar(&until, "until", "", "Only search conversations until this time")
+	searchCmd.Flags().BoolVarP(&searchInteractive, "interactive", "i", false, "Open the matching conversations in asc view")
+	searchCmd.Flags().IntVar(&viewHeight, "height", 15, "Number of table rows to show with --interactive")
+	searchCmd.Flags().BoolVar(&searchReplay, "replay", false, "Pick a match and send its prompt again, optionally edited, to the default model")
+	searchCmd.MarkFlagsMutuallyExclusive("interactive", "replay")
+	for _, c := range []*cobra.Command{viewCmd, bundleExportCmd, searchCmd} {
+		c.Flags().StringArrayVar(&metaFilters, "meta", nil, "Only include conversations with this metadata, key=value or key (repeatable)")
+		c.Flags().StringArrayVar(&tagFilters, "tag", nil, "Only include conversations with this tag (repeatable)")
+	}
+
+	editCmd.Flags().StringVar(&editID, "id", "", "ID of the conversation to edit (default: most recent)")
+	appendCmd.Flags().StringVar(&appendID, "id", "", "ID of the conversation to continue (default: most recent)")
+	for _, c := range []*cobra.Command{appendCmd, editCmd, chatCmd, doCmd, tailCmd, viewCmd} {
+		c.RegisterFlagCompletionFunc("id", completeConversationIDs)
+	}
+	chatCmd.Flags().StringVar(&chatID, "id", "", "Continue this conversation instead of starting a new one")
+	chatCmd.Flags().BoolVar(&chatLine, "line", false, "Use the line-by-line prompt instead of the full-screen chat")
+	editCmd.Flags().IntVar(&editTurn, "turn", 1, "Turn of the thread to edit (1-based); later turns are replayed")
+	pruneCmd.Flags().StringVar(&pruneOlderThan, "older-than", "", "Delete conversations without activity for this long (e.g. 90d, 12w)")
+	pruneCmd.Flags().IntVar(&pruneKeep, "keep", 0, "Delete all but this many most recently active conversations")
+	pruneCmd.Flags().BoolVarP(&pruneDryRun, "dry-run", "n", false, "List the conversations that would be deleted")
+	pruneCmd.Flags().BoolVarP(&pruneForce, "force", "f", false, "Delete without asking for confirmation")
+	pruneCmd.Flags().StringVar(&since, "since", "", "Only delete conversations started since this time (e.g. 2024-01-01, 365d)")
+	pruneCmd.Flags().StringVar(&until, "until", "", "Only delete conversations started until this time (e.g. 2024-12-31, 180d)")
+	tidyCmd.Flags().BoolVarP(&tidyList, "list", "l", false, "Only list the findings")
+	renameCmd.Flags().BoolVar(&renameAuto, "auto", false, "Ask the provider for a title, as is done for new conversations")
+	tidyCmd.Flags().IntVar(&tidyHugeKB, "huge-kb", 512, "Size in KB from which a conversation is huge, 0 to not look for them")
+	deleteCmd.Flags().BoolVarP(&deleteForce, "force", "f", false, "Delete without asking for confirmation")
+	forkCmd.Flags().IntVar(&forkTurn, "turn", 0, "Only copy the thread up to this turn (1-based; default: all turns)")
+	statsCmd.Flags().StringVar(&since, "since", "", "Only include conversations since this time (e.g. 2025-07-01, 7d)")
+	changedCmd.Flags().StringVar(&since, "since", "", "Time (e.g. 2025-07-01, 7d) or checkpoint to compare with (default: list all)")
+	changedCmd.Flags().StringVar(&checkpointName, "save", "", "Record the current checksums as this checkpoint afterwards")
+	statsCmd.Flags().StringVar(&until, "until", "", "Only include conversations until this time")
+	statsCmd.Flags().BoolVar(&statsDashboard, "dashboard", false, "Chart conversations, tokens and cost in a dashboard")
+	statsCmd.Flags().StringVar(&statsBy, "by", stats.DimensionDay, "Dashboard grouping: day, week, model or provider")
+	statsCmd.Flags().StringVar(&statsMetric, "metric", stats.MetricCost, "Dashboard metric: cost, tokens or conversations")
+	topCmd.Flags().DurationVar(&topInterval, "interval", 2*time.Second, "Time between two refreshes")
+	redactCmd.Flags().StringArrayVarP(&redactStrings, "string", "s", nil, "Literal string to redact (repeatable)")
+	redactCmd.Flags().StringArrayVarP(&redactRegexps, "pattern", "e", nil, "Regular expression to redact (repeatable)")
+	redactCmd.Flags().BoolVar(&redactSecret, "secrets", false, "Redact common API keys and private keys")
+	redactCmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "Only report how many matches would be redacted")
+	bundleExportCmd.Flags().BoolVar(&forceExport, "force", false, "Export private conversations too")
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "Write to this file instead of stdout")
+	exportCmd.Flags().StringVar(&exportFormat, "format", "", "Export format: markdown, html or json (default: from the extension of --output, else markdown)")
+	exportCmd.Flags().BoolVar(&forceExport, "force", false, "Export a private conversation too")
+	exportCmd.Flags().StringVar(&since, "since", "", "Export the conversations since this time to the --output directory (e.g. 2025-07-01, 7d)")
+	exportCmd.Flags().StringVar(&until, "until", "", "Export the conversations until this time to the --output directory")
+	packExportCmd.Flags().StringVar(&packName, "name", "", "Name of the pack, the namespace of its items on import (default: the directory name)")
+	packImportCmd.Flags().StringVar(&packNamespace, "namespace", "", "Import the items as <namespace>.<name> (default: the pack name)")
+	packImportCmd.Flags().BoolVar(&packFlat, "no-namespace", false, "Import the items under their own names")
+	packImportCmd.Flags().BoolVar(&packForce, "force", false, "Replace installed items of the same name")
+	packImportCmd.MarkFlagsMutuallyExclusive("namespace", "no-namespace")
+	statusLineCmd.Flags().StringVar(&statusFormat, "format", "", "Output format with {unread}, {running}, {title} and {id} (default: compact)")
+	statusLineCmd.Flags().IntVar(&statusWidth, "width", 30, "Cut the title to this many characters (0 for no limit)")
+	statusLineCmd.Flags().BoolVar(&statusRefresh, "refresh", false, "Rebuild the summary from the conversations first")
+	bundleExportCmd.Flags().BoolVar(&encryptBundle, "encrypt", false, "Encrypt the bundle with a passphrase ($ASC_BUNDLE_PASSPHRASE or prompted)")
+	bundleExportCmd.Flags().StringVar(&since, "since", "", "Only bundle conversations since this time (e.g. 2025-07-01, 7d)")
+	bundleExportCmd.Flags().StringVar(&until, "until", "", "Only bundle conversations until this time")
+	promptsCmd.Flags().IntVarP(&promptsLimit, "limit", "n", 20, "Number of recent prompts to list (0 for all)")
+	promptsCmd.Flags().StringVar(&since, "since", "", "Only list prompts sent since this time (e.g. 2025-07-01, yesterday, 7d)")
+	promptsCmd.Flags().StringVar(&until, "until", "", "Only list prompts sent until this time")
+	showCmd.Flags().BoolVar(&showMeta, "meta", false, "Show provider response metadata instead of the conversation")
+
+	// Per-invocation context and system prompt files
+	for _, c := range []*cobra.Command{newCmd, appendCmd, editCmd, promptCmd, askCmd, chatCmd, tailCmd, doCmd} {
+		c.Flags().StringVar(&contextFile, "context-file", "", "Read context from this file instead of context.txt (- for stdin)")
+		c.Flags().StringVar(&contextCommand, "context-cmd", "", "Use the output of this shell command as context instead of context.txt (e.g. \"git diff --staged\")")
+		c.MarkFlagsMutuallyExclusive("context-file", "context-cmd")
+		c.Flags().StringVar(&systemFile, "system-file", "", "Read a system prompt from this file (- for stdin)")
+		c.Flags().StringArrayVarP(&attachFiles, "file", "f", nil, "Attach a text file to the message (repeatable)")
+		c.Flags().StringArrayVar(&imageFiles, "image", nil, "Send an image with the message to a provider with vision support (repeatable)")
+		c.Flags().BoolVar(&autoRetry, "auto-retry-on-refusal", false, "Retry with a clarified prompt when the answer looks like a refusal")
+		c.Flags().BoolVar(&private, "private", false, "Mark the conversation as private so that it is not exported without --force")
+		c.Flags().BoolVar(&queueNew, "queue", false, "Put the conversation on the reading queue (see asc queue)")
+		c.Flags().StringVar(&personaName, "persona", "", "Use the system prompt and few-shot examples of this persona and record it with the conversation (see asc persona)")
+		c.Flags().IntVar(&fewShot, "examples", 0, "Add this many answers rated up for the persona as few-shot examples (see asc examples)")
+		c.Flags().BoolVar(&noAutoContinue, "no-auto-continue", false, "Do not continue answers that were cut off")
+		c.Flags().StringVar(&quality, "quality", "", "Requested quality for model routing: low, normal or high")
+	}
+	lintPromptCmd.Flags().BoolVar(&lintFix, "fix", false, "Print the prompt rewritten with the cleanup template")
+	for _, c := range []*cobra.Command{newCmd, appendCmd, promptCmd} {
+		c.Flags().BoolVar(&lintBefore, "lint", false, "Check the prompt for common problems before sending it")
+		c.Flags().BoolVar(&normalizePrompt, "normalize", false, "Fix obvious typos and whitespace in the prompt, showing the changes first")
+		c.Flags().StringVar(&templateName, "template", "", "Start the message with this prompt template (see asc template)")
+		c.Flags().StringArrayVar(&templateVars, "var", nil, "Value of a template placeholder as name=value (repeatable)")
+	}
+	newCmd.MarkFlagsMutuallyExclusive("template", "split")
+	for _, c := range []*cobra.Command{newCmd, appendCmd, promptCmd, askCmd} {
+		c.Flags().BoolVar(&useCache, "cache", false, "Reuse the answer to the same prompt sent before; with files in a git repository, only while HEAD is the same commit")
+	}
+	for _, c := range []*cobra.Command{newCmd, appendCmd, promptCmd, tailCmd} {
+		c.Flags().Var(&verifyMode, "verify", "Check the answer in a second pass: critique (default) or revise")
+		c.Flags().Lookup("verify").NoOptDefVal = string(conversation.VerifyCritique)
+		c.Flags().StringVar(&verifyModel, "verify-model", "", "Model that reviews the answer with --verify (default: the same model)")
+		c.Flags().BoolVar(&streamJSON, "stream-json", false, "Write the response as JSON Lines events (delta, usage, done) instead of rendering it")
+		c.Flags().BoolVar(&rawOutput, "raw", false, "Write the response as plain text instead of rendering it")
+		c.MarkFlagsMutuallyExclusive("stream-json", "raw")
+	}
+}
+
+// verifyModeFlag is the value of --verify.
+type verifyModeFlag conversation.VerifyMode
+
+func (f *verifyModeFlag) String() string { return string(*f) }
+
+func (f *verifyModeFlag) Set(s string) error {
+	mode, err := conversation.ParseVerifyMode(s)
+	if err != nil {
+		return err
+	}
+	*f = verifyModeFlag(mode)
+	return nil
+}
+
+func (f *verifyModeFlag) Type() string { return "mode" }
+
+// recordPrompt adds message to the prompt history. Failing to record it
+// does not stop the message from being sent.
+func recordPrompt(message string) {
+	if err := history.Add(message); err != nil {
+		logger.Warn("Failed to record prompt history", "error", err)
+	}
+}
+
+// selectedProvider returns the provider chosen with the flags or the config
+// file.
+func selectedProvider() string {
+	if usePerplexity {
+		return "perplexity"
+	}
+	if providerFlag != "" {
+		return providerFlag
+	}
+	return conversation.DefaultProvider
+}
+
+// continueOptions returns the options for continuing conv. The model and
+// the perplexity search options saved with conv are reused unless given as
+// flags.
+func continueOptions(cmd *cobra.Command, conv conversation.Conversation) conversation.Options {
+	opts := messageOptions()
+	flags := cmd.Flags()
+	if conv.Model != "" && !flags.Changed("model") && !flags.Changed("provider") && !flags.Changed("perplexity") {
+		opts.Provider = conv.Provider
+		opts.Model = conv.Model
+	}
+	if !flags.Changed("persona") {
+		opts.Persona = conv.Metadata[conversation.PersonaKey]
+	}
+	if saved := conv.Perplexity; saved != nil {
+		if !flags.Changed("no-citation") {
+			opts.Perplexity.NoCitations = saved.NoCitations
+		}
+		if !flags.Changed("search-focus") {
+			opts.Perplexity.Focus = saved.Focus
+		}
+		if !flags.Changed("recency") {
+			opts.Perplexity.Recency = saved.Recency
+		}
+	}
+	return opts
+}
+
+// messageOptions returns the conversation options shared by the commands
+// that send messages to AI.
+func messageOptions() conversation.Options {
+	opts := conversation.Options{
+		Provider:       selectedProvider(),
+		Model:          modelName,
+		ContextFile:    contextFile,
+		ContextCommand: contextCommand,
+		SystemFile:     systemFile,
+		Language:       answerLanguage,
+		Attachments:    attachFiles,
+		Images:         imageFiles,
+
+		AutoRetryOnRefusal: autoRetry,
+		NoAutoContinue:     noAutoContinue,
+		Verify:             conversation.VerifyMode(verifyMode),
+		VerifyModel:        verifyModel,
+		Quality:            quality,
+		Private:            private,
+		Queue:              queueNew,
+		Persona:            personaName,
+		Examples:           fewShot,
+		Perplexity: conversation.PerplexityOptions{
+			NoCitations: noCitation,
+			Focus:       searchFocus,
+			Recency:     recency,
+		},
+		Dump:   conversation.DumpOptions{Dir: dumpDir, RetentionDays: dumpRetentionDays},
+		Record: recordSuite,
+		Cache:  useCache,
+
+		StreamInterval: streamInterval,
+	}
+	if streamJSON {
+		opts.Output = conversation.OutputJSON
+	} else if rawOutput {
+		opts.Output = conversation.OutputRaw
+	} else if accessible {
+		opts.Output = conversation.OutputPlain
+	} else if minimalOutput() {
+		opts.Output = conversation.OutputMinimal
+	}
+	return opts
+}
+
+// minimalOutput reports whether answers are streamed in the minimal mode:
+// as set with --minimal or in the config file, or by default when the
+// terminal is reached over a slow SSH link.
+func minimalOutput() bool {
+	switch minimalMode {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	return term.IsTerminal(int(os.Stdout.Fd())) && remote.Slow(logger)
+}
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Show version information",
+	Long:  `Display the current version of ASC and build information.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Printf("ASC version %s\n", version)
+	},
+}
+
+var newCmd = &cobra.Command{
+	Use:     "new [message]",
+	Aliases: []string{"n"},
+	Short:   "Start a new conversation with AI",
+	Long: `Start a new interactive conversation session with AI.
+The conversation will be saved in your data directory for future reference.
+
+If a message is provided, it will be sent as the first message to AI.
+Otherwise, you'll enter an interactive mode where you can type messages.
+
+Text piped to stdin is attached to the message in a fenced block, or is the
+message when none is given:
+
+  cat error.log | asc new "explain this error"
+
+With --split, the message holds several independent questions separated by
+";;". They are sent at the same time, the answers are printed in order,
+and each is saved as its own conversation, linked to the first one by the
+split metadata (asc view --meta split=<id>). Piped text is attached to
+every question:
+
+  asc new --split "What is a mutex? ;; What is a semaphore? ;; When to use which?"`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		message := ""
+		if len(args) > 0 {
+			message = args[0]
+		}
+		if splitMessage {
+			return fanOut(message)
+		}
+		message, err := normalizeMessage(message)
+		if err != nil {
+			return err
+		}
+		if message, err = templateMessage(message); err != nil {
+			return err
+		}
+		if message, err = withPipedInput(message); err != nil {
+			return err
+		}
+		if strings.TrimSpace(message) == "" {
+			logger.Error("Message is required")
+			os.Exit(1)
+		}
+
+		if message, err = lintMessage(message, false); err != nil {
+			return err
+		}
+		logger.Debug("Starting new conversation", "message", message)
+		if len(args) > 0 {
+			recordPrompt(args[0])
+		}
+
+		return conversation.StartNewConversation(message, messageOptions(), logger)
+	},
+}
+
+var promptCmd = &cobra.Command{
+	Use:   "prompt [message]",
+	Short: "Send a one-shot prompt without saving it",
+	Long: `Send a message to AI and print the answer without writing anything
+to the conversation history.
+
+This is meant for throwaway questions and for scripts where persistence
+is unwanted. The context file is still prepended as with 'new', and text
+piped to stdin is attached.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		message := ""
+		if len(args) > 0 {
+			message = args[0]
+		}
+		message, err := normalizeMessage(message)
+		if err != nil {
+			return err
+		}
+		if message, err = templateMessage(message); err != nil {
+			return err
+		}
+		if message, err = withPipedInput(message); err != nil {
+			return err
+		}
+		if strings.TrimSpace(message) == "" {
+			return fmt.Errorf("message is required")
+		}
+
+		if message, err = lintMessage(message, false); err != nil {
+			return err
+		}
+		logger.Debug("Sending one-shot prompt", "message", message)
+
+		opts := messageOptions()
+		opts.Ephemeral = true
+		return conversation.StartNewConversation(message, opts, logger)
+	},
+}
+
+var askCmd = &cobra.Command{
+	Use:   "ask [question...]",
+	Short: "Ask a quick question, with piped input attached",
+	Long: `Ask a one-off question from the shell. The arguments are joined into the
+question, so quoting is optional:
+
+  ps aux | asc ask "which process is eating RAM?"
+  asc ask how do I undo the last git commit
+
+Text piped to stdin is attached to the question, or is the question when no
+arguments are given. The answer is rendered on a terminal and written as
+plain text otherwise. Nothing is saved unless --save is given.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		message, err := withPipedInput(strings.Join(args, " "))
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(message) == "" {
+			return fmt.Errorf("question is required")
+		}
+		logger.Debug("Asking", "message", message)
+
+		opts := messageOptions()
+		opts.Ephemeral = !askSave
+		if askSave && len(args) > 0 {
+			recordPrompt(strings.Join(args, " "))
+		}
+		if !term.IsTerminal(int(os.Stdout.Fd())) {
+			opts.Output = conversation.OutputRaw
+		}
+		return conversation.StartNewConversation(message, opts, logger)
+	},
+}
+
+var clipwatchCmd = &cobra.Command{
+	Use:   "clipwatch",
+	Short: "Send copied text to AI with a template",
+	Long: `Watch the clipboard and, whenever new text is copied, ask whether to
+explain, translate or summarize it. The answer is shown and saved like with
+'asc new'. Translations go into the language of --language, or of language
+in the config file, and into English from it; without one, into English.
+
+Reads the clipboard with pbpaste, wl-paste, xclip or xsel.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return clipboard.Watch(clipInterval, clipTemplate, answerLanguage, func(template, prompt string) error {
+			opts := messageOptions()
+			if template == "translate" {
+				// The prompt names the languages to translate between
+				opts.Language = ""
+			}
+			return conversation.StartNewConversation(prompt, opts, logger)
+		}, logger)
+	},
+}
+
+var lintPromptCmd = &cobra.Command{
+	Use:   "lint-prompt [prompt]",
+	Short: "Check a prompt for common problems without sending it",
+	Long: `Analyze a prompt locally and suggest improvements: prompts that are too
+short, start with a pronoun that refers to nothing, mention "this error" or
+"the attached file" without attaching anything, or paste a lot of text
+without structure. Reads the prompt from stdin if none is given.
+
+With --fix, the prompt rewritten with the cleanup template (question first,
+pasted text in a fenced block) is printed to stdout.
+
+Use --lint on new, append or prompt to check before sending.`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		prompt := "-"
+		if len(args) == 1 {
+			prompt = args[0]
+		}
+		if prompt == "-" {
+			data, err := conversation.ReadInputFile("-")
+			if err != nil {
+				return err
+			}
+			prompt = data
+		}
+
+		issues := lint.Check(lintInput(prompt, false))
+		for _, issue := range issues {
+			fmt.Fprintln(os.Stderr, issue)
+		}
+		if lintFix {
+			fmt.Println(lint.Fix(prompt))
+			return nil
+		}
+		if len(issues) > 0 {
+			return fmt.Errorf("%d issue(s) found", len(issues))
+		}
+		fmt.Fprintln(os.Stderr, "No issues found")
+		return nil
+	},
+}
+
+// withPipedInput returns message with the text piped to stdin attached as
+// set in the [stdin] section of the config, or the piped text alone if
+// message is empty. Stdin is left alone on a terminal, with --no-stdin and
+// when --context-file or --system-file reads it.
+func withPipedInput(message string) (string, error) {
+	input, err := pipedInput()
+	if err != nil {
+		return "", err
+	}
+	return attachPiped(message, input), nil
+}
+
+// pipedInput returns the text piped to stdin, or "" when stdin is left
+// alone.
+func pipedInput() (string, error) {
+	if noStdin || contextFile == "-" || systemFile == "-" || term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", nil
+	}
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", fmt.Errorf("failed to read stdin: %w", err)
+	}
+	return conversation.DecodeInput(data)
+}
+
+// attachPiped adds input to message as set in the [stdin] section.
+func attachPiped(message, input string) string {
+	cfg := config.Current().Stdin
+	return conversation.AttachInput(message, input, cfg.MaxSize, cfg.Fence == nil || *cfg.Fence)
+}
+
+// fanOut sends the questions of message, separated by ";;", as separate
+// conversations at the same time.
+func fanOut(message string) error {
+	input, err := pipedInput()
+	if err != nil {
+		return err
+	}
+	if message == "" {
+		message, input = input, ""
+	} else if message, err = normalizeMessage(message); err != nil {
+		return err
+	}
+	questions := conversation.SplitQuestions(message)
+	if len(questions) == 0 {
+		return fmt.Errorf("message is required")
+	}
+	for i := range questions {
+		questions[i] = attachPiped(questions[i], input)
+	}
+	opts := messageOptions()
+	if opts.Verify != conversation.VerifyNone {
+		return fmt.Errorf("--verify cannot be combined with --split")
+	}
+	recordPrompt(message)
+	ids, err := conversation.FanOut(questions, opts, logger)
+	if len(ids) > 0 {
+		fmt.Fprintf(os.Stderr, "Saved %d conversation(s): %s\n", len(ids), strings.Join(ids, " "))
+	}
+	return err
+}
+
+// lintInput describes prompt and what the current flags send along with it.
+func lintInput(prompt string, followUp bool) lint.Input {
+	hasContext := contextFile != "" || contextCommand != "" || systemFile != ""
+	if !hasContext {
+		if context, err := conversation.LoadContext(logger); err == nil && strings.TrimSpace(context) != "" {
+			hasContext = true
+		}
+	}
+	return lint.Input{Prompt: prompt, HasContext: hasContext, Attachments: len(attachFiles), FollowUp: followUp}
+}
+
+// lintMessage checks message when --lint is given. On a terminal it asks
+// whether to send the message as is, send it cleaned up or abort, and
+// returns the message to send; otherwise the issues are only reported.
+func lintMessage(message string, followUp bool) (string, error) {
+	if !lintBefore {
+		return message, nil
+	}
+	issues := lint.Check(lintInput(message, followUp))
+	if len(issues) == 0 {
+		return message, nil
+	}
+	for _, issue := range issues {
+		fmt.Fprintln(os.Stderr, issue)
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return message, nil
+	}
+
+	fmt.Fprint(os.Stderr, "[s]end anyway, [f]ix and send, [A]bort? ")
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("failed to read answer: %w", err)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "s":
+		return message, nil
+	case "f":
+		return lint.Fix(message), nil
+	}
+	return "", fmt.Errorf("aborted")
+}
+
+// templateMessage expands the template of --template with the values of
+// --var, followed by message if one was given.
+func templateMessage(message string) (string, error) {
+	if templateName == "" {
+		if len(templateVars) > 0 {
+			return "", fmt.Errorf("--var needs --template")
+		}
+		return message, nil
+	}
+	text, err := conversation.LoadTemplate(templateName)
+	if err != nil {
+		return "", err
+	}
+	vars, err := conversation.ParseVars(templateVars)
+	if err != nil {
+		return "", err
+	}
+	placeholders := conversation.Placeholders(text)
+	for name := range vars {
+		if !slices.Contains(placeholders, name) {
+			logger.Warn("Template has no such placeholder", "template", templateName, "var", name)
+		}
+	}
+	expanded, err := conversation.ExpandTemplate(text, vars)
+	if err != nil {
+		return "", fmt.Errorf("template %s: %w", templateName, err)
+	}
+	if strings.TrimSpace(message) != "" {
+		expanded += "\n\n" + message
+	}
+	return expanded, nil
+}
+
+// shellQuote quotes s for a POSIX shell if it needs it.
+func shellQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n'\"\\$`!*?[]{}()<>|&;#~") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// normalizeMessage fixes obvious typos and whitespace in message when
+// --normalize is given, printing the changed lines to stderr. On a terminal
+// it asks whether to send the corrected message, the message as typed or
+// abort; otherwise the corrected message is sent.
+func normalizeMessage(message string) (string, error) {
+	if !normalizePrompt || strings.TrimSpace(message) == "" {
+		return message, nil
+	}
+	normalized := lint.Normalize(message)
+	if normalized == strings.TrimSpace(message) {
+		return message, nil
+	}
+	for _, line := range lint.Diff(message, normalized) {
+		fmt.Fprintln(os.Stderr, line)
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return normalized, nil
+	}
+
+	fmt.Fprint(os.Stderr, "[Y]es send corrected, [n]o send as typed, [a]bort? ")
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("failed to read answer: %w", err)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "", "y":
+		return normalized, nil
+	case "n":
+		return message, nil
+	}
+	return "", fmt.Errorf("aborted")
+}
+
+var visibilityCmd = &cobra.Command{
+	Use:   "visibility <id> [private|shareable]",
+	Short: "Show or set whether a conversation may be exported",
+	Long: `Show or set the visibility of a conversation. Private conversations are
+refused by exports (bundle export, the x key of 'asc view', /save in chat)
+unless forced with --force where available.`,
+	Args:        cobra.RangeArgs(1, 2),
+	Annotations: map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		conv, err := conversation.LoadConversation(args[0], logger)
+		if err != nil {
+			return err
+		}
+		if len(args) == 1 {
+			visibility := conv.Visibility
+			if visibility == "" {
+				visibility = conversation.VisibilityShareable
+			}
+			fmt.Println(visibility)
+			return nil
+		}
+		if conv.Visibility, err = conversation.ParseVisibility(args[1]); err != nil {
+			return err
+		}
+		return conversation.SaveConversation(conv, logger)
+	},
+}
+
+var metaCmd = &cobra.Command{
+	Use:   "meta <id>",
+	Short: "Show or change the metadata of a conversation",
+	Long: `Conversations can carry key=value metadata to tie them to tickets, papers
+or experiments:
+
+  asc meta set 20250701120000 ticket=JIRA-123 paper=arXiv:1706.03762
+  asc meta 20250701120000
+  asc view --meta ticket=JIRA-123
+
+The metadata is listed in exports and 'asc show', and --meta of 'asc view'
+and 'asc bundle export' filters on it.`,
+	Args:        cobra.ExactArgs(1),
+	Annotations: map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		conv, err := conversation.LoadConversation(args[0], logger)
+		if err != nil {
+			return err
+		}
+		for _, key := range conversation.MetadataKeys(conv.Metadata) {
+			fmt.Printf("%s=%s\n", key, conv.Metadata[key])
+		}
+		return nil
+	},
+}
+
+var metaSetCmd = &cobra.Command{
+	Use:          "set <id> <key=value>...",
+	Short:        "Set metadata of a conversation",
+	Args:         cobra.MinimumNArgs(2),
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		values, err := conversation.ParseMetadata(args[1:])
+		if err != nil {
+			return err
+		}
+		conv, err := conversation.LoadConversation(args[0], logger)
+		if err != nil {
+			return err
+		}
+		conversation.SetMetadata(&conv, values)
+		return conversation.SaveConversation(conv, logger)
+	},
+}
+
+var metaUnsetCmd = &cobra.Command{
+	Use:          "unset <id> <key>...",
+	Short:        "Remove metadata from a conversation",
+	Args:         cobra.MinimumNArgs(2),
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		conv, err := conversation.LoadConversation(args[0], logger)
+		if err != nil {
+			return err
+		}
+		unsetErr := conversation.UnsetMetadata(&conv, args[1:])
+		if err := conversation.SaveConversation(conv, logger); err != nil {
+			return err
+		}
+		return unsetErr
+	},
+}
+
+var queueCmd = &cobra.Command{
+	Use:   "queue",
+	Short: "List the reading queue",
+	Long: `The reading queue holds answers to read later, e.g. from scheduled or
+batch runs. 'asc queue' lists it in the order conversations were added:
+
+  asc queue add 20250701120000
+  asc new --queue "Summarize the release notes of Go 1.25" < /dev/null
+  asc queue
+  asc queue done 20250701120000
+
+Marking a conversation done is separate from read/unread: viewing an
+answer does not take it off the queue. Done conversations are listed with
+--all until they are removed.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		entries, err := conversation.LoadEntries(logger)
+		if err != nil {
+			return fmt.Errorf("failed to load conversations: %w", err)
+		}
+		queue := conversation.Queue(entries, queueAll)
+		if len(queue) == 0 {
+			fmt.Println("The reading queue is empty")
+			return nil
+		}
+
+		if queueInteractive && !accessible {
+			filter := conversation.Filter{IDs: make(map[string]bool, len(queue))}
+			for _, entry := range queue {
+				filter.IDs[entry.ID] = true
+			}
+			return view.StartView(filter, false, false, viewHeight, "", logger)
+		}
+
+		muted := lipgloss.NewStyle().Foreground(lipgloss.Color(config.Colors().Muted))
+		for i, entry := range queue {
+			heading := entry.Title
+			if heading == "" {
+				heading = strings.Join(strings.Fields(entry.Message), " ")
+			}
+			var state []string
+			if entry.Unread {
+				state = append(state, "unread")
+			}
+			if entry.QueueDone != nil {
+				state = append(state, "done")
+			}
+			status := ""
+			if len(state) > 0 {
+				status = "  " + muted.Render("("+strings.Join(state, ", ")+")")
+			}
+			fmt.Printf("%3d. %s  %s  %s%s\n", i+1, entry.ID,
+				muted.Render("queued "+timeutil.Format(*entry.Queued)), truncateString(heading, 60), status)
+		}
+		return nil
+	},
+}
+
+var queueAddCmd = &cobra.Command{
+	Use:          "add <id>...",
+	Short:        "Put conversations on the reading queue",
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, id := range args {
+			conv, err := conversation.LoadConversation(id, logger)
+			if err != nil {
+				return err
+			}
+			conversation.QueueAdd(&conv)
+			if err := conversation.SaveConversation(conv, logger); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+var queueDoneCmd = &cobra.Command{
+	Use:          "done <id>...",
+	Short:        "Mark conversations on the reading queue as done",
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, id := range args {
+			conv, err := conversation.LoadConversation(id, logger)
+			if err != nil {
+				return err
+			}
+			if err := conversation.QueueDone(&conv); err != nil {
+				return err
+			}
+			if err := conversation.SaveConversation(conv, logger); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+var queueRemoveCmd = &cobra.Command{
+	Use:          "remove <id>...",
+	Aliases:      []string{"rm"},
+	Short:        "Take conversations off the reading queue",
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, id := range args {
+			conv, err := conversation.LoadConversation(id, logger)
+			if err != nil {
+				return err
+			}
+			if err := conversation.QueueRemove(&conv); err != nil {
+				return err
+			}
+			if err := conversation.SaveConversation(conv, logger); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+var rateCmd = &cobra.Command{
+	Use:   "rate <id> [up|down]",
+	Short: "Rate the answer of a conversation",
+	Long: `Rate the last answer of a conversation as good (up) or bad (down), with an
+optional note. Ratings are kept in the metadata of the conversation
+(rating and rating_note) and 'asc stats' counts them per provider and
+model, which shows the models that work well for you.
+
+Without a rating, the current rating is shown.`,
+	Example: `  asc rate 20250701120000 up
+  asc rate 20250701120000 down --note "hallucinated API"
+  asc view --meta rating=down`,
+	Args:         cobra.RangeArgs(1, 2),
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		conv, err := conversation.LoadConversation(args[0], logger)
+		if err != nil {
+			return err
+		}
+		switch {
+		case rateClear:
+			if len(args) > 1 {
+				return fmt.Errorf("--clear takes no rating")
+			}
+			if err := conversation.Unrate(&conv); err != nil {
+				return err
+			}
+		case len(args) == 1:
+			rating, ok := conv.Metadata[conversation.RatingKey]
+			if !ok {
+				fmt.Println("Not rated")
+				return nil
+			}
+			if note := conv.Metadata[conversation.RatingNoteKey]; note != "" {
+				fmt.Printf("%s: %s\n", rating, note)
+			} else {
+				fmt.Println(rating)
+			}
+			return nil
+		default:
+			rating, err := conversation.ParseRating(args[1])
+			if err != nil {
+				return err
+			}
+			conversation.Rate(&conv, rating, rateNote)
+		}
+		return conversation.SaveConversation(conv, logger)
+	},
+}
+
+var personaCmd = &cobra.Command{
+	Use:   "persona",
+	Short: "Manage personas, named system prompts",
+	Long: `A persona is a named system prompt kept in the share directory. With
+--persona on new, append, chat and the other message commands, its system
+prompt is sent before the one of --system-file, and the persona is recorded
+with the conversation so that follow-ups keep using it. Answers rated up
+under a persona also become its few-shot examples (see asc examples).
+
+Without a subcommand, the personas are listed.`,
+	Example: `  asc persona add reviewer "You are a strict code reviewer. Point out bugs first."
+  asc persona edit reviewer
+  asc new --persona reviewer "Review this function" -f main.go`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		names, err := conversation.ListPersonas()
+		if err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			fmt.Println("No personas, add one with asc persona add")
+			return nil
+		}
+		for _, name := range names {
+			prompt, err := conversation.PersonaPrompt(name)
+			if err != nil {
+				return err
+			}
+			examples, err := conversation.LoadExamples(name)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%-20s %3d example(s)  %s\n", name, len(examples), truncateString(strings.TrimSpace(strings.SplitN(prompt, "\n", 2)[0]), 60))
+		}
+		return nil
+	},
+}
+
+var personaAddCmd = &cobra.Command{
+	Use:   "add <name> [prompt]",
+	Short: "Create a persona",
+	Long: `Create a persona with the given system prompt. Without a prompt, text
+piped to stdin is used, or the editor is opened.`,
+	Args:         cobra.RangeArgs(1, 2),
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		existing, err := conversation.PersonaPrompt(name)
+		if err != nil {
+			return err
+		}
+		if existing != "" && !personaForce {
+			return fmt.Errorf("persona %s exists, use asc persona edit or --force", name)
+		}
+		var prompt string
+		switch {
+		case len(args) == 2:
+			prompt = args[1]
+		case !term.IsTerminal(int(os.Stdin.Fd())):
+			if prompt, err = conversation.ReadInputFile("-"); err != nil {
+				return err
+			}
+		default:
+			if prompt, err = editContext(existing); err != nil {
+				return err
+			}
+		}
+		if strings.TrimSpace(prompt) == "" {
+			return fmt.Errorf("the system prompt is empty")
+		}
+		path, err := conversation.SavePersona(name, prompt)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Saved persona %s in %s\n", name, path)
+		return nil
+	},
+}
+
+var personaEditCmd = &cobra.Command{
+	Use:          "edit <name>",
+	Short:        "Edit the system prompt of a persona, creating it if needed",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		prompt, err := conversation.PersonaPrompt(args[0])
+		if err != nil {
+			return err
+		}
+		edited, err := editContext(prompt)
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(edited) == "" {
+			return fmt.Errorf("the system prompt is empty, use asc persona remove to delete the persona")
+		}
+		if strings.TrimSpace(edited) == prompt {
+			fmt.Println("No changes")
+			return nil
+		}
+		path, err := conversation.SavePersona(args[0], edited)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Saved persona %s in %s\n", args[0], path)
+		return nil
+	},
+}
+
+var personaShowCmd = &cobra.Command{
+	Use:          "show <name>",
+	Short:        "Print the system prompt of a persona",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		prompt, err := conversation.PersonaPrompt(args[0])
+		if err != nil {
+			return err
+		}
+		if prompt == "" {
+			return fmt.Errorf("persona %s does not exist", args[0])
+		}
+		fmt.Println(prompt)
+		return nil
+	},
+}
+
+var personaRemoveCmd = &cobra.Command{
+	Use:     "remove <name>",
+	Aliases: []string{"rm"},
+	Short:   "Remove a persona",
+	Long: `Remove the system prompt of a persona. Its few-shot examples and the
+conversations held as it are kept.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := conversation.DeletePersona(args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("Removed persona %s\n", args[0])
+		return nil
+	},
+}
+
+var templateCmd = &cobra.Command{
+	Use:   "template",
+	Short: "Manage prompt templates with placeholders",
+	Long: `A prompt template is a message kept in the share directory, with
+{{name}} placeholders filled in when it is used:
+
+  asc template add code-review "Review {{file}} for {{focus}}. Point out bugs first."
+  asc new --template code-review --var file=main.go --var focus=concurrency -f main.go
+
+--template works with new, append and prompt; a message given as well is
+added after the template.`,
+}
+
+var templateAddCmd = &cobra.Command{
+	Use:   "add <name> [text]",
+	Short: "Create a prompt template",
+	Long: `Create a prompt template with the given text. Without text, text piped
+to stdin is used, or the editor is opened.`,
+	Args:         cobra.RangeArgs(1, 2),
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		exists, err := conversation.TemplateExists(name)
+		if err != nil {
+			return err
+		}
+		if exists && !templateForce {
+			return fmt.Errorf("template %s exists, use asc template edit or --force", name)
+		}
+		var text string
+		switch {
+		case len(args) == 2:
+			text = args[1]
+		case !term.IsTerminal(int(os.Stdin.Fd())):
+			if text, err = conversation.ReadInputFile("-"); err != nil {
+				return err
+			}
+		default:
+			if text, err = editContext(""); err != nil {
+				return err
+			}
+		}
+		if strings.TrimSpace(text) == "" {
+			return fmt.Errorf("the template is empty")
+		}
+		path, err := conversation.SaveTemplate(name, text)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Saved template %s in %s\n", name, path)
+		return nil
+	},
+}
+
+var templateFromCmd = &cobra.Command{
+	Use:   "from <id> <name>",
+	Short: "Create a prompt template from the message of a conversation",
+	Long: `Create a prompt template from the first message of a conversation, or
+of the turn given with --turn, without its attachments. File names, paths, URLs and short quoted
+values are replaced with placeholders such as {{file}} and {{url}}, and
+the values they replaced are listed; --literal keeps the message as is.
+With --edit, the template is opened in the editor before it is saved.`,
+	Example: `  asc template from 20250701120000 code-review
+  asc template use code-review --var file=main.go`,
+	Args:         cobra.ExactArgs(2),
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return completeConversationIDs(cmd, args, toComplete)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[1]
+		exists, err := conversation.TemplateExists(name)
+		if err != nil {
+			return err
+		}
+		if exists && !templateForce {
+			return fmt.Errorf("template %s exists, use asc template edit or --force", name)
+		}
+		conv, err := conversation.LoadConversation(args[0], logger)
+		if err != nil {
+			return err
+		}
+		exchanges := conv.Exchanges()
+		if templateTurn < 1 || templateTurn > len(exchanges) {
+			return fmt.Errorf("turn %d does not exist (conversation %s has %d turns)", templateTurn, conv.ID, len(exchanges))
+		}
+		text := conversation.WithoutAttachments(exchanges[templateTurn-1].Message)
+		var suggestions []conversation.Suggestion
+		if !templateLiteral {
+			text, suggestions = conversation.Templatize(text)
+		}
+		if templateEdit {
+			if text, err = editContext(text); err != nil {
+				return err
+			}
+		}
+		if strings.TrimSpace(text) == "" {
+			return fmt.Errorf("the template is empty")
+		}
+		path, err := conversation.SaveTemplate(name, text)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Saved template %s in %s\n", name, path)
+
+		// Show how to use it with the values of the conversation
+		usage := "asc template use " + name
+		placeholders := conversation.Placeholders(text)
+		for _, placeholder := range placeholders {
+			value := "..."
+			for _, suggestion := range suggestions {
+				if suggestion.Name == placeholder {
+					value = suggestion.Value
+					fmt.Printf("  {{%s}} replaced %s\n", suggestion.Name, suggestion.Value)
+				}
+			}
+			usage += " --var " + shellQuote(placeholder+"="+value)
+		}
+		for _, attachment := range conversation.ListAttachments(conv) {
+			if attachment.Turn == templateTurn && attachment.Path != "" {
+				usage += " -f " + shellQuote(attachment.Path)
+			}
+		}
+		if len(placeholders) > 0 {
+			fmt.Printf("Use it with: %s\n", usage)
+		}
+		return nil
+	},
+}
+
+var templateEditCmd = &cobra.Command{
+	Use:          "edit <name>",
+	Short:        "Edit a prompt template",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		text, err := conversation.LoadTemplate(args[0])
+		if err != nil {
+			return err
+		}
+		edited, err := editContext(text)
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(edited) == "" {
+			return fmt.Errorf("the template is empty, use asc template remove to delete it")
+		}
+		if strings.TrimSpace(edited) == text {
+			fmt.Println("No changes")
+			return nil
+		}
+		path, err := conversation.SaveTemplate(args[0], edited)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Saved template %s in %s\n", args[0], path)
+		return nil
+	},
+}
+
+var templateListCmd = &cobra.Command{
+	Use:          "list",
+	Aliases:      []string{"ls"},
+	Short:        "List the prompt templates and their placeholders",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		names, err := conversation.ListTemplates()
+		if err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			fmt.Println("No templates, add one with asc template add")
+			return nil
+		}
+		for _, name := range names {
+			text, err := conversation.LoadTemplate(name)
+			if err != nil {
+				return err
+			}
+			placeholders := conversation.Placeholders(text)
+			for i, placeholder := range placeholders {
+				placeholders[i] = "{{" + placeholder + "}}"
+			}
+			fmt.Printf("%-20s %s\n", name, strings.Join(placeholders, " "))
+		}
+		return nil
+	},
+}
+
+var templateShowCmd = &cobra.Command{
+	Use:          "show <name>",
+	Short:        "Print a prompt template",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		text, err := conversation.LoadTemplate(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Println(text)
+		return nil
+	},
+}
+
+var templateUseCmd = &cobra.Command{
+	Use:   "use <name> [message]",
+	Short: "Start a new conversation from a prompt template",
+	Long: `Start a new conversation with the template filled in with the values
+of --var, like asc new --template. A message given as well is added after
+the template, and text piped to stdin is attached.`,
+	Example: `  asc template use code-review --var file=main.go --var focus=errors`,
+	Args:    cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		templateName = args[0]
+		message := ""
+		if len(args) > 1 {
+			message = args[1]
+		}
+		message, err := templateMessage(message)
+		if err != nil {
+			return err
+		}
+		if message, err = withPipedInput(message); err != nil {
+			return err
+		}
+		logger.Debug("Starting new conversation from template", "template", templateName, "message", message)
+		return conversation.StartNewConversation(message, messageOptions(), logger)
+	},
+}
+
+var templateRemoveCmd = &cobra.Command{
+	Use:          "remove <name>",
+	Aliases:      []string{"rm"},
+	Short:        "Remove a prompt template",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := conversation.DeleteTemplate(args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("Removed template %s\n", args[0])
+		return nil
+	},
+}
+
+var examplesCmd = &cobra.Command{
+	Use:   "examples",
+	Short: "Manage the few-shot examples built from rated answers",
+	Long: `Answers rated up with 'asc rate' can be shown to the model as examples of
+what you consider a good answer. 'asc examples build' collects them per
+persona (the --persona a conversation was held as, or "default"), and
+--examples k of new, append, chat and the other message commands adds the
+k examples closest to the question to the system prompt:
+
+  asc rate 20250701120000 up
+  asc examples build
+  asc new --persona reviewer --examples 3 "Review this function" -f main.go
+
+Set a default with [command.new] examples = 3 in the config file. Build
+again after rating more answers.`,
+}
+
+var examplesBuildCmd = &cobra.Command{
+	Use:          "build",
+	Short:        "Collect the answers rated up into example banks",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		conversations, err := conversation.LoadConversations(logger)
+		if err != nil {
+			return fmt.Errorf("failed to load conversations: %w", err)
+		}
+		personas := []string{personaName}
+		if personaName == "" {
+			seen := map[string]bool{}
+			personas = nil
+			for _, conv := range conversations {
+				if persona := conversation.PersonaOf(conv.Metadata); !seen[persona] {
+					seen[persona] = true
+					personas = append(personas, persona)
+				}
+			}
+			sort.Strings(personas)
+		}
+		for _, persona := range personas {
+			if err := conversation.CheckPersonaName(persona); err != nil {
+				logger.Warn("Skipping persona", "error", err)
+				continue
+			}
+			examples := conversation.BuildExamples(conversations, persona)
+			if len(examples) == 0 && personaName == "" {
+				continue
+			}
+			path, err := conversation.SaveExamples(persona, examples)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s: %d example(s) in %s\n", persona, len(examples), path)
+		}
+		return nil
+	},
+}
+
+var examplesListCmd = &cobra.Command{
+	Use:          "list",
+	Short:        "List the examples of the personas",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		persona := personaName
+		if persona == "" {
+			persona = conversation.DefaultPersona
+		}
+		if err := conversation.CheckPersonaName(persona); err != nil {
+			return err
+		}
+		examples, err := conversation.LoadExamples(persona)
+		if err != nil {
+			return err
+		}
+		if len(examples) == 0 {
+			fmt.Printf("No examples for %s, rate answers with asc rate and run asc examples build\n", persona)
+			return nil
+		}
+		for _, example := range examples {
+			fmt.Printf("%s  %s\n", example.ID, truncateString(strings.Join(strings.Fields(example.Question), " "), 70))
+		}
+		return nil
+	},
+}
+
+var tagCmd = &cobra.Command{
+	Use:   "tag",
+	Short: "Tag conversations",
+	Long: `Tags group conversations, e.g. by project:
+
+  asc tag add 20250701120000 work k8s
+  asc tag list
+  asc view --tag work
+
+Tags are shown in exports and 'asc show', and can also be edited with 't'
+in asc view.`,
+}
+
+var tagAddCmd = &cobra.Command{
+	Use:          "add <id> <tag>...",
+	Short:        "Add tags to a conversation",
+	Args:         cobra.MinimumNArgs(2),
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tags, err := conversation.ParseTags(args[1:])
+		if err != nil {
+			return err
+		}
+		conv, err := conversation.LoadConversation(args[0], logger)
+		if err != nil {
+			return err
+		}
+		conversation.AddTags(&conv, tags)
+		return conversation.SaveConversation(conv, logger)
+	},
+}
+
+var tagRemoveCmd = &cobra.Command{
+	Use:          "remove <id> <tag>...",
+	Aliases:      []string{"rm"},
+	Short:        "Remove tags from a conversation",
+	Args:         cobra.MinimumNArgs(2),
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tags, err := conversation.ParseTags(args[1:])
+		if err != nil {
+			return err
+		}
+		conv, err := conversation.LoadConversation(args[0], logger)
+		if err != nil {
+			return err
+		}
+		removeErr := conversation.RemoveTags(&conv, tags)
+		if err := conversation.SaveConversation(conv, logger); err != nil {
+			return err
+		}
+		return removeErr
+	},
+}
+
+var tagListCmd = &cobra.Command{
+	Use:          "list [id]",
+	Short:        "List the tags of a conversation, or all tags with their counts",
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 1 {
+			conv, err := conversation.LoadConversation(args[0], logger)
+			if err != nil {
+				return err
+			}
+			for _, tag := range conv.Tags {
+				fmt.Println(tag)
+			}
+			return nil
+		}
+		entries, err := conversation.LoadEntries(logger)
+		if err != nil {
+			return fmt.Errorf("failed to load conversations: %w", err)
+		}
+		counts := conversation.CountTags(entries)
+		tags := make([]string, 0, len(counts))
+		for tag := range counts {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		for _, tag := range tags {
+			fmt.Printf("%s\t%d\n", tag, counts[tag])
+		}
+		return nil
+	},
+}
+
+var tailCmd = &cobra.Command{
+	Use:   "tail --fifo <path>",
+	Short: "Answer prompts written to a FIFO",
+	Long: `Keep running and read prompts from a FIFO, one per line (or separated by
+NUL bytes with --null). Each answer is printed and appended to the same
+conversation, so other processes can talk to asc without starting it each
+time:
+
+  asc tail --fifo /tmp/asc.in &
+  echo "What does EADDRINUSE mean?" > /tmp/asc.in`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var conv conversation.Conversation
+		if chatID != "" {
+			var err error
+			if conv, err = conversation.LoadConversation(chatID, logger); err != nil {
+				return err
+			}
+		}
+		return feed.Tail(fifoPath, nullSeparated, func(prompt string) error {
+			recordPrompt(prompt)
+			return conversation.SendTurn(&conv, prompt, continueOptions(cmd, conv), logger)
+		}, logger)
+	},
+}
+
+var warmCmd = &cobra.Command{
+	Use:   "warm",
+	Short: "Load a local model ahead of use",
+	Long: `Load the model of a provider that runs models locally, such as ollama,
+so that the first question of a session does not wait for it to load.
+
+The server keeps the model loaded for keep_alive in the [ollama] section of
+the config file (e.g. "30m", or -1 for as long as the server runs). With
+--every, asc keeps running and loads the model again at that interval,
+which keeps it warm with any keep_alive:
+
+  asc warm --provider ollama -m llama3 --every 4m &
+
+asc chat also loads the model in the background when it starts.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		opts := messageOptions()
+		for {
+			start := time.Now()
+			name, model, err := conversation.Warm(ctx, opts)
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Loaded %s (%s) in %s\n", model, name, time.Since(start).Round(time.Millisecond))
+			if warmEvery <= 0 {
+				return nil
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(warmEvery):
+			}
+		}
+	},
+}
+
+var chatCmd = &cobra.Command{
+	Use:   "chat",
+	Short: "Chat with AI interactively",
+	Long: `Start an interactive chat. Each message is sent with the earlier turns
+of the chat as history, and the whole chat is saved as one conversation.
+
+The chat runs full screen: answers stream into the thread above a message
+box and are rendered as they arrive. Enter sends, Alt-Enter or
+Ctrl-J starts a new line, Esc stops an answer and Ctrl-D quits.
+
+With --line, or when not on a terminal, it reads one line at a time
+instead. Tab then completes commands and earlier prompts shown as ghost
+text, and Up/Down recall earlier prompts.
+
+Messages starting with / are commands, e.g. /attach <file> or /retry; type
+/help for the list. Files given with --file are attached to the first
+message.
+
+Local models, e.g. of ollama, are loaded in the background while the first
+message is typed (see asc warm).`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var conv conversation.Conversation
+		if chatID != "" {
+			var err error
+			if conv, err = conversation.LoadConversation(chatID, logger); err != nil {
+				return err
+			}
+		}
+		opts := continueOptions(cmd, conv)
+		go func() {
+			if _, _, err := conversation.Warm(context.Background(), opts); err != nil {
+				logger.Debug("Not warming up the model", "error", err)
+			}
+		}()
+		if chatLine || accessible || !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+			return chat.Run(conv, opts, logger)
+		}
+		return chat.RunTUI(conv, opts, logger)
+	},
+}
+
+var doCmd = &cobra.Command{
+	Use:   "do [task]",
+	Short: "Ask AI for a shell command and run it",
+	Long: `Ask AI for a shell command that performs the task, show it and run it
+after confirmation.
+
+The exit code and output of the command are saved in the conversation as a
+tool-result turn, so a follow-up such as
+
+  asc do --id <id> "it failed, fix it"
+
+is sent with the command and its output as history.
+
+The [sandbox] section of the config file can restrict the programs the
+command may run, make paths read-only and cut the network; commands it
+does not allow are not run.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var conv conversation.Conversation
+		if chatID != "" {
+			var err error
+			if conv, err = conversation.LoadConversation(chatID, logger); err != nil {
+				return err
+			}
+		}
+		recordPrompt(args[0])
+		if err := conversation.Do(&conv, args[0], continueOptions(cmd, conv), doYes, logger); err != nil {
+			return err
+		}
+		if conv.ID != "" {
+			fmt.Fprintf(os.Stderr, "Conversation %s\n", conv.ID)
+		}
+		return nil
+	},
+}
+
+type model struct {
+	table         table.Model
+	conversations []conversation.Conversation
+}
+
+func initialModel() model {
+	columns := []table.Column{
+		{Title: "ID", Width: 15},
+		{Title: "Date", Width: 20},
+		{Title: "Message", Width: 50},
+	}
+
+	t := table.New(
+		table.WithColumns(columns),
+		table.WithFocused(true),
+		table.WithHeight(10),
+	)
+
+	s := table.DefaultStyles()
+	s.Header = s.Header.
+		BorderStyle(lipgloss.NormalBorder()).
+		BorderForeground(lipgloss.Color("240"))
+	s.Selected = s.Selected.
+		Foreground(lipgloss.Color("229")).
+		Background(lipgloss.Color("57")).
+		Bold(false)
+	t.SetStyles(s)
+
+	return model{
+		table: t,
+	}
+}
+
+func (m model) Init() tea.Cmd {
+	return nil
+}
+
+func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "esc", "q":
+			return m, tea.Quit
+		case "enter", "v":
+			if len(m.conversations) > 0 {
+				selected := m.conversations[m.table.Cursor()]
+				if err := conversation.ShowConversation(selected, logger); err != nil {
+					logger.Error("Failed to show conversation", "error", err)
+				}
+			}
+			return m, nil
+		}
+	}
+	m.table, cmd = m.table.Update(msg)
+	return m, cmd
+}
+
+func (m model) View() string {
+	return m.table.View()
+}
+
+var viewCmd = &cobra.Command{
+	Use:     "view",
+	Aliases: []string{"v", "V"},
+	Short:   "View conversation history",
+	Long: `Display the history of your conversations with AI.
+Shows a list of all conversations with their IDs, timestamps, and previews.
+You can use these IDs with other commands like 'append' and 'edit'.
+
+With --id, the list opens with that conversation selected and shows it
+right away; quitting the pager returns to the list.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		filter, err := conversation.NewTimeFilter(since, until)
+		if err != nil {
+			logger.Error("Invalid time range", "error", err)
+			os.Exit(1)
+		}
+		if filter.Metadata, err = conversation.ParseMetadataFilter(metaFilters); err != nil {
+			logger.Error("Invalid metadata filter", "error", err)
+			os.Exit(1)
+		}
+		if filter.Tags, err = conversation.ParseTags(tagFilters); err != nil {
+			logger.Error("Invalid tag filter", "error", err)
+			os.Exit(1)
+		}
+		if accessible {
+			err = view.PrintList(os.Stdout, filter, viewUnread, viewArchived, logger)
+			if viewID != "" && err == nil {
+				var conv conversation.Conversation
+				if conv, err = conversation.LoadConversation(viewID, logger); err == nil {
+					fmt.Print("\n" + conversation.FormatPlain(conv))
+					err = conversation.MarkRead(&conv, logger)
+				}
+			}
+			if err != nil {
+				logger.Error("Failed to list conversations", "error", err)
+				os.Exit(1)
+			}
+			return
+		}
+		if err := view.StartView(filter, viewUnread, viewArchived, viewHeight, viewID, logger); err != nil {
+			logger.Error("Failed to start view", "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var searchCmd = &cobra.Command{
+	Use:     "search <query>",
+	Aliases: []string{"grep"},
+	Short:   "Search messages and answers of saved conversations",
+	Long: `Search the messages and answers of all saved conversations and print the
+matching ones, newest first, with the matches highlighted. Every word of the
+query must occur in a conversation, ignoring case; use double quotes to
+search for a phrase.
+
+With --interactive, the matching conversations are listed in asc view
+instead.
+
+With --replay, the matches are numbered and the prompt of the one you pick
+(the message of the first turn that matched) is sent again as a new
+conversation, to the default model rather than the one that answered it.
+You can edit the prompt before it is sent.`,
+	Example: `  asc search docker compose
+  asc search '"connection refused"' --since 30d
+  asc search -i rust lifetimes
+  asc grep --replay nginx rewrite`,
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filter, err := conversation.NewTimeFilter(since, until)
+		if err != nil {
+			return err
+		}
+		if filter.Metadata, err = conversation.ParseMetadataFilter(metaFilters); err != nil {
+			return err
+		}
+		if filter.Tags, err = conversation.ParseTags(tagFilters); err != nil {
+			return err
+		}
+		query := strings.Join(args, " ")
+		results, err := conversation.Search(query, filter, logger)
+		if err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			fmt.Printf("No conversations match %s\n", query)
+			return nil
+		}
+
+		if searchInteractive && !accessible {
+			filter.IDs = make(map[string]bool, len(results))
+			for _, result := range results {
+				filter.IDs[result.Entry.ID] = true
+			}
+			return view.StartView(filter, false, false, viewHeight, "", logger)
+		}
+
+		colors := config.Colors()
+		highlight := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color(colors.Accent))
+		muted := lipgloss.NewStyle().Foreground(lipgloss.Color(colors.Muted))
+		for i, result := range results {
+			if i > 0 {
+				fmt.Println()
+			}
+			heading := result.Entry.Title
+			if heading == "" {
+				heading = strings.Join(strings.Fields(result.Entry.Message), " ")
+			}
+			if searchReplay {
+				fmt.Printf("[%d] ", i+1)
+			}
+			fmt.Printf("%s  %s  %s\n", result.Entry.ID, muted.Render(timeutil.Format(result.Entry.Timestamp)), truncateString(heading, 60))
+			for _, snippet := range result.Snippets {
+				fmt.Printf("    %s %s\n", muted.Render(snippet.Role+":"), highlightSpans(snippet.Text, snippet.Spans, highlight))
+			}
+			if more := result.Hits - len(result.Snippets); more > 0 {
+				fmt.Println(muted.Render(fmt.Sprintf("    (%d more)", more)))
+			}
+		}
+		if searchReplay {
+			return replayResult(results)
+		}
+		return nil
+	},
+}
+
+// replayResult asks which of results to replay, and whether to edit its
+// prompt first, then sends the prompt as a new conversation. Without a
+// terminal, the only result is sent as it is.
+func replayResult(results []conversation.SearchResult) error {
+	interactive := term.IsTerminal(int(os.Stdin.Fd()))
+	if len(results) > 1 && !interactive {
+		return fmt.Errorf("%d conversations match, narrow the query to replay one", len(results))
+	}
+	reader := bufio.NewReader(os.Stdin)
+	result := results[0]
+	if len(results) > 1 {
+		fmt.Fprintf(os.Stderr, "\nReplay which? [1-%d] ", len(results))
+		answer, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read answer: %w", err)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(answer))
+		if err != nil || n < 1 || n > len(results) {
+			return fmt.Errorf("aborted")
+		}
+		result = results[n-1]
+	}
+
+	prompt := result.Prompt
+	if interactive {
+		fmt.Fprintf(os.Stderr, "\n%s\n\n[S]end, [e]dit first, [a]bort? ", truncateString(strings.TrimSpace(prompt), 300))
+		answer, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read answer: %w", err)
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "", "s":
+		case "e":
+			if prompt, err = editContext(prompt); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("aborted")
+		}
+	}
+	if strings.TrimSpace(prompt) == "" {
+		return fmt.Errorf("the prompt is empty")
+	}
+	logger.Info("Replaying prompt", "id", result.Entry.ID, "turn", result.Turn)
+	return conversation.StartNewConversation(prompt, messageOptions(), logger)
+}
+
+// highlightSpans renders the byte ranges spans of text with style.
+func highlightSpans(text string, spans [][2]int, style lipgloss.Style) string {
+	var b strings.Builder
+	last := 0
+	for _, span := range spans {
+		b.WriteString(text[last:span[0]])
+		b.WriteString(style.Render(text[span[0]:span[1]]))
+		last = span[1]
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export <id>",
+	Short: "Export a conversation to a Markdown or HTML file",
+	Long: `Write a conversation as standalone Markdown, with its context, messages,
+answers and citations, to stdout or to the file given with -o.
+
+With --format html (or an -o file ending in .html), the conversation is
+written as a self-contained HTML page with highlighted code blocks, which
+can be shared with people who do not use a terminal. --format json (or a
+file ending in .json) writes the conversation as stored.
+
+With --since or --until instead of an ID, every conversation started in
+that range is written to the directory given with -o, as <id>.md (or .html
+or .json for those formats).
+
+Private conversations are only exported with --force.`,
+	Example: `  asc export 20250701120000 -o docker-networking.md
+  asc export 20250701120000 -o docker-networking.html
+  asc export 20250701120000 --format html > answer.html
+  asc export 20250701120000 | pandoc -o answer.pdf
+  asc export --since 2025-07-01 --until 2025-07-31 -o july/`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filter, err := conversation.NewTimeFilter(since, until)
+		if err != nil {
+			return err
+		}
+		if len(args) == 1 && filter.HasTime() {
+			return fmt.Errorf("give either a conversation ID or --since/--until, not both")
+		}
+		if len(args) == 0 {
+			if !filter.HasTime() {
+				return fmt.Errorf("give a conversation ID, or --since/--until to export a range")
+			}
+			return exportRange(filter)
+		}
+		conv, err := conversation.LoadConversation(args[0], logger)
+		if err != nil {
+			return err
+		}
+		if err := conversation.CheckShareable(conv); err != nil && !forceExport {
+			return fmt.Errorf("%w; use --force to export it anyway", err)
+		}
+		format := ""
+		if exportFormat != "" {
+			if format, err = conversation.ParseTranscriptFormat(exportFormat); err != nil {
+				return err
+			}
+		}
+		if exportOutput == "" || exportOutput == "-" {
+			if format == "" {
+				format = conversation.TranscriptMarkdown
+			}
+			data, err := conversation.Transcript(conv, format)
+			if err != nil {
+				return err
+			}
+			_, err = os.Stdout.Write(data)
+			return err
+		}
+		if format == "" {
+			format = conversation.TranscriptFormat(exportOutput)
+		}
+		if err := conversation.WriteTranscript(conv, exportOutput, format); err != nil {
+			return err
+		}
+		fmt.Printf("Exported %s to %s (%s)\n", conv.ID, exportOutput, format)
+		return nil
+	},
+}
+
+// exportRange writes the conversations matching filter to the directory
+// given with --output, one file per conversation.
+func exportRange(filter conversation.Filter) error {
+	if exportOutput == "" || exportOutput == "-" {
+		return fmt.Errorf("exporting a range needs a directory, give it with -o")
+	}
+	format := conversation.TranscriptMarkdown
+	if exportFormat != "" {
+		var err error
+		if format, err = conversation.ParseTranscriptFormat(exportFormat); err != nil {
+			return err
+		}
+	}
+	entries, err := conversation.LoadEntries(logger)
+	if err != nil {
+		return fmt.Errorf("failed to load conversations: %w", err)
+	}
+	exported, private := 0, 0
+	for _, entry := range filter.ApplyEntries(entries) {
+		conv, err := conversation.LoadConversation(entry.ID, logger)
+		if err != nil {
+			return err
+		}
+		if conversation.CheckShareable(conv) != nil && !forceExport {
+			private++
+			continue
+		}
+		path := filepath.Join(exportOutput, conv.ID+conversation.TranscriptExtension(format))
+		if err := conversation.WriteTranscript(conv, path, format); err != nil {
+			return err
+		}
+		exported++
+	}
+	fmt.Printf("Exported %d conversation(s) to %s (%s)\n", exported, exportOutput, format)
+	if private > 0 {
+		fmt.Printf("Skipped %d private conversation(s), use --force to export them too\n", private)
+	}
+	return nil
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import <file|dir>",
+	Short: "Import conversations from ChatGPT or sgpt",
+	Long: `Convert the history of other tools into asc conversations:
+
+  - ChatGPT data exports: the zip archive from Settings > Data controls >
+    Export data, or the conversations.json in it
+  - sgpt chats: a file of ~/.config/shell_gpt/chat_cache, or the whole
+    directory
+
+Conversations get IDs and timestamps from their original creation time;
+sgpt chats, which do not record times, use the modification time of the
+file. Importing the same export again skips the conversations imported
+before. Use 'asc bundle import' for bundles written by asc.`,
+	Example: `  asc import ~/Downloads/chatgpt-export.zip
+  asc import ~/.config/shell_gpt/chat_cache`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		stats, err := importer.Import(args[0], logger)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Imported %d conversation(s) from the %s history\n", stats.Conversations, stats.Format)
+		if len(stats.Skipped) > 0 {
+			fmt.Printf("Skipped %d conversation(s) imported before\n", len(stats.Skipped))
+		}
+		if stats.Empty > 0 {
+			fmt.Printf("Skipped %d conversation(s) without messages\n", stats.Empty)
+		}
+		return nil
+	},
+}
+
+var changedCmd = &cobra.Command{
+	Use:   "changed",
+	Short: "List conversations changed since a time or checkpoint",
+	Long: `List the conversations added (A), modified (M) or deleted (D) since a
+point of reference, one per line as "<status><TAB><id>", so that sync and
+export scripts only process what changed.
+
+Every conversation keeps a checksum of its content, updated when it is
+saved; viewing a conversation does not change it. --since takes a time, or
+the name of a checkpoint recorded earlier with --save. Only checkpoints
+report deleted conversations. Without --since, every conversation is listed
+as added.`,
+	Example: `  asc changed --save backup                 # record the first checkpoint
+  asc changed --since backup --save backup  # list changes and move it
+  asc changed --since 1d`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		entries, err := conversation.LoadEntries(logger)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to load conversations: %w", err)
+		}
+		var changes []conversation.Change
+		var current conversation.Checkpoint
+		if t, err := timeutil.Parse(since, time.Now()); since != "" && err == nil {
+			if changes, err = conversation.ChangedSince(entries, t, logger); err != nil {
+				return err
+			}
+		} else {
+			var checkpoint conversation.Checkpoint
+			if since != "" {
+				if checkpoint, err = conversation.LoadCheckpoint(since); err != nil {
+					if os.IsNotExist(err) {
+						return fmt.Errorf("%q is neither a time nor a checkpoint saved with --save", since)
+					}
+					return fmt.Errorf("failed to load checkpoint: %w", err)
+				}
+			}
+			if changes, current, err = conversation.ChangedFrom(entries, checkpoint, logger); err != nil {
+				return err
+			}
+		}
+		printChanges(changes)
+
+		if checkpointName != "" {
+			if current.Checksums == nil {
+				if _, current, err = conversation.ChangedFrom(entries, conversation.Checkpoint{}, logger); err != nil {
+					return err
+				}
+			}
+			if err := conversation.SaveCheckpoint(checkpointName, current); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Saved checkpoint %s (%d conversations)\n", checkpointName, len(current.Checksums))
+		}
+		return nil
+	},
+}
+
+// printChanges lists changes as "<status><TAB><id>" lines.
+func printChanges(changes []conversation.Change) {
+	for _, change := range changes {
+		fmt.Printf("%s\t%s\n", change.Status, change.ID)
+	}
+}
+
+var showCmd = &cobra.Command{
+	Use:   "show <id>",
+	Short: "Show a single conversation",
+	Long: `Display a saved conversation by its ID.
+
+With --meta, prints the response metadata recorded from the provider
+(provider, model, finish reason, token usage, request ID) instead, which
+helps to debug truncated or refused answers.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		conv, err := conversation.LoadConversation(args[0], logger)
+		if err != nil {
+			return err
+		}
+
+		if !showMeta {
+			if accessible {
+				fmt.Print(conversation.FormatPlain(conv))
+				return conversation.MarkRead(&conv, logger)
+			}
+			if err := conversation.ShowConversation(conv, logger); err != nil {
+				return err
+			}
+			return conversation.MarkRead(&conv, logger)
+		}
+
+		fmt.Printf("ID:            %s\n", conv.ID)
+		fmt.Printf("Date:          %s\n", timeutil.Format(conv.Timestamp))
+		if conv.Meta == nil {
+			fmt.Println("No response metadata recorded")
+			return nil
+		}
+		meta := conv.Meta
+		fmt.Printf("Provider:      %s\n", meta.Provider)
+		fmt.Printf("Model:         %s\n", valueOrUnknown(meta.Model))
+		fmt.Printf("Finish reason: %s\n", valueOrUnknown(meta.FinishReason))
+		fmt.Printf("Request ID:    %s\n", valueOrUnknown(meta.RequestID))
+		if meta.DurationMS > 0 {
+			fmt.Printf("Latency:       %dms to first token, %dms total\n", meta.FirstTokenMS, meta.DurationMS)
+		}
+		if meta.Usage != nil {
+			estimated := ""
+			if meta.Usage.Estimated {
+				estimated = " (estimated)"
+			}
+			fmt.Printf("Usage:         %d prompt + %d completion = %d tokens%s\n",
+				meta.Usage.PromptTokens, meta.Usage.CompletionTokens, meta.Usage.TotalTokens, estimated)
+			if meta.Cost != nil {
+				fmt.Printf("Cost:          %s\n", formatCost(*meta.Cost))
+			}
+		} else {
+			fmt.Printf("Usage:         %s\n", valueOrUnknown(""))
+		}
+		if meta.Error != "" {
+			fmt.Printf("Error:         %s\n", meta.Error)
+		}
+		for i, retry := range meta.Retries {
+			fmt.Printf("Retry %d:       %s from %s, %s\n", i+1, retry.Reason, retry.Provider, retry.Action)
+		}
+		if meta.Route != "" {
+			fmt.Printf("Route:         %s\n", meta.Route)
+		}
+		if meta.Continuations > 0 {
+			fmt.Printf("Continued:     %d time(s) after being cut off\n", meta.Continuations)
+		}
+		if meta.Cached {
+			fmt.Println("Cached:        answered from the cache of --cache")
+		}
+		return nil
+	},
+}
+
+var mergeCmd = &cobra.Command{
+	Use:   "merge-conv <id> <id>...",
+	Short: "Merge conversations into a single thread",
+	Long: `Concatenate two or more conversations into a new conversation.
+The turns are ordered by timestamp and marked with the ID of the
+conversation they came from. The original conversations are kept.`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		merged, err := conversation.MergeConversations(args, logger)
+		if err != nil {
+			return fmt.Errorf("failed to merge conversations: %w", err)
+		}
+		saved, err := conversation.SaveNewConversation(merged, logger)
+		if err != nil {
+			return fmt.Errorf("failed to save merged conversation: %w", err)
+		}
+		fmt.Printf("Merged %d conversations into %s\n", len(args), saved.ID)
+		return nil
+	},
+}
+
+var forkCmd = &cobra.Command{
+	Use:   "fork <id>",
+	Short: "Copy a conversation as a new thread",
+	Long: `Copy a conversation as a new conversation to explore another follow-up
+in, while the original line of discussion is kept. With --turn, only the
+thread up to that turn is copied, to take another direction from there.
+
+Continue the copy with 'asc chat --id <new id>'. In 'asc view', f forks
+the selected conversation.`,
+	Args:         cobra.ExactArgs(1),
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	SilenceUsage: true,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return completeConversationIDs(cmd, args, toComplete)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		conv, err := conversation.LoadConversation(args[0], logger)
+		if err != nil {
+			return err
+		}
+		fork, err := conversation.Fork(conv, forkTurn)
+		if err != nil {
+			return err
+		}
+		saved, err := conversation.SaveNewConversation(fork, logger)
+		if err != nil {
+			return fmt.Errorf("failed to save fork: %w", err)
+		}
+		fmt.Printf("Forked %s as %s\n", conv.ID, saved.ID)
+		if term.IsTerminal(int(os.Stdout.Fd())) {
+			fmt.Printf("Continue it with: asc chat --id %s\n", saved.ID)
+		}
+		return nil
+	},
+}
+
+var deleteCmd = &cobra.Command{
+	Use:     "delete <id>...",
+	Aliases: []string{"rm"},
+	Short:   "Delete conversations",
+	Long: `Delete conversations by ID, as the d key of 'asc view' does. The
+conversations are listed and confirmation is asked first; nothing is
+deleted if one of the IDs does not exist.
+
+--force deletes without asking, e.g. in scripts, where stdin is not a
+terminal and confirmation cannot be asked.`,
+	Example: `  asc delete 20250701120000
+  asc delete --force 20250701120000 20250701123000`,
+	Args:         cobra.MinimumNArgs(1),
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	SilenceUsage: true,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		completions, directive := completeConversationIDs(cmd, args, toComplete)
+		return slices.DeleteFunc(completions, func(c string) bool {
+			id, _, _ := strings.Cut(c, "\t")
+			return slices.Contains(args, id)
+		}), directive
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var conversations []conversation.Conversation
+		for _, id := range args {
+			if slices.ContainsFunc(conversations, func(c conversation.Conversation) bool { return c.ID == id }) {
+				continue
+			}
+			conv, err := conversation.LoadConversation(id, logger)
+			if err != nil {
+				return err
+			}
+			conversations = append(conversations, conv)
+		}
+
+		if !deleteForce {
+			if !term.IsTerminal(int(os.Stdin.Fd())) {
+				return fmt.Errorf("not deleting without confirmation, use --force")
+			}
+			for _, conv := range conversations {
+				description := conv.Title
+				if description == "" {
+					description = strings.Join(strings.Fields(conv.Message), " ")
+				}
+				fmt.Fprintf(os.Stderr, "%s  %s\n", conv.ID, truncateString(description, 60))
+			}
+			fmt.Fprintf(os.Stderr, "Delete %d conversation(s)? [y/N] ", len(conversations))
+			answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil {
+				return fmt.Errorf("failed to read answer: %w", err)
+			}
+			if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+				return fmt.Errorf("aborted")
+			}
+		}
+
+		for _, conv := range conversations {
+			if err := conversation.DeleteConversation(conv.ID, logger); err != nil {
+				return err
+			}
+			fmt.Printf("Deleted %s\n", conv.ID)
+		}
+		return nil
+	},
+}
+
+var archiveCmd = &cobra.Command{
+	Use:   "archive <id>...",
+	Short: "Hide conversations from asc view without deleting them",
+	Long: `Archive conversations, as the A key of 'asc view' does. Archived
+conversations are kept, but 'asc view' only lists them with --archived;
+'asc unarchive' lists them again.`,
+	Args:              cobra.MinimumNArgs(1),
+	Annotations:       map[string]string{skipChecksAnnotation: "true"},
+	SilenceUsage:      true,
+	ValidArgsFunction: completeArchive(false),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, id := range args {
+			conv, err := conversation.LoadConversation(id, logger)
+			if err != nil {
+				return err
+			}
+			conversation.Archive(&conv)
+			if err := conversation.SaveConversation(conv, logger); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+var unarchiveCmd = &cobra.Command{
+	Use:               "unarchive <id>...",
+	Short:             "List archived conversations in asc view again",
+	Args:              cobra.MinimumNArgs(1),
+	Annotations:       map[string]string{skipChecksAnnotation: "true"},
+	SilenceUsage:      true,
+	ValidArgsFunction: completeArchive(true),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, id := range args {
+			conv, err := conversation.LoadConversation(id, logger)
+			if err != nil {
+				return err
+			}
+			if err := conversation.Unarchive(&conv); err != nil {
+				return err
+			}
+			if err := conversation.SaveConversation(conv, logger); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+var renameCmd = &cobra.Command{
+	Use:   "rename <id> [title]",
+	Short: "Set the title of a conversation",
+	Long: `Set the title lists show for a conversation instead of its first message,
+replacing the one generated when it was saved as new. An
+empty title removes it; --auto asks the provider for a new one.`,
+	Example: `  asc rename 20250706023320 Docker compose networks
+  asc rename --auto 20250706023320
+  asc rename 20250706023320 ""`,
+	Args:         cobra.MinimumNArgs(1),
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	SilenceUsage: true,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return completeConversationIDs(cmd, args, toComplete)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if renameAuto == (len(args) > 1) {
+			return fmt.Errorf("give either a title or --auto")
+		}
+		conv, err := conversation.LoadConversation(args[0], logger)
+		if err != nil {
+			return err
+		}
+		title := strings.TrimSpace(strings.Join(args[1:], " "))
+		if renameAuto {
+			if title, err = conversation.GenerateTitle(conv, logger); err != nil {
+				return fmt.Errorf("failed to generate a title: %w", err)
+			}
+		}
+		conv.Title = title
+		if err := conversation.SaveConversation(conv, logger); err != nil {
+			return err
+		}
+		if title == "" {
+			fmt.Printf("Removed the title of %s\n", conv.ID)
+		} else {
+			fmt.Printf("%s: %s\n", conv.ID, title)
+		}
+		return nil
+	},
+}
+
+var pinCmd = &cobra.Command{
+	Use:   "pin <id>...",
+	Short: "List conversations first in asc view",
+	Long: `Pin conversations, as the P key of 'asc view' does, so that they are
+listed before the others, newest first among themselves. Pinned
+conversations are not pruned.`,
+	Args:              cobra.MinimumNArgs(1),
+	Annotations:       map[string]string{skipChecksAnnotation: "true"},
+	SilenceUsage:      true,
+	ValidArgsFunction: completeConversationIDs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setPinned(args, true)
+	},
+}
+
+var unpinCmd = &cobra.Command{
+	Use:               "unpin <id>...",
+	Short:             "List pinned conversations by date again",
+	Args:              cobra.MinimumNArgs(1),
+	Annotations:       map[string]string{skipChecksAnnotation: "true"},
+	SilenceUsage:      true,
+	ValidArgsFunction: completeConversationIDs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setPinned(args, false)
+	},
+}
+
+// setPinned pins or unpins the conversations ids.
+func setPinned(ids []string, pinned bool) error {
+	for _, id := range ids {
+		conv, err := conversation.LoadConversation(id, logger)
+		if err != nil {
+			return err
+		}
+		conv.Pinned = pinned
+		if err := conversation.SaveConversation(conv, logger); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete old conversations",
+	Long: `Delete the conversations without activity for longer than --older-than,
+or all but the --keep most recently active ones, so that the history does
+not grow without bound. A conversation is active when it is saved with a
+change, e.g. a follow-up. Unread and pinned conversations and those on the
+reading queue are kept.
+
+--since and --until limit the deletion to conversations started in that
+range; alone, they delete every conversation in the range.
+
+Without flags, older_than and keep of the [prune] section of the config
+file are used; with auto = true there, conversations are also pruned once
+a day when one is saved.
+
+The number of conversations is shown and confirmation is asked first;
+--dry-run lists them instead, --force deletes them without asking.`,
+	Example: `  asc prune --older-than 90d --dry-run
+  asc prune --keep 500 --force
+  asc prune --until 2024-12-31 --dry-run`,
+	Args:         cobra.NoArgs,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts, err := conversation.PruneOptionsFromConfig()
+		if err != nil {
+			return err
+		}
+		filter, err := conversation.NewTimeFilter(since, until)
+		if err != nil {
+			return err
+		}
+		if cmd.Flags().Changed("older-than") || cmd.Flags().Changed("keep") || filter.HasTime() {
+			opts = conversation.PruneOptions{Keep: pruneKeep, Filter: filter}
+			if pruneOlderThan != "" {
+				if opts.OlderThan, err = timeutil.ParseDuration(pruneOlderThan); err != nil {
+					return err
+				}
+			}
+		}
+		opts.DryRun = true
+		selected, err := conversation.Prune(opts, logger)
+		if err != nil {
+			return err
+		}
+		if len(selected) == 0 {
+			fmt.Println("Nothing to prune")
+			return nil
+		}
+		if pruneDryRun {
+			for _, entry := range selected {
+				description := entry.Title
+				if description == "" {
+					description = strings.Join(strings.Fields(entry.Message), " ")
+				}
+				fmt.Printf("%s  %s\n", entry.ID, truncateString(description, 60))
+			}
+			fmt.Printf("%d conversation(s) would be deleted\n", len(selected))
+			return nil
+		}
+
+		if !pruneForce {
+			if !term.IsTerminal(int(os.Stdin.Fd())) {
+				return fmt.Errorf("not deleting without confirmation, use --force")
+			}
+			fmt.Fprintf(os.Stderr, "Delete %d conversation(s) (list them with --dry-run)? [y/N] ", len(selected))
+			answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil {
+				return fmt.Errorf("failed to read answer: %w", err)
+			}
+			if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+				return fmt.Errorf("aborted")
+			}
+		}
+		for i, entry := range selected {
+			if err := conversation.DeleteConversation(entry.ID, logger); err != nil {
+				return fmt.Errorf("deleted %d conversation(s), then: %w", i, err)
+			}
+		}
+		fmt.Printf("Deleted %d conversation(s)\n", len(selected))
+		return nil
+	},
+}
+
+var tidyCmd = &cobra.Command{
+	Use:   "tidy",
+	Short: "Walk through conversations to title, tag, archive or delete",
+	Long: `Walk through the conversations worth cleaning up, with a suggested change
+for each:
+
+  near-duplicate  the first message repeats a newer conversation: archive
+  huge            the text exceeds --huge-kb: delete
+  untitled        no title: one taken from the first message
+  untagged        no tags: the tags in use that the first message names
+
+Enter accepts the suggestion, other input replaces it, "-" skips and "."
+ends the review. Nothing is changed until the review is over: the changes
+are then listed and applied together after confirmation. Archived
+conversations are left out.`,
+	Args:         cobra.NoArgs,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		entries, err := conversation.LoadEntries(logger)
+		if err != nil {
+			return fmt.Errorf("failed to load conversations: %w", err)
+		}
+		findings := tidy.Find(entries, tidy.Options{HugeSize: tidyHugeKB * 1024}, logger)
+		if len(findings) == 0 {
+			fmt.Println("Nothing to tidy")
+			return nil
+		}
+		if tidyList {
+			for _, finding := range findings {
+				description := finding.Entry.Title
+				if description == "" {
+					description = strings.Join(strings.Fields(finding.Entry.Message), " ")
+				}
+				fmt.Printf("%s  %-14s  %s\n", finding.Entry.ID, finding.Kind, truncateString(description, 60))
+			}
+			return nil
+		}
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return fmt.Errorf("asc tidy asks what to do on a terminal, use --list to only list the findings")
+		}
+
+		in := bufio.NewReader(os.Stdin)
+		plan, err := tidy.Review(in, os.Stderr, findings)
+		if err != nil {
+			return err
+		}
+		if plan.Len() == 0 {
+			fmt.Fprintln(os.Stderr, "\nNothing to change")
+			return nil
+		}
+		fmt.Fprint(os.Stderr, "\n"+plan.String())
+		fmt.Fprintf(os.Stderr, "Apply the changes to %d conversation(s)? [y/N] ", plan.Len())
+		answer, err := in.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read answer: %w", err)
+		}
+		if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+			return fmt.Errorf("aborted")
+		}
+		changed, err := plan.Apply(logger)
+		if err != nil {
+			return fmt.Errorf("changed %d conversation(s), then: %w", changed, err)
+		}
+		fmt.Printf("Changed %d conversation(s)\n", changed)
+		return nil
+	},
+}
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show usage statistics",
+	Long: `Aggregate the recorded response metadata of saved conversations.
+Shows, per provider and model, how many responses were received and how
+long they took: time to first token and total request duration. Ratings
+given with 'asc rate' are counted per provider and model of the rated
+answer.
+
+With --dashboard, the conversations, tokens and estimated cost (see asc
+cost) are charted by day, week, model or provider. On a terminal the
+dashboard is interactive: tab or d/w/o/p switch the grouping, m the
+metric, q quits. Otherwise, and with --a11y, the chart of --by and
+--metric is printed.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filter, err := conversation.NewTimeFilter(since, until)
+		if err != nil {
+			return err
+		}
+		conversations, err := conversation.LoadConversations(logger)
+		if err != nil {
+			return fmt.Errorf("failed to load conversations: %w", err)
+		}
+		conversations = filter.Apply(conversations)
+		if len(conversations) == 0 {
+			fmt.Println("No conversations found")
+			return nil
+		}
+		if statsDashboard {
+			width, _, err := term.GetSize(int(os.Stdout.Fd()))
+			if err != nil {
+				width = 80
+			}
+			dashboard, err := stats.NewDashboard(conversations, statsBy, statsMetric, width)
+			if err != nil {
+				return err
+			}
+			if accessible || !term.IsTerminal(int(os.Stdout.Fd())) {
+				fmt.Println(dashboard.Static())
+				return nil
+			}
+			return dashboard.Run()
+		}
+		if err := stats.PrintLatency(os.Stdout, stats.ByModel(conversations)); err != nil {
+			return err
+		}
+		if ratings := stats.ByRating(conversations); len(ratings) > 0 {
+			fmt.Println()
+			return stats.PrintRatings(os.Stdout, ratings)
+		}
+		return nil
+	},
+}
+
+var topCmd = &cobra.Command{
+	Use:         "top",
+	Short:       "Watch running requests, today's usage and provider health",
+	Annotations: map[string]string{skipChecksAnnotation: "true"},
+	Long: `Show a live view of the requests in progress in every asc process,
+with how long they have been running and how much of the answer has
+arrived, the conversations, tokens and estimated cost of the day, and
+whether each provider can be used. It is refreshed every --interval; r
+refreshes it at once, q quits.
+
+When the output is not a terminal, and with --a11y, the view is printed
+once.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if topInterval <= 0 {
+			return fmt.Errorf("invalid --interval %s", topInterval)
+		}
+		if accessible || !term.IsTerminal(int(os.Stdout.Fd())) {
+			fmt.Println(stats.TakeSnapshot(true, logger))
+			return nil
+		}
+		width, _, err := term.GetSize(int(os.Stdout.Fd()))
+		if err != nil {
+			width = 80
+		}
+		return stats.NewTop(topInterval, width, logger).Run()
+	},
+}
+
+var redactCmd = &cobra.Command{
+	Use:         "redact <id>...",
+	Short:       "Scrub strings or patterns from stored conversations",
+	Annotations: map[string]string{skipChecksAnnotation: "true"},
+	Long: `Replace accidentally pasted secrets in stored conversations with
+[REDACTED]. Titles, metadata, messages, responses, errors, context and
+system prompt are scrubbed, and the file is rewritten atomically. The
+prompt history, the answer cache and the example banks are scrubbed too.
+Attached files are not changed; their content sent with a message is
+scrubbed from the message.
+
+Examples:
+  asc redact 20250706023320 --secrets
+  asc redact 20250706023320 -s "my-password" -e 'token=[0-9a-f]+'`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		redactor, err := conversation.NewRedactor(redactStrings, redactRegexps, redactSecret)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range args {
+			conv, err := conversation.LoadConversation(id, logger)
+			if err != nil {
+				return err
+			}
+			count := conversation.RedactConversation(&conv, redactor)
+			if count == 0 {
+				fmt.Printf("%s: nothing to redact\n", id)
+				continue
+			}
+			if dryRun {
+				fmt.Printf("%s: %d match(es) would be redacted\n", id, count)
+				continue
+			}
+			if err := conversation.SaveConversation(conv, logger); err != nil {
+				return fmt.Errorf("failed to save %s: %w", id, err)
+			}
+			fmt.Printf("%s: redacted %d match(es)\n", id, count)
+		}
+
+		// Prompts and answers are also kept outside the conversations
+		stores := []struct {
+			name   string
+			redact func() (int, error)
+		}{
+			{"prompt history", func() (int, error) { return history.Redact(redactor.Redact, dryRun) }},
+			{"answer cache", func() (int, error) { return conversation.RedactCache(redactor, dryRun) }},
+			{"example banks", func() (int, error) { return conversation.RedactExamples(redactor, dryRun) }},
+		}
+		for _, store := range stores {
+			count, err := store.redact()
+			if err != nil {
+				return fmt.Errorf("failed to redact the %s: %w", store.name, err)
+			}
+			switch {
+			case count == 0:
+			case dryRun:
+				fmt.Printf("%s: %d match(es) would be redacted\n", store.name, count)
+			default:
+				fmt.Printf("%s: redacted %d match(es)\n", store.name, count)
+			}
+		}
+		return nil
+	},
+}
+
+var bundleCmd = &cobra.Command{
+	Use:         "bundle",
+	Short:       "Move conversations between machines as a single file",
+	Annotations: map[string]string{skipChecksAnnotation: "true"},
+	Long: `Export selected conversations together with their attachments and the
+personas into a single compressed (and optionally encrypted) bundle, and
+import it again on another machine.`,
+}
+
+var bundleExportCmd = &cobra.Command{
+	Use:   "export <file.ascpack> [id...]",
+	Short: "Export conversations to a bundle",
+	Long: `Write conversations, the files they attached and every persona with its
+examples to a bundle. Without IDs, every conversation (within
+--since/--until) is exported.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var conversations []conversation.Conversation
+		if len(args) > 1 {
+			for _, id := range args[1:] {
+				conv, err := conversation.LoadConversation(id, logger)
+				if err != nil {
+					return err
+				}
+				if err := conversation.CheckShareable(conv); err != nil && !forceExport {
+					return fmt.Errorf("%w; use --force to export it anyway", err)
+				}
+				conversations = append(conversations, conv)
+			}
+		} else {
+			filter, err := conversation.NewTimeFilter(since, until)
+			if err != nil {
+				return err
+			}
+			if filter.Metadata, err = conversation.ParseMetadataFilter(metaFilters); err != nil {
+				return err
+			}
+			if filter.Tags, err = conversation.ParseTags(tagFilters); err != nil {
+				return err
+			}
+			all, err := conversation.LoadConversations(logger)
+			if err != nil {
+				return fmt.Errorf("failed to load conversations: %w", err)
+			}
+			// Leave private conversations out of bulk exports
+			for _, conv := range filter.Apply(all) {
+				if conv.IsPrivate() && !forceExport {
+					logger.Info("Skipping private conversation, use --force to include it", "id", conv.ID)
+					continue
+				}
+				conversations = append(conversations, conv)
+			}
+		}
+		if len(conversations) == 0 {
+			return fmt.Errorf("no conversations to export")
+		}
+
+		passphrase := ""
+		if encryptBundle {
+			var err error
+			if passphrase, err = readPassphrase(true); err != nil {
+				return err
+			}
+		}
+
+		stats, err := bundle.Export(args[0], conversations, passphrase, logger)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Exported %d conversation(s), %d attachment(s) and %d persona(s) to %s\n", stats.Conversations, stats.Attachments, stats.Personas, args[0])
+		return nil
+	},
+}
+
+var bundleImportCmd = &cobra.Command{
+	Use:   "import <file.ascpack>",
+	Short: "Import conversations from a bundle",
+	Long: `Restore the conversations and personas of a bundle. Conversations whose
+ID already exists are skipped, as are personas that already have a system
+prompt or examples.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		encrypted, err := bundle.IsEncrypted(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to read bundle: %w", err)
+		}
+		passphrase := ""
+		if encrypted {
+			if passphrase, err = readPassphrase(false); err != nil {
+				return err
+			}
+		}
+
+		stats, err := bundle.Import(args[0], passphrase, logger)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Imported %d conversation(s), %d attachment(s) and %d persona(s)\n", stats.Conversations, stats.Attachments, stats.Personas)
+		if len(stats.Skipped) > 0 {
+			fmt.Printf("Skipped %d existing conversation(s): %s\n", len(stats.Skipped), strings.Join(stats.Skipped, ", "))
+		}
+		if len(stats.SkippedPersonas) > 0 {
+			fmt.Printf("Skipped %d existing persona(s): %s\n", len(stats.SkippedPersonas), strings.Join(stats.SkippedPersonas, ", "))
+		}
+		return nil
+	},
+}
+
+var packCmd = &cobra.Command{
+	Use:         "pack",
+	Short:       "Share personas, styles and templates as a directory",
+	Annotations: map[string]string{skipChecksAnnotation: "true"},
+	Long: `Copy personas (their system prompts and few-shot example banks),
+installed styles and prompt templates to a pack directory that can be
+versioned in a dotfiles repository or shared with a team, and install the
+items of a pack.
+
+Items are named kind/name, e.g. persona/reviewer, style/dracula or
+template/code-review. On
+import they are renamed into a namespace, <namespace>.<name>, so that packs
+do not replace each other or your own items.`,
+}
+
+var packExportCmd = &cobra.Command{
+	Use:   "export <dir> [kind/name...]",
+	Short: "Export personas and styles to a pack directory",
+	Long: `Copy items to the pack directory dir, with a pack.json manifest listing
+them. Without items, every persona and installed style is exported.
+Exporting to the same directory again replaces the pack, so it can be kept
+up to date in a dotfiles repository.`,
+	Example: `  asc pack export ~/dotfiles/asc-pack persona/reviewer style/dracula
+  asc pack export --name team /srv/shared/asc-team`,
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var items []pack.Item
+		for _, ref := range args[1:] {
+			item, err := pack.ParseItem(ref)
+			if err != nil {
+				return err
+			}
+			items = append(items, item)
+		}
+		name := packName
+		if name == "" {
+			abs, err := filepath.Abs(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to resolve %s: %w", args[0], err)
+			}
+			name = filepath.Base(abs)
+		}
+		manifest, err := pack.Export(args[0], name, items)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Exported %d item(s) to %s as pack %q\n", len(manifest.Items), args[0], manifest.Name)
+		return nil
+	},
+}
+
+var packImportCmd = &cobra.Command{
+	Use:   "import <dir>",
+	Short: "Install the personas and styles of a pack directory",
+	Long: `Install the items of a pack directory, named <namespace>.<name>. The
+namespace is the pack name unless --namespace is given; --no-namespace keeps
+the names as they are. Nothing is installed when an item would replace a
+different one of the same name, unless --force is given.`,
+	Example: `  asc pack import ~/dotfiles/asc-pack
+  asc new --persona team.reviewer --examples 3 "Review this diff" < change.diff`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		namespace := packNamespace
+		if namespace == "" && !packFlat {
+			manifest, err := pack.ReadManifest(args[0])
+			if err != nil {
+				return err
+			}
+			namespace = manifest.Name
+		}
+		imported, err := pack.Import(args[0], namespace, packForce)
+		for _, item := range imported {
+			if item.Unchanged {
+				fmt.Printf("%s (unchanged)\n", item.To)
+			} else {
+				fmt.Println(item.To)
+			}
+		}
+		return err
+	},
+}
+
+// readPassphrase returns $ASC_BUNDLE_PASSPHRASE or prompts for a passphrase
+// on the terminal, asking twice when confirm is set.
+func readPassphrase(confirm bool) (string, error) {
+	if passphrase := os.Getenv("ASC_BUNDLE_PASSPHRASE"); passphrase != "" {
+		return passphrase, nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("a passphrase is required, set ASC_BUNDLE_PASSPHRASE")
+	}
+
+	fmt.Fprint(os.Stderr, "Passphrase: ")
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	if len(passphrase) == 0 {
+		return "", fmt.Errorf("empty passphrase")
+	}
+	if confirm {
+		fmt.Fprint(os.Stderr, "Confirm passphrase: ")
+		again, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		if string(again) != string(passphrase) {
+			return "", fmt.Errorf("passphrases do not match")
+		}
+	}
+	return string(passphrase), nil
+}
+
+var providersCmd = &cobra.Command{
+	Use:         "providers",
+	Short:       "List AI providers and their capabilities",
+	Annotations: map[string]string{skipChecksAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, name := range provider.Names() {
+			caps, _ := provider.Lookup(name, "")
+			var features []string
+			for _, f := range caps.Features() {
+				features = append(features, string(f))
+			}
+			installed := "installed"
+			if p, err := provider.Get(name); err != nil || p.Available() != nil {
+				installed = "not installed"
+			}
+			fmt.Printf("%-12s %-14s %s\n", name, installed, strings.Join(features, ", "))
+		}
+	},
+}
+
+var modelsCmd = &cobra.Command{
+	Use:   "models [provider]",
+	Short: "List known models with their context window and pricing",
+	Long: `List the models of the model registry with their context window and
+price in USD per million input and output tokens.
+
+The registry is used to warn about prompts that do not fit in the context
+window and to skip routes to models that are too small. It starts as a
+built-in list; run 'asc models update' to fetch the current one.`,
+	Args:        cobra.MaximumNArgs(1),
+	Annotations: map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		reg, err := provider.Models()
+		if err != nil {
+			logger.Warn("Using the built-in model list", "error", err)
+		}
+		if reg.Source == "" {
+			fmt.Println("Built-in model list; run 'asc models update' to refresh it")
+		} else {
+			fmt.Printf("Updated %s from %s\n", reg.Updated.Format("2006-01-02 15:04"), reg.Source)
+		}
+		fmt.Printf("%-12s %-40s %10s %10s %10s\n", "PROVIDER", "MODEL", "CONTEXT", "INPUT $/M", "OUTPUT $/M")
+		for _, m := range reg.Models {
+			if len(args) > 0 && m.Provider != args[0] {
+				continue
+			}
+			fmt.Printf("%-12s %-40s %10d %10.2f %10.2f\n", m.Provider, m.Name, m.ContextWindow, m.InputPrice, m.OutputPrice)
+		}
+		return nil
+	},
+}
+
+var costCmd = &cobra.Command{
+	Use:   "cost <id>",
+	Short: "Show the token usage and estimated cost of a conversation",
+	Long: `List the prompt and completion tokens of each exchange of a conversation
+with its estimated cost, and the total.
+
+Token counts are those reported by the provider; when it reports none they
+are estimated from the length of the text and marked with "~". Prices come
+from the [pricing] section of the config file, then from the model registry
+(see asc models). Exchanges of unknown models have no cost.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		conv, err := conversation.LoadConversation(args[0], logger)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%-4s %-24s %10s %10s %10s\n", "#", "MODEL", "PROMPT", "COMPLETION", "COST")
+		for i, turn := range conv.Exchanges() {
+			meta := turn.Meta
+			if meta == nil || meta.Usage == nil {
+				fmt.Printf("%-4d %-24s %10s %10s %10s\n", i+1, "", "-", "-", "-")
+				continue
+			}
+			model := meta.Model
+			if model == "" {
+				model = meta.Provider
+			}
+			approx := ""
+			if meta.Usage.Estimated {
+				approx = "~"
+			}
+			cost := "-"
+			if meta.Cost != nil {
+				cost = formatCost(*meta.Cost)
+			}
+			fmt.Printf("%-4d %-24s %10s %10s %10s\n", i+1, truncateString(model, 24),
+				approx+strconv.Itoa(meta.Usage.PromptTokens), approx+strconv.Itoa(meta.Usage.CompletionTokens), cost)
+		}
+		total := conversation.ConversationCost(conv)
+		fmt.Printf("Total: %d prompt + %d completion = %d tokens, %s\n",
+			total.PromptTokens, total.CompletionTokens, total.TotalTokens(), formatCost(total.Cost))
+		if total.Estimated > 0 {
+			fmt.Printf("%d exchange(s) with estimated token counts\n", total.Estimated)
+		}
+		if total.Unpriced > 0 {
+			fmt.Printf("%d exchange(s) of models without a known price are not counted\n", total.Unpriced)
+		}
+		return nil
+	},
+}
+
+var statusLineCmd = &cobra.Command{
+	Use:   "status-line",
+	Short: "Print a one-line summary for tmux or shell prompts",
+	Long: `Print the number of unread conversations, the requests in progress and
+the title of the last conversation on one line, e.g. "●3 ⟳1 Docker networking".
+Parts that are zero are left out.
+
+The summary is kept up to date as conversations are saved, so this reads
+one small file instead of the conversations and is cheap enough for a
+status bar refreshed every few seconds. --refresh rebuilds it.`,
+	Example: `  # tmux.conf
+  set -g status-right '#(asc status-line --width 20)'
+
+  # starship.toml
+  [custom.asc]
+  command = "asc status-line --format '{unread} unread'"
+  when = true`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		status, err := conversation.LoadStatus(statusRefresh, logger)
+		if err != nil {
+			return err
+		}
+		title := status.LastTitle
+		if statusWidth > 0 && len([]rune(title)) > statusWidth {
+			title = string([]rune(title)[:max(statusWidth-1, 0)]) + "…"
+		}
+		if statusFormat != "" {
+			fmt.Println(strings.NewReplacer(
+				"{unread}", strconv.Itoa(len(status.Unread)),
+				"{running}", strconv.Itoa(status.Running),
+				"{title}", title,
+				"{id}", status.LastID,
+			).Replace(statusFormat))
+			return nil
+		}
+		var parts []string
+		if len(status.Unread) > 0 {
+			parts = append(parts, fmt.Sprintf("●%d", len(status.Unread)))
+		}
+		if status.Running > 0 {
+			parts = append(parts, fmt.Sprintf("⟳%d", status.Running))
+		}
+		if title != "" {
+			parts = append(parts, title)
+		}
+		fmt.Println(strings.Join(parts, " "))
+		return nil
+	},
+}
+
+// formatCost formats a cost in USD, with enough digits for single cheap
+// requests.
+func formatCost(cost float64) string {
+	return fmt.Sprintf("$%.4f", cost)
+}
+
+var modelsUpdateCmd = &cobra.Command{
+	Use:   "update [url|file]",
+	Short: "Refresh the model registry",
+	Long: `Fetch the model registry and save it in the share directory. The source is
+a URL or a file in the format of LiteLLM's model_prices_and_context_window.json;
+it defaults to the models_url key of the config file, then to LiteLLM's copy
+on GitHub.`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		source := config.Current().ModelsURL
+		if len(args) > 0 {
+			source = args[0]
+		}
+		if source == "" {
+			source = provider.DefaultModelsURL
+		}
+		reg, err := provider.UpdateModels(cmd.Context(), source)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Saved %d models from %s\n", len(reg.Models), source)
+		return nil
+	},
+}
+
+var replaySuiteCmd = &cobra.Command{
+	Use:   "replay-suite <file>",
+	Short: "Replay recorded prompts and compare the answers",
+	Long: `Send the prompts of a suite recorded with --record again and show how the
+answers differ from the recorded ones, e.g. to check personas and templates
+before switching models. Nothing is saved to the history.
+
+Without --provider and --model, each prompt goes to the provider and model it
+was recorded with.`,
+	Example: `  asc --record suite.jsonl new "Review this function" -f main.go
+  asc replay-suite suite.jsonl --model gpt-4.1`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cases, err := suite.Load(args[0])
+		if err != nil {
+			return err
+		}
+		if len(cases) == 0 {
+			return fmt.Errorf("no cases in %s", args[0])
+		}
+		removed := lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+		added := lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+		var same, changed, failed int
+		for i, c := range cases {
+			target := replayProvider
+			if target == "" {
+				target = c.Provider
+			}
+			prompt := strings.Join(strings.Fields(c.Prompt), " ")
+			fmt.Printf("Case %d/%d: %s\n", i+1, len(cases), truncateString(prompt, 60))
+			answer, err := suite.Replay(cmd.Context(), c, replayProvider, replayModel, os.Stderr)
+			if err != nil {
+				failed++
+				fmt.Printf("  failed on %s: %v\n\n", target, err)
+				continue
+			}
+			diff := suite.Diff(c.Response, answer)
+			if diff == "" {
+				same++
+				fmt.Println("  identical")
+				fmt.Println()
+				continue
+			}
+			changed++
+			for _, line := range strings.Split(strings.TrimRight(diff, "\n"), "\n") {
+				switch line[0] {
+				case '-':
+					line = removed.Render(line)
+				case '+':
+					line = added.Render(line)
+				}
+				fmt.Println("  " + line)
+			}
+			fmt.Println()
+		}
+		fmt.Printf("%d identical, %d changed, %d failed\n", same, changed, failed)
+		if failed > 0 {
+			return fmt.Errorf("%d of %d cases failed", failed, len(cases))
+		}
+		return nil
+	},
+}
+
+var storageCmd = &cobra.Command{
+	Use:   "storage",
+	Short: "Manage where conversations are kept",
+	Long: `Conversations are kept as one JSON file each by default. With storage = "sqlite"
+in config.toml they are kept in a single database, conversations.db in the
+data directory, which lists and searches large histories faster.`,
+}
+
+var storageMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Copy conversations into the configured storage",
+	Long: `Copy the conversations kept by the other storage into the one selected by the
+storage key of config.toml, e.g. the JSON files into the database after
+setting storage = "sqlite". Conversations with the same ID are replaced; the
+source is left as it is.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		count, err := conversation.MigrateStorage(logger)
+		if err != nil {
+			return fmt.Errorf("failed to migrate conversations: %w", err)
+		}
+		storage := config.Current().Storage
+		if storage == "" {
+			storage = conversation.StorageJSON
+		}
+		fmt.Printf("Copied %d conversations into the %s storage\n", count, storage)
+		return nil
+	},
+}
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the answers kept for --cache",
+	Long: `With --cache, the answer to a prompt is kept in the data directory and
+reused when the same prompt is sent to the same model again. For questions
+about files in a git repository (--file, --context-file or --context-cmd)
+the HEAD commit is part of the key, so cached answers are reused while the
+code has not changed and are not once a new commit is checked out.`,
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:          "clear",
+	Short:        "Remove the cached answers",
+	Args:         cobra.NoArgs,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		count, err := conversation.ClearCache()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Removed %d cached answers\n", count)
+		return nil
+	},
+}
+
+var configCmd = &cobra.Command{
+	Use:         "config",
+	Short:       "Inspect the configuration file",
+	Annotations: map[string]string{skipChecksAnnotation: "true"},
+	Long: `Commands to inspect the configuration file
+($XDG_CONFIG_HOME/asc/config.toml, or ~/.config/asc/config.toml).`,
+}
+
+var configPathCmd = &cobra.Command{
+	Use:   "path",
+	Short: "Print the path of the configuration file",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := config.GetConfigPath()
+		if err != nil {
+			return err
+		}
+		fmt.Println(path)
+		return nil
+	},
+}
+
+var configDoctorCmd = &cobra.Command{
+	Use:          "doctor",
+	Short:        "Validate the configuration file",
+	SilenceUsage: true,
+	Long: `Check the configuration file against the schema and report syntax and
+type errors, unknown keys (with suggestions for typos), invalid values and
+deprecated options, each with its line number.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := config.GetConfigPath()
+		if err != nil {
+			return err
+		}
+		problems, err := config.Check(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				fmt.Printf("No config file at %s, using defaults\n", path)
+				return nil
+			}
+			return fmt.Errorf("failed to read config file: %w", err)
+		}
+		commandProblems, err := config.CheckCommands(path, validateCommandFlag)
+		if err != nil {
+			return fmt.Errorf("failed to read config file: %w", err)
+		}
+		problems = append(problems, commandProblems...)
+		sort.SliceStable(problems, func(i, j int) bool { return problems[i].Line < problems[j].Line })
+		if len(problems) == 0 {
+			fmt.Printf("%s: OK\n", path)
+			return nil
+		}
+
+		errorCount := 0
+		for _, problem := range problems {
+			fmt.Printf("%s:%s\n", path, problem)
+			if problem.Severity == "error" {
+				errorCount++
+			}
+		}
+		if errorCount > 0 {
+			return fmt.Errorf("%d error(s) in %s", errorCount, path)
+		}
+		return nil
+	},
+}
+
+var promptsCmd = &cobra.Command{
+	Use:   "prompts [n]",
+	Short: "List recently sent prompts",
+	Long: `List the prompts sent with new, append and edit, newest last, like
+shell history. Prompts sent with 'asc prompt' are not recorded.
+
+With a number, print that prompt as-is so it can be sent again:
+
+  asc new "$(asc prompts 3)"
+
+--since and --until list only the prompts sent in that range; they keep
+their numbers.`,
+	Args:        cobra.MaximumNArgs(1),
+	Annotations: map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		entries, err := history.Load()
+		if err != nil {
+			return err
+		}
+
+		if len(args) == 1 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 1 || n > len(entries) {
+				return fmt.Errorf("no prompt %s (history has %d prompts)", args[0], len(entries))
+			}
+			fmt.Print(entries[n-1].Prompt)
+			return nil
+		}
+
+		filter, err := conversation.NewTimeFilter(since, until)
+		if err != nil {
+			return err
+		}
+		var numbers []int
+		for i, entry := range entries {
+			if filter.MatchTime(entry.Timestamp) {
+				numbers = append(numbers, i+1)
+			}
+		}
+		if promptsLimit > 0 && len(numbers) > promptsLimit {
+			numbers = numbers[len(numbers)-promptsLimit:]
+		}
+		for _, n := range numbers {
+			firstLine, _, _ := strings.Cut(entries[n-1].Prompt, "\n")
+			fmt.Printf("%5d  %s  %s\n", n, timeutil.Format(entries[n-1].Timestamp), firstLine)
+		}
+		return nil
+	},
+}
+
+var initCmd = &cobra.Command{
+	Use:   "init <zsh|bash>",
+	Short: "Print shell integration for inline suggestions",
+	Long: `Print a script that binds Ctrl-X a to send the current command line to
+asc and replace it with the suggested command. Load it from your shell
+startup file:
+
+  eval "$(asc init zsh)"    # ~/.zshrc
+  eval "$(asc init bash)"   # ~/.bashrc`,
+	Args:        cobra.ExactArgs(1),
+	ValidArgs:   shell.Shells(),
+	Annotations: map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		script, err := shell.Script(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Print(script)
+		return nil
+	},
 }
 
-var versionCmd = &cobra.Command{
-	Use:   "version",
-	Short: "Show version information",
-	Long:  `Display the current version of ASC and build information.`,
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Switch between the profiles of the config file",
+	Long: `Commands to list and select the profiles defined in [profile.<name>]
+sections of config.toml. A profile replaces the provider and model settings
+and can set environment variables for the providers. --profile selects a
+profile for a single command.`,
+}
+
+var profileListCmd = &cobra.Command{
+	Use:         "list",
+	Short:       "List the profiles of the config file",
+	Annotations: map[string]string{skipChecksAnnotation: "true"},
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Printf("ASC version %s\n", version)
+		cfg := config.Current()
+		for _, name := range cfg.ProfileNames() {
+			marker := " "
+			if name == cfg.ActiveProfile {
+				marker = "*"
+			}
+			profile := cfg.Profiles[name]
+			var settings []string
+			if profile.Provider != "" {
+				settings = append(settings, "provider="+profile.Provider)
+			}
+			if profile.Model != "" {
+				settings = append(settings, "model="+profile.Model)
+			}
+			var env []string
+			for key := range profile.Env {
+				env = append(env, "$"+key)
+			}
+			sort.Strings(env)
+			settings = append(settings, env...)
+			fmt.Printf("%s %-12s %s\n", marker, name, strings.Join(settings, " "))
+		}
 	},
 }
 
-var newCmd = &cobra.Command{
-	Use:     "new [message]",
-	Aliases: []string{"n"},
-	Short:   "Start a new conversation with AI",
-	Long: `Start a new interactive conversation session with AI.
-The conversation will be saved in your data directory for future reference.
-
-If a message is provided, it will be sent as the first message to AI.
-Otherwise, you'll enter an interactive mode where you can type messages.`,
+var profileUseCmd = &cobra.Command{
+	Use:          "use <name>",
+	Short:        "Use a profile by default",
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if clearProfile {
+			if len(args) > 0 {
+				return fmt.Errorf("--clear takes no profile name")
+			}
+			if err := config.SelectProfile(""); err != nil {
+				return err
+			}
+			fmt.Println("Using the top-level settings")
+			return nil
+		}
 		if len(args) == 0 {
-			logger.Error("Message is required")
-			os.Exit(1)
+			return fmt.Errorf("a profile name is required, or --clear")
 		}
-
-		message := args[0]
-		logger.Debug("Starting new conversation", "message", message)
-
-		return conversation.StartNewConversation(message, usePerplexity, logger)
+		cfg := config.Current()
+		name := args[0]
+		if _, ok := cfg.Profiles[name]; !ok {
+			return fmt.Errorf("unknown profile %q (known: %s)", name, strings.Join(cfg.ProfileNames(), ", "))
+		}
+		if err := config.SelectProfile(name); err != nil {
+			return err
+		}
+		if cfg.DefaultProfile != "" && cfg.DefaultProfile != name {
+			logger.Warn("The default_profile key in config.toml takes precedence", "profile", cfg.DefaultProfile)
+		}
+		fmt.Printf("Using profile %s\n", name)
+		return nil
 	},
 }
 
-type model struct {
-	table         table.Model
-	conversations []conversation.Conversation
+var styleCmd = &cobra.Command{
+	Use:   "style",
+	Short: "Manage the markdown style of rendered answers",
+	Long: `Commands to select, install and preview markdown styles.
+
+The default style "auto" uses the "asc" style that comes with asc on dark
+terminals and the standard light style on light ones. Set background = "dark" or "light" in config.toml if detection
+does not work with your terminal.`,
 }
 
-func initialModel() model {
-	columns := []table.Column{
-		{Title: "ID", Width: 15},
-		{Title: "Date", Width: 20},
-		{Title: "Message", Width: 50},
-	}
+var styleSetCmd = &cobra.Command{
+	Use:          "set <name|file>",
+	Short:        "Select a style, installing it first if a file is given",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		if info, err := os.Stat(name); err == nil && !info.IsDir() {
+			if name, err = style.Install(name); err != nil {
+				return err
+			}
+			fmt.Printf("Installed style %s\n", name)
+		} else if _, err := style.Resolve(name, logger); err != nil {
+			return err
+		}
+		if err := style.Select(name); err != nil {
+			return err
+		}
+		if cfg := config.Current(); cfg.Style != "" && cfg.Style != name {
+			logger.Warn("The style key in config.toml takes precedence", "style", cfg.Style)
+		}
+		fmt.Printf("Using style %s\n", name)
+		return nil
+	},
+}
 
-	t := table.New(
-		table.WithColumns(columns),
-		table.WithFocused(true),
-		table.WithHeight(10),
-	)
+var styleListCmd = &cobra.Command{
+	Use:         "list",
+	Short:       "List the built-in and installed styles",
+	Annotations: map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		selected, err := style.Selected()
+		if err != nil {
+			return err
+		}
+		installed, err := style.Installed()
+		if err != nil {
+			return err
+		}
+		names := append([]string{style.Auto}, style.Builtin...)
+		for _, name := range append(names, installed...) {
+			marker := " "
+			if name == selected {
+				marker = "*"
+			}
+			fmt.Printf("%s %s\n", marker, name)
+		}
+		return nil
+	},
+}
 
-	s := table.DefaultStyles()
-	s.Header = s.Header.
-		BorderStyle(lipgloss.NormalBorder()).
-		BorderForeground(lipgloss.Color("240"))
-	s.Selected = s.Selected.
-		Foreground(lipgloss.Color("229")).
-		Background(lipgloss.Color("57")).
-		Bold(false)
-	t.SetStyles(s)
+var stylePreviewCmd = &cobra.Command{
+	Use:   "preview [name]",
+	Short: "Render sample markdown with a style (default: the selected one)",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, err := style.Selected()
+		if err != nil {
+			return err
+		}
+		if len(args) > 0 {
+			name = args[0]
+		}
+		glowStyle, err := style.Resolve(name, logger)
+		if err != nil {
+			return err
+		}
+		width, _, err := term.GetSize(int(os.Stdout.Fd()))
+		if err != nil {
+			width = 80
+		}
+		renderer, err := style.NewRendererFor(glowStyle, width)
+		if err != nil {
+			return err
+		}
+		rendered, err := renderer.Render(style.Sample)
+		if err != nil {
+			return err
+		}
+		fmt.Print(rendered)
+		return nil
+	},
+}
 
-	return model{
-		table: t,
+// validateCommandFlag checks that a [command.<name>] config section refers
+// to an existing command and flag.
+func validateCommandFlag(command, flag string) error {
+	cmd, rest, err := rootCmd.Find(strings.Fields(command))
+	if err != nil || len(rest) > 0 || commandKey(cmd) != command {
+		return fmt.Errorf("unknown command %q", command)
+	}
+	if cmd.Flags().Lookup(flag) == nil && cmd.InheritedFlags().Lookup(flag) == nil {
+		return fmt.Errorf("unknown flag %q for command %q", flag, command)
 	}
+	return nil
 }
 
-func (m model) Init() tea.Cmd {
-	return nil
+func valueOrUnknown(s string) string {
+	if s == "" {
+		return "(not reported)"
+	}
+	return s
 }
 
-func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-	var cmd tea.Cmd
-	switch msg := msg.(type) {
-	case tea.KeyMsg:
-		switch msg.String() {
-		case "esc", "q":
-			return m, tea.Quit
-		case "enter", "v":
-			if len(m.conversations) > 0 {
-				selected := m.conversations[m.table.Cursor()]
-				if err := conversation.ShowConversation(selected, logger); err != nil {
-					logger.Error("Failed to show conversation", "error", err)
-				}
-			}
-			return m, nil
-		}
+func truncateString(s string, maxLen int) string {
+	if len(s) <= maxLen {
+		return s
 	}
-	m.table, cmd = m.table.Update(msg)
-	return m, cmd
+	return s[:maxLen-3] + "..."
 }
 
-func (m model) View() string {
-	return m.table.View()
+// conversationIDPattern matches conversation IDs, which are timestamps.
+var conversationIDPattern = regexp.MustCompile(`^[0-9]{14}$`)
+
+// completeConversationIDs completes conversation IDs, newest first, with
+// their title or first message as the description.
+func completeConversationIDs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	entries, err := conversation.LoadEntries(logger)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Timestamp.After(entries[j].Timestamp)
+	})
+	var completions []string
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.ID, toComplete) {
+			continue
+		}
+		description := entry.Title
+		if description == "" {
+			description = strings.Join(strings.Fields(entry.Message), " ")
+		}
+		completions = append(completions, entry.ID+"\t"+truncateString(description, 60))
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveKeepOrder
 }
 
-var viewCmd = &cobra.Command{
-	Use:     "view",
-	Aliases: []string{"v", "V"},
-	Short:   "View conversation history",
-	Long: `Display the history of your conversations with AI.
-Shows a list of all conversations with their IDs, timestamps, and previews.
-You can use these IDs with other commands like 'append' and 'edit'.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		if err := view.StartView(logger); err != nil {
-			logger.Error("Failed to start view", "error", err)
-			os.Exit(1)
+// completeArchive completes the IDs of the conversations that are archived
+// when archived is set, and of the others otherwise, leaving out those
+// already given.
+func completeArchive(archived bool) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		entries, err := conversation.LoadEntries(logger)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
 		}
-	},
+		listed := map[string]bool{}
+		for _, entry := range conversation.Archived(entries, archived) {
+			listed[entry.ID] = !slices.Contains(args, entry.ID)
+		}
+		completions, directive := completeConversationIDs(cmd, args, toComplete)
+		return slices.DeleteFunc(completions, func(c string) bool {
+			id, _, _ := strings.Cut(c, "\t")
+			return !listed[id]
+		}), directive
+	}
 }
 
-func truncateString(s string, maxLen int) string {
-	if len(s) <= maxLen {
-		return s
+// appendTarget returns the conversation append continues: the one of
+// --id, of a leading ID argument, or the most recent one, and the
+// remaining arguments.
+func appendTarget(args []string) (conversation.Conversation, []string, error) {
+	id := appendID
+	switch {
+	case len(args) == 2:
+		if id != "" && id != args[0] {
+			return conversation.Conversation{}, nil, fmt.Errorf("conversation given both as %s and with --id %s", args[0], id)
+		}
+		id, args = args[0], args[1:]
+	case len(args) == 1 && id == "" && conversationIDPattern.MatchString(args[0]):
+		if conv, err := conversation.LoadConversation(args[0], logger); err == nil {
+			return conv, nil, nil
+		}
 	}
-	return s[:maxLen-3] + "..."
+	if id == "" {
+		latest, err := conversation.LatestConversation(logger)
+		return latest, args, err
+	}
+	conv, err := conversation.LoadConversation(id, logger)
+	return conv, args, err
 }
 
 var appendCmd = &cobra.Command{
-	Use:     "append [message]",
+	Use:     "append [id] [message]",
 	Aliases: []string{"a"},
 	Short:   "Continue a previous conversation",
 	Long: `Add a follow-up question or message to a previous conversation.
 If no conversation ID is specified, continues with the most recent conversation.
+The ID is given with --id or before the message; a single argument that is
+the ID of a conversation selects it, e.g. with the message piped to stdin.
 
-The message will be added to the existing conversation context,
-allowing AI to maintain context from previous messages.`,
+Every turn of the conversation is sent along with the message, so that AI
+keeps the context of the whole discussion; the middle of a thread too long
+for the context window of the model is left out (see history_tokens in the
+config file). The answer is saved as a new conversation holding the thread
+and the follow-up. Text piped to stdin is attached to the message.`,
+	Args: cobra.MaximumNArgs(2),
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 || appendID != "" {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return completeConversationIDs(cmd, args, toComplete)
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if len(args) == 0 {
-			return fmt.Errorf("message is required")
+		// Find the conversation first, so that a wrong ID fails before the
+		// message is edited or linted
+		target, args, err := appendTarget(args)
+		if err != nil {
+			return err
 		}
-
-		message := args[0]
-		logger.Debug("Continuing previous conversation", "message", message)
-
-		// Load conversations
-		conversations, err := conversation.LoadConversations(logger)
+		message := ""
+		if len(args) > 0 {
+			message = args[0]
+		}
+		message, err = normalizeMessage(message)
 		if err != nil {
-			return fmt.Errorf("failed to load conversations: %w", err)
+			return err
 		}
-
-		if len(conversations) == 0 {
-			return fmt.Errorf("no conversations found")
+		if message, err = templateMessage(message); err != nil {
+			return err
+		}
+		if message, err = withPipedInput(message); err != nil {
+			return err
+		}
+		if strings.TrimSpace(message) == "" {
+			return fmt.Errorf("message is required")
 		}
 
-		// Get the most recent conversation
-		latest := conversations[0]
-
-		// Create a new message that includes the previous conversation
-		contextMessage := fmt.Sprintf("Previous conversation:\nUser: %s\nAI: %s\n\n# Follow-up question\n%s",
-			latest.Message, latest.Response, message)
+		if message, err = lintMessage(message, true); err != nil {
+			return err
+		}
+		logger.Debug("Continuing previous conversation", "message", message)
+		if len(args) > 0 {
+			recordPrompt(args[0])
+		}
 
-		// Start a new conversation with the context
-		return conversation.StartNewConversation(contextMessage, usePerplexity, logger)
+		// Start a new conversation with the whole thread as history
+		opts := continueOptions(cmd, target)
+		opts.History = target.Exchanges()
+		opts.Recalled = []string{target.ID}
+		opts.Private = opts.Private || target.IsPrivate()
+		return conversation.StartNewConversation(message, opts, logger)
 	},
 }
 
@@ -283,26 +4264,33 @@ var editCmd = &cobra.Command{
 	Aliases: []string{"e"},
 	Short:   "Edit and resend a previous message",
 	Long: `Modify a previous message and resend it to AI.
-If no message ID is specified, edits the most recent message.
+If no conversation ID is specified, edits the most recent conversation.
+
+Use --turn to edit any earlier user message of a thread. The edited message
+and every later message are sent again as a new branch, so the original
+conversation is preserved.
 
 This is useful when you want to rephrase a question or
 correct a typo in a previous message.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		logger.Debug("Editing previous message")
+		logger.Debug("Editing previous message", "id", editID, "turn", editTurn)
 
-		// Load conversations
-		conversations, err := conversation.LoadConversations(logger)
+		var target conversation.Conversation
+		var err error
+		if editID != "" {
+			target, err = conversation.LoadConversation(editID, logger)
+		} else {
+			target, err = conversation.LatestConversation(logger)
+		}
 		if err != nil {
-			return fmt.Errorf("failed to load conversations: %w", err)
+			return err
 		}
 
-		if len(conversations) == 0 {
-			return fmt.Errorf("no conversations found")
+		exchanges := target.Exchanges()
+		if editTurn < 1 || editTurn > len(exchanges) {
+			return fmt.Errorf("turn %d does not exist (conversation %s has %d turns)", editTurn, target.ID, len(exchanges))
 		}
 
-		// Get the most recent conversation
-		latest := conversations[0]
-
 		// Create a temporary file with the message
 		tmpFile, err := os.CreateTemp("", "edit-*.txt")
 		if err != nil {
@@ -310,13 +4298,13 @@ correct a typo in a previous message.`,
 		}
 		defer os.Remove(tmpFile.Name())
 
-		if _, err := tmpFile.WriteString(latest.Message); err != nil {
+		if _, err := tmpFile.WriteString(exchanges[editTurn-1].Message); err != nil {
 			return fmt.Errorf("failed to write to temp file: %w", err)
 		}
 		tmpFile.Close()
 
 		// Get editor from environment variable
-		editor := os.Getenv("EDITOR")
+		editor := config.GetEditor()
 		if editor == "" {
 			return fmt.Errorf("EDITOR environment variable is not set")
 		}
@@ -336,8 +4324,13 @@ correct a typo in a previous message.`,
 			return fmt.Errorf("failed to read edited message: %w", err)
 		}
 
-		// Start a new conversation with the edited message
-		return conversation.StartNewConversation(string(editedMessage), usePerplexity, logger)
+		// Replay the thread from the edited turn as a new branch
+		recordPrompt(string(editedMessage))
+		branch, err := conversation.ReplayBranch(target, editTurn-1, string(editedMessage), continueOptions(cmd, target), logger)
+		if branch.ID != "" {
+			logger.Debug("Saved branch", "id", branch.ID, "branch_of", target.ID)
+		}
+		return err
 	},
 }
 
@@ -345,7 +4338,12 @@ var contextCmd = &cobra.Command{
 	Use:     "context",
 	Aliases: []string{"c"},
 	Short:   "Edit the context file",
-	Long:    `Open the context file in your default editor. The context is used to provide additional information to AI.`,
+	Long: `Open the context file in your default editor. The context is used to provide additional information to AI.
+
+If the context file was changed elsewhere while you were editing, e.g. in
+another terminal, you are asked whether to merge the changes, overwrite them
+or cancel.`,
+	SilenceUsage: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Load existing context
 		context, err := conversation.LoadContext(logger)
@@ -353,58 +4351,172 @@ var contextCmd = &cobra.Command{
 			return err
 		}
 
-		// Create a temporary file with the context
-		tmpFile, err := os.CreateTemp("", "context-*.txt")
+		editedContext, err := editContext(context)
 		if err != nil {
-			logger.Error("Failed to create temp file", "error", err)
 			return err
 		}
 
-		if _, err := tmpFile.WriteString(context); err != nil {
-			logger.Error("Failed to write to temp file", "error", err)
+		// Do not clobber changes saved while the editor was open
+		current, changed, err := conversation.ContextChanged(context, logger)
+		if err != nil {
 			return err
 		}
-		tmpFile.Close()
+		if changed && current != editedContext {
+			if !term.IsTerminal(int(os.Stdin.Fd())) {
+				return fmt.Errorf("context file was changed while editing, not saving")
+			}
+			fmt.Fprint(os.Stderr, "The context file was changed while you were editing it.\n[m]erge, [o]verwrite or [C]ancel? ")
+			answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			switch strings.ToLower(strings.TrimSpace(answer)) {
+			case "m":
+				if editedContext, err = editContext(conversation.MergeConflict(editedContext, current)); err != nil {
+					return err
+				}
+			case "o":
+			default:
+				logger.Info("Context not saved")
+				return nil
+			}
+		}
 
-		// Get editor from environment variable
-		editor := os.Getenv("EDITOR")
-		if editor == "" {
-			logger.Error("EDITOR environment variable is not set")
+		// Save the edited context
+		if err := conversation.SaveContext(editedContext, logger); err != nil {
+			logger.Error("Failed to save context", "error", err)
 			return err
 		}
 
-		// Open the file in the editor
-		editCmd := exec.Command(editor, tmpFile.Name())
-		editCmd.Stdin = os.Stdin
-		editCmd.Stdout = os.Stdout
-		editCmd.Stderr = os.Stderr
-		logger.Info("Opening editor", "editor", editor, "file", tmpFile.Name())
+		return nil
+	},
+}
 
-		if err := editCmd.Run(); err != nil {
-			logger.Error("Failed to open editor", "error", err)
+var contextHistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List earlier versions of the context",
+	Long: `List the versions of the context that were replaced by 'asc context',
+'asc clear' or a rollback, newest first. Pass the number of a version to
+'asc context rollback' to restore it.`,
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		history, err := conversation.ContextHistory(logger)
+		if err != nil {
 			return err
 		}
+		if len(history) == 0 {
+			fmt.Println("No earlier versions of the context")
+			return nil
+		}
+		for i, snapshot := range history {
+			firstLine, _, _ := strings.Cut(strings.TrimSpace(snapshot.Content), "\n")
+			if len([]rune(firstLine)) > 50 {
+				firstLine = string([]rune(firstLine)[:50]) + "…"
+			}
+			fmt.Printf("%3d  %s  %6d bytes  %s\n", i+1, snapshot.Time.Format("2006-01-02 15:04:05"), len(snapshot.Content), firstLine)
+		}
+		return nil
+	},
+}
 
-		// Read the edited context
-		editedContext, err := os.ReadFile(tmpFile.Name())
+var contextRollbackCmd = &cobra.Command{
+	Use:   "rollback <n>",
+	Short: "Restore an earlier version of the context",
+	Long: `Restore version n of the context as listed by 'asc context history'
+(1 is the most recent). The context being replaced is kept in the history.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid version %q: %w", args[0], err)
+		}
+		snapshot, err := conversation.RollbackContext(n, logger)
 		if err != nil {
-			logger.Error("Failed to read edited context", "error", err)
 			return err
 		}
+		fmt.Printf("Restored the context from %s\n", snapshot.Time.Format("2006-01-02 15:04:05"))
+		return nil
+	},
+}
 
-		// Save the edited context
-		if err := conversation.SaveContext(string(editedContext), logger); err != nil {
-			logger.Error("Failed to save context", "error", err)
+var contextExecCmd = &cobra.Command{
+	Use:   "exec <command>",
+	Short: "Replace the context with the output of a shell command",
+	Long: `Run a shell command and save its output, headed by the command line, as
+the context. The context being replaced is kept in the history.
+
+To use the output of a command for one message only, pass it with
+--context-cmd instead:
+
+  asc new --context-cmd "git diff --staged" "Write a commit message"`,
+	Example: `  asc context exec "git diff --staged"
+  asc context exec "ps aux | head -20"`,
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	Annotations:  map[string]string{skipChecksAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		command := strings.Join(args, " ")
+		context, err := conversation.RunContextCommand(command, config.Current().Stdin.MaxSize, logger)
+		if err != nil {
+			return err
+		}
+		if context == "" {
+			return fmt.Errorf("%q printed nothing, the context was not changed", command)
+		}
+		if err := conversation.SaveContext(context, logger); err != nil {
 			return err
 		}
+		fmt.Printf("Saved %d bytes of output of %q as the context\n", len(context), command)
+		return nil
+	},
+}
 
+// editContext opens text in the editor and returns the edited text.
+func editContext(text string) (string, error) {
+	// Create a temporary file with the context
+	tmpFile, err := os.CreateTemp("", "context-*.txt")
+	if err != nil {
+		logger.Error("Failed to create temp file", "error", err)
+		return "", err
+	}
+	defer func() {
 		// Clean up
 		if err := os.Remove(tmpFile.Name()); err != nil {
 			logger.Error("Failed to remove temporary file", "error", err)
 		}
+	}()
 
-		return nil
-	},
+	if _, err := tmpFile.WriteString(text); err != nil {
+		logger.Error("Failed to write to temp file", "error", err)
+		return "", err
+	}
+	tmpFile.Close()
+
+	// Get editor from environment variable
+	editor := config.GetEditor()
+	if editor == "" {
+		return "", fmt.Errorf("EDITOR environment variable is not set")
+	}
+
+	// Open the file in the editor
+	editCmd := exec.Command(editor, tmpFile.Name())
+	editCmd.Stdin = os.Stdin
+	editCmd.Stdout = os.Stdout
+	editCmd.Stderr = os.Stderr
+	logger.Info("Opening editor", "editor", editor, "file", tmpFile.Name())
+
+	if err := editCmd.Run(); err != nil {
+		logger.Error("Failed to open editor", "error", err)
+		return "", err
+	}
+
+	// Read the edited context
+	edited, err := os.ReadFile(tmpFile.Name())
+	if err != nil {
+		logger.Error("Failed to read edited context", "error", err)
+		return "", err
+	}
+	return string(edited), nil
 }
 
 var clearCmd = &cobra.Command{
@@ -0,0 +1,416 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"asc/internal/config"
+	"asc/internal/conversation"
+
+	"github.com/charmbracelet/log"
+	"golang.org/x/crypto/scrypt"
+)
+
+// encryptedMagic starts every encrypted bundle. It is followed by the scrypt
+// salt, the AES-GCM nonce and the sealed gzip'd tar archive.
+var encryptedMagic = []byte("ASCPACK1")
+
+const (
+	saltSize    = 16
+	manifestKey = "manifest.json"
+)
+
+// Manifest describes the content of a bundle.
+type Manifest struct {
+	Version       int       `json:"version"`
+	Created       time.Time `json:"created"`
+	Conversations []string  `json:"conversations"`
+	Personas      []string  `json:"personas,omitempty"`
+}
+
+// Stats summarizes an export or import.
+type Stats struct {
+	Conversations int
+	Attachments   int
+	Skipped       []string
+	Personas      int
+	// SkippedPersonas are the personas kept as they were because they
+	// already exist.
+	SkippedPersonas []string
+}
+
+// Export writes the conversations, the files they attached and every
+// persona with its example bank to a single compressed bundle at dest. If passphrase is not empty the bundle is
+// encrypted with AES-256-GCM using a key derived by scrypt.
+func Export(dest string, conversations []conversation.Conversation, passphrase string, logger *log.Logger) (Stats, error) {
+	var stats Stats
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+
+	manifest := Manifest{Version: 1, Created: time.Now()}
+	for _, conv := range conversations {
+		// Attachments are stored next to the conversation and their paths
+		// rewritten to point into the bundle
+		for i, attachment := range conv.Attachments {
+			data, err := os.ReadFile(attachment.Path)
+			if err != nil {
+				logger.Warn("Attachment not bundled", "id", conv.ID, "path", attachment.Path, "error", err)
+				continue
+			}
+			name := path.Join("attachments", conv.ID, fmt.Sprintf("%d-%s", i, filepath.Base(attachment.Path)))
+			if err := writeEntry(tw, name, data); err != nil {
+				return stats, err
+			}
+			conv.Attachments[i].Path = name
+			stats.Attachments++
+		}
+
+		conv.FilePath = ""
+		data, err := json.MarshalIndent(conv, "", "  ")
+		if err != nil {
+			return stats, fmt.Errorf("failed to marshal conversation %s: %w", conv.ID, err)
+		}
+		if err := writeEntry(tw, path.Join("conversations", conv.ID+".json"), data); err != nil {
+			return stats, err
+		}
+		manifest.Conversations = append(manifest.Conversations, conv.ID)
+		stats.Conversations++
+	}
+	personas, err := exportPersonas(tw)
+	if err != nil {
+		return stats, err
+	}
+	manifest.Personas = personas
+	stats.Personas = len(personas)
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return stats, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := writeEntry(tw, manifestKey, data); err != nil {
+		return stats, err
+	}
+	if err := tw.Close(); err != nil {
+		return stats, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return stats, fmt.Errorf("failed to compress archive: %w", err)
+	}
+
+	content := archive.Bytes()
+	if passphrase != "" {
+		if content, err = encrypt(content, passphrase); err != nil {
+			return stats, err
+		}
+	}
+	if err := os.WriteFile(dest, content, 0600); err != nil {
+		return stats, fmt.Errorf("failed to write bundle: %w", err)
+	}
+	return stats, nil
+}
+
+// exportPersonas adds the system prompt and example bank of every persona
+// and returns their names.
+func exportPersonas(tw *tar.Writer) ([]string, error) {
+	prompts, err := conversation.ListPersonas()
+	if err != nil {
+		return nil, err
+	}
+	banks, err := conversation.ExamplePersonas()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range append(prompts, banks...) {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		prompt, err := conversation.PersonaPrompt(name)
+		if err != nil {
+			return nil, err
+		}
+		if prompt != "" {
+			if err := writeEntry(tw, path.Join("personas", name+".md"), []byte(prompt+"\n")); err != nil {
+				return nil, err
+			}
+		}
+		examples, err := conversation.LoadExamples(name)
+		if err != nil {
+			return nil, err
+		}
+		if len(examples) > 0 {
+			data, err := json.MarshalIndent(examples, "", "  ")
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal examples of %s: %w", name, err)
+			}
+			if err := writeEntry(tw, path.Join("examples", name+".json"), data); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return names, nil
+}
+
+// IsEncrypted reports whether the bundle at src needs a passphrase.
+func IsEncrypted(src string) (bool, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	head := make([]byte, len(encryptedMagic))
+	if _, err := io.ReadFull(f, head); err != nil {
+		return false, nil
+	}
+	return bytes.Equal(head, encryptedMagic), nil
+}
+
+// Import restores the conversations and personas of the bundle at src.
+// Conversations whose ID already exists and personas that already have a
+// system prompt or examples are skipped. Attachments are extracted under
+// the share directory and their paths updated.
+func Import(src, passphrase string, logger *log.Logger) (Stats, error) {
+	var stats Stats
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return stats, fmt.Errorf("failed to read bundle: %w", err)
+	}
+	if bytes.HasPrefix(content, encryptedMagic) {
+		if passphrase == "" {
+			return stats, fmt.Errorf("bundle is encrypted, a passphrase is required")
+		}
+		if content, err = decrypt(content, passphrase); err != nil {
+			return stats, err
+		}
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return stats, fmt.Errorf("not a bundle: %w", err)
+	}
+	tr := tar.NewReader(gz)
+
+	files := map[string][]byte{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return stats, fmt.Errorf("failed to read bundle: %w", err)
+		}
+		name := path.Clean(hdr.Name)
+		if strings.HasPrefix(name, "..") || path.IsAbs(name) {
+			return stats, fmt.Errorf("invalid entry %q in bundle", hdr.Name)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return stats, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		files[name] = data
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(files[manifestKey], &manifest); err != nil {
+		return stats, fmt.Errorf("bundle has no valid manifest: %w", err)
+	}
+
+	shareDir, err := config.GetShareDir()
+	if err != nil {
+		return stats, err
+	}
+	existing := map[string]bool{}
+	if conversations, err := conversation.LoadConversations(logger); err == nil {
+		for _, conv := range conversations {
+			existing[conv.ID] = true
+		}
+	}
+
+	for _, id := range manifest.Conversations {
+		// IDs name the files conversations are saved to, so a crafted one
+		// could write anywhere
+		if !conversation.ValidID(id) {
+			return stats, fmt.Errorf("invalid conversation ID %q in bundle", id)
+		}
+		var conv conversation.Conversation
+		if err := json.Unmarshal(files[path.Join("conversations", id+".json")], &conv); err != nil {
+			return stats, fmt.Errorf("invalid conversation %s in bundle: %w", id, err)
+		}
+		if conv.ID != id {
+			return stats, fmt.Errorf("conversation %s in bundle has ID %q", id, conv.ID)
+		}
+		if existing[conv.ID] {
+			stats.Skipped = append(stats.Skipped, conv.ID)
+			continue
+		}
+
+		for i, attachment := range conv.Attachments {
+			// Only the attachments of the conversation are extracted
+			if !strings.HasPrefix(attachment.Path, path.Join("attachments", id)+"/") {
+				continue
+			}
+			data, ok := files[attachment.Path]
+			if !ok {
+				continue
+			}
+			dest := filepath.Join(shareDir, filepath.FromSlash(attachment.Path))
+			if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+				return stats, fmt.Errorf("failed to create attachment directory: %w", err)
+			}
+			if err := os.WriteFile(dest, data, 0644); err != nil {
+				return stats, fmt.Errorf("failed to write attachment: %w", err)
+			}
+			conv.Attachments[i].Path = dest
+			stats.Attachments++
+		}
+
+		if err := conversation.SaveConversation(conv, logger); err != nil {
+			return stats, err
+		}
+		stats.Conversations++
+	}
+
+	for _, name := range manifest.Personas {
+		// Persona names also name files
+		if err := conversation.CheckPersonaName(name); err != nil {
+			return stats, fmt.Errorf("%w in bundle", err)
+		}
+		imported, err := importPersona(name, files)
+		if err != nil {
+			return stats, err
+		}
+		if imported {
+			stats.Personas++
+		} else {
+			stats.SkippedPersonas = append(stats.SkippedPersonas, name)
+		}
+	}
+	return stats, nil
+}
+
+// importPersona saves the system prompt and examples of persona name found
+// in files, unless the persona already has either. It reports whether the
+// persona was imported.
+func importPersona(name string, files map[string][]byte) (bool, error) {
+	prompt, err := conversation.PersonaPrompt(name)
+	if err != nil {
+		return false, err
+	}
+	existing, err := conversation.LoadExamples(name)
+	if err != nil {
+		return false, err
+	}
+	if prompt != "" || len(existing) > 0 {
+		return false, nil
+	}
+	if data, ok := files[path.Join("personas", name+".md")]; ok {
+		if _, err := conversation.SavePersona(name, string(data)); err != nil {
+			return false, err
+		}
+	}
+	if data, ok := files[path.Join("examples", name+".json")]; ok {
+		var examples []conversation.Example
+		if err := json.Unmarshal(data, &examples); err != nil {
+			return false, fmt.Errorf("invalid examples of persona %s in bundle: %w", name, err)
+		}
+		if _, err := conversation.SaveExamples(name, examples); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func writeEntry(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to add %s: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to add %s: %w", name, err)
+	}
+	return nil
+}
+
+func deriveKey(passphrase string, salt []byte) ([]byte, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	return key, nil
+}
+
+func newGCM(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func encrypt(plain []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out := append([]byte{}, encryptedMagic...)
+	out = append(out, salt...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, plain, encryptedMagic), nil
+}
+
+func decrypt(content []byte, passphrase string) ([]byte, error) {
+	content = content[len(encryptedMagic):]
+	if len(content) < saltSize {
+		return nil, fmt.Errorf("bundle is truncated")
+	}
+	salt, content := content[:saltSize], content[saltSize:]
+	gcm, err := newGCM(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(content) < gcm.NonceSize() {
+		return nil, fmt.Errorf("bundle is truncated")
+	}
+	nonce, sealed := content[:gcm.NonceSize()], content[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, sealed, encryptedMagic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt bundle (wrong passphrase?)")
+	}
+	return plain, nil
+}
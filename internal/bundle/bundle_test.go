@@ -0,0 +1,177 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"asc/internal/conversation"
+
+	"github.com/charmbracelet/log"
+)
+
+// isolate points the data directory of asc to a temporary directory and
+// returns it.
+func isolate(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_DATA_HOME", filepath.Join(dir, "share"))
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	return dir
+}
+
+// writeBundle writes an unencrypted bundle holding files and returns its
+// path.
+func writeBundle(t *testing.T, files map[string]any) string {
+	t.Helper()
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		data, ok := content.([]byte)
+		if !ok {
+			var err error
+			if data, err = json.Marshal(content); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := writeEntry(tw, name, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	dest := filepath.Join(t.TempDir(), "crafted.ascpack")
+	if err := os.WriteFile(dest, archive.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return dest
+}
+
+func TestImportRejectsCraftedIDs(t *testing.T) {
+	logger := log.New(io.Discard)
+	tests := []struct {
+		name  string
+		files map[string]any
+	}{
+		{"manifest", map[string]any{
+			manifestKey:    Manifest{Version: 1, Conversations: []string{"../.bashrc"}},
+			".bashrc.json": conversation.Conversation{ID: "../.bashrc", Message: "echo pwned"},
+		}},
+		{"conversation", map[string]any{
+			manifestKey:                         Manifest{Version: 1, Conversations: []string{"20250101120000"}},
+			"conversations/20250101120000.json": conversation.Conversation{ID: "../.bashrc", Message: "echo pwned"},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			home := isolate(t)
+			src := writeBundle(t, test.files)
+			stats, err := Import(src, "", logger)
+			if err == nil || !strings.Contains(err.Error(), "ID") {
+				t.Fatalf("Import = %+v, %v, want an invalid ID", stats, err)
+			}
+			if _, err := os.Stat(filepath.Join(home, "share", "asc", "data", ".bashrc.json")); !os.IsNotExist(err) {
+				t.Errorf("Import wrote outside the data directory")
+			}
+		})
+	}
+}
+
+func TestImportKeepsAttachmentsInBundle(t *testing.T) {
+	logger := log.New(io.Discard)
+	home := isolate(t)
+	conv := conversation.Conversation{
+		ID:          "20250101120000",
+		Timestamp:   time.Date(2025, 1, 1, 12, 0, 0, 0, time.Local),
+		Message:     "hello",
+		Attachments: []conversation.Attachment{{Path: "context.txt"}},
+	}
+	src := writeBundle(t, map[string]any{
+		manifestKey:                         Manifest{Version: 1, Conversations: []string{conv.ID}},
+		"conversations/20250101120000.json": conv,
+		"context.txt":                       []byte("overwritten"),
+	})
+	stats, err := Import(src, "", logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Conversations != 1 || stats.Attachments != 0 {
+		t.Errorf("Import = %+v, want 1 conversation and no attachment", stats)
+	}
+	if _, err := os.Stat(filepath.Join(home, "share", "asc", "context.txt")); !os.IsNotExist(err) {
+		t.Errorf("Import extracted a file outside the attachments")
+	}
+}
+
+func TestPersonasRoundTrip(t *testing.T) {
+	logger := log.New(io.Discard)
+	isolate(t)
+	if _, err := conversation.SavePersona("reviewer", "Review the code."); err != nil {
+		t.Fatal(err)
+	}
+	examples := []conversation.Example{{ID: "20250101120000", Question: "Is this safe?", Answer: "No."}}
+	if _, err := conversation.SaveExamples("reviewer", examples); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conversation.SaveExamples("writer", examples); err != nil {
+		t.Fatal(err)
+	}
+	conv := conversation.Conversation{ID: "20250101120000", Timestamp: time.Now(), Message: "hello"}
+	src := filepath.Join(t.TempDir(), "personas.ascpack")
+	stats, err := Export(src, []conversation.Conversation{conv}, "", logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Personas != 2 {
+		t.Errorf("Export = %+v, want 2 personas", stats)
+	}
+
+	// Import on another machine, where writer exists already
+	isolate(t)
+	if _, err := conversation.SavePersona("writer", "Write well."); err != nil {
+		t.Fatal(err)
+	}
+	if stats, err = Import(src, "", logger); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Personas != 1 || len(stats.SkippedPersonas) != 1 || stats.SkippedPersonas[0] != "writer" {
+		t.Errorf("Import = %+v, want reviewer imported and writer skipped", stats)
+	}
+	if prompt, err := conversation.PersonaPrompt("reviewer"); err != nil || prompt != "Review the code." {
+		t.Errorf("PersonaPrompt(reviewer) = %q, %v", prompt, err)
+	}
+	if got, err := conversation.LoadExamples("reviewer"); err != nil || len(got) != 1 || got[0].Answer != "No." {
+		t.Errorf("LoadExamples(reviewer) = %+v, %v", got, err)
+	}
+	if got, _ := conversation.LoadExamples("writer"); len(got) != 0 {
+		t.Errorf("Import replaced the examples of an existing persona")
+	}
+}
+
+func TestImportRejectsCraftedPersonas(t *testing.T) {
+	logger := log.New(io.Discard)
+	home := isolate(t)
+	src := writeBundle(t, map[string]any{
+		manifestKey:          Manifest{Version: 1, Personas: []string{"../../../.bashrc"}},
+		"personas/bashrc.md": []byte("echo pwned"),
+	})
+	if _, err := Import(src, "", logger); err == nil || !strings.Contains(err.Error(), "invalid persona name") {
+		t.Fatalf("Import = %v, want an invalid persona name", err)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".bashrc.md")); !os.IsNotExist(err) {
+		t.Errorf("Import wrote outside the personas directory")
+	}
+}
@@ -0,0 +1,346 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"asc/internal/config"
+	"asc/internal/conversation"
+	"asc/internal/history"
+	"asc/internal/provider"
+
+	"github.com/charmbracelet/log"
+)
+
+// session is the state of a running chat REPL.
+type session struct {
+	conv   conversation.Conversation
+	opts   conversation.Options
+	logger *log.Logger
+	// out receives the output of the commands.
+	out io.Writer
+	// keyHelp describes the keys of the input for /help.
+	keyHelp string
+	// attachments are attached to the next message only.
+	attachments []string
+	quit        bool
+}
+
+// newSession starts a session of conv. The files of opts.Attachments are
+// attached to the first message only.
+func newSession(conv conversation.Conversation, opts conversation.Options, logger *log.Logger) *session {
+	s := &session{conv: conv, opts: opts, logger: logger, attachments: opts.Attachments}
+	s.opts.Attachments = nil
+	return s
+}
+
+// command is a slash-command of the REPL.
+type command struct {
+	name string
+	// args describes the arguments, empty if the command takes none.
+	args string
+	help string
+	run  func(s *session, arg string) error
+}
+
+var commands []command
+
+// replKeyHelp describes the keys of the line REPL for /help.
+const replKeyHelp = "  Tab accepts a suggestion, Ctrl-N/Ctrl-P cycle them, Up/Down recall prompts."
+
+func init() {
+	commands = []command{
+		{name: "/attach", args: "<file>", help: "Attach a text file to the next message", run: (*session).attach},
+		{name: "/model", args: "<name|default>", help: "Use another model for the next messages", run: (*session).model},
+		{name: "/context", args: "<name|file|off>", help: "Use a named context, a file or no context", run: (*session).context},
+		{name: "/title", args: "<title>", help: "Set the title of the conversation", run: (*session).title},
+		{name: "/fork", help: "Continue in a copy of the conversation, keeping the original", run: (*session).fork},
+		{name: "/save", args: "<file>", help: "Write a transcript (.md, .html or .json)", run: (*session).save},
+		{name: "/retry", help: "Send the last message again, replacing its answer", run: (*session).retry},
+		{name: "/help", help: "List the commands", run: (*session).help},
+		{name: "/quit", help: "Leave the chat (also Ctrl-D)", run: (*session).exit},
+	}
+}
+
+// Run starts an interactive chat. Every message is sent with the earlier
+// turns as history and the thread is saved as a single conversation. If
+// conv has an ID, the chat continues that conversation.
+func Run(conv conversation.Conversation, opts conversation.Options, logger *log.Logger) error {
+	s := newSession(conv, opts, logger)
+	s.out, s.keyHelp = os.Stdout, replKeyHelp
+	if conv.ID != "" {
+		fmt.Fprintf(s.out, "Continuing conversation %s (%d turns)\n", conv.ID, len(conv.Exchanges()))
+	}
+	fmt.Fprintln(s.out, "Type /help for commands, Ctrl-D to quit.")
+
+	for !s.quit {
+		prompts, err := history.Prompts()
+		if err != nil {
+			logger.Warn("Failed to load prompt history", "error", err)
+		}
+		in, err := readLine(suggestions(prompts), prompts, config.Current().Chat.PasteAttachmentSize)
+		if errors.Is(err, errQuit) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+		line := in.line
+		if line == "" && in.paste == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "/") {
+			if in.paste != "" {
+				logger.Warn("Discarding the paste, which only goes with messages")
+			}
+			if err := s.runCommand(line); err != nil {
+				logger.Error("Command failed", "error", err)
+			}
+			continue
+		}
+		if line != "" {
+			if err := history.Add(line); err != nil {
+				logger.Warn("Failed to record prompt history", "error", err)
+			}
+		}
+		message, err := s.withPaste(in)
+		if err != nil {
+			logger.Error("Failed to attach the paste", "error", err)
+			continue
+		}
+		if err := s.send(message); err != nil {
+			logger.Error("Failed to send message", "error", err)
+		}
+	}
+
+	if s.conv.ID != "" {
+		fmt.Fprintf(s.out, "Saved as conversation %s\n", s.conv.ID)
+	}
+	return nil
+}
+
+// suggestions returns the completions offered while typing: the slash
+// commands followed by earlier prompts.
+func suggestions(prompts []string) []string {
+	var result []string
+	for _, c := range commands {
+		name := c.name
+		if c.args != "" {
+			name += " "
+		}
+		result = append(result, name)
+	}
+	// Offer the most recent prompts first
+	for i := len(prompts) - 1; i >= 0; i-- {
+		result = append(result, prompts[i])
+	}
+	return result
+}
+
+// runCommand parses and runs a slash-command line.
+func (s *session) runCommand(line string) error {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	for _, c := range commands {
+		if c.name == name {
+			if c.args != "" && arg == "" {
+				return fmt.Errorf("usage: %s %s", c.name, c.args)
+			}
+			return c.run(s, arg)
+		}
+	}
+	return fmt.Errorf("unknown command %s, type /help for the list", name)
+}
+
+// withPaste returns the message for in. A paste is appended to the line,
+// or saved to a file and attached to the message.
+func (s *session) withPaste(in input) (string, error) {
+	if in.paste == "" {
+		return in.line, nil
+	}
+	if !in.pasteAsFile {
+		if in.line == "" {
+			return in.paste, nil
+		}
+		return in.line + "\n\n" + in.paste, nil
+	}
+	path, err := savePaste(in.paste)
+	if err != nil {
+		return "", err
+	}
+	s.attachments = append(s.attachments, path)
+	fmt.Fprintf(s.out, "Attached the paste as %s\n", path)
+	if in.line == "" {
+		return "Please look at the attached text.", nil
+	}
+	return in.line, nil
+}
+
+// savePaste writes text to a new file in the pastes directory, where it is
+// kept so that the attachment recorded with the conversation stays valid.
+func savePaste(text string) (string, error) {
+	shareDir, err := config.GetShareDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(shareDir, "pastes")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create pastes directory: %w", err)
+	}
+	f, err := os.CreateTemp(dir, time.Now().Format("20060102-150405")+"-*.txt")
+	if err != nil {
+		return "", fmt.Errorf("failed to create paste file: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(text); err != nil {
+		return "", fmt.Errorf("failed to write paste file: %w", err)
+	}
+	return f.Name(), nil
+}
+
+// send sends message as the next turn of the chat.
+func (s *session) send(message string) error {
+	opts := s.opts
+	opts.Attachments = append(append([]string{}, opts.Attachments...), s.attachments...)
+	s.attachments = nil
+	return conversation.SendTurn(&s.conv, message, opts, s.logger)
+}
+
+func (s *session) attach(path string) error {
+	if _, _, err := conversation.LoadAttachment(path); err != nil {
+		return err
+	}
+	s.attachments = append(s.attachments, path)
+	fmt.Fprintf(s.out, "Attached %s to the next message\n", path)
+	return nil
+}
+
+func (s *session) retry(string) error {
+	backup := s.conv
+	last, ok := conversation.PopTurn(&s.conv)
+	if !ok {
+		return fmt.Errorf("nothing to retry")
+	}
+	err := s.send(last.Message)
+	// Keep the old answer if no new one was received
+	if s.conv.Message == "" || len(s.conv.Turns) < len(backup.Turns) {
+		s.conv = backup
+	}
+	return err
+}
+
+func (s *session) model(name string) error {
+	if name == "default" {
+		name = ""
+	}
+	if name != "" {
+		providerName := s.opts.Provider
+		if providerName == "" {
+			providerName = conversation.DefaultProvider
+		}
+		if err := provider.Require(providerName, name, provider.FeatureModel); err != nil {
+			return err
+		}
+	}
+	s.opts.Model = name
+	if name == "" {
+		fmt.Fprintln(s.out, "Using the default model")
+	} else {
+		fmt.Fprintf(s.out, "Using model %s\n", name)
+	}
+	return nil
+}
+
+func (s *session) context(arg string) error {
+	switch {
+	case arg == "off":
+		s.opts.ContextFile = ""
+		s.opts.NoContext = true
+		fmt.Fprintln(s.out, "Sending no context")
+		return nil
+	case fileExists(arg):
+		s.opts.ContextFile = arg
+	default:
+		path, err := conversation.GetNamedContextPath(arg)
+		if err != nil {
+			return err
+		}
+		if !fileExists(path) {
+			return fmt.Errorf("no context file %s and no named context %s", arg, path)
+		}
+		s.opts.ContextFile = path
+	}
+	s.opts.NoContext = false
+	fmt.Fprintf(s.out, "Using context %s\n", s.opts.ContextFile)
+	return nil
+}
+
+func (s *session) title(title string) error {
+	s.conv.Title = title
+	if s.conv.ID == "" {
+		fmt.Fprintln(s.out, "The title is saved with the first message")
+		return nil
+	}
+	return conversation.SaveConversation(s.conv, s.logger)
+}
+
+func (s *session) fork(string) error {
+	if s.conv.Message == "" {
+		return fmt.Errorf("nothing to fork yet")
+	}
+	fork, err := conversation.Fork(s.conv, 0)
+	if err != nil {
+		return err
+	}
+	if s.opts.Ephemeral {
+		s.conv = fork
+		return nil
+	}
+	saved, err := conversation.SaveNewConversation(fork, s.logger)
+	if err != nil {
+		return fmt.Errorf("failed to save fork: %w", err)
+	}
+	fmt.Fprintf(s.out, "Forked %s as %s\n", s.conv.ID, saved.ID)
+	s.conv = saved
+	return nil
+}
+
+func (s *session) save(path string) error {
+	if err := conversation.CheckShareable(s.conv); err != nil {
+		return fmt.Errorf("%w; run 'asc visibility %s shareable' to export it", err, s.conv.ID)
+	}
+	if err := conversation.WriteTranscript(s.conv, path, ""); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "Wrote %s\n", path)
+	return nil
+}
+
+// fileExists reports whether path is an existing regular file.
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+func (s *session) help(string) error {
+	for _, c := range commands {
+		usage := c.name
+		if c.args != "" {
+			usage += " " + c.args
+		}
+		fmt.Fprintf(s.out, "  %-20s %s\n", usage, c.help)
+	}
+	fmt.Fprintln(s.out, s.keyHelp)
+	return nil
+}
+
+func (s *session) exit(string) error {
+	s.quit = true
+	return nil
+}
@@ -0,0 +1,179 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"asc/internal/config"
+	"asc/internal/crash"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// errQuit is returned by readLine when the user leaves the REPL.
+var errQuit = errors.New("quit")
+
+// input is what the user entered at the prompt.
+type input struct {
+	line string
+	// paste is text pasted with newlines or tabs, which is kept verbatim
+	// instead of being flattened into the line.
+	paste string
+	// pasteAsFile sends the paste as an attached file.
+	pasteAsFile bool
+}
+
+// inputModel reads a single line. Tab accepts the ghost suggestion shown
+// after the cursor, Ctrl-N/Ctrl-P cycle through matching suggestions and
+// Up/Down recall earlier prompts. Multi-line pastes are held aside and
+// shown as a size indicator; Ctrl-T toggles sending them as an attachment.
+type inputModel struct {
+	input   textinput.Model
+	history []string
+	// recall is the index into history being shown, len(history) when
+	// the user is editing a new line.
+	recall      int
+	draft       string
+	paste       string
+	pasteAsFile bool
+	// pasteLimit is the size from which pastes become attachments, 0 for
+	// never.
+	pasteLimit int
+	done       bool
+	quit       bool
+}
+
+func newInputModel(suggestions, history []string, pasteLimit int) inputModel {
+	ti := textinput.New()
+	colors := config.Colors()
+	ti.Prompt = lipgloss.NewStyle().Foreground(lipgloss.Color(colors.Accent)).Bold(true).Render("> ")
+	ti.Placeholder = "Ask anything, or /help"
+	ti.ShowSuggestions = true
+	ti.CompletionStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(colors.Muted))
+	ti.KeyMap.NextSuggestion = key.NewBinding(key.WithKeys("ctrl+n"))
+	ti.KeyMap.PrevSuggestion = key.NewBinding(key.WithKeys("ctrl+p"))
+	ti.SetSuggestions(suggestions)
+	ti.Focus()
+	return inputModel{input: ti, history: history, recall: len(history), pasteLimit: pasteLimit}
+}
+
+func (m inputModel) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+func (m inputModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		if msg.Paste && strings.ContainsAny(string(msg.Runes), "\n\t") {
+			text := strings.ReplaceAll(string(msg.Runes), "\r\n", "\n")
+			if m.paste != "" {
+				m.paste += "\n"
+			}
+			m.paste += text
+			if m.pasteLimit > 0 && len(m.paste) >= m.pasteLimit {
+				m.pasteAsFile = true
+			}
+			return m, nil
+		}
+		switch msg.Type {
+		case tea.KeyEnter:
+			m.done = true
+			return m, tea.Quit
+		case tea.KeyCtrlC:
+			m.quit = true
+			return m, tea.Quit
+		case tea.KeyCtrlD:
+			if m.input.Value() == "" {
+				m.quit = true
+				return m, tea.Quit
+			}
+		case tea.KeyCtrlT:
+			if m.paste != "" {
+				m.pasteAsFile = !m.pasteAsFile
+			}
+			return m, nil
+		case tea.KeyBackspace:
+			// Backspace on an empty line drops the paste
+			if m.input.Value() == "" && m.paste != "" {
+				m.paste, m.pasteAsFile = "", false
+				return m, nil
+			}
+		case tea.KeyUp:
+			if m.recall > 0 {
+				if m.recall == len(m.history) {
+					m.draft = m.input.Value()
+				}
+				m.recall--
+				m.input.SetValue(m.history[m.recall])
+				m.input.CursorEnd()
+			}
+			return m, nil
+		case tea.KeyDown:
+			if m.recall < len(m.history) {
+				m.recall++
+				if m.recall == len(m.history) {
+					m.input.SetValue(m.draft)
+				} else {
+					m.input.SetValue(m.history[m.recall])
+				}
+				m.input.CursorEnd()
+			}
+			return m, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+func (m inputModel) View() string {
+	if m.done || m.quit {
+		// Leave the submitted line on screen without the ghost text
+		view := m.input.Prompt + m.input.Value() + "\n"
+		if m.paste != "" && m.done {
+			view += m.pasteIndicator() + "\n"
+		}
+		return view
+	}
+	if m.paste == "" {
+		return m.input.View()
+	}
+	help := lipgloss.NewStyle().Foreground(lipgloss.Color(config.Colors().Muted)).
+		Render("Ctrl-T: toggle attachment, Backspace on an empty line: discard")
+	return m.input.View() + "\n" + m.pasteIndicator() + "  " + help
+}
+
+// pasteIndicator describes the held paste.
+func (m inputModel) pasteIndicator() string {
+	how := "sent after the line"
+	if m.pasteAsFile {
+		how = "sent as an attachment"
+	}
+	return fmt.Sprintf("[pasted %d lines, %s, %s]", strings.Count(m.paste, "\n")+1, formatSize(len(m.paste)), how)
+}
+
+// formatSize formats a size in bytes for the paste indicator.
+func formatSize(n int) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f KB", float64(n)/1024)
+}
+
+// readLine reads a line from the terminal. It returns errQuit when the user
+// pressed Ctrl-C, or Ctrl-D on an empty line.
+func readLine(suggestions, history []string, pasteLimit int) (input, error) {
+	final, err := crash.NewProgram(newInputModel(suggestions, history, pasteLimit)).Run()
+	if err != nil {
+		return input{}, err
+	}
+	m := final.(inputModel)
+	if m.quit {
+		return input{}, errQuit
+	}
+	return input{line: strings.TrimSpace(m.input.Value()), paste: m.paste, pasteAsFile: m.pasteAsFile}, nil
+}
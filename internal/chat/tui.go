@@ -0,0 +1,399 @@
+package chat
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"asc/internal/config"
+	"asc/internal/conversation"
+	"asc/internal/crash"
+	"asc/internal/history"
+	"asc/internal/style"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/log"
+)
+
+// inputHeight is the number of lines of the message box.
+const inputHeight = 3
+
+// tuiKeyHelp describes the keys of the chat screen for /help.
+const tuiKeyHelp = "  Enter sends, Alt-Enter or Ctrl-J starts a new line, PgUp/PgDn scroll,\n" +
+	"  Esc or Ctrl-C stops an answer, Ctrl-X exports the transcript, Ctrl-D quits."
+
+// lineMsg is a line of the answer being streamed.
+type lineMsg string
+
+// logMsg is a message of the logger, shown in the status line.
+type logMsg string
+
+// doneMsg is sent when a message or command has been handled.
+type doneMsg struct {
+	// output is what the command printed.
+	output string
+	err    error
+}
+
+// tuiModel is the chat screen: the thread in a viewport above a message
+// box. Messages are sent in the background and their answers rendered into
+// the viewport as they stream.
+type tuiModel struct {
+	s         *session
+	program   **crash.Program
+	glowStyle string
+	// renderer renders markdown for the current width.
+	renderer *style.Renderer
+	viewport viewport.Model
+	input    textarea.Model
+	// transcript is the rendered thread, rendered for width.
+	transcript string
+	width      int
+	// pending is the message being answered, and streamed the answer
+	// received so far.
+	pending  string
+	streamed []string
+	// busy is set while a message or command is handled; stop stops the
+	// answer being streamed.
+	busy   bool
+	stop   chan struct{}
+	status string
+	ready  bool
+	// exporting is set while the path of a transcript export is asked for
+	// in place of the message box, which keeps its draft.
+	exporting   bool
+	exportInput textinput.Model
+}
+
+// RunTUI starts the full-screen chat. Like Run, every message is sent with
+// the earlier turns as history and the thread is saved as a single
+// conversation, which is continued if conv has an ID.
+func RunTUI(conv conversation.Conversation, opts conversation.Options, logger *log.Logger) error {
+	glowStyle, err := style.GlowStyle(logger)
+	if err != nil {
+		return err
+	}
+
+	var program *crash.Program
+	// The screen belongs to the TUI, so log messages go to the status line
+	tuiLogger := logger.With()
+	tuiLogger.SetOutput(logWriter{&program})
+	tuiLogger.SetReportTimestamp(false)
+	tuiLogger.SetReportCaller(false)
+	opts.OnLine = func(line string) {
+		program.Send(lineMsg(line))
+	}
+	s := newSession(conv, opts, tuiLogger)
+	s.keyHelp = tuiKeyHelp
+
+	colors := config.Colors()
+	ta := textarea.New()
+	ta.Placeholder = "Ask anything, or /help"
+	ta.ShowLineNumbers = false
+	ta.Prompt = lipgloss.NewStyle().Foreground(lipgloss.Color(colors.Accent)).Render("┃ ")
+	ta.FocusedStyle.CursorLine = lipgloss.NewStyle()
+	ta.SetHeight(inputHeight)
+	ta.KeyMap.InsertNewline = key.NewBinding(key.WithKeys("alt+enter", "ctrl+j"))
+	ta.Focus()
+
+	m := tuiModel{s: s, program: &program, glowStyle: glowStyle, input: ta}
+	program = crash.NewProgram(m, tea.WithAltScreen(), tea.WithMouseCellMotion())
+	if _, err := program.Run(); err != nil {
+		return fmt.Errorf("failed to run chat: %w", err)
+	}
+	if s.conv.ID != "" {
+		fmt.Printf("Saved as conversation %s\n", s.conv.ID)
+	}
+	return nil
+}
+
+// logWriter sends what the logger writes to the program.
+type logWriter struct {
+	program **crash.Program
+}
+
+func (w logWriter) Write(p []byte) (int, error) {
+	(*w.program).Send(logMsg(strings.TrimSpace(string(p))))
+	return len(p), nil
+}
+
+func (m tuiModel) Init() tea.Cmd {
+	return textarea.Blink
+}
+
+func (m tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.input.SetWidth(msg.Width)
+		height := max(1, msg.Height-inputHeight-2)
+		if !m.ready {
+			m.viewport = viewport.New(msg.Width, height)
+			m.ready = true
+		} else {
+			m.viewport.Width, m.viewport.Height = msg.Width, height
+		}
+		// The thread is being changed while busy and rendered when done
+		if msg.Width != m.width {
+			m.width = msg.Width
+			renderer, err := style.NewRendererFor(m.glowStyle, m.width)
+			if err != nil {
+				m.status = "Error: " + err.Error()
+			}
+			m.renderer = renderer
+			if !m.busy {
+				m.renderTranscript()
+			}
+		}
+		m.refresh(true)
+		return m, nil
+
+	case lineMsg:
+		m.streamed = append(m.streamed, string(msg))
+		m.refresh(m.viewport.AtBottom())
+		return m, nil
+
+	case logMsg:
+		m.status = string(msg)
+		return m, nil
+
+	case doneMsg:
+		m.busy, m.stop = false, nil
+		m.pending, m.streamed = "", nil
+		m.renderTranscript()
+		if strings.TrimSpace(msg.output) != "" {
+			m.transcript += "\n" + strings.TrimRight(msg.output, "\n") + "\n"
+		}
+		m.refresh(true)
+		if msg.err != nil {
+			m.status = "Error: " + msg.err.Error()
+		}
+		if m.s.quit {
+			return m, tea.Quit
+		}
+		return m, nil
+
+	case tea.KeyMsg:
+		if m.exporting {
+			return m.updateExport(msg)
+		}
+		switch msg.Type {
+		case tea.KeyCtrlX:
+			return m.startExport()
+		case tea.KeyCtrlC, tea.KeyEsc:
+			if m.busy {
+				if m.stop != nil {
+					close(m.stop)
+					m.stop = nil
+				}
+				return m, nil
+			}
+			if msg.Type == tea.KeyCtrlC {
+				return m, tea.Quit
+			}
+			return m, nil
+		case tea.KeyCtrlD:
+			if !m.busy && m.input.Value() == "" {
+				return m, tea.Quit
+			}
+		case tea.KeyPgUp:
+			m.viewport.PageUp()
+			return m, nil
+		case tea.KeyPgDown:
+			m.viewport.PageDown()
+			return m, nil
+		case tea.KeyEnter:
+			if msg.Alt {
+				break
+			}
+			if m.busy {
+				return m, nil
+			}
+			return m.submit()
+		}
+
+	case tea.MouseMsg:
+		var cmd tea.Cmd
+		m.viewport, cmd = m.viewport.Update(msg)
+		return m, cmd
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+// submit sends the message in the box, or runs it if it is a command.
+func (m tuiModel) submit() (tea.Model, tea.Cmd) {
+	text := strings.TrimSpace(m.input.Value())
+	if text == "" {
+		return m, nil
+	}
+	m.input.Reset()
+	m.busy = true
+	m.status = ""
+	s := m.s
+
+	if strings.HasPrefix(text, "/") && !strings.Contains(text, "\n") {
+		if text == "/retry" && s.conv.Message != "" {
+			exchanges := s.conv.Exchanges()
+			m.stop = make(chan struct{})
+			s.opts.Interrupt = m.stop
+			m.pending = exchanges[len(exchanges)-1].Message
+			m.refresh(true)
+		}
+		return m, func() tea.Msg {
+			var out bytes.Buffer
+			s.out = &out
+			err := s.runCommand(text)
+			return doneMsg{output: out.String(), err: err}
+		}
+	}
+
+	m.stop = make(chan struct{})
+	s.opts.Interrupt = m.stop
+	m.pending = text
+	m.streamed = nil
+	m.refresh(true)
+	return m, func() tea.Msg {
+		if err := history.Add(text); err != nil {
+			s.logger.Warn("Failed to record prompt history", "error", err)
+		}
+		var out bytes.Buffer
+		s.out = &out
+		err := s.send(text)
+		return doneMsg{output: out.String(), err: err}
+	}
+}
+
+// startExport asks for the file to write the transcript to, suggesting a
+// Markdown file named after the conversation.
+func (m tuiModel) startExport() (tea.Model, tea.Cmd) {
+	// The thread changes while a message is handled
+	if m.busy {
+		m.status = "Wait for the answer to export the transcript"
+		return m, nil
+	}
+	if m.s.conv.ID == "" {
+		m.status = "Nothing to export yet"
+		return m, nil
+	}
+	m.exportInput = textinput.New()
+	m.exportInput.Prompt = "Export to: "
+	m.exportInput.SetValue(fmt.Sprintf("conversation-%s.md", m.s.conv.ID))
+	m.exportInput.Focus()
+	m.exporting = true
+	m.status = "The extension picks the format (.md, .html or .json). Enter exports, Esc cancels"
+	return m, textinput.Blink
+}
+
+// updateExport handles key input while the export path is asked for.
+// The transcript is written with /save, so the chat goes on as before.
+func (m tuiModel) updateExport(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEsc, tea.KeyCtrlC:
+		m.exporting = false
+		m.status = ""
+		return m, nil
+	case tea.KeyEnter:
+		m.exporting = false
+		path := strings.TrimSpace(m.exportInput.Value())
+		if path == "" {
+			m.status = ""
+			return m, nil
+		}
+		var out bytes.Buffer
+		saved := m.s.out
+		m.s.out = &out
+		err := m.s.save(path)
+		m.s.out = saved
+		if err != nil {
+			m.status = "Error: " + err.Error()
+		} else {
+			m.status = strings.TrimSpace(out.String())
+		}
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.exportInput, cmd = m.exportInput.Update(msg)
+	return m, cmd
+}
+
+// InFlight returns the message being answered and the answer streamed so
+// far, for crash dumps.
+func (m tuiModel) InFlight() string {
+	if m.pending == "" {
+		return ""
+	}
+	return "User: " + m.pending + "\n\nAI: " + strings.Join(m.streamed, "\n")
+}
+
+// renderTranscript renders the thread for the current width.
+func (m *tuiModel) renderTranscript() {
+	if m.s.conv.Message == "" {
+		m.transcript = lipgloss.NewStyle().Foreground(lipgloss.Color(config.Colors().Muted)).
+			Render("New conversation. Type /help for commands, Ctrl-D to quit.") + "\n"
+		return
+	}
+	m.transcript = m.render(conversation.FormatConversation(m.s.conv))
+}
+
+// render renders markdown, or returns it as is if that fails.
+func (m *tuiModel) render(markdown string) string {
+	if m.renderer == nil {
+		return markdown
+	}
+	rendered, err := m.renderer.Render(markdown)
+	if err != nil {
+		m.status = "Error: " + err.Error()
+		return markdown
+	}
+	return rendered
+}
+
+// refresh updates the viewport with the thread and the answer being
+// streamed, scrolling to the bottom if follow is set.
+func (m *tuiModel) refresh(follow bool) {
+	if !m.ready {
+		return
+	}
+	content := m.transcript
+	if m.pending != "" {
+		content += m.render(fmt.Sprintf("## User\n%s\n\n## AI\n%s", m.pending, strings.Join(m.streamed, "\n")))
+	}
+	m.viewport.SetContent(content)
+	if follow {
+		m.viewport.GotoBottom()
+	}
+}
+
+func (m tuiModel) View() string {
+	if !m.ready {
+		return ""
+	}
+	colors := config.Colors()
+	status := m.status
+	if status == "" {
+		if m.busy {
+			status = "Answering… Esc stops"
+		} else if m.s.conv.ID != "" {
+			status = "Conversation " + m.s.conv.ID
+		}
+	}
+	statusLine := lipgloss.NewStyle().
+		Foreground(lipgloss.Color(colors.Muted)).
+		Border(lipgloss.NormalBorder(), true, false, false, false).
+		BorderForeground(lipgloss.Color(colors.Border)).
+		Width(m.width).
+		MaxHeight(2).
+		Render(status)
+	input := m.input.View()
+	if m.exporting {
+		input = m.exportInput.View()
+	}
+	return m.viewport.View() + "\n" + statusLine + "\n" + input
+}
@@ -0,0 +1,46 @@
+package clipboard
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// readers are the commands that print the clipboard, in order of
+// preference.
+var readers = [][]string{
+	{"pbpaste"},
+	{"wl-paste", "--no-newline"},
+	{"xclip", "-selection", "clipboard", "-o"},
+	{"xsel", "--clipboard", "--output"},
+}
+
+// readCommand returns the first available clipboard reader.
+func readCommand() ([]string, error) {
+	for _, reader := range readers {
+		if reader[0] == "wl-paste" && os.Getenv("WAYLAND_DISPLAY") == "" {
+			continue
+		}
+		if reader[0] == "pbpaste" && runtime.GOOS != "darwin" {
+			continue
+		}
+		if _, err := exec.LookPath(reader[0]); err == nil {
+			return reader, nil
+		}
+	}
+	return nil, fmt.Errorf("no clipboard command found (install wl-clipboard, xclip or xsel)")
+}
+
+// Read returns the text on the clipboard.
+func Read() (string, error) {
+	reader, err := readCommand()
+	if err != nil {
+		return "", err
+	}
+	out, err := exec.Command(reader[0], reader[1:]...).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read clipboard with %s: %w", reader[0], err)
+	}
+	return string(out), nil
+}
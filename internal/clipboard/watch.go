@@ -0,0 +1,157 @@
+package clipboard
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"golang.org/x/term"
+)
+
+// Template turns copied text into a prompt.
+type Template struct {
+	// Key is the key that selects the template when asked.
+	Key    byte
+	Prompt string
+}
+
+// Templates are the prompts offered for copied text, by name. The prompt
+// of translate depends on the answer language, see TemplatePrompt.
+var Templates = map[string]Template{
+	"explain":   {Key: 'e', Prompt: "Explain the following:\n\n"},
+	"translate": {Key: 't', Prompt: "Translate the following into English:\n\n"},
+	"summarize": {Key: 's', Prompt: "Summarize the following:\n\n"},
+}
+
+// TemplatePrompt returns the prompt of the template name. With a language,
+// e.g. the one of --language, translate turns text into it, or into
+// English when the text already is in it.
+func TemplatePrompt(name, language string) string {
+	if name == "translate" && language != "" && !strings.EqualFold(language, "English") {
+		return fmt.Sprintf("Translate the following into %s, or into English if it is already in %s:\n\n", language, language)
+	}
+	return Templates[name].Prompt
+}
+
+// TemplateNames lists the template names in a stable order.
+func TemplateNames() []string {
+	var names []string
+	for name := range Templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Watch polls the clipboard every interval and asks which template to use
+// whenever new text is copied. Enter picks defaultTemplate, if set. The
+// name of the chosen template and its prompt for language are passed to
+// send. Watch returns when the user presses q or Ctrl-C at the question.
+// Failures to read the clipboard count as no new text, since the readers
+// fail on an empty clipboard.
+func Watch(interval time.Duration, defaultTemplate, language string, send func(template, prompt string) error, logger *log.Logger) error {
+	if defaultTemplate != "" {
+		if _, ok := Templates[defaultTemplate]; !ok {
+			return fmt.Errorf("unknown template %q (available: %s)", defaultTemplate, strings.Join(TemplateNames(), ", "))
+		}
+	}
+	if _, err := readCommand(); err != nil {
+		return err
+	}
+
+	// Only react to text copied after starting
+	last, err := Read()
+	if err != nil {
+		logger.Debug("Clipboard not read", "error", err)
+	}
+	fmt.Fprintln(os.Stderr, "Watching the clipboard, copy some text... (Ctrl-C to quit)")
+	for {
+		time.Sleep(interval)
+		text, err := Read()
+		if err != nil {
+			logger.Debug("Clipboard not read", "error", err)
+			continue
+		}
+		if text == last || strings.TrimSpace(text) == "" {
+			continue
+		}
+		last = text
+
+		name, quit, err := askTemplate(text, defaultTemplate)
+		if err != nil {
+			return err
+		}
+		if quit {
+			return nil
+		}
+		if name == "" {
+			continue
+		}
+		logger.Debug("Sending clipboard", "template", name, "length", len(text))
+		if err := send(name, TemplatePrompt(name, language)+text); err != nil {
+			logger.Error("Failed to send clipboard", "error", err)
+		}
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+// askTemplate asks which template to apply to text and returns its name,
+// or "" to skip the text.
+func askTemplate(text, defaultTemplate string) (string, bool, error) {
+	preview := strings.Join(strings.Fields(text), " ")
+	if len([]rune(preview)) > 60 {
+		preview = string([]rune(preview)[:60]) + "…"
+	}
+	var choices []string
+	for _, name := range TemplateNames() {
+		key := string(Templates[name].Key)
+		if name == defaultTemplate {
+			// Enter picks the default, shown in upper case
+			key = strings.ToUpper(key)
+		}
+		choices = append(choices, fmt.Sprintf("[%s]%s", key, name[1:]))
+	}
+	fmt.Fprintf(os.Stderr, "\nCopied %q\n%s, [i]gnore, [q]uit? ", preview, strings.Join(choices, " "))
+
+	key, err := readKey()
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", false, err
+	}
+	switch key {
+	case 'q', 3: // Ctrl-C
+		return "", true, nil
+	case '\r', '\n':
+		return defaultTemplate, false, nil
+	}
+	for _, name := range TemplateNames() {
+		if Templates[name].Key == key {
+			return name, false, nil
+		}
+	}
+	return "", false, nil
+}
+
+// readKey reads a single key press from the terminal.
+func readKey() (byte, error) {
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return 0, fmt.Errorf("failed to open terminal: %w", err)
+	}
+	defer tty.Close()
+
+	state, err := term.MakeRaw(int(tty.Fd()))
+	if err != nil {
+		return 0, fmt.Errorf("failed to set terminal to raw mode: %w", err)
+	}
+	defer term.Restore(int(tty.Fd()), state)
+
+	var buf [1]byte
+	if _, err := tty.Read(buf[:]); err != nil {
+		return 0, fmt.Errorf("failed to read key: %w", err)
+	}
+	return buf[0], nil
+}
@@ -0,0 +1,756 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"asc/internal/timeutil"
+
+	"github.com/BurntSushi/toml"
+	"github.com/charmbracelet/log"
+)
+
+// Config is the user configuration read from config.toml.
+// Every field is optional; the zero value means "use the built-in default".
+type Config struct {
+	// Provider is the default AI provider: "sgpt", "perplexity" or "ollama".
+	Provider string `toml:"provider"`
+	// Model is the default model of the default provider; --model and
+	// matching routes take precedence.
+	Model string `toml:"model"`
+	// Language is the language answers are requested in, e.g. "Japanese".
+	Language string `toml:"language"`
+	// HistoryTokens is how many tokens of earlier turns are sent with a
+	// follow-up at most; 0 derives it from the context window of the model.
+	HistoryTokens int `toml:"history_tokens"`
+	// ModelsURL is where `asc models update` fetches the model registry.
+	ModelsURL string `toml:"models_url"`
+	// Storage is where conversations are kept: "json" (one file per
+	// conversation, the default) or "sqlite" (a single database).
+	Storage string `toml:"storage"`
+	// StreamInterval coalesces the lines of streamed answers and prints
+	// them at most this often, e.g. "250ms" over slow SSH links; 0 prints
+	// every line as it arrives.
+	StreamInterval time.Duration `toml:"stream_interval"`
+	// Minimal selects the minimal streaming of --minimal: "auto" (the
+	// default) over SSH links with a slow round trip, "always" or "never".
+	Minimal string `toml:"minimal"`
+	// A11y turns on the accessibility mode of --a11y.
+	A11y bool `toml:"a11y"`
+	// Editor overrides $EDITOR for asc.
+	Editor string `toml:"editor"`
+	// Pager overrides $PAGER for asc, e.g. "less -SR".
+	Pager string `toml:"pager"`
+	// AutoRetryOnRefusal retries refused answers without asking.
+	AutoRetryOnRefusal bool `toml:"auto_retry_on_refusal"`
+	// Normalize fixes obvious typos and whitespace in prompts before they
+	// are sent, as --normalize does.
+	Normalize bool `toml:"normalize"`
+	// Style is the markdown style: "auto", a built-in or an installed style.
+	Style string `toml:"style"`
+	// Background overrides terminal background detection: "auto", "dark" or "light".
+	Background string `toml:"background"`
+	// Command holds per-command flag defaults from [command.<name>]
+	// sections, keyed by the command path after "asc" (e.g. "new" or
+	// "bundle export") and the flag name.
+	Command map[string]map[string]any `toml:"command"`
+	// Routes pick the model for requests without an explicit one. They are
+	// tried in order and the first matching route wins.
+	Routes []Route `toml:"route"`
+	// DumpDir is where raw provider requests and responses are written for
+	// troubleshooting; empty disables dumping.
+	DumpDir string `toml:"dump_dir"`
+	// DumpRetentionDays is how long dumps are kept (default 7).
+	DumpRetentionDays int `toml:"dump_retention_days"`
+	// Perplexity holds the default search options of perplexity.
+	Perplexity Perplexity `toml:"perplexity"`
+	// UI holds the colors of the interactive screens.
+	UI UI `toml:"ui"`
+	// Chat holds the settings of asc chat.
+	Chat Chat `toml:"chat"`
+	// Ollama holds the settings of the ollama provider.
+	Ollama Ollama `toml:"ollama"`
+	// Stdin holds how text piped to asc is added to messages.
+	Stdin Stdin `toml:"stdin"`
+	// Paging holds when long answers are shown in a pager.
+	Paging Paging `toml:"paging"`
+	// Sandbox limits the commands asc do runs.
+	Sandbox Sandbox `toml:"sandbox"`
+	// Prune holds which conversations asc prune deletes.
+	Prune Prune `toml:"prune"`
+	// Titles holds how new conversations are titled.
+	Titles Titles `toml:"titles"`
+	// Pricing overrides the prices of the model registry, keyed by model
+	// name, for the cost estimates of asc cost.
+	Pricing map[string]Price `toml:"pricing"`
+	// Profiles are named sets of settings selected with --profile or
+	// `asc profile use`, keyed by name.
+	Profiles map[string]Profile `toml:"profile"`
+	// DefaultProfile is the profile used without --profile.
+	DefaultProfile string `toml:"default_profile"`
+	// ActiveProfile is the name of the applied profile, if any.
+	ActiveProfile string `toml:"-"`
+
+	// UsePerplexity is deprecated in favor of Provider = "perplexity".
+	UsePerplexity bool `toml:"use_perplexity"`
+}
+
+// Perplexity is the [perplexity] section of the config file.
+type Perplexity struct {
+	// Citation lists the sources under answers; unset means true.
+	Citation *bool `toml:"citation"`
+	// Focus restricts the search, e.g. to "scholar" or "youtube".
+	Focus string `toml:"focus"`
+	// Recency only searches recent pages: hour, day, week, month or year.
+	Recency string `toml:"recency"`
+}
+
+// UI is the [ui] section of the config file. Colors are ANSI 256-color
+// numbers such as "57" or hex values such as "#5f00ff"; empty keeps the
+// default.
+type UI struct {
+	Border             string `toml:"border"`
+	SelectedForeground string `toml:"selected_foreground"`
+	SelectedBackground string `toml:"selected_background"`
+	// Accent colors the chat prompt.
+	Accent string `toml:"accent"`
+	// Muted colors secondary text such as input suggestions.
+	Muted string `toml:"muted"`
+}
+
+// Chat is the [chat] section of the config file.
+type Chat struct {
+	// PasteAttachmentSize is the size in bytes from which multi-line
+	// pastes are sent as attached files; 0 never does so automatically.
+	PasteAttachmentSize int `toml:"paste_attachment_size"`
+}
+
+// Ollama is the [ollama] section of the config file.
+type Ollama struct {
+	// KeepAlive is how long the server keeps a model loaded after a
+	// request, e.g. "30m", or a number of seconds where -1 keeps it until
+	// the server stops; empty uses the server default of 5 minutes.
+	KeepAlive string `toml:"keep_alive"`
+}
+
+// Stdin is the [stdin] section of the config file.
+type Stdin struct {
+	// MaxSize is the most piped input attached to a message, in bytes;
+	// longer input is cut. 0 means 100000.
+	MaxSize int `toml:"max_size"`
+	// Fence wraps piped input in a fenced code block; unset means true.
+	Fence *bool `toml:"fence"`
+}
+
+// Paging is the [paging] section of the config file.
+type Paging struct {
+	// Lines is the length of an answer, in lines, from which it is shown
+	// in a pager once complete instead of being left in the scrollback;
+	// only that many lines are printed while it streams. 0 never pages.
+	Lines int `toml:"lines"`
+	// Viewer is "pager" for the pager key or $PAGER (the default), or
+	// "builtin" for the full-screen viewer of asc.
+	Viewer string `toml:"viewer"`
+}
+
+// Sandbox is the [sandbox] section of the config file, also allowed in
+// profiles. The limits are checked before a command is run.
+type Sandbox struct {
+	// Allow lists the programs commands may run, by name or absolute path;
+	// empty allows any.
+	Allow []string `toml:"allow"`
+	// ReadOnly lists paths that commands cannot change.
+	ReadOnly []string `toml:"read_only"`
+	// NoNetwork runs commands without network access.
+	NoNetwork bool `toml:"no_network"`
+}
+
+// Enabled reports whether the sandbox limits anything.
+func (s Sandbox) Enabled() bool {
+	return len(s.Allow) > 0 || len(s.ReadOnly) > 0 || s.NoNetwork
+}
+
+// Prune is the [prune] section of the config file.
+type Prune struct {
+	// OlderThan deletes conversations without activity for this long,
+	// e.g. "90d".
+	OlderThan string `toml:"older_than"`
+	// Keep deletes all but this many most recently active conversations.
+	Keep int `toml:"keep"`
+	// Auto prunes once a day when a conversation is saved.
+	Auto bool `toml:"auto"`
+}
+
+// Titles is the [titles] section of the config file.
+type Titles struct {
+	// Auto asks for a title of each new conversation once it is saved;
+	// unset means true.
+	Auto *bool `toml:"auto"`
+	// Provider and Model answer the title requests, e.g. a cheap model;
+	// empty uses the provider of the conversation and its default model.
+	Provider string `toml:"provider"`
+	Model    string `toml:"model"`
+}
+
+// Price is a [pricing.<model>] section of the config file, in USD per
+// million tokens.
+type Price struct {
+	Input  float64 `toml:"input"`
+	Output float64 `toml:"output"`
+}
+
+// defaultUI holds the built-in colors.
+var defaultUI = UI{
+	Border:             "240",
+	SelectedForeground: "229",
+	SelectedBackground: "57",
+	Accent:             "205",
+	Muted:              "240",
+}
+
+// Recencies lists the values of the perplexity recency filter.
+var Recencies = []string{"hour", "day", "week", "month", "year"}
+
+// Route is a [[route]] of the config file. A route matches a request when
+// all of its conditions hold; conditions that are not set always hold.
+type Route struct {
+	Name string `toml:"name"`
+	// MaxChars and MinChars bound the length of the message in characters.
+	MaxChars int `toml:"max_chars"`
+	MinChars int `toml:"min_chars"`
+	// ContainsCode matches messages with code blocks or attached files.
+	ContainsCode bool `toml:"contains_code"`
+	// Pattern is a regular expression the message must match.
+	Pattern string `toml:"pattern"`
+	// Quality matches the --quality of the request: low, normal or high.
+	Quality string `toml:"quality"`
+	// Provider and Model are used when the route matches. An empty
+	// provider keeps the selected one.
+	Provider string `toml:"provider"`
+	Model    string `toml:"model"`
+}
+
+// deprecatedKeys maps deprecated keys to a hint on what to use instead.
+var deprecatedKeys = map[string]string{
+	"use_perplexity": `use provider = "perplexity" instead`,
+}
+
+// allowedValues restricts string keys to a fixed set of values.
+var allowedValues = map[string][]string{
+	"provider":   {"sgpt", "perplexity", "ollama"},
+	"background": {"auto", "dark", "light"},
+	"storage":    {"json", "sqlite"},
+	"minimal":    {"auto", "always", "never"},
+
+	"paging.viewer": {"pager", "builtin"},
+
+	"perplexity.recency": Recencies,
+}
+
+var current *Config
+
+// decodeErrorPattern matches the decode errors of the toml package, which
+// are not ParseErrors but mention the line and key in the message.
+var decodeErrorPattern = regexp.MustCompile(`^toml: line (\d+) \(last key "([^"]*)"\): (.*)$`)
+
+// GetConfigPath returns the path of the config file.
+// It follows the XDG Base Directory Specification:
+// - Uses XDG_CONFIG_HOME if set
+// - Falls back to $HOME/.config
+func GetConfigPath() (string, error) {
+	if xdgConfigHome := os.Getenv("XDG_CONFIG_HOME"); xdgConfigHome != "" {
+		return filepath.Join(xdgConfigHome, "asc", "config.toml"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "asc", "config.toml"), nil
+}
+
+// Load reads the config file. A missing file yields the default config.
+// Unknown keys are ignored here; `asc config doctor` reports them.
+func Load() (*Config, error) {
+	cfg := &Config{}
+	path, err := GetConfigPath()
+	if err != nil {
+		return cfg, err
+	}
+
+	if _, err := toml.DecodeFile(path, cfg); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			log.Debug("No config file", "path", path)
+			current = cfg
+			return cfg, nil
+		}
+		return &Config{}, fmt.Errorf("failed to load %s: %w", path, err)
+	}
+
+	if cfg.UsePerplexity && cfg.Provider == "" {
+		cfg.Provider = "perplexity"
+	}
+	log.Debug("Loaded config", "path", path)
+	current = cfg
+	return cfg, nil
+}
+
+// Current returns the loaded config, or the defaults if Load has not
+// succeeded.
+func Current() *Config {
+	if current == nil {
+		return &Config{}
+	}
+	return current
+}
+
+// GetEditor returns the editor to use: the configured one, then $EDITOR.
+func GetEditor() string {
+	if editor := Current().Editor; editor != "" {
+		return editor
+	}
+	return os.Getenv("EDITOR")
+}
+
+// GetPager returns the pager command line: the configured one, then
+// $PAGER, then less.
+func GetPager() []string {
+	for _, pager := range []string{Current().Pager, os.Getenv("PAGER")} {
+		if fields := strings.Fields(pager); len(fields) > 0 {
+			return fields
+		}
+	}
+	return []string{"less", "-SR"}
+}
+
+// Colors returns the configured UI colors with defaults for unset ones.
+func Colors() UI {
+	ui := Current().UI
+	for _, c := range []struct {
+		value    *string
+		fallback string
+	}{
+		{&ui.Border, defaultUI.Border},
+		{&ui.SelectedForeground, defaultUI.SelectedForeground},
+		{&ui.SelectedBackground, defaultUI.SelectedBackground},
+		{&ui.Accent, defaultUI.Accent},
+		{&ui.Muted, defaultUI.Muted},
+	} {
+		if *c.value == "" {
+			*c.value = c.fallback
+		}
+	}
+	return ui
+}
+
+// Problem is an issue found while validating the config file.
+type Problem struct {
+	Line     int
+	Key      string
+	Severity string // "error" or "warning"
+	Message  string
+}
+
+// String formats the problem as "LINE: SEVERITY: KEY: MESSAGE", omitting
+// the parts that are unknown.
+func (p Problem) String() string {
+	var b strings.Builder
+	if p.Line > 0 {
+		fmt.Fprintf(&b, "%d: ", p.Line)
+	}
+	fmt.Fprintf(&b, "%s: ", p.Severity)
+	if p.Key != "" {
+		fmt.Fprintf(&b, "%s: ", p.Key)
+	}
+	b.WriteString(p.Message)
+	return b.String()
+}
+
+// Check validates the config file at path against the schema and returns
+// every problem found: syntax and type errors, unknown keys (with a
+// suggestion for likely typos), invalid values and deprecated options.
+func Check(path string) ([]Problem, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	md, err := toml.Decode(string(data), &cfg)
+	if err != nil {
+		var parseErr toml.ParseError
+		if errors.As(err, &parseErr) {
+			return []Problem{{
+				Line:     parseErr.Position.Line,
+				Key:      parseErr.LastKey,
+				Severity: "error",
+				Message:  parseErr.Message,
+			}}, nil
+		}
+		// Type mismatches are plain errors carrying the position in the text
+		if m := decodeErrorPattern.FindStringSubmatch(err.Error()); m != nil {
+			line, _ := strconv.Atoi(m[1])
+			return []Problem{{Line: line, Key: m[2], Severity: "error", Message: m[3]}}, nil
+		}
+		return []Problem{{Severity: "error", Message: err.Error()}}, nil
+	}
+
+	lines := strings.Split(string(data), "\n")
+	known := knownKeys(reflect.TypeOf(Config{}), "")
+	var problems []Problem
+
+	for _, key := range md.Undecoded() {
+		name := key.String()
+		if isUnderMapKey(name, known) {
+			continue
+		}
+		message := "unknown key"
+		if suggestion := closestKey(name, known); suggestion != "" {
+			message = fmt.Sprintf("unknown key, did you mean %q?", suggestion)
+		}
+		problems = append(problems, Problem{Line: findKeyLine(lines, key), Key: name, Severity: "error", Message: message})
+	}
+
+	for _, key := range md.Keys() {
+		name := key.String()
+		if hint, ok := deprecatedKeys[name]; ok {
+			problems = append(problems, Problem{Line: findKeyLine(lines, key), Key: name, Severity: "warning", Message: "deprecated, " + hint})
+		}
+	}
+
+	for name, values := range allowedValues {
+		value := stringField(&cfg, name)
+		if value == "" {
+			continue
+		}
+		if !containsValue(values, value) {
+			problems = append(problems, Problem{
+				Line:     findKeyLine(lines, toml.Key(strings.Split(name, "."))),
+				Key:      name,
+				Severity: "error",
+				Message:  fmt.Sprintf("invalid value %q, expected one of %s", value, strings.Join(values, ", ")),
+			})
+		}
+	}
+
+	problems = append(problems, checkRoutes(cfg.Routes, lines)...)
+	problems = append(problems, checkColors(cfg.UI, lines)...)
+	problems = append(problems, checkKeepAlive(cfg.Ollama.KeepAlive, lines)...)
+	problems = append(problems, checkPrune(cfg.Prune, lines)...)
+	problems = append(problems, checkProfiles(cfg, lines)...)
+
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Line < problems[j].Line })
+	return problems, nil
+}
+
+// Qualities lists the values of --quality and of the quality of a route.
+var Qualities = []string{"low", "normal", "high"}
+
+// checkRoutes validates the values of the [[route]] tables.
+func checkRoutes(routes []Route, lines []string) []Problem {
+	var problems []Problem
+	for i, route := range routes {
+		invalid := func(key, message string) {
+			problems = append(problems, Problem{
+				Line:     findArrayKeyLine(lines, "route", i, key),
+				Key:      fmt.Sprintf("route[%d].%s", i, key),
+				Severity: "error",
+				Message:  message,
+			})
+		}
+		if route.Quality != "" && !containsValue(Qualities, route.Quality) {
+			invalid("quality", fmt.Sprintf("invalid value %q, expected one of %s", route.Quality, strings.Join(Qualities, ", ")))
+		}
+		if route.Provider != "" && !containsValue(allowedValues["provider"], route.Provider) {
+			invalid("provider", fmt.Sprintf("invalid value %q, expected one of %s", route.Provider, strings.Join(allowedValues["provider"], ", ")))
+		}
+		if route.Pattern != "" {
+			if _, err := regexp.Compile(route.Pattern); err != nil {
+				invalid("pattern", fmt.Sprintf("invalid regular expression: %v", err))
+			}
+		}
+		if route.Model == "" && route.Provider == "" {
+			invalid("model", "route sets neither model nor provider")
+		}
+	}
+	return problems
+}
+
+// checkKeepAlive validates [ollama] keep_alive, a duration or a number of
+// seconds.
+func checkKeepAlive(value string, lines []string) []Problem {
+	if value == "" {
+		return nil
+	}
+	if _, err := strconv.Atoi(value); err == nil {
+		return nil
+	}
+	if _, err := time.ParseDuration(value); err == nil {
+		return nil
+	}
+	key := toml.Key{"ollama", "keep_alive"}
+	return []Problem{{
+		Line:     findKeyLine(lines, key),
+		Key:      key.String(),
+		Severity: "error",
+		Message:  fmt.Sprintf("invalid value %q, expected a duration such as 30m or a number of seconds", value),
+	}}
+}
+
+// checkPrune validates [prune] older_than, a duration such as 90d.
+func checkPrune(prune Prune, lines []string) []Problem {
+	if prune.OlderThan == "" {
+		return nil
+	}
+	if _, err := timeutil.ParseDuration(prune.OlderThan); err == nil {
+		return nil
+	}
+	key := toml.Key{"prune", "older_than"}
+	return []Problem{{
+		Line:     findKeyLine(lines, key),
+		Key:      key.String(),
+		Severity: "error",
+		Message:  fmt.Sprintf("invalid value %q, expected a duration such as 90d or 12w", prune.OlderThan),
+	}}
+}
+
+// colorPattern matches the color values lipgloss understands.
+var colorPattern = regexp.MustCompile(`^(\d{1,3}|#[0-9a-fA-F]{6}|#[0-9a-fA-F]{3})$`)
+
+// checkColors validates the values of the [ui] section.
+func checkColors(ui UI, lines []string) []Problem {
+	var problems []Problem
+	v := reflect.ValueOf(ui)
+	for i := 0; i < v.NumField(); i++ {
+		value := v.Field(i).String()
+		if n, err := strconv.Atoi(value); value == "" || colorPattern.MatchString(value) && (err != nil || n <= 255) {
+			continue
+		}
+		key := toml.Key{"ui", v.Type().Field(i).Tag.Get("toml")}
+		problems = append(problems, Problem{
+			Line:     findKeyLine(lines, key),
+			Key:      key.String(),
+			Severity: "error",
+			Message:  fmt.Sprintf("invalid color %q, expected a number from 0 to 255 or #rrggbb", value),
+		})
+	}
+	return problems
+}
+
+// findArrayKeyLine returns the 1-based line of key in the index-th (0-based)
+// [[table]] of an array of tables, or 0 if it cannot be located.
+func findArrayKeyLine(lines []string, table string, index int, key string) int {
+	count := -1
+	inTable := false
+	header := 0
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			inTable = false
+			if strings.Trim(line, "[] ") == table && strings.HasPrefix(line, "[[") {
+				count++
+				if count == index {
+					inTable = true
+					header = i + 1
+				}
+			}
+			continue
+		}
+		if !inTable {
+			continue
+		}
+		if name, _, ok := strings.Cut(line, "="); ok && strings.TrimSpace(name) == key {
+			return i + 1
+		}
+	}
+	return header
+}
+
+// knownKeys lists the dotted TOML keys of t. Map-typed fields are recorded
+// with a trailing ".*" since their children are free-form.
+func knownKeys(t reflect.Type, prefix string) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("toml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + name
+		keys = append(keys, key)
+		switch field.Type.Kind() {
+		case reflect.Struct:
+			keys = append(keys, knownKeys(field.Type, key+".")...)
+		case reflect.Map:
+			keys = append(keys, key+".*")
+		case reflect.Slice:
+			if field.Type.Elem().Kind() == reflect.Struct {
+				keys = append(keys, knownKeys(field.Type.Elem(), key+".")...)
+			}
+		}
+	}
+	return keys
+}
+
+// isUnderMapKey reports whether name lives below a free-form map key.
+func isUnderMapKey(name string, known []string) bool {
+	for _, key := range known {
+		if prefix, ok := strings.CutSuffix(key, ".*"); ok && strings.HasPrefix(name, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// closestKey returns the known key most similar to name, if any is close.
+func closestKey(name string, known []string) string {
+	best, bestDistance := "", 3
+	for _, key := range known {
+		if strings.HasSuffix(key, ".*") {
+			continue
+		}
+		if d := levenshtein(name, key); d < bestDistance {
+			best, bestDistance = key, d
+		}
+	}
+	return best
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// CheckCommands reports the [command.<name>] sections of the config file
+// at path that validate rejects, typically because the command or flag
+// does not exist.
+func CheckCommands(path string, validate func(command, flag string) error) ([]Problem, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if _, err := toml.Decode(string(data), &cfg); err != nil {
+		// Syntax errors are reported by Check
+		return nil, nil
+	}
+
+	lines := strings.Split(string(data), "\n")
+	var problems []Problem
+	commands := make([]string, 0, len(cfg.Command))
+	for command := range cfg.Command {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+	for _, command := range commands {
+		flags := make([]string, 0, len(cfg.Command[command]))
+		for flag := range cfg.Command[command] {
+			flags = append(flags, flag)
+		}
+		sort.Strings(flags)
+		for _, flag := range flags {
+			if err := validate(command, flag); err != nil {
+				key := toml.Key{"command", command, flag}
+				problems = append(problems, Problem{Line: findKeyLine(lines, key), Key: key.String(), Severity: "error", Message: err.Error()})
+			}
+		}
+	}
+	return problems, nil
+}
+
+// FlagValues converts a value from a [command.<name>] section into the
+// strings to pass to the flag. Arrays yield one string per element, for
+// repeatable flags.
+func FlagValues(value any) []string {
+	if values, ok := value.([]any); ok {
+		var result []string
+		for _, v := range values {
+			result = append(result, fmt.Sprint(v))
+		}
+		return result
+	}
+	return []string{fmt.Sprint(value)}
+}
+
+// findKeyLine returns the 1-based line on which key is defined, tracking
+// [table] headers so nested keys are found in the right section. It
+// returns 0 if the key cannot be located.
+func findKeyLine(lines []string, key toml.Key) int {
+	table := ""
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			table = strings.Trim(line, "[] ")
+			if table == key.String() {
+				return i + 1
+			}
+			continue
+		}
+		name, _, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		full := strings.Trim(strings.TrimSpace(name), `"`)
+		if table != "" {
+			full = table + "." + full
+		}
+		if full == key.String() {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// stringField returns the string value of the field tagged with the dotted
+// key name, or "" if there is none.
+func stringField(cfg *Config, name string) string {
+	v := reflect.ValueOf(cfg).Elem()
+	for _, part := range strings.Split(name, ".") {
+		found := false
+		for i := 0; i < v.NumField(); i++ {
+			if strings.Split(v.Type().Field(i).Tag.Get("toml"), ",")[0] == part {
+				v = v.Field(i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return ""
+		}
+	}
+	if v.Kind() != reflect.String {
+		return ""
+	}
+	return v.String()
+}
+
+func containsValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// profileFile holds the profile selected with `asc profile use`, in the
+// share directory.
+const profileFile = "profile"
+
+// Profile is a [profile.<name>] section of the config file. Its settings
+// replace the top-level ones while the profile is active.
+type Profile struct {
+	Provider string `toml:"provider"`
+	Model    string `toml:"model"`
+	// Env sets environment variables for the providers, e.g.
+	// OPENAI_API_BASE to go through a gateway or OLLAMA_HOST.
+	Env map[string]string `toml:"env"`
+	// Sandbox replaces the [sandbox] section, e.g. to be stricter at work.
+	Sandbox *Sandbox `toml:"sandbox"`
+}
+
+// ProfileNames returns the names of the configured profiles, sorted.
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ApplyProfile activates the profile called name.
+func (c *Config) ApplyProfile(name string) error {
+	profile, ok := c.Profiles[name]
+	if !ok {
+		known := strings.Join(c.ProfileNames(), ", ")
+		if known == "" {
+			known = "none configured"
+		}
+		return fmt.Errorf("unknown profile %q (known: %s)", name, known)
+	}
+	if profile.Provider != "" {
+		c.Provider = profile.Provider
+	}
+	if profile.Model != "" {
+		c.Model = profile.Model
+	}
+	if profile.Sandbox != nil {
+		c.Sandbox = *profile.Sandbox
+	}
+	for key, value := range profile.Env {
+		if err := os.Setenv(key, value); err != nil {
+			return fmt.Errorf("failed to set %s: %w", key, err)
+		}
+	}
+	c.ActiveProfile = name
+	return nil
+}
+
+// SelectedProfile returns the profile to use without --profile: the
+// default_profile key of the config file, then the one selected with
+// SelectProfile. It returns "" if there is none.
+func SelectedProfile() (string, error) {
+	if name := Current().DefaultProfile; name != "" {
+		return name, nil
+	}
+	path, err := profilePath()
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read selected profile: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// SelectProfile makes name the profile used by default. An empty name
+// goes back to the top-level settings.
+func SelectProfile(name string) error {
+	path, err := profilePath()
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to clear selected profile: %w", err)
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create share directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(name+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to save selected profile: %w", err)
+	}
+	return nil
+}
+
+func profilePath() (string, error) {
+	shareDir, err := GetShareDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(shareDir, profileFile), nil
+}
+
+// checkProfiles validates the [profile.<name>] sections and the
+// default_profile key.
+func checkProfiles(cfg Config, lines []string) []Problem {
+	var problems []Problem
+	for _, name := range cfg.ProfileNames() {
+		provider := cfg.Profiles[name].Provider
+		if provider != "" && !containsValue(allowedValues["provider"], provider) {
+			key := fmt.Sprintf("profile.%s.provider", name)
+			problems = append(problems, Problem{
+				Line:     findKeyLine(lines, strings.Split(key, ".")),
+				Key:      key,
+				Severity: "error",
+				Message:  fmt.Sprintf("invalid value %q, expected one of %s", provider, strings.Join(allowedValues["provider"], ", ")),
+			})
+		}
+	}
+	if name := cfg.DefaultProfile; name != "" {
+		if _, ok := cfg.Profiles[name]; !ok {
+			problems = append(problems, Problem{
+				Line:     findKeyLine(lines, []string{"default_profile"}),
+				Key:      "default_profile",
+				Severity: "error",
+				Message:  fmt.Sprintf("profile %q is not defined", name),
+			})
+		}
+	}
+	return problems
+}
@@ -0,0 +1,37 @@
+package conversation
+
+import (
+	"fmt"
+	"time"
+)
+
+// Archive hides conv from the default list of asc view, without deleting
+// it.
+func Archive(conv *Conversation) {
+	if conv.Archived != nil {
+		return
+	}
+	now := time.Now()
+	conv.Archived = &now
+}
+
+// Unarchive lists conv in the default view again.
+func Unarchive(conv *Conversation) error {
+	if conv.Archived == nil {
+		return fmt.Errorf("conversation %s is not archived", conv.ID)
+	}
+	conv.Archived = nil
+	return nil
+}
+
+// Archived returns the entries that are archived when archived is set,
+// and the others otherwise.
+func Archived(entries []Entry, archived bool) []Entry {
+	var matched []Entry
+	for _, entry := range entries {
+		if (entry.Archived != nil) == archived {
+			matched = append(matched, entry)
+		}
+	}
+	return matched
+}
@@ -0,0 +1,311 @@
+package conversation
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"asc/internal/render"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// ProvenanceAttachment is the provenance kind of an attached file.
+const ProvenanceAttachment = "attachment"
+
+// Attachment describes a file whose content was included in the prompt.
+type Attachment struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	// Encoding is the original text encoding when it was transcoded to UTF-8.
+	Encoding string `json:"encoding,omitempty"`
+	// MediaType is the type of an image sent with --image, e.g.
+	// "image/png"; empty for text files.
+	MediaType string `json:"media_type,omitempty"`
+}
+
+// fallbackEncodings are tried, in order, for text that is not valid UTF-8.
+var fallbackEncodings = []struct {
+	name     string
+	encoding encoding.Encoding
+}{
+	{"Shift_JIS", japanese.ShiftJIS},
+	{"EUC-JP", japanese.EUCJP},
+	{"ISO-2022-JP", japanese.ISO2022JP},
+}
+
+// LoadAttachment reads a text file for inclusion in a prompt. Content in
+// UTF-16 (with BOM) or common Japanese encodings is transcoded to UTF-8.
+// Binary files are refused with an error describing what was detected.
+func LoadAttachment(path string) (Attachment, string, error) {
+	attachment := Attachment{Path: path}
+	if abs, err := filepath.Abs(path); err == nil {
+		attachment.Path = abs
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return attachment, "", fmt.Errorf("failed to read attachment: %w", err)
+	}
+	attachment.Size = int64(len(data))
+
+	text, enc, err := decodeText(data)
+	if err != nil {
+		return attachment, "", fmt.Errorf("cannot attach %s: %w", path, err)
+	}
+	attachment.Encoding = enc
+	return attachment, text, nil
+}
+
+// decodeText returns data as UTF-8 text along with the name of the encoding
+// it was converted from ("" if it already was UTF-8).
+func decodeText(data []byte) (string, string, error) {
+	// UTF-16 is only recognized with a byte order mark
+	if bytes.HasPrefix(data, []byte{0xFF, 0xFE}) || bytes.HasPrefix(data, []byte{0xFE, 0xFF}) {
+		decoded, err := unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM).NewDecoder().Bytes(data)
+		if err == nil && utf8.Valid(decoded) {
+			return string(decoded), "UTF-16", nil
+		}
+	}
+	data = bytes.TrimPrefix(data, []byte{0xEF, 0xBB, 0xBF})
+
+	if looksBinary(data) {
+		mime := http.DetectContentType(data)
+		hint := ""
+		if strings.HasPrefix(mime, "image/") {
+			hint = "; send images with --image to a provider with vision support"
+		}
+		return "", "", fmt.Errorf("file looks binary (%s)%s", mime, hint)
+	}
+
+	if utf8.Valid(data) {
+		return string(data), "", nil
+	}
+
+	for _, fallback := range fallbackEncodings {
+		decoded, err := fallback.encoding.NewDecoder().Bytes(data)
+		if err == nil && utf8.Valid(decoded) && !bytes.ContainsRune(decoded, utf8.RuneError) {
+			return string(decoded), fallback.name, nil
+		}
+	}
+	return "", "", fmt.Errorf("file is neither UTF-8 nor a known encoding (tried UTF-16, Shift_JIS, EUC-JP, ISO-2022-JP)")
+}
+
+// DecodeInput returns input piped to asc as UTF-8 text, transcoded like an
+// attached file. Binary input is refused.
+func DecodeInput(data []byte) (string, error) {
+	text, _, err := decodeText(data)
+	if err != nil {
+		return "", fmt.Errorf("cannot attach the input: %w", err)
+	}
+	return text, nil
+}
+
+// looksBinary reports whether data contains NUL bytes or a high ratio of
+// control characters in its first few kilobytes.
+func looksBinary(data []byte) bool {
+	head := data
+	if len(head) > 8192 {
+		head = head[:8192]
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		return true
+	}
+	control := 0
+	for _, c := range head {
+		if c < 0x20 && c != '\n' && c != '\r' && c != '\t' && c != '\f' && c != 0x1b {
+			control++
+		}
+	}
+	return len(head) > 0 && control*10 > len(head)
+}
+
+// maxImageSize is the largest image sent with a message, in bytes.
+const maxImageSize = 20 << 20
+
+// imageTypes are the image formats vision models accept.
+var imageTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp"}
+
+// LoadImage reads an image to send to a vision model and returns it
+// base64-encoded.
+func LoadImage(path string) (Attachment, string, error) {
+	attachment := Attachment{Path: path}
+	if abs, err := filepath.Abs(path); err == nil {
+		attachment.Path = abs
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return attachment, "", fmt.Errorf("failed to read image: %w", err)
+	}
+	attachment.Size = int64(len(data))
+	if len(data) > maxImageSize {
+		return attachment, "", fmt.Errorf("image %s is too large (%d bytes, at most %d)", path, len(data), maxImageSize)
+	}
+	attachment.MediaType = http.DetectContentType(data)
+	if !containsString(imageTypes, attachment.MediaType) {
+		return attachment, "", fmt.Errorf("%s is not a PNG, JPEG, GIF or WebP image (%s)", path, attachment.MediaType)
+	}
+	return attachment, base64.StdEncoding.EncodeToString(data), nil
+}
+
+// appendAttachments adds each attached file to message as a fenced block.
+func appendAttachments(message string, attachments []Attachment, contents []string) string {
+	if len(attachments) == 0 {
+		return message
+	}
+	var b strings.Builder
+	b.WriteString(message)
+	for i, attachment := range attachments {
+		b.WriteString(render.Attachment(attachment.Path, contents[i]))
+	}
+	return b.String()
+}
+
+// attachmentProvenance lists attachments for the provenance footer.
+func attachmentProvenance(attachments []Attachment) []Provenance {
+	var sources []Provenance
+	for _, attachment := range attachments {
+		sources = append(sources, Provenance{Kind: ProvenanceAttachment, Ref: attachment.Path})
+	}
+	return sources
+}
+
+// attachmentHeading matches the heading and opening fence that
+// render.Attachment puts before the content of an attachment.
+var attachmentHeading = regexp.MustCompile("(?m)^# Attachment: (.+)\n(`{3,})[^\n]*\n")
+
+// WithoutAttachments returns message without the content of the files
+// and piped input attached after it.
+func WithoutAttachments(message string) string {
+	if loc := attachmentHeading.FindStringIndex(message); loc != nil {
+		return strings.TrimSpace(message[:loc[0]])
+	}
+	return message
+}
+
+// StoredAttachment is an attachment of a conversation: a text file or
+// piped input whose content is kept in a message, or an image of which
+// only the path is kept.
+type StoredAttachment struct {
+	Attachment
+	// Name is the name the content was sent under, e.g. "main.go" or
+	// "stdin".
+	Name string
+	// Turn is the 1-based turn whose message holds the content.
+	Turn int
+	// Content is the text as it was sent; Stored says whether there is
+	// one.
+	Content string
+	Stored  bool
+}
+
+// ListAttachments returns the attachments of conv in the order they were
+// sent. The files and images attached to the last message are listed with
+// their path; earlier text attachments only with their name.
+func ListAttachments(conv Conversation) []StoredAttachment {
+	var result []StoredAttachment
+	seen := map[string]bool{}
+	for i, turn := range conv.Exchanges() {
+		for _, match := range attachmentHeading.FindAllStringSubmatchIndex(turn.Message, -1) {
+			name, fence := turn.Message[match[2]:match[3]], turn.Message[match[4]:match[5]]
+			rest := turn.Message[match[1]:]
+			end := strings.Index(rest, "\n"+fence)
+			if end < 0 {
+				continue
+			}
+			content := rest[:end]
+			// Follow-ups carry the earlier messages
+			if seen[name+"\x00"+content] {
+				continue
+			}
+			seen[name+"\x00"+content] = true
+			stored := StoredAttachment{Name: name, Turn: i + 1, Content: content, Stored: true}
+			stored.Size = int64(len(content))
+			result = append(result, stored)
+		}
+	}
+	last := len(conv.Exchanges())
+	for _, attachment := range conv.Attachments {
+		name := filepath.Base(attachment.Path)
+		matched := false
+		for i := len(result) - 1; i >= 0; i-- {
+			if attachment.MediaType == "" && result[i].Name == name && result[i].Path == "" {
+				result[i].Attachment = attachment
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			result = append(result, StoredAttachment{Attachment: attachment, Name: name, Turn: last})
+		}
+	}
+	return result
+}
+
+// ExportAttachment writes the content of attachment to path, or copies its
+// file when the content is not stored, e.g. for images.
+func ExportAttachment(attachment StoredAttachment, path string) error {
+	data := []byte(attachment.Content)
+	if !attachment.Stored {
+		if attachment.Path == "" {
+			return fmt.Errorf("the content of %s is not stored", attachment.Name)
+		}
+		var err error
+		if data, err = os.ReadFile(attachment.Path); err != nil {
+			return fmt.Errorf("the content of %s is not stored and the file cannot be read: %w", attachment.Name, err)
+		}
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// DefaultStdinMaxSize is the most piped input attached to a message, in
+// bytes, unless max_size in the [stdin] section of the config says
+// otherwise.
+const DefaultStdinMaxSize = 100000
+
+// AttachInput adds input piped to stdin to message, in a fenced block if
+// fence is set, or returns input alone if message is empty. Input longer
+// than maxSize bytes is cut at a line boundary and the cut is noted.
+func AttachInput(message, input string, maxSize int, fence bool) string {
+	if strings.TrimSpace(input) == "" {
+		return message
+	}
+	if maxSize <= 0 {
+		maxSize = DefaultStdinMaxSize
+	}
+	note := ""
+	if len(input) > maxSize {
+		cut := input[:maxSize]
+		// Drop a rune split by the cut, at most UTFMax-1 bytes
+		for n := 1; n < utf8.UTFMax; n++ {
+			if r, size := utf8.DecodeLastRuneInString(cut); r != utf8.RuneError || size != 1 {
+				break
+			}
+			cut = cut[:len(cut)-1]
+		}
+		if i := strings.LastIndexByte(cut, '\n'); i > 0 {
+			cut = cut[:i+1]
+		}
+		note = fmt.Sprintf("\n\n(The input was cut to the first %d of %d bytes.)", len(cut), len(input))
+		input = cut
+	}
+	switch {
+	case message == "":
+		return input + note
+	case fence:
+		return message + render.Attachment("stdin", input) + note
+	}
+	return message + "\n\n" + strings.TrimRight(input, "\n") + note
+}
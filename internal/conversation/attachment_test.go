@@ -0,0 +1,48 @@
+package conversation
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestAttachInputCut(t *testing.T) {
+	tests := []struct {
+		name, input string
+		maxSize     int
+		wantLen     int
+	}{
+		{"line boundary", "first\nsecond\nthird\n", 16, len("first\nsecond\n")},
+		{"split rune", strings.Repeat("あ", 10), 10, 9},
+		// A stray byte early on must not shrink the input to what precedes it
+		{"invalid byte", "a\xff" + strings.Repeat("x", 200), 100, 100},
+	}
+	for _, test := range tests {
+		got := AttachInput("", test.input, test.maxSize, false)
+		cut, note, ok := strings.Cut(got, "\n\n(The input was cut")
+		if !ok {
+			t.Errorf("%s: no cut noted in %q", test.name, got)
+			continue
+		}
+		if len(cut) != test.wantLen {
+			t.Errorf("%s: cut to %d bytes, want %d", test.name, len(cut), test.wantLen)
+		}
+		if !strings.Contains(note, fmt.Sprintf("first %d of", test.wantLen)) {
+			t.Errorf("%s: note %q does not give the cut size", test.name, note)
+		}
+		if test.name == "split rune" && !utf8.ValidString(cut) {
+			t.Errorf("%s: cut %q is not valid UTF-8", test.name, cut)
+		}
+	}
+}
+
+func TestDecodeInput(t *testing.T) {
+	// "日本語" in Shift_JIS
+	if got, err := DecodeInput([]byte{0x93, 0xfa, 0x96, 0x7b, 0x8c, 0xea}); err != nil || got != "日本語" {
+		t.Errorf("DecodeInput(Shift_JIS) = %q, %v, want 日本語", got, err)
+	}
+	if _, err := DecodeInput([]byte("\x00\x01\x02binary")); err == nil {
+		t.Error("DecodeInput accepted binary input")
+	}
+}
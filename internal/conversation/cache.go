@@ -0,0 +1,210 @@
+package conversation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"asc/internal/config"
+	"asc/internal/style"
+
+	"github.com/charmbracelet/log"
+)
+
+// cacheDir holds the cached answers, in the data directory.
+const cacheDir = "cache"
+
+// cachedAnswer is an answer kept for prompts sent again with --cache.
+type cachedAnswer struct {
+	Created time.Time `json:"created"`
+	// Commit is the HEAD commit of the repositories the prompt was about,
+	// if any.
+	Commit   string        `json:"commit,omitempty"`
+	Response string        `json:"response"`
+	Meta     *ResponseMeta `json:"meta"`
+}
+
+// projectCommit returns the HEAD commit of the git repositories that hold
+// the files attached to the message or its context file, or of the
+// working directory for a context command. It is empty for questions that
+// are not about a project, or not about one kept in git.
+func projectCommit(opts Options, logger *log.Logger) string {
+	var dirs []string
+	for _, path := range opts.Attachments {
+		dirs = append(dirs, filepath.Dir(path))
+	}
+	if opts.ContextFile != "" && opts.ContextFile != "-" {
+		dirs = append(dirs, filepath.Dir(opts.ContextFile))
+	}
+	if opts.ContextCommand != "" {
+		dirs = append(dirs, ".")
+	}
+	seen := map[string]bool{}
+	var commits []string
+	for _, dir := range dirs {
+		out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+		if err != nil {
+			logger.Debug("Not in a git repository, the cached answer is kept across commits", "dir", dir, "error", err)
+			continue
+		}
+		if commit := strings.TrimSpace(string(out)); !seen[commit] {
+			seen[commit] = true
+			commits = append(commits, commit)
+		}
+	}
+	sort.Strings(commits)
+	return strings.Join(commits, ",")
+}
+
+// answerCacheKey returns the key of the answer to prompt sent as described
+// by spec while the project was at commit.
+func answerCacheKey(prompt string, spec callSpec, commit string) string {
+	h := sha256.New()
+	fields := []string{spec.provider, spec.model, strings.Join(spec.perplexity.args(), " "), commit, prompt}
+	fields = append(fields, spec.images...)
+	for _, field := range fields {
+		fmt.Fprintf(h, "%d:%s\n", len(field), field)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func cachePath(key string) (string, error) {
+	dataDir, err := config.GetDataDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get data directory: %w", err)
+	}
+	return filepath.Join(dataDir, cacheDir, key+".json"), nil
+}
+
+// lookupCache returns the answer cached under key, if any.
+func lookupCache(key string, logger *log.Logger) (cachedAnswer, bool) {
+	var cached cachedAnswer
+	path, err := cachePath(key)
+	if err != nil {
+		logger.Debug("Not using the cache", "error", err)
+		return cached, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warn("Failed to read cached answer", "error", err)
+		}
+		return cached, false
+	}
+	if err := json.Unmarshal(data, &cached); err != nil || cached.Meta == nil {
+		logger.Warn("Ignoring an invalid cached answer", "path", path, "error", err)
+		return cached, false
+	}
+	return cached, true
+}
+
+// storeCache keeps response under key.
+func storeCache(key, commit, response string, meta *ResponseMeta) error {
+	path, err := cachePath(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	data, err := json.Marshal(cachedAnswer{Created: time.Now(), Commit: commit, Response: response, Meta: meta})
+	if err != nil {
+		return fmt.Errorf("failed to marshal cached answer: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write cached answer: %w", err)
+	}
+	return nil
+}
+
+// ClearCache removes the cached answers and returns how many there were.
+func ClearCache() (int, error) {
+	dataDir, err := config.GetDataDir()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get data directory: %w", err)
+	}
+	dir := filepath.Join(dataDir, cacheDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read cache directory: %w", err)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return 0, fmt.Errorf("failed to clear cache: %w", err)
+	}
+	return len(entries), nil
+}
+
+// RedactCache scrubs the cached answers with r and returns the number of
+// replacements. With dryRun nothing is rewritten.
+func RedactCache(r *Redactor, dryRun bool) (int, error) {
+	dataDir, err := config.GetDataDir()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get data directory: %w", err)
+	}
+	paths, err := filepath.Glob(filepath.Join(dataDir, cacheDir, "*.json"))
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return total, fmt.Errorf("failed to read cached answer: %w", err)
+		}
+		var cached cachedAnswer
+		if err := json.Unmarshal(data, &cached); err != nil {
+			continue
+		}
+		n := redactText(&cached.Response, r) + redactMeta(cached.Meta, r)
+		if n == 0 {
+			continue
+		}
+		total += n
+		if dryRun {
+			continue
+		}
+		if data, err = json.Marshal(cached); err != nil {
+			return total, fmt.Errorf("failed to marshal cached answer: %w", err)
+		}
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return total, fmt.Errorf("failed to write cached answer: %w", err)
+		}
+	}
+	return total, nil
+}
+
+// showCached writes a cached response as if it was streamed.
+func showCached(response string, opts Options, logger *log.Logger) error {
+	var renderer *style.Renderer
+	if opts.Output == OutputMarkdown && opts.OnLine == nil {
+		var err error
+		if renderer, err = style.NewRenderer(getTerminalWidth(), logger); err != nil {
+			return err
+		}
+	}
+	sink := newStreamSink(opts, renderer)
+	var buffer strings.Builder
+	for _, line := range strings.Split(response, "\n") {
+		buffer.WriteString(line + "\n")
+		if err := sink.Line(line, buffer.String()); err != nil {
+			return err
+		}
+	}
+	if err := sink.Flush(); err != nil {
+		return err
+	}
+	if paging, ok := sink.(*pagingSink); ok {
+		return paging.page()
+	}
+	return nil
+}
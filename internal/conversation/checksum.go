@@ -0,0 +1,186 @@
+package conversation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"asc/internal/config"
+
+	"github.com/charmbracelet/log"
+)
+
+// Statuses of a Change, as in git diff --name-status.
+const (
+	ChangeAdded    = "A"
+	ChangeModified = "M"
+	ChangeDeleted  = "D"
+)
+
+// Change is a conversation that changed since a point of reference.
+type Change struct {
+	Status   string `json:"status"`
+	ID       string `json:"id"`
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// Checkpoint records the checksums of all conversations at one time, so
+// that asc changed can list what changed since.
+type Checkpoint struct {
+	Time      time.Time         `json:"time"`
+	Checksums map[string]string `json:"checksums"`
+}
+
+// Checksum returns the SHA-256 of the content of conv. The file path, the
+// unread, archived and pinned flags and the checksum with its change time
+// are left out, since they change without the conversation changing.
+func Checksum(conv Conversation) string {
+	conv.FilePath = ""
+	conv.Unread = false
+	conv.Archived = nil
+	conv.Pinned = false
+	conv.Checksum = ""
+	conv.Changed = nil
+	data, _ := json.Marshal(conv)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// stamp updates the checksum of conv before it is saved, and the change
+// time if the content differs from what was loaded.
+func stamp(conv *Conversation) {
+	sum := Checksum(*conv)
+	if sum == conv.Checksum && conv.Changed != nil {
+		return
+	}
+	now := time.Now()
+	conv.Checksum = sum
+	conv.Changed = &now
+}
+
+// changeState returns the checksum and change time of the conversation of
+// entry. Conversations saved before checksums were kept are loaded to
+// compute them, and count as changed at their last exchange.
+func changeState(entry Entry, logger *log.Logger) (string, time.Time, error) {
+	if entry.Checksum != "" && entry.Changed != nil {
+		return entry.Checksum, *entry.Changed, nil
+	}
+	conv, err := LoadConversation(entry.ID, logger)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	changed := conv.Timestamp
+	for _, turn := range conv.Turns {
+		if turn.Timestamp.After(changed) {
+			changed = turn.Timestamp
+		}
+	}
+	return Checksum(conv), changed, nil
+}
+
+// ChangedSince lists the conversations of entries created or changed
+// after since, ordered by ID.
+func ChangedSince(entries []Entry, since time.Time, logger *log.Logger) ([]Change, error) {
+	var changes []Change
+	for _, entry := range entries {
+		sum, changed, err := changeState(entry, logger)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case entry.Timestamp.After(since):
+			changes = append(changes, Change{Status: ChangeAdded, ID: entry.ID, Checksum: sum})
+		case changed.After(since):
+			changes = append(changes, Change{Status: ChangeModified, ID: entry.ID, Checksum: sum})
+		}
+	}
+	sortChanges(changes)
+	return changes, nil
+}
+
+// ChangedFrom lists the conversations of entries that were added or whose
+// checksum differs from checkpoint, and those deleted since, ordered by ID.
+// It also returns the checkpoint of entries.
+func ChangedFrom(entries []Entry, checkpoint Checkpoint, logger *log.Logger) ([]Change, Checkpoint, error) {
+	var changes []Change
+	current := Checkpoint{Time: time.Now(), Checksums: make(map[string]string, len(entries))}
+	for _, entry := range entries {
+		sum, _, err := changeState(entry, logger)
+		if err != nil {
+			return nil, current, err
+		}
+		current.Checksums[entry.ID] = sum
+		previous, ok := checkpoint.Checksums[entry.ID]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Status: ChangeAdded, ID: entry.ID, Checksum: sum})
+		case previous != sum:
+			changes = append(changes, Change{Status: ChangeModified, ID: entry.ID, Checksum: sum})
+		}
+	}
+	for id := range checkpoint.Checksums {
+		if _, ok := current.Checksums[id]; !ok {
+			changes = append(changes, Change{Status: ChangeDeleted, ID: id})
+		}
+	}
+	sortChanges(changes)
+	return changes, current, nil
+}
+
+func sortChanges(changes []Change) {
+	sort.Slice(changes, func(i, j int) bool { return changes[i].ID < changes[j].ID })
+}
+
+// checkpointPath returns the file of the checkpoint called name.
+func checkpointPath(name string) (string, error) {
+	if err := checkFileName("checkpoint", name); err != nil {
+		return "", err
+	}
+	shareDir, err := config.GetShareDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get share directory: %w", err)
+	}
+	return filepath.Join(shareDir, "checkpoints", name+".json"), nil
+}
+
+// LoadCheckpoint reads the checkpoint called name. A missing checkpoint
+// is reported with an error satisfying os.IsNotExist.
+func LoadCheckpoint(name string) (Checkpoint, error) {
+	var checkpoint Checkpoint
+	path, err := checkpointPath(name)
+	if err != nil {
+		return checkpoint, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return checkpoint, err
+	}
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return checkpoint, fmt.Errorf("invalid checkpoint %s: %w", path, err)
+	}
+	return checkpoint, nil
+}
+
+// SaveCheckpoint writes checkpoint under name, replacing an earlier one.
+func SaveCheckpoint(name string, checkpoint Checkpoint) error {
+	path, err := checkpointPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create checkpoints directory: %w", err)
+	}
+	data, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package conversation
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"asc/internal/config"
+
+	"github.com/charmbracelet/log"
+)
+
+// maxContextSnapshots is how many earlier versions of the context are kept.
+const maxContextSnapshots = 20
+
+// snapshotLayout names snapshot files so that they sort by time.
+const snapshotLayout = "20060102-150405.000000000"
+
+// ContextSnapshot is an earlier version of the context file.
+type ContextSnapshot struct {
+	Time    time.Time
+	Content string
+}
+
+// contextHistoryDir returns the directory the snapshots are kept in.
+func contextHistoryDir() (string, error) {
+	shareDir, err := config.GetShareDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get share directory: %w", err)
+	}
+	return filepath.Join(shareDir, "context_history"), nil
+}
+
+// snapshotContext saves the current context, if any, before it is replaced
+// or removed, and deletes the oldest snapshots beyond maxContextSnapshots.
+func snapshotContext(logger *log.Logger) error {
+	current, err := LoadContext(logger)
+	if err != nil || current == "" {
+		return err
+	}
+	history, err := ContextHistory(logger)
+	if err != nil {
+		return err
+	}
+	if len(history) > 0 && history[0].Content == current {
+		return nil
+	}
+
+	dir, err := contextHistoryDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create context history directory: %w", err)
+	}
+	name := time.Now().Format(snapshotLayout) + ".txt"
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(current), 0644); err != nil {
+		return fmt.Errorf("failed to save context snapshot: %w", err)
+	}
+	logger.Debug("Saved context snapshot", "name", name)
+
+	names, err := snapshotNames(dir)
+	if err != nil {
+		return err
+	}
+	for len(names) > maxContextSnapshots {
+		if err := os.Remove(filepath.Join(dir, names[len(names)-1])); err != nil {
+			return fmt.Errorf("failed to remove old context snapshot: %w", err)
+		}
+		names = names[:len(names)-1]
+	}
+	return nil
+}
+
+// snapshotNames returns the snapshot file names in dir, newest first.
+func snapshotNames(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read context history: %w", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".txt") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	return names, nil
+}
+
+// ContextHistory returns the saved versions of the context, newest first.
+func ContextHistory(logger *log.Logger) ([]ContextSnapshot, error) {
+	dir, err := contextHistoryDir()
+	if err != nil {
+		return nil, err
+	}
+	names, err := snapshotNames(dir)
+	if err != nil {
+		return nil, err
+	}
+	var history []ContextSnapshot
+	for _, name := range names {
+		t, err := time.ParseInLocation(snapshotLayout, strings.TrimSuffix(name, ".txt"), time.Local)
+		if err != nil {
+			logger.Debug("Skipping unknown file in context history", "name", name)
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read context snapshot: %w", err)
+		}
+		history = append(history, ContextSnapshot{Time: t, Content: string(data)})
+	}
+	return history, nil
+}
+
+// RollbackContext restores the n-th most recent version of the context
+// (1-based, as listed by ContextHistory). The context it replaces is
+// saved as a new snapshot, so a rollback can itself be undone.
+func RollbackContext(n int, logger *log.Logger) (ContextSnapshot, error) {
+	history, err := ContextHistory(logger)
+	if err != nil {
+		return ContextSnapshot{}, err
+	}
+	if n < 1 || n > len(history) {
+		return ContextSnapshot{}, fmt.Errorf("version %d does not exist (%d saved)", n, len(history))
+	}
+	snapshot := history[n-1]
+	if err := SaveContext(snapshot.Content, logger); err != nil {
+		return ContextSnapshot{}, err
+	}
+	return snapshot, nil
+}
+
+// ContextChanged reports whether the context file no longer holds loaded,
+// e.g. because it was edited in another terminal, and returns what it
+// holds now.
+func ContextChanged(loaded string, logger *log.Logger) (string, bool, error) {
+	current, err := LoadContext(logger)
+	if err != nil {
+		return "", false, err
+	}
+	return current, current != loaded, nil
+}
+
+// MergeConflict combines two versions of a text for resolving in an editor.
+// Lines both versions start and end with are kept once; the lines in
+// between are shown as a conflict with markers like those of git.
+func MergeConflict(mine, theirs string) string {
+	a := strings.Split(strings.TrimSuffix(mine, "\n"), "\n")
+	b := strings.Split(strings.TrimSuffix(theirs, "\n"), "\n")
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	lines := append([]string{}, a[:prefix]...)
+	lines = append(lines, "<<<<<<< your edit")
+	lines = append(lines, a[prefix:len(a)-suffix]...)
+	lines = append(lines, "=======")
+	lines = append(lines, b[prefix:len(b)-suffix]...)
+	lines = append(lines, ">>>>>>> saved meanwhile")
+	lines = append(lines, a[len(a)-suffix:]...)
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// RunContextCommand runs command with the shell and returns its output as
+// context, headed by the command line so that the model knows where it
+// comes from. Output beyond maxSize bytes is cut as for piped input.
+func RunContextCommand(command string, maxSize int, logger *log.Logger) (string, error) {
+	cmd := exec.Command("sh", "-c", command)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	logger.Debug("Running context command", "command", command)
+	output, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg != "" {
+			return "", fmt.Errorf("context command %q failed: %w: %s", command, err, msg)
+		}
+		return "", fmt.Errorf("context command %q failed: %w", command, err)
+	}
+	if strings.TrimSpace(string(output)) == "" {
+		logger.Warn("Context command printed nothing", "command", command)
+		return "", nil
+	}
+	text, err := DecodeInput(output)
+	if err != nil {
+		return "", fmt.Errorf("context command %q: %w", command, err)
+	}
+	return AttachInput("$ "+command, text, maxSize, false), nil
+}
@@ -0,0 +1,64 @@
+package conversation
+
+import (
+	"strings"
+)
+
+// FinishLength is the finish reason of a response cut off by the token
+// limit of the provider.
+const FinishLength = "length"
+
+// maxContinuations bounds how often a single response is continued.
+const maxContinuations = 3
+
+// DetectTruncation reports whether response looks cut off, together with
+// a short reason: the provider stopped at its length limit, or a code block
+// was left open.
+func DetectTruncation(response string, meta *ResponseMeta) (string, bool) {
+	if meta != nil && meta.FinishReason == FinishLength {
+		return "length limit", true
+	}
+	if inCodeBlock(response) {
+		return "unterminated code block", true
+	}
+	return "", false
+}
+
+// inCodeBlock reports whether text ends inside a fenced code block.
+func inCodeBlock(text string) bool {
+	open := false
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			open = !open
+		}
+	}
+	return open
+}
+
+// continuePrompt asks the provider to resume question where partial stopped.
+func continuePrompt(question, partial string) string {
+	return question + "\n\n# Partial answer\n" + partial + "\n\n" +
+		"# Instruction\nThe answer above was cut off. Continue exactly where it " +
+		"stopped, without repeating anything and without any preamble."
+}
+
+// stitch appends continuation to partial. A partial cut off in the middle
+// of a line or word is joined directly, so that the continuation finishes
+// it. When partial ends inside a code block, a fence the provider opened
+// again at the start of the continuation is dropped so that the block is
+// not split; the lines after it start a new line.
+func stitch(partial, continuation string) string {
+	if inCodeBlock(partial) {
+		first, rest, _ := strings.Cut(strings.TrimLeft(continuation, "\n"), "\n")
+		if strings.HasPrefix(strings.TrimSpace(first), "```") {
+			if !strings.HasSuffix(partial, "\n") {
+				partial += "\n"
+			}
+			continuation = rest
+		}
+	}
+	if strings.HasSuffix(partial, "\n") {
+		return partial + strings.TrimLeft(continuation, "\n")
+	}
+	return partial + continuation
+}
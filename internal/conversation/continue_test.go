@@ -0,0 +1,21 @@
+package conversation
+
+import "testing"
+
+func TestStitch(t *testing.T) {
+	tests := []struct {
+		name, partial, continuation, want string
+	}{
+		{"mid-word", "The quick bro", "wn fox jumps.", "The quick brown fox jumps."},
+		{"mid-line", "The quick brown", " fox jumps.", "The quick brown fox jumps."},
+		{"line boundary", "First line.\n", "\nSecond line.", "First line.\nSecond line."},
+		{"reopened fence", "```go\nfunc main() {\n", "```go\n\tfmt.Println()\n}\n```", "```go\nfunc main() {\n\tfmt.Println()\n}\n```"},
+		{"reopened fence mid-line", "```go\nfunc main() {", "```go\n\tfmt.Println()\n}\n```", "```go\nfunc main() {\n\tfmt.Println()\n}\n```"},
+		{"code mid-line", "```go\nfmt.Prin", "tln()\n```", "```go\nfmt.Println()\n```"},
+	}
+	for _, test := range tests {
+		if got := stitch(test.partial, test.continuation); got != test.want {
+			t.Errorf("%s: stitch(%q, %q) = %q, want %q", test.name, test.partial, test.continuation, got, test.want)
+		}
+	}
+}
@@ -1,7 +1,7 @@
 package conversation
 
 import (
-	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -12,52 +12,163 @@ import (
 	"time"
 
 	"asc/internal/config"
+	"asc/internal/provider"
+	"asc/internal/render"
+	"asc/internal/style"
 
 	"github.com/charmbracelet/log"
 	"golang.org/x/term"
 )
 
 type Conversation struct {
-	ID        string    `json:"id"`
-	Timestamp time.Time `json:"timestamp"`
-	Message   string    `json:"message"`
-	Response  string    `json:"response"`
-	FilePath  string    `json:"file_path"`
-	Context   string    `json:"context,omitempty"`
+	ID        string        `json:"id"`
+	Timestamp time.Time     `json:"timestamp"`
+	Message   string        `json:"message"`
+	Response  string        `json:"response"`
+	FilePath  string        `json:"file_path"`
+	Context   string        `json:"context,omitempty"`
+	System    string        `json:"system,omitempty"`
+	Meta      *ResponseMeta `json:"meta,omitempty"`
+	// Turns holds the follow-up exchanges after Message/Response.
+	Turns []Turn `json:"turns,omitempty"`
+	// Source is the ID of the conversation the first exchange came from
+	// when this conversation was created by merging.
+	Source     string   `json:"source,omitempty"`
+	MergedFrom []string `json:"merged_from,omitempty"`
+	// BranchOf is the ID of the conversation this one was branched from,
+	// and BranchTurn the (1-based) turn that was edited.
+	BranchOf   string `json:"branch_of,omitempty"`
+	BranchTurn int    `json:"branch_turn,omitempty"`
+	// Provenance lists the sources that were injected into the prompt.
+	Provenance  []Provenance `json:"provenance,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+	Title       string       `json:"title,omitempty"`
+	// Metadata holds key=value pairs set with `asc meta set`, e.g. a
+	// ticket the conversation belongs to.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Tags organize conversations, e.g. by project.
+	Tags []string `json:"tags,omitempty"`
+	// Unread is set when the answer was not shown on a terminal, e.g. for
+	// runs from scripts, until the conversation is viewed.
+	Unread bool `json:"unread,omitempty"`
+	// Queued is when the conversation was put on the reading queue and
+	// QueueDone when it was marked done there. Unlike Unread, they only
+	// change with asc queue.
+	Queued    *time.Time `json:"queued,omitempty"`
+	QueueDone *time.Time `json:"queue_done,omitempty"`
+	// Archived is when the conversation was archived, which hides it from
+	// asc view unless --archived is given.
+	Archived *time.Time `json:"archived,omitempty"`
+	// Pinned conversations are listed first in asc view.
+	Pinned bool `json:"pinned,omitempty"`
+	// Visibility is VisibilityPrivate for conversations that must not be
+	// exported without --force; empty means shareable.
+	Visibility string `json:"visibility,omitempty"`
+	// SGPTChat is the sgpt chat session (sgpt --chat) that holds the
+	// first SGPTChatTurns exchanges of the conversation, so that they are
+	// not sent again with every message.
+	SGPTChat      string `json:"sgpt_chat,omitempty"`
+	SGPTChatTurns int    `json:"sgpt_chat_turns,omitempty"`
+	// Perplexity holds the search options of the last turn answered by
+	// perplexity, which follow-ups reuse.
+	Perplexity *PerplexityOptions `json:"perplexity,omitempty"`
+	// Provider and Model are the model last selected with --model and its
+	// provider, which follow-ups reuse. Routed models are not recorded.
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+	// Checksum is the hash of the content when it was last saved, and
+	// Changed when that content last changed. See asc changed.
+	Checksum string     `json:"checksum,omitempty"`
+	Changed  *time.Time `json:"changed,omitempty"`
 }
 
-func SaveNewConversation(response, message, context string, logger *log.Logger) error {
+// Usage is the token usage reported by a provider.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+	// Estimated is set when the provider did not report usage and the
+	// counts were estimated from the length of the text.
+	Estimated bool `json:"estimated,omitempty"`
+}
+
+// ResponseMeta records how a provider produced a response. Fields that the
+// provider does not report are left empty.
+type ResponseMeta struct {
+	Provider     string `json:"provider"`
+	Model        string `json:"model,omitempty"`
+	FinishReason string `json:"finish_reason,omitempty"`
+	RequestID    string `json:"request_id,omitempty"`
+	Usage        *Usage `json:"usage,omitempty"`
+	Error        string `json:"error,omitempty"`
+	// DurationMS is the time from sending the request until the response
+	// was complete, and FirstTokenMS the time until the first output arrived.
+	DurationMS   int64 `json:"duration_ms,omitempty"`
+	FirstTokenMS int64 `json:"first_token_ms,omitempty"`
+	// Retries lists the refused attempts that preceded this response.
+	Retries []RetryAttempt `json:"retries,omitempty"`
+	// Continuations counts the requests that continued a cut-off response.
+	Continuations int `json:"continuations,omitempty"`
+	// Route is the name of the routing rule that chose the model.
+	Route string `json:"route,omitempty"`
+	// Cost is the estimated price of Usage in USD, nil when the price of
+	// the model is not known.
+	Cost *float64 `json:"cost,omitempty"`
+	// Cached is set when the answer came from the cache of --cache, which
+	// costs nothing.
+	Cached bool `json:"cached,omitempty"`
+}
+
+// SaveNewConversation assigns an ID and timestamp to conv, writes it to the
+// conversations directory and returns the saved conversation.
+func SaveNewConversation(conv Conversation, logger *log.Logger) (Conversation, error) {
+	if usesSQLite() {
+		saved, err := saveNewSQLite(conv, logger)
+		if err == nil {
+			noteSaved(saved, logger)
+			autoPrune(logger)
+		}
+		return saved, err
+	}
+
 	// Get data directory
 	dataDir, err := config.GetDataDir()
 	if err != nil {
-		return fmt.Errorf("failed to get data directory: %w", err)
+		return conv, fmt.Errorf("failed to get data directory: %w", err)
 	}
 
 	// Create conversations directory if it doesn't exist
 	conversationsDir := filepath.Join(dataDir, "conversations")
 	if err := os.MkdirAll(conversationsDir, 0755); err != nil {
-		return fmt.Errorf("failed to create conversations directory: %w", err)
+		return conv, fmt.Errorf("failed to create conversations directory: %w", err)
 	}
 
 	// Create new conversation
-	conversation := Conversation{
-		ID:        time.Now().Format("20060102150405"),
-		Timestamp: time.Now(),
-		Message:   message,
-		Response:  response,
-		Context:   context,
+	// The ID is derived from the same instant as the timestamp so that both
+	// always agree. The timestamp itself is stored with its zone offset.
+	// IDs have a resolution of one second, so skip ahead on collisions.
+	now := time.Now()
+	for {
+		if _, err := os.Stat(filepath.Join(conversationsDir, now.Format("20060102150405")+".json")); os.IsNotExist(err) {
+			break
+		}
+		now = now.Add(time.Second)
 	}
+	conversation := conv
+	conversation.ID = now.Format("20060102150405")
+	conversation.Timestamp = now
+	stamp(&conversation)
 
 	// Convert to JSON
 	data, err := json.MarshalIndent(conversation, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to marshal conversation: %w", err)
+		return conv, fmt.Errorf("failed to marshal conversation: %w", err)
 	}
 
 	// Save to file
 	filename := filepath.Join(conversationsDir, conversation.ID+".json")
 	if err := os.WriteFile(filename, data, 0644); err != nil {
-		return fmt.Errorf("failed to save conversation: %w", err)
+		return conv, fmt.Errorf("failed to save conversation: %w", err)
 	}
 
 	// ファイルパスを設定
@@ -66,17 +177,142 @@ func SaveNewConversation(response, message, context string, logger *log.Logger)
 	// ファイルパスを含めて再度保存
 	data, err = json.MarshalIndent(conversation, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to marshal conversation with file path: %w", err)
+		return conv, fmt.Errorf("failed to marshal conversation with file path: %w", err)
 	}
 	if err := os.WriteFile(filename, data, 0644); err != nil {
-		return fmt.Errorf("failed to save conversation with file path: %w", err)
+		return conv, fmt.Errorf("failed to save conversation with file path: %w", err)
 	}
 
 	logger.Debug("Saved conversation", "id", conversation.ID, "path", filename)
+	noteSaved(conversation, logger)
+	autoPrune(logger)
+	return conversation, nil
+}
+
+// ValidID reports whether id has the format of conversation IDs: the time
+// the conversation started, to the second, e.g. 20250131120000.
+func ValidID(id string) bool {
+	_, err := time.Parse("20060102150405", id)
+	return err == nil && len(id) == len("20060102150405")
+}
+
+// SaveConversation rewrites an existing conversation.
+func SaveConversation(conv Conversation, logger *log.Logger) error {
+	var err error
+	if usesSQLite() {
+		err = saveSQLite(conv, logger)
+	} else {
+		err = saveJSON(conv, logger)
+	}
+	if err == nil {
+		noteSaved(conv, logger)
+	}
+	return err
+}
+
+// saveJSON writes conv to its file. The file is replaced atomically so that
+// an interrupted write never leaves it truncated.
+func saveJSON(conv Conversation, logger *log.Logger) error {
+	dataDir, err := config.GetDataDir()
+	if err != nil {
+		return fmt.Errorf("failed to get data directory: %w", err)
+	}
+
+	conversationsDir := filepath.Join(dataDir, "conversations")
+	if err := os.MkdirAll(conversationsDir, 0755); err != nil {
+		return fmt.Errorf("failed to create conversations directory: %w", err)
+	}
+	filename := filepath.Join(conversationsDir, conv.ID+".json")
+	conv.FilePath = filename
+	stamp(&conv)
+
+	data, err := json.MarshalIndent(conv, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal conversation: %w", err)
+	}
+
+	tmpFile, err := os.CreateTemp(conversationsDir, "."+conv.ID+"-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to write conversation: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to write conversation: %w", err)
+	}
+	if err := os.Chmod(tmpFile.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to set permissions: %w", err)
+	}
+	if err := os.Rename(tmpFile.Name(), filename); err != nil {
+		return fmt.Errorf("failed to replace conversation: %w", err)
+	}
+
+	logger.Debug("Saved conversation", "id", conv.ID, "path", filename)
 	return nil
 }
 
+// LoadConversation loads a single conversation by its ID.
+func LoadConversation(id string, logger *log.Logger) (Conversation, error) {
+	if usesSQLite() {
+		return loadSQLite(id, logger)
+	}
+
+	var conv Conversation
+	dataDir, err := config.GetDataDir()
+	if err != nil {
+		return conv, fmt.Errorf("failed to get data directory: %w", err)
+	}
+
+	filePath := filepath.Join(dataDir, "conversations", id+".json")
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return conv, fmt.Errorf("conversation %s not found", id)
+		}
+		return conv, fmt.Errorf("failed to read conversation: %w", err)
+	}
+	if err := json.Unmarshal(data, &conv); err != nil {
+		return conv, fmt.Errorf("failed to unmarshal conversation: %w", err)
+	}
+	if conv.FilePath == "" {
+		conv.FilePath = filePath
+	}
+
+	logger.Debug("Loaded conversation", "id", id, "path", filePath)
+	return conv, nil
+}
+
+// LatestConversation returns the most recent conversation.
+func LatestConversation(logger *log.Logger) (Conversation, error) {
+	conversations, err := LoadConversations(logger)
+	if err != nil {
+		return Conversation{}, fmt.Errorf("failed to load conversations: %w", err)
+	}
+	if len(conversations) == 0 {
+		return Conversation{}, fmt.Errorf("no conversations found")
+	}
+	latest := conversations[0]
+	for _, conv := range conversations[1:] {
+		if conv.Timestamp.After(latest.Timestamp) {
+			latest = conv
+		}
+	}
+	return latest, nil
+}
+
+// LoadConversations returns all saved conversations.
 func LoadConversations(logger *log.Logger) ([]Conversation, error) {
+	if usesSQLite() {
+		return loadAllSQLite(logger)
+	}
+	return loadAllJSON(logger)
+}
+
+// loadAllJSON reads every file of the conversations directory.
+func loadAllJSON(logger *log.Logger) ([]Conversation, error) {
 	dataDir, err := config.GetDataDir()
 	if err != nil {
 		return nil, err
@@ -126,6 +362,21 @@ func LoadConversations(logger *log.Logger) ([]Conversation, error) {
 	return conversations, nil
 }
 
+// shownOnTerminal reports whether responses sent with opts are displayed
+// to the user as they stream.
+func shownOnTerminal(opts Options) bool {
+	return opts.Output != OutputJSON && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// MarkRead clears the unread state of conv and saves it.
+func MarkRead(conv *Conversation, logger *log.Logger) error {
+	if !conv.Unread {
+		return nil
+	}
+	conv.Unread = false
+	return SaveConversation(*conv, logger)
+}
+
 // getTerminalWidth returns the terminal width, defaulting to 80 if unable to determine
 func getTerminalWidth() int {
 	width, _, err := term.GetSize(int(os.Stdout.Fd()))
@@ -135,149 +386,615 @@ func getTerminalWidth() int {
 	return width
 }
 
+// ShowConversation renders conv and shows it in the pager, or prints it
+// when stdout is not a terminal.
 func ShowConversation(conv Conversation, logger *log.Logger) error {
-	// Get terminal width
-	terminalWidth := getTerminalWidth()
-	
-	// Execute glow command with conversation content
-	glowCmd := exec.Command("glow", "-p", "-w", fmt.Sprintf("%d", terminalWidth-2))
-
-	// Check if style file exists
-	shareDir, err := config.GetShareDir()
+	renderer, err := style.NewRenderer(getTerminalWidth(), logger)
 	if err != nil {
-		return fmt.Errorf("failed to get share directory: %w", err)
+		return err
 	}
-	stylePath := filepath.Join(shareDir, "ggpt_glow_style.json")
-	if _, err := os.Stat(stylePath); err == nil {
-		glowCmd.Args = append(glowCmd.Args, "--style", stylePath)
+	rendered, err := renderer.Render(FormatConversation(conv))
+	if err != nil {
+		return err
+	}
+	if !term.IsTerminal(int(os.Stdout.Fd())) {
+		_, err := fmt.Print(rendered)
+		return err
 	}
 
-	// Format conversation content
-	content := fmt.Sprintf("# Conversation %s\n\n## User\n%s\n\n## AI\n%s",
-		conv.ID, conv.Message, conv.Response)
-
-	glowCmd.Stdin = strings.NewReader(content)
-	glowCmd.Stdout = os.Stdout
-	glowCmd.Stderr = os.Stderr
-	if err := glowCmd.Run(); err != nil {
-		return fmt.Errorf("failed to execute glow: %w", err)
+	pager := config.GetPager()
+	pagerCmd := exec.Command(pager[0], pager[1:]...)
+	pagerCmd.Stdin = strings.NewReader(rendered)
+	pagerCmd.Stdout = os.Stdout
+	pagerCmd.Stderr = os.Stderr
+	if err := pagerCmd.Run(); err != nil {
+		return fmt.Errorf("failed to run pager: %w", err)
 	}
 	return nil
 }
 
-func StartNewConversation(message string, usePerplexity bool, logger *log.Logger) error {
-	// Load context if exists
-	context, err := LoadContext(logger)
+// Options controls how a message is sent to the AI provider and what is
+// recorded afterwards.
+type Options struct {
+	// Provider is the name of the AI provider; empty selects
+	// DefaultProvider.
+	Provider string
+	// Model selects the model of the provider. When empty, the routing
+	// rules of the config file may choose one.
+	Model string
+	// Quality is the requested answer quality (low, normal or high) that
+	// routing rules can match on.
+	Quality string
+	// Ephemeral disables saving the conversation to the history.
+	Ephemeral bool
+	// ContextFile replaces the global context file for this invocation.
+	// "-" reads the context from stdin.
+	ContextFile string
+	// NoContext sends no context at all, not even the global one.
+	NoContext bool
+	// ContextCommand is run with the shell and its output used as the
+	// context instead, e.g. "git diff --staged".
+	ContextCommand string
+	// SystemFile is read and sent as a system prompt. "-" reads it from stdin.
+	SystemFile string
+	// Language is the language answers are requested in, regardless of
+	// the language of the question, e.g. "Japanese". Empty leaves it to
+	// the provider.
+	Language string
+	// Attachments are paths of text files included in the message.
+	Attachments []string
+	// Images are paths of images sent along with the message, for
+	// providers with vision support.
+	Images []string
+	// imageData holds the loaded Images, base64-encoded.
+	imageData []string
+	// History holds earlier turns of the thread. They are included in the
+	// prompt and saved before the new turn.
+	History []Turn
+	// Recalled lists the IDs of earlier conversations whose content is
+	// included in the message, for the provenance footer.
+	Recalled []string
+	// AutoRetryOnRefusal retries with a clarified prompt without asking
+	// when the response looks like a refusal.
+	AutoRetryOnRefusal bool
+	// Private marks new conversations as private.
+	Private bool
+	// Queue puts new conversations on the reading queue.
+	Queue bool
+	// Persona is recorded in the metadata of the conversation, sends its
+	// system prompt and selects the example bank; empty is DefaultPersona.
+	Persona string
+	// Examples is how many rated examples of the persona are added to the
+	// system prompt as few-shot examples; 0 adds none.
+	Examples int
+	// exampleIDs are the conversations of the examples that were added,
+	// for the provenance footer.
+	exampleIDs []string
+	// job records the progress of the request for asc top.
+	job *runningJob
+	// NoAutoContinue disables continuing responses that were cut off.
+	NoAutoContinue bool
+	// Verify enables a verification pass over the answer, optionally with
+	// VerifyModel as the reviewer.
+	Verify      VerifyMode
+	VerifyModel string
+	// Output selects how the response is written to stdout while it streams.
+	Output OutputMode
+	// StreamInterval is the minimum time between two writes of a streaming
+	// response to the terminal; lines received in between are coalesced.
+	StreamInterval time.Duration
+	// OnLine, if set, receives the response line by line instead of
+	// stdout, for callers that show it themselves.
+	OnLine func(line string)
+	// Interrupt stops the generation like Ctrl-C when it is closed,
+	// keeping what has arrived so far.
+	Interrupt <-chan struct{}
+	// Dump records the raw provider calls for troubleshooting.
+	Dump DumpOptions
+	// Record is a suite file that every completed provider call is
+	// appended to, for `asc replay-suite`.
+	Record string
+	// SGPTChat is the sgpt chat session to send the message in. It holds
+	// the first SGPTChatTurns turns of History, which are not sent again.
+	// Other providers ignore both.
+	SGPTChat      string
+	SGPTChatTurns int
+	// Perplexity holds the search options used with perplexity.
+	Perplexity PerplexityOptions
+	// Cache answers a prompt sent before with the same model from the
+	// cache. Answers about files in a git repository are only reused while
+	// its HEAD is the same commit.
+	Cache bool
+}
+
+// DefaultProvider is used when no provider is selected.
+const DefaultProvider = "sgpt"
+
+// recordPersona saves the persona given in opts in the metadata of conv.
+func (c *Conversation) recordPersona(opts Options) {
+	if opts.Persona != "" && opts.Persona != DefaultPersona {
+		SetMetadata(c, map[string]string{PersonaKey: opts.Persona})
+	}
+}
+
+// recordModel saves the model given in opts with conv.
+func (c *Conversation) recordModel(opts Options) {
+	if opts.Model != "" {
+		c.Provider = opts.providerName()
+		c.Model = opts.Model
+	}
+}
+
+// defaultProvider returns the provider used when none is selected.
+func defaultProvider(cfg *config.Config) string {
+	if cfg.Provider == "" {
+		return DefaultProvider
+	}
+	return cfg.Provider
+}
+
+// Warm loads the model selected by opts ahead of the first message, for
+// providers that run models locally. It returns the provider and model.
+func Warm(ctx context.Context, opts Options) (string, string, error) {
+	name, model := opts.providerName(), opts.Model
+	if cfg := config.Current(); model == "" && cfg.Model != "" && name == defaultProvider(cfg) {
+		model = cfg.Model
+	}
+	return name, model, provider.Warm(ctx, name, model)
+}
+
+// providerName returns the name of the selected provider.
+func (opts Options) providerName() string {
+	if opts.Provider == "" {
+		return DefaultProvider
+	}
+	return opts.Provider
+}
+
+// callSpec describes a call to providerName with the options, using the
+// sgpt chat session chat if not empty.
+func (opts Options) callSpec(providerName, chat string) callSpec {
+	return callSpec{provider: providerName, model: opts.Model, chat: chat, perplexity: opts.Perplexity, images: opts.imageData}
+}
+
+// otherProvider returns the provider to retry refused answers with.
+func otherProvider(name string) string {
+	if name == "perplexity" {
+		return DefaultProvider
+	}
+	return "perplexity"
+}
+
+// requiredFeatures lists the provider features the options depend on.
+func (opts Options) requiredFeatures() []provider.Feature {
+	var features []provider.Feature
+	if opts.ContextFile != "" || opts.ContextCommand != "" {
+		features = append(features, provider.FeatureContext)
+	}
+	if opts.SystemFile != "" {
+		features = append(features, provider.FeatureSystemPrompt)
+	}
+	if opts.Model != "" {
+		features = append(features, provider.FeatureModel)
+	}
+	if len(opts.Images) > 0 {
+		features = append(features, provider.FeatureVision)
+	}
+	return features
+}
+
+// ReadInputFile reads the file at path, or stdin if path is "-".
+// Paths like /dev/fd/3 can be used to pass an extra file descriptor.
+func ReadInputFile(path string) (string, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
 	if err != nil {
-		logger.Error("Failed to load context", "error", err)
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return string(data), nil
+}
+
+// buildPrompt combines the system prompt, context and message into the text
+// sent to the AI provider. Providers without context support, like
+// perplexity, only get the query message. The answer language, if set, is
+// requested in the system prompt, or after the message for providers that
+// take no system prompt.
+func buildPrompt(message, context, system, language, providerName string) string {
+	instruction := ""
+	if language != "" {
+		instruction = fmt.Sprintf("Always answer in %s, regardless of the language of the question.", language)
+	}
+	if caps, _ := provider.Lookup(providerName, ""); !caps.Context {
+		if instruction != "" {
+			return message + "\n\n" + instruction
+		}
+		return message
+	}
+	if instruction != "" {
+		system = strings.TrimSpace(system + "\n\n" + instruction)
+	}
+	return render.Prompt(message, context, system)
+}
+
+func StartNewConversation(message string, opts Options, logger *log.Logger) error {
+	result, err := sendMessage(message, opts, logger)
+	if result == nil {
+		if err != nil && opts.Output == OutputJSON {
+			if err := finishEvents("", nil, err); err != nil {
+				logger.Debug("Failed to write error event", "error", err)
+			}
+		}
 		return err
 	}
 
-	// Prepend context to message if it exists (only for sgpt)
-	var fullMessage string
-	if !usePerplexity && context != "" {
-		fullMessage = fmt.Sprintf("# Context\n%s\n\n# Question\n%s", context, message)
-	} else {
-		fullMessage = message
+	// Check the answer in a second pass if asked to
+	var verification []Turn
+	if err == nil && opts.Verify != VerifyNone && result.meta.FinishReason != FinishStoppedByUser {
+		verification, err = verify(result, opts, logger)
+		for i := range verification {
+			verification[i].Timestamp = time.Now()
+		}
 	}
 
-	// Execute AI command based on provider
-	var aiCmd *exec.Cmd
-	if usePerplexity {
-		aiCmd = exec.Command("perplexity", "-g", "--stream", "--citation", fullMessage)
+	var id string
+	if opts.Ephemeral {
+		logger.Debug("Ephemeral mode, conversation not saved")
 	} else {
-		aiCmd = exec.Command("sgpt", "--stream", fullMessage)
+		saved, err := saveResult(message, result, verification, opts, logger)
+		if err != nil {
+			return err
+		}
+		id = saved.ID
 	}
-	stdout, err := aiCmd.StdoutPipe()
+
+	if opts.Output == OutputJSON {
+		if err := finishEvents(id, result.meta, err); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// saveResult saves the answer to message, followed by extra turns, as a
+// new conversation.
+func saveResult(message string, result *sendResult, extra []Turn, opts Options, logger *log.Logger) (Conversation, error) {
+	conv := newThreadConversation(opts.History, Turn{
+		Message:  message,
+		Response: result.response,
+		Meta:     result.meta,
+	})
+	conv.Context = result.context
+	conv.System = result.system
+	conv.Provenance = result.provenance
+	conv.Attachments = result.attachments
+	conv.Turns = append(conv.Turns, extra...)
+	conv.recordPerplexity(result.meta, opts)
+	conv.recordModel(opts)
+	conv.recordPersona(opts)
+	conv.Unread = !shownOnTerminal(opts)
+	if opts.Private {
+		conv.Visibility = VisibilityPrivate
+	}
+	if opts.Queue {
+		QueueAdd(&conv)
+	}
+	saved, err := SaveNewConversation(conv, logger)
 	if err != nil {
-		return fmt.Errorf("failed to create stdout pipe: %w", err)
+		return saved, fmt.Errorf("failed to save conversation: %w", err)
+	}
+	autoTitle(&saved, logger)
+	return saved, nil
+}
+
+// sendResult is the outcome of sending a single message.
+type sendResult struct {
+	// sgptChat is the sgpt chat session the message was sent in, if any.
+	sgptChat string
+	// question is the message as sent, with the thread and attachments.
+	question    string
+	response    string
+	meta        *ResponseMeta
+	context     string
+	system      string
+	provenance  []Provenance
+	attachments []Attachment
+}
+
+// sendMessage sends message, preceded by opts.History, to the AI provider
+// and streams the answer to the terminal. A nil result means nothing was
+// received; otherwise the result is valid even when an error is returned.
+func sendMessage(message string, opts Options, logger *log.Logger) (*sendResult, error) {
+	opts.job = startJob(message, logger)
+	defer opts.job.finish()
+	if opts.Quality != "" && !containsString(config.Qualities, opts.Quality) {
+		return nil, fmt.Errorf("invalid quality %q, expected one of %s", opts.Quality, strings.Join(config.Qualities, ", "))
+	}
+	if err := opts.Perplexity.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.Persona != "" {
+		if err := CheckPersonaName(opts.Persona); err != nil {
+			return nil, err
+		}
+	}
+	opts.Provider = opts.providerName()
+	var routeName string
+	// Pick the provider and model from the routing rules unless a model
+	// was given explicitly
+	if opts.Model == "" {
+		request := provider.Request{Message: message, Attachments: len(opts.Attachments), Quality: opts.Quality}
+		if route, ok := provider.ChooseRoute(config.Current().Routes, request); ok {
+			routeName = route.Name
+			if routeName == "" {
+				routeName = route.Model
+			}
+			opts.Model = route.Model
+			if route.Provider != "" {
+				opts.Provider = route.Provider
+			}
+			logger.Info("Routed request", "route", routeName, "provider", opts.Provider, "model", opts.Model)
+		}
+	}
+	// The configured model belongs to the configured provider
+	if cfg := config.Current(); opts.Model == "" && cfg.Model != "" && opts.Provider == defaultProvider(cfg) {
+		opts.Model = cfg.Model
 	}
-	aiCmd.Stderr = os.Stderr
 
-	if err := aiCmd.Start(); err != nil {
-		return fmt.Errorf("failed to start AI command: %w", err)
+	// Reject options the provider cannot handle before doing any work
+	if err := provider.Require(opts.Provider, opts.Model, opts.requiredFeatures()...); err != nil {
+		return nil, err
 	}
 
-	// Check if style file exists
-	shareDir, err := config.GetShareDir()
-	if err != nil {
-		return fmt.Errorf("failed to get share directory: %w", err)
+	// Load context from the given file or command, or the global context if
+	// not specified, unless it is turned off
+	var context string
+	var err error
+	switch {
+	case opts.NoContext:
+	case opts.ContextFile != "":
+		context, err = ReadInputFile(opts.ContextFile)
+	case opts.ContextCommand != "":
+		context, err = RunContextCommand(opts.ContextCommand, config.Current().Stdin.MaxSize, logger)
+	default:
+		context, err = LoadContext(logger)
 	}
-	stylePath := filepath.Join(shareDir, "ggpt_glow_style.json")
-	hasStyleFile := false
-	if _, err := os.Stat(stylePath); err == nil {
-		logger.Debug("Using custom style", "path", stylePath)
-		hasStyleFile = true
+	if err != nil {
+		logger.Error("Failed to load context", "error", err)
+		return nil, err
 	}
 
-	// Buffer for storing all output
-	var buffer strings.Builder
-	scanner := bufio.NewScanner(stdout)
-	var previousGlowOutput string
-	previousGlowOutput = ""
+	var system string
+	if opts.SystemFile != "" {
+		if system, err = ReadInputFile(opts.SystemFile); err != nil {
+			logger.Error("Failed to load system prompt", "error", err)
+			return nil, err
+		}
+	}
+	// The system prompt of the persona comes before the one given for
+	// this message
+	if opts.Persona != "" {
+		personaPrompt, err := PersonaPrompt(opts.Persona)
+		if err != nil {
+			return nil, err
+		}
+		if bank, _ := LoadExamples(opts.Persona); personaPrompt == "" && len(bank) == 0 && opts.Persona != DefaultPersona {
+			logger.Warn("Persona has neither a system prompt nor examples, see asc persona add", "persona", opts.Persona)
+		}
+		system = strings.TrimSpace(personaPrompt + "\n\n" + system)
+	}
 
-	const HELD_OUT_LINE_COUNT = 4
-	for {
-		if !scanner.Scan() {
-			if err := scanner.Err(); err != nil {
-				if err != io.EOF {
-					return fmt.Errorf("error reading AI output: %w", err)
-				}
-				// Stream is closed (EOF)
-				// break
-			}
-			// No more data and no error (EOF)
-			previousGlowOutputLines := strings.Split(previousGlowOutput, "\n")
-			for i := max(0, len(previousGlowOutputLines)-HELD_OUT_LINE_COUNT); i < len(previousGlowOutputLines); i++ {
-				fmt.Println(previousGlowOutputLines[i])
+	// Show the model answers the user rated up for the persona
+	promptSystem := system
+	if opts.Examples > 0 {
+		persona := opts.Persona
+		if persona == "" {
+			persona = DefaultPersona
+		}
+		bank, err := LoadExamples(persona)
+		if err != nil {
+			return nil, err
+		}
+		if selected := SelectExamples(bank, message, opts.Examples); len(selected) > 0 {
+			promptSystem = strings.TrimSpace(system + "\n\n" + formatExamples(selected))
+			for _, example := range selected {
+				opts.exampleIDs = append(opts.exampleIDs, example.ID)
 			}
-			// Trim excessive trailing newlines before saving
-			response := strings.TrimRightFunc(buffer.String(), func(r rune) bool {
-				return r == '\n' || r == '\r'
-			})
-			if err := SaveNewConversation(response, message, context, logger); err != nil {
-				return fmt.Errorf("failed to save conversation: %w", err)
+			logger.Debug("Added few-shot examples", "persona", persona, "examples", opts.exampleIDs)
+		}
+	}
+
+	var attachments []Attachment
+	var contents []string
+	for _, path := range opts.Attachments {
+		attachment, content, err := LoadAttachment(path)
+		if err != nil {
+			return nil, err
+		}
+		if attachment.Encoding != "" {
+			logger.Info("Transcoded attachment to UTF-8", "path", path, "encoding", attachment.Encoding)
+		}
+		attachments = append(attachments, attachment)
+		contents = append(contents, content)
+	}
+	var images []Attachment
+	for _, path := range opts.Images {
+		image, data, err := LoadImage(path)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+		opts.imageData = append(opts.imageData, data)
+	}
+
+	// Include earlier turns of the thread in the question itself so that
+	// every provider sees them, unless the sgpt chat session has them
+	var chat string
+	history := opts.History
+	if opts.Provider == "sgpt" && opts.SGPTChat != "" {
+		chat = opts.SGPTChat
+		if opts.SGPTChatTurns <= len(history) {
+			history = history[opts.SGPTChatTurns:]
+		}
+	}
+	// Leave out the middle of threads too long for the context window
+	promptTokens := provider.EstimateTokens(message + context + promptSystem + strings.Join(contents, ""))
+	budget := historyBudget(opts.Provider, opts.Model, promptTokens)
+	history, omitted := fitHistory(history, budget)
+	if omitted > 0 {
+		logger.Info("Left out earlier turns to fit the context window", "omitted", omitted, "budget_tokens", budget)
+	}
+	question := appendAttachments(threadMessage(history, message), attachments, contents)
+
+	// Prepend context to message if it exists (only for sgpt)
+	fullMessage := buildPrompt(question, context, promptSystem, opts.Language, opts.Provider)
+	provenance := collectProvenance(opts, context, system, opts.Provider, logger)
+	provenance = append(provenance, attachmentProvenance(attachments)...)
+	provenance = append(provenance, attachmentProvenance(images)...)
+	if caps, _ := provider.Lookup(opts.providerName(), opts.Model); caps.MaxContext > 0 {
+		if tokens := provider.EstimateTokens(fullMessage); tokens > caps.MaxContext {
+			logger.Warn("The prompt may not fit in the context window of the model", "model", opts.Model, "estimated_tokens", tokens, "context_window", caps.MaxContext)
+		}
+	}
+
+	// Answer a prompt sent before from the cache. Prompts sent in an sgpt
+	// chat session lack the history, so they are not cached.
+	var cacheKey, commit string
+	if opts.Cache && chat == "" {
+		commit = projectCommit(opts, logger)
+		cacheKey = answerCacheKey(fullMessage, opts.callSpec(opts.Provider, chat), commit)
+		if cached, ok := lookupCache(cacheKey, logger); ok {
+			logger.Info("Answered from the cache", "created", cached.Created, "commit", cached.Commit)
+			if err := showCached(cached.Response, opts, logger); err != nil {
+				return nil, err
 			}
+			meta := *cached.Meta
+			meta.Cached = true
+			meta.Usage, meta.Cost = nil, nil
+			meta.DurationMS, meta.FirstTokenMS = 0, 0
+			meta.Route = routeName
+			return &sendResult{
+				question:    question,
+				response:    cached.Response,
+				meta:        &meta,
+				context:     context,
+				system:      system,
+				provenance:  provenance,
+				attachments: append(attachments, images...),
+			}, nil
+		}
+	}
+
+	response, meta, err := streamResponse(fullMessage, opts.callSpec(opts.Provider, chat), opts, logger)
+	if meta == nil {
+		return nil, err
+	}
+
+	// Offer a retry when the answer looks like a refusal
+	for err == nil && meta.FinishReason != FinishStoppedByUser {
+		reason, refused := DetectRefusal(response)
+		if !refused {
+			break
+		}
+		retry := RetryAttempt{Reason: reason, Provider: meta.Provider}
+		action := chooseRetryAction(reason, opts, meta.Retries, logger)
+		if action == RetryNone {
 			break
 		}
-		buffer.WriteString(scanner.Text() + "\n")
+		retry.Action = string(action)
 
-		// Execute glow command with buffer content
-		terminalWidth := getTerminalWidth()
-		glowCmd := exec.Command("glow", "-w", fmt.Sprintf("%d", terminalWidth-2))
-		glowCmd.Env = append(os.Environ(), "CLICOLOR_FORCE=1")
+		retryProvider := meta.Provider
+		retryMessage := fullMessage
+		if action == RetryOtherProvider {
+			retryProvider = otherProvider(retryProvider)
+			if err := provider.Require(retryProvider, opts.Model, opts.requiredFeatures()...); err != nil {
+				logger.Warn("Cannot retry with the other provider", "error", err)
+				break
+			}
+			if retryProvider != "sgpt" && len(history) < len(opts.History) {
+				// Other providers do not see the turns in the sgpt session
+				fitted, _ := fitHistory(opts.History, budget)
+				question = appendAttachments(threadMessage(fitted, message), attachments, contents)
+			}
+			retryMessage = buildPrompt(question, context, promptSystem, opts.Language, retryProvider)
+			provenance = collectProvenance(opts, context, system, retryProvider, logger)
+			provenance = append(provenance, attachmentProvenance(attachments)...)
+		} else {
+			retryMessage = clarifyPrompt(fullMessage)
+		}
+		logger.Info("Retrying after refusal", "reason", reason, "action", action)
 
-		if hasStyleFile {
-			glowCmd.Args = append(glowCmd.Args, "--style", stylePath)
+		retries := append(meta.Retries, retry)
+		if retryProvider != "sgpt" {
+			// Answers of other providers are not part of the sgpt session
+			chat = ""
+		}
+		response, meta, err = streamResponse(retryMessage, opts.callSpec(retryProvider, chat), opts, logger)
+		if meta == nil {
+			return nil, err
 		}
+		meta.Retries = retries
+	}
 
-		glowCmd.Stdin = strings.NewReader(buffer.String())
-		glowCmd.Stderr = os.Stderr
-		var glowOutput strings.Builder
-		glowOutput = strings.Builder{}
-		glowCmd.Stdout = &glowOutput
-		if err := glowCmd.Run(); err != nil {
-			return fmt.Errorf("failed to execute glow: %w", err)
+	// Continue answers that were cut off and stitch the parts together
+	for err == nil && !opts.NoAutoContinue && meta.Continuations < maxContinuations {
+		reason, truncated := DetectTruncation(response, meta)
+		if !truncated {
+			break
 		}
-		if previousGlowOutput != glowOutput.String() {
-			previousGlowOutputLines := strings.Split(previousGlowOutput, "\n")
-			glowOutputLines := strings.Split(glowOutput.String(), "\n")
-			for i := max(0, len(previousGlowOutputLines)-HELD_OUT_LINE_COUNT); i < len(glowOutputLines)-HELD_OUT_LINE_COUNT; i++ {
-				fmt.Println(glowOutputLines[i])
-			}
-			previousGlowOutput = glowOutput.String()
+		logger.Info("Response was cut off, continuing", "reason", reason)
+		prompt := buildPrompt(continuePrompt(question, response), context, promptSystem, opts.Language, meta.Provider)
+		continuation, continuationMeta, continueErr := streamResponse(prompt, opts.callSpec(meta.Provider, ""), opts, logger)
+		if continuationMeta == nil {
+			logger.Warn("Failed to continue the response", "error", continueErr)
+			break
+		}
+		response = stitch(response, continuation)
+		meta.Continuations++
+		meta.FinishReason = continuationMeta.FinishReason
+		meta.Error = continuationMeta.Error
+		meta.DurationMS += continuationMeta.DurationMS
+		meta.Usage = addUsage(meta.Usage, continuationMeta.Usage)
+		err = continueErr
+		if meta.FinishReason == FinishStoppedByUser {
+			break
 		}
 	}
 
-	if err := aiCmd.Wait(); err != nil {
-		return fmt.Errorf("AI command failed: %w", err)
+	meta.Route = routeName
+	meta.Cost = EstimateCost(meta.Provider, meta.Model, meta.Usage)
+	if cacheKey != "" && err == nil && meta.FinishReason != FinishStoppedByUser {
+		if err := storeCache(cacheKey, commit, response, meta); err != nil {
+			logger.Warn("Failed to cache the answer", "error", err)
+		}
 	}
 
-	return nil
+	return &sendResult{
+		sgptChat:    chat,
+		question:    question,
+		response:    response,
+		meta:        meta,
+		context:     context,
+		system:      system,
+		provenance:  provenance,
+		attachments: append(attachments, images...),
+	}, err
 }
 
 // DeleteConversation deletes a conversation by its ID
 func DeleteConversation(id string, logger *log.Logger) error {
+	if usesSQLite() {
+		if err := deleteSQLite(id, logger); err != nil {
+			return err
+		}
+		noteDeleted(id, logger)
+		return nil
+	}
+
 	dataDir, err := config.GetDataDir()
 	if err != nil {
 		return fmt.Errorf("failed to get data directory: %w", err)
@@ -291,6 +1008,7 @@ func DeleteConversation(id string, logger *log.Logger) error {
 	}
 
 	logger.Debug("Deleted conversation", "id", id)
+	noteDeleted(id, logger)
 	return nil
 }
 
@@ -303,6 +1021,16 @@ func GetContextPath(logger *log.Logger) (string, error) {
 	return filepath.Join(shareDir, "context.txt"), nil
 }
 
+// GetNamedContextPath returns the path of the context saved under name in
+// the contexts directory.
+func GetNamedContextPath(name string) (string, error) {
+	shareDir, err := config.GetShareDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get share directory: %w", err)
+	}
+	return filepath.Join(shareDir, "contexts", name+".txt"), nil
+}
+
 // LoadContext loads the context from the file
 func LoadContext(logger *log.Logger) (string, error) {
 	contextPath, err := GetContextPath(logger)
@@ -323,12 +1051,19 @@ func LoadContext(logger *log.Logger) (string, error) {
 	return string(content), nil
 }
 
-// SaveContext saves the context to the file
+// SaveContext saves the context to the file. The previous context is kept
+// in the context history.
 func SaveContext(context string, logger *log.Logger) error {
 	contextPath, err := GetContextPath(logger)
 	if err != nil {
 		return err
 	}
+	if current, err := LoadContext(logger); err == nil && current == context {
+		return nil
+	}
+	if err := snapshotContext(logger); err != nil {
+		return err
+	}
 
 	// Create directory if it doesn't exist
 	dir := filepath.Dir(contextPath)
@@ -343,12 +1078,16 @@ func SaveContext(context string, logger *log.Logger) error {
 	return nil
 }
 
-// ClearContext removes the context file
+// ClearContext removes the context file. The removed context is kept in the
+// context history.
 func ClearContext(logger *log.Logger) error {
 	contextPath, err := GetContextPath(logger)
 	if err != nil {
 		return err
 	}
+	if err := snapshotContext(logger); err != nil {
+		return err
+	}
 
 	if err := os.Remove(contextPath); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to remove context file: %w", err)
@@ -0,0 +1,115 @@
+package conversation
+
+import (
+	"asc/internal/config"
+	"asc/internal/provider"
+)
+
+// CostSummary adds up the token usage and cost of the exchanges of a
+// conversation.
+type CostSummary struct {
+	PromptTokens     int
+	CompletionTokens int
+	// Cost is the estimated price in USD of the priced exchanges.
+	Cost float64
+	// Unpriced counts the exchanges with usage but no known price, and
+	// Estimated those whose usage was estimated from the text.
+	Unpriced  int
+	Estimated int
+}
+
+// TotalTokens returns the prompt and completion tokens together.
+func (s CostSummary) TotalTokens() int {
+	return s.PromptTokens + s.CompletionTokens
+}
+
+// Add counts the usage and cost of meta.
+func (s *CostSummary) Add(meta *ResponseMeta) {
+	if meta == nil || meta.Usage == nil {
+		return
+	}
+	s.PromptTokens += meta.Usage.PromptTokens
+	s.CompletionTokens += meta.Usage.CompletionTokens
+	if meta.Usage.Estimated {
+		s.Estimated++
+	}
+	// Answers saved before costs were recorded are priced now
+	cost := meta.Cost
+	if cost == nil {
+		cost = EstimateCost(meta.Provider, meta.Model, meta.Usage)
+	}
+	if cost != nil {
+		s.Cost += *cost
+	} else {
+		s.Unpriced++
+	}
+}
+
+// ConversationCost sums the usage and cost recorded for each exchange of
+// conv.
+func ConversationCost(conv Conversation) CostSummary {
+	var s CostSummary
+	for _, turn := range conv.Exchanges() {
+		s.Add(turn.Meta)
+	}
+	return s
+}
+
+// Price returns the price of model in USD per million input and output
+// tokens: the [pricing] section of the config file, then the model
+// registry.
+func Price(providerName, model string) (input, output float64, ok bool) {
+	if model == "" {
+		return 0, 0, false
+	}
+	if p, found := config.Current().Pricing[model]; found {
+		return p.Input, p.Output, true
+	}
+	m, found := provider.LookupModel(providerName, model)
+	if !found {
+		return 0, 0, false
+	}
+	return m.InputPrice, m.OutputPrice, true
+}
+
+// EstimateCost returns the price of usage with model, or nil when either
+// is not known.
+func EstimateCost(providerName, model string, usage *Usage) *float64 {
+	if usage == nil {
+		return nil
+	}
+	input, output, ok := Price(providerName, model)
+	if !ok {
+		return nil
+	}
+	cost := (float64(usage.PromptTokens)*input + float64(usage.CompletionTokens)*output) / 1e6
+	return &cost
+}
+
+// estimateUsage estimates the usage of an answer from the length of the
+// prompt and response, for providers that do not report it.
+func estimateUsage(prompt, response string) *Usage {
+	promptTokens, completionTokens := provider.EstimateTokens(prompt), provider.EstimateTokens(response)
+	return &Usage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		TotalTokens:      promptTokens + completionTokens,
+		Estimated:        true,
+	}
+}
+
+// addUsage returns the sum of two usages, either of which may be nil.
+func addUsage(a, b *Usage) *Usage {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	return &Usage{
+		PromptTokens:     a.PromptTokens + b.PromptTokens,
+		CompletionTokens: a.CompletionTokens + b.CompletionTokens,
+		TotalTokens:      a.TotalTokens + b.TotalTokens,
+		Estimated:        a.Estimated || b.Estimated,
+	}
+}
@@ -0,0 +1,151 @@
+package conversation
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"asc/internal/config"
+	"asc/internal/render"
+	"asc/internal/sandbox"
+
+	"github.com/charmbracelet/log"
+	"golang.org/x/term"
+)
+
+// TurnToolResult marks turns that record a command run by asc do. Message
+// holds the command and Response its exit code and output.
+const TurnToolResult = render.KindToolResult
+
+// maxCapturedOutput is how much of each output stream is kept in the
+// conversation. Longer output keeps its end, where errors usually are.
+const maxCapturedOutput = 16 * 1024
+
+var commandBlock = regexp.MustCompile("(?s)```(?:sh|bash|shell|zsh|console)?[ \\t]*\\n(.*?)```")
+
+// doPrompt asks for a command that performs task, using only the programs
+// allowed by the sandbox if it limits them.
+func doPrompt(task string, policy config.Sandbox) string {
+	prompt := "Write a shell command that does the following. Reply with the command in a single ```sh block, followed by a short explanation."
+	if len(policy.Allow) > 0 {
+		prompt += " Only use these programs and shell builtins: " + strings.Join(policy.Allow, ", ") + "."
+	}
+	return prompt + "\n\n" + task
+}
+
+// ExtractCommand returns the shell command in response: the first fenced
+// block, or the response itself if it is a single line.
+func ExtractCommand(response string) (string, bool) {
+	if m := commandBlock.FindStringSubmatch(response); m != nil {
+		command := strings.TrimSpace(m[1])
+		return command, command != ""
+	}
+	response = strings.TrimSpace(response)
+	if response == "" || strings.Contains(response, "\n") {
+		return "", false
+	}
+	return strings.Trim(response, "`"), true
+}
+
+// Do asks the provider for a shell command that performs task, as the next
+// turn of conv, and runs it after confirmation unless yes is set. The exit
+// code and output of the command are saved in conv as a tool-result turn,
+// so that follow-ups on the conversation see what happened. Commands the
+// sandbox of the config does not allow are not run.
+func Do(conv *Conversation, task string, opts Options, yes bool, logger *log.Logger) error {
+	policy := config.Current().Sandbox
+	if err := SendTurn(conv, doPrompt(task, policy), opts, logger); err != nil {
+		return err
+	}
+	exchanges := conv.Exchanges()
+	command, ok := ExtractCommand(exchanges[len(exchanges)-1].Response)
+	if !ok {
+		return fmt.Errorf("no command found in the answer")
+	}
+	if err := sandbox.Check(policy, command); err != nil {
+		return fmt.Errorf("not running %q, blocked by the sandbox: %w", command, err)
+	}
+	cmd, err := sandbox.Command(policy, command)
+	if err != nil {
+		return err
+	}
+
+	if !yes {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return fmt.Errorf("not running the command without a terminal to confirm it, pass --yes to run it anyway")
+		}
+		question := "Run this command?"
+		if policy.Enabled() {
+			question = fmt.Sprintf("Run this command in the sandbox (%s)?", sandbox.Describe(policy))
+		}
+		fmt.Fprintf(os.Stderr, "\n$ %s\n%s [y/N] ", command, question)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+			logger.Info("Command not run")
+			return nil
+		}
+	}
+
+	result, runErr := runCommand(cmd, command, logger)
+	conv.Turns = append(conv.Turns, result)
+	if opts.Ephemeral {
+		return runErr
+	}
+	if err := SaveConversation(*conv, logger); err != nil {
+		return fmt.Errorf("failed to save command output: %w", err)
+	}
+	return runErr
+}
+
+// runCommand runs cmd, which runs command with the shell, showing its
+// output as it runs, and returns a tool-result turn describing it. A
+// non-zero exit code is recorded, not returned as an error.
+func runCommand(cmd *exec.Cmd, command string, logger *log.Logger) (Turn, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = io.MultiWriter(os.Stdout, &stdout)
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+
+	start := time.Now()
+	err := cmd.Run()
+	exitCode := 0
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		exitCode = exitErr.ExitCode()
+		err = nil
+	case err != nil:
+		err = fmt.Errorf("failed to run command: %w", err)
+		exitCode = -1
+	}
+	logger.Debug("Ran command", "command", command, "exit_code", exitCode, "duration", time.Since(start))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Exit code: %d", exitCode)
+	for _, stream := range []struct {
+		name string
+		data []byte
+	}{{"stdout", stdout.Bytes()}, {"stderr", stderr.Bytes()}} {
+		if len(stream.data) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n\n%s:\n```\n%s\n```", stream.name, strings.TrimRight(capOutput(stream.data), "\n"))
+	}
+	return Turn{Timestamp: time.Now(), Kind: TurnToolResult, Message: command, Response: b.String()}, err
+}
+
+// capOutput keeps the last maxCapturedOutput bytes of data.
+func capOutput(data []byte) string {
+	if len(data) <= maxCapturedOutput {
+		return string(data)
+	}
+	skipped := len(data) - maxCapturedOutput
+	return fmt.Sprintf("[... %d bytes omitted ...]\n%s", skipped, strings.ToValidUTF8(string(data[skipped:]), ""))
+}
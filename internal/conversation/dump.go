@@ -0,0 +1,175 @@
+package conversation
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// DefaultDumpRetentionDays is how long dumps are kept when no retention is
+// configured.
+const DefaultDumpRetentionDays = 7
+
+// dumpSuffix is the extension of dump files; only these are cleaned up.
+const dumpSuffix = ".dump.txt"
+
+// DumpOptions enable writing the raw requests and responses of providers
+// to files in Dir for troubleshooting. Secrets are redacted with
+// SecretPatterns. Dumps older than RetentionDays are deleted.
+type DumpOptions struct {
+	Dir           string
+	RetentionDays int
+}
+
+// dumpFile records one provider call. A nil dumpFile ignores every call, so
+// that callers need not check whether dumping is enabled.
+type dumpFile struct {
+	f        *os.File
+	redactor *Redactor
+	// mu guards stderr and http, which the provider writes to from its
+	// own goroutines.
+	mu     sync.Mutex
+	stderr bytes.Buffer
+	http   bytes.Buffer
+}
+
+// openDump starts a dump of a call to providerName. Failing to dump is
+// logged and never fails the request.
+func openDump(dump DumpOptions, providerName string, logger *log.Logger) *dumpFile {
+	if dump.Dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(dump.Dir, 0700); err != nil {
+		logger.Warn("Failed to create dump directory", "dir", dump.Dir, "error", err)
+		return nil
+	}
+	pruneDumps(dump, logger)
+
+	now := time.Now()
+	name := fmt.Sprintf("%s-%s%s", now.Format("20060102-150405.000"), providerName, dumpSuffix)
+	f, err := os.OpenFile(filepath.Join(dump.Dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		logger.Warn("Failed to create dump file", "error", err)
+		return nil
+	}
+	redactor, err := NewRedactor(nil, nil, true)
+	if err != nil {
+		f.Close()
+		logger.Warn("Failed to set up redaction for dump", "error", err)
+		return nil
+	}
+	fmt.Fprintf(f, "time: %s\n", now.Format(time.RFC3339Nano))
+	logger.Debug("Dumping provider call", "path", f.Name())
+	return &dumpFile{f: f, redactor: redactor}
+}
+
+// request records the request described by args, whose last element is
+// the prompt.
+func (d *dumpFile) request(args []string) {
+	if d == nil {
+		return
+	}
+	fmt.Fprintf(d.f, "command: %s\n\n--- request ---\n%s\n\n--- response ---\n",
+		d.redact(strings.Join(args[:len(args)-1], " ")), d.redact(args[len(args)-1]))
+}
+
+func (d *dumpFile) redact(text string) string {
+	redacted, _ := d.redactor.Redact(text)
+	return redacted
+}
+
+// chunk records a piece of the response exactly as the provider delivered
+// it, quoted so that the chunk boundaries and control characters show.
+func (d *dumpFile) chunk(chunk string) {
+	if d == nil {
+		return
+	}
+	fmt.Fprintf(d.f, "%q\n", d.redact(chunk))
+}
+
+// Write collects the stderr of the provider, which is written at the end
+// so that it does not interleave with the response.
+func (d *dumpFile) Write(p []byte) (int, error) {
+	if d == nil {
+		return len(p), nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stderr.Write(p)
+}
+
+// trace returns the writer for the raw HTTP traffic of the provider, which
+// is likewise written at the end.
+func (d *dumpFile) trace() io.Writer {
+	if d == nil {
+		return nil
+	}
+	return httpTrace{d}
+}
+
+type httpTrace struct{ d *dumpFile }
+
+func (t httpTrace) Write(p []byte) (int, error) {
+	t.d.mu.Lock()
+	defer t.d.mu.Unlock()
+	return t.d.http.Write(p)
+}
+
+// close records how the call finished and closes the file. Only the first
+// call has an effect.
+func (d *dumpFile) close(meta *ResponseMeta, err error) {
+	if d == nil || d.f == nil {
+		return
+	}
+	d.mu.Lock()
+	if d.http.Len() > 0 {
+		fmt.Fprintf(d.f, "\n--- http ---\n%s", d.redact(d.http.String()))
+	}
+	if d.stderr.Len() > 0 {
+		fmt.Fprintf(d.f, "\n--- stderr ---\n%s", d.redact(d.stderr.String()))
+	}
+	d.mu.Unlock()
+	fmt.Fprintf(d.f, "\n--- result ---\n")
+	if meta != nil {
+		fmt.Fprintf(d.f, "finish_reason: %s\nduration_ms: %d\nfirst_token_ms: %d\n", meta.FinishReason, meta.DurationMS, meta.FirstTokenMS)
+	}
+	if err != nil {
+		fmt.Fprintf(d.f, "error: %s\n", d.redact(err.Error()))
+	}
+	d.f.Close()
+	d.f = nil
+}
+
+// pruneDumps deletes dumps older than the retention period.
+func pruneDumps(dump DumpOptions, logger *log.Logger) {
+	days := dump.RetentionDays
+	if days <= 0 {
+		days = DefaultDumpRetentionDays
+	}
+	cutoff := time.Now().AddDate(0, 0, -days)
+
+	entries, err := os.ReadDir(dump.Dir)
+	if err != nil {
+		logger.Debug("Failed to read dump directory", "error", err)
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), dumpSuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dump.Dir, entry.Name())); err != nil {
+			logger.Debug("Failed to delete old dump", "file", entry.Name(), "error", err)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package conversation
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"asc/internal/config"
+
+	"github.com/charmbracelet/log"
+)
+
+// maxEntryMessage is how much of the first message an Entry keeps; lists
+// only show its beginning.
+const maxEntryMessage = 512
+
+// Entry is the part of a conversation shown in lists. It is small, so that
+// listing long histories with large answers does not hold them in memory;
+// the conversation itself is loaded with LoadConversation when needed.
+type Entry struct {
+	ID         string
+	Timestamp  time.Time
+	Message    string
+	Title      string
+	Unread     bool
+	Visibility string
+	Metadata   map[string]string
+	Tags       []string
+	Queued     *time.Time
+	QueueDone  *time.Time
+	Archived   *time.Time
+	Pinned     bool
+	Checksum   string
+	Changed    *time.Time
+}
+
+// NewEntry returns the list entry of conv.
+func NewEntry(conv Conversation) Entry {
+	message := conv.Message
+	if len(message) > maxEntryMessage {
+		message = strings.ToValidUTF8(message[:maxEntryMessage], "")
+	}
+	return Entry{
+		ID:         conv.ID,
+		Timestamp:  conv.Timestamp,
+		Message:    message,
+		Title:      conv.Title,
+		Unread:     conv.Unread,
+		Visibility: conv.Visibility,
+		Metadata:   conv.Metadata,
+		Tags:       conv.Tags,
+		Queued:     conv.Queued,
+		QueueDone:  conv.QueueDone,
+		Archived:   conv.Archived,
+		Pinned:     conv.Pinned,
+		Checksum:   conv.Checksum,
+		Changed:    conv.Changed,
+	}
+}
+
+// LoadEntries returns the list entries of all saved conversations. Each
+// file is decoded and dropped in turn, so only one conversation is held
+// in full at a time; the database stores entries as columns.
+func LoadEntries(logger *log.Logger) ([]Entry, error) {
+	if usesSQLite() {
+		return loadEntriesSQLite(logger)
+	}
+
+	dataDir, err := config.GetDataDir()
+	if err != nil {
+		return nil, err
+	}
+
+	conversationsDir := filepath.Join(dataDir, "conversations")
+	files, err := os.ReadDir(conversationsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(conversationsDir, file.Name()))
+		if err != nil {
+			logger.Error("Failed to read conversation file", "file", file.Name(), "error", err)
+			continue
+		}
+		var conv Conversation
+		if err := json.Unmarshal(data, &conv); err != nil {
+			logger.Error("Failed to unmarshal conversation", "file", file.Name(), "error", err)
+			continue
+		}
+		entries = append(entries, NewEntry(conv))
+	}
+	logger.Debug("Loaded conversation entries", "count", len(entries))
+	return entries, nil
+}
+
+// Size estimates the memory held by the conversation, in bytes.
+func (c Conversation) Size() int {
+	size := len(c.Message) + len(c.Response) + len(c.Context) + len(c.System)
+	for _, turn := range c.Turns {
+		size += len(turn.Message) + len(turn.Response)
+	}
+	return size
+}
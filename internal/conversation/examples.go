@@ -0,0 +1,232 @@
+package conversation
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"asc/internal/config"
+)
+
+// PersonaKey is the metadata key of the persona a conversation was held
+// as. Conversations without it belong to DefaultPersona.
+const PersonaKey = "persona"
+
+// DefaultPersona is the persona of conversations that do not name one.
+const DefaultPersona = "default"
+
+// maxExampleSize is the largest question plus answer kept as an example,
+// in bytes, so that a few examples do not crowd out the prompt.
+const maxExampleSize = 4000
+
+// Example is a question and answer rated up, kept to show the model what
+// good answers look like.
+type Example struct {
+	// ID is the conversation the example comes from.
+	ID       string `json:"id"`
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+}
+
+// PersonaOf returns the persona recorded in metadata.
+func PersonaOf(metadata map[string]string) string {
+	if persona := metadata[PersonaKey]; persona != "" {
+		return persona
+	}
+	return DefaultPersona
+}
+
+// CheckPersonaName rejects persona names that cannot be used as file
+// names.
+func CheckPersonaName(name string) error {
+	return checkFileName("persona", name)
+}
+
+// checkFileName rejects names of kind that cannot be used as file names.
+func checkFileName(kind, name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\ `) {
+		return fmt.Errorf("invalid %s name %q", kind, name)
+	}
+	return nil
+}
+
+// BuildExamples collects the exchanges of the conversations of persona
+// that were rated up, newest first. Each conversation gives its last
+// message and answer; long ones are left out.
+func BuildExamples(conversations []Conversation, persona string) []Example {
+	var examples []Example
+	sorted := append([]Conversation{}, conversations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Timestamp.After(sorted[j].Timestamp) })
+	for _, conv := range sorted {
+		if conv.Metadata[RatingKey] != RatingUp || PersonaOf(conv.Metadata) != persona {
+			continue
+		}
+		var last Turn
+		for _, ex := range conv.Exchanges() {
+			if ex.Kind == "" {
+				last = ex
+			}
+		}
+		if strings.TrimSpace(last.Message) == "" || strings.TrimSpace(last.Response) == "" ||
+			len(last.Message)+len(last.Response) > maxExampleSize {
+			continue
+		}
+		examples = append(examples, Example{ID: conv.ID, Question: last.Message, Answer: last.Response})
+	}
+	return examples
+}
+
+// examplesPath returns the file of the example bank of persona.
+func examplesPath(persona string) (string, error) {
+	if err := CheckPersonaName(persona); err != nil {
+		return "", err
+	}
+	shareDir, err := config.GetShareDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get share directory: %w", err)
+	}
+	return filepath.Join(shareDir, "examples", persona+".json"), nil
+}
+
+// SaveExamples replaces the example bank of persona and returns its path.
+func SaveExamples(persona string, examples []Example) (string, error) {
+	path, err := examplesPath(persona)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create examples directory: %w", err)
+	}
+	data, err := json.MarshalIndent(examples, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal examples: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write examples: %w", err)
+	}
+	return path, nil
+}
+
+// LoadExamples returns the example bank of persona, which is empty until
+// asc examples build has run.
+func LoadExamples(persona string) ([]Example, error) {
+	path, err := examplesPath(persona)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read examples: %w", err)
+	}
+	var examples []Example
+	if err := json.Unmarshal(data, &examples); err != nil {
+		return nil, fmt.Errorf("invalid examples in %s: %w", path, err)
+	}
+	return examples, nil
+}
+
+// ExamplePersonas returns the names of the personas with an example bank.
+func ExamplePersonas() ([]string, error) {
+	shareDir, err := config.GetShareDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get share directory: %w", err)
+	}
+	paths, err := filepath.Glob(filepath.Join(shareDir, "examples", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, path := range paths {
+		names = append(names, strings.TrimSuffix(filepath.Base(path), ".json"))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// RedactExamples scrubs the example banks of every persona with r and
+// returns the number of replacements. With dryRun nothing is rewritten.
+func RedactExamples(r *Redactor, dryRun bool) (int, error) {
+	personas, err := ExamplePersonas()
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, persona := range personas {
+		examples, err := LoadExamples(persona)
+		if err != nil {
+			return total, err
+		}
+		n := 0
+		for i := range examples {
+			n += redactText(&examples[i].Question, r) + redactText(&examples[i].Answer, r)
+		}
+		total += n
+		if n == 0 || dryRun {
+			continue
+		}
+		if _, err := SaveExamples(persona, examples); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// SelectExamples returns the k examples whose questions share the most
+// words with message. Ties keep the order of the bank, newest first.
+func SelectExamples(examples []Example, message string, k int) []Example {
+	if k <= 0 || len(examples) == 0 {
+		return nil
+	}
+	words := exampleWords(message)
+	type scored struct {
+		example Example
+		score   int
+	}
+	candidates := make([]scored, len(examples))
+	for i, example := range examples {
+		score := 0
+		for word := range exampleWords(example.Question) {
+			if words[word] {
+				score++
+			}
+		}
+		candidates[i] = scored{example, score}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].score > candidates[j].score })
+	selected := make([]Example, 0, min(k, len(candidates)))
+	for _, c := range candidates[:min(k, len(candidates))] {
+		selected = append(selected, c.example)
+	}
+	return selected
+}
+
+// exampleWords returns the lower-cased words of text that are long enough
+// to tell questions apart.
+func exampleWords(text string) map[string]bool {
+	words := map[string]bool{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(word)) > 3 {
+			words[word] = true
+		}
+	}
+	return words
+}
+
+// formatExamples renders examples for the system prompt.
+func formatExamples(examples []Example) string {
+	var b strings.Builder
+	b.WriteString("Earlier questions and answers the user rated as good. Answer in the same manner.")
+	for _, example := range examples {
+		fmt.Fprintf(&b, "\n\n## Example question\n%s\n\n## Example answer\n%s", example.Question, example.Answer)
+	}
+	return b.String()
+}
@@ -0,0 +1,94 @@
+package conversation
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Export formats of a single conversation.
+const (
+	TranscriptMarkdown = "markdown"
+	TranscriptJSON     = "json"
+	TranscriptHTML     = "html"
+)
+
+// ParseTranscriptFormat checks an export format given by the user.
+func ParseTranscriptFormat(s string) (string, error) {
+	switch strings.ToLower(s) {
+	case "md", TranscriptMarkdown:
+		return TranscriptMarkdown, nil
+	case TranscriptJSON:
+		return TranscriptJSON, nil
+	case "htm", TranscriptHTML:
+		return TranscriptHTML, nil
+	}
+	return "", fmt.Errorf("invalid export format %q, expected %s, %s or %s", s, TranscriptMarkdown, TranscriptHTML, TranscriptJSON)
+}
+
+// TranscriptFormat returns the export format implied by the extension of
+// path: "json" for .json, "html" for .html, otherwise "markdown".
+func TranscriptFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return TranscriptJSON
+	case ".html", ".htm":
+		return TranscriptHTML
+	}
+	return TranscriptMarkdown
+}
+
+// TranscriptExtension returns the file extension of format, including
+// the dot.
+func TranscriptExtension(format string) string {
+	switch format {
+	case TranscriptJSON:
+		return ".json"
+	case TranscriptHTML:
+		return ".html"
+	}
+	return ".md"
+}
+
+// Transcript returns conv in format.
+func Transcript(conv Conversation, format string) ([]byte, error) {
+	switch format {
+	case TranscriptJSON:
+		data, err := json.MarshalIndent(conv, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal conversation: %w", err)
+		}
+		return append(data, '\n'), nil
+	case TranscriptHTML:
+		page, err := FormatHTML(conv)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(page), nil
+	}
+	return []byte(FormatConversation(conv) + "\n"), nil
+}
+
+// WriteTranscript writes conv to path in format, or in the format implied
+// by the extension of path if format is empty.
+func WriteTranscript(conv Conversation, path, format string) error {
+	if format == "" {
+		format = TranscriptFormat(path)
+	}
+	data, err := Transcript(conv, format)
+	if err != nil {
+		return err
+	}
+
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write transcript: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package conversation
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"asc/internal/style"
+
+	"github.com/charmbracelet/log"
+)
+
+// SplitKey is the metadata key that links the conversations of one
+// asc new --split to the ID of the first of them.
+const SplitKey = "split"
+
+// SplitSeparator separates the questions of asc new --split.
+const SplitSeparator = ";;"
+
+// maxFanOut is how many questions of a split are sent at the same time.
+const maxFanOut = 4
+
+// SplitQuestions splits message into the questions separated by
+// SplitSeparator, dropping empty ones.
+func SplitQuestions(message string) []string {
+	var questions []string
+	for _, q := range strings.Split(message, SplitSeparator) {
+		if q = strings.TrimSpace(q); q != "" {
+			questions = append(questions, q)
+		}
+	}
+	return questions
+}
+
+// FanOut sends each message as an independent conversation, several at a
+// time, and prints the answers as sections in the order of the messages.
+// The conversations are saved with SplitKey set to the ID of the first
+// one. It returns the IDs of the saved conversations.
+func FanOut(messages []string, opts Options, logger *log.Logger) ([]string, error) {
+	if opts.Output == OutputJSON {
+		return nil, fmt.Errorf("several questions cannot be written as JSON Lines, send them one at a time")
+	}
+	results := make([]*sendResult, len(messages))
+	errs := make([]error, len(messages))
+	done := make([]chan struct{}, len(messages))
+	limit := make(chan struct{}, maxFanOut)
+	var wg sync.WaitGroup
+	for i, message := range messages {
+		done[i] = make(chan struct{})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(done[i])
+			limit <- struct{}{}
+			defer func() { <-limit }()
+			o := opts
+			// Answers are printed whole once they are complete
+			o.OnLine = func(string) {}
+			results[i], errs[i] = sendMessage(message, o, logger)
+		}()
+	}
+
+	var renderer *style.Renderer
+	if opts.Output == OutputMarkdown && shownOnTerminal(opts) {
+		var err error
+		if renderer, err = style.NewRenderer(getTerminalWidth(), logger); err != nil {
+			return nil, err
+		}
+	}
+	for i, message := range messages {
+		<-done[i]
+		answer := ""
+		if results[i] != nil {
+			answer = results[i].response
+		}
+		if errs[i] != nil {
+			answer = strings.TrimSpace(answer + "\n\n*Error: " + errs[i].Error() + "*")
+		}
+		section := fmt.Sprintf("## %d. %s\n\n%s\n", i+1, firstLine(message), answer)
+		if renderer != nil {
+			if rendered, err := renderer.Render(section); err == nil {
+				section = rendered
+			}
+		}
+		fmt.Fprintln(os.Stdout, section)
+	}
+	wg.Wait()
+
+	var ids []string
+	var first Conversation
+	for i, message := range messages {
+		if results[i] == nil || opts.Ephemeral {
+			continue
+		}
+		saved, err := saveResult(message, results[i], nil, opts, logger)
+		if err != nil {
+			return ids, err
+		}
+		if first.ID == "" {
+			first = saved
+		}
+		SetMetadata(&saved, map[string]string{SplitKey: first.ID})
+		if err := SaveConversation(saved, logger); err != nil {
+			return ids, fmt.Errorf("failed to link conversation: %w", err)
+		}
+		ids = append(ids, saved.ID)
+	}
+	return ids, errors.Join(errs...)
+}
+
+// firstLine returns the first line of s, for headings.
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
@@ -0,0 +1,101 @@
+package conversation
+
+import (
+	"fmt"
+	"time"
+
+	"asc/internal/timeutil"
+)
+
+// Filter selects conversations by their attributes. The zero value matches
+// every conversation.
+type Filter struct {
+	// Since excludes conversations older than this time when non-zero.
+	Since time.Time
+	// Until excludes conversations newer than this time when non-zero. A
+	// day without a time of day is included up to its end.
+	Until time.Time
+	// Metadata keeps conversations with these metadata values; an empty
+	// value only requires the key.
+	Metadata map[string]string
+	// Tags keeps conversations that carry all of these tags.
+	Tags []string
+	// IDs keeps only the conversations with these IDs when non-nil, e.g.
+	// the results of a search.
+	IDs map[string]bool
+}
+
+// NewTimeFilter builds a Filter from --since/--until style arguments.
+// Empty strings leave the corresponding bound open.
+func NewTimeFilter(since, until string) (Filter, error) {
+	var f Filter
+	now := time.Now()
+	if since != "" {
+		t, err := timeutil.Parse(since, now)
+		if err != nil {
+			return f, fmt.Errorf("invalid --since: %w", err)
+		}
+		f.Since = t
+	}
+	if until != "" {
+		t, err := timeutil.ParseEnd(until, now)
+		if err != nil {
+			return f, fmt.Errorf("invalid --until: %w", err)
+		}
+		f.Until = t
+	}
+	if !f.Since.IsZero() && !f.Until.IsZero() && f.Until.Before(f.Since) {
+		return f, fmt.Errorf("--until (%s) is before --since (%s)",
+			timeutil.Format(f.Until), timeutil.Format(f.Since))
+	}
+	return f, nil
+}
+
+// HasTime reports whether Since or Until is set.
+func (f Filter) HasTime() bool {
+	return !f.Since.IsZero() || !f.Until.IsZero()
+}
+
+// Match reports whether conv satisfies the filter.
+func (f Filter) Match(conv Conversation) bool {
+	return f.MatchTime(conv.Timestamp) && matchMetadata(conv.Metadata, f.Metadata) &&
+		matchTags(conv.Tags, f.Tags) && f.matchID(conv.ID)
+}
+
+func (f Filter) matchID(id string) bool {
+	return f.IDs == nil || f.IDs[id]
+}
+
+// MatchTime reports whether t lies within Since and Until.
+func (f Filter) MatchTime(t time.Time) bool {
+	if !f.Since.IsZero() && t.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && t.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+// Apply returns the conversations that satisfy the filter, keeping order.
+func (f Filter) Apply(conversations []Conversation) []Conversation {
+	var matched []Conversation
+	for _, conv := range conversations {
+		if f.Match(conv) {
+			matched = append(matched, conv)
+		}
+	}
+	return matched
+}
+
+// ApplyEntries returns the entries that satisfy the filter, keeping order.
+func (f Filter) ApplyEntries(entries []Entry) []Entry {
+	var matched []Entry
+	for _, entry := range entries {
+		if f.MatchTime(entry.Timestamp) && matchMetadata(entry.Metadata, f.Metadata) &&
+			matchTags(entry.Tags, f.Tags) && f.matchID(entry.ID) {
+			matched = append(matched, entry)
+		}
+	}
+	return matched
+}
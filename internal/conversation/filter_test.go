@@ -0,0 +1,28 @@
+package conversation
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeFilterUntilDate(t *testing.T) {
+	f, err := NewTimeFilter("2025-07-01", "2025-07-31")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		timestamp time.Time
+		want      bool
+	}{
+		{time.Date(2025, 7, 1, 0, 0, 0, 0, time.Local), true},
+		{time.Date(2025, 7, 31, 0, 0, 0, 0, time.Local), true},
+		{time.Date(2025, 7, 31, 18, 45, 0, 0, time.Local), true},
+		{time.Date(2025, 8, 1, 0, 0, 0, 0, time.Local), false},
+		{time.Date(2025, 6, 30, 23, 59, 0, 0, time.Local), false},
+	}
+	for _, test := range tests {
+		if got := f.Match(Conversation{Timestamp: test.timestamp}); got != test.want {
+			t.Errorf("Match(%v) = %v, want %v", test.timestamp, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package conversation
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"asc/internal/provider"
+
+	"github.com/charmbracelet/log"
+)
+
+// fakeProvider answers every call with answer, word by word. With hang it
+// then waits until the call is cancelled, like a provider still
+// generating. Title requests are answered with a fixed title.
+type fakeProvider struct {
+	answer string
+	hang   bool
+
+	mu      sync.Mutex
+	prompts []string
+}
+
+func (f *fakeProvider) Available() error { return nil }
+
+func (f *fakeProvider) Stream(ctx context.Context, call provider.Call) (*provider.Stream, error) {
+	f.mu.Lock()
+	f.prompts = append(f.prompts, call.Prompt)
+	f.mu.Unlock()
+	answer, hang := f.answer, f.hang
+	if strings.HasPrefix(call.Prompt, "Write a title") {
+		answer, hang = "Fake title", false
+	}
+	tokens := make(chan string)
+	done := make(chan struct{})
+	var err error
+	go func() {
+		defer close(done)
+		defer close(tokens)
+		for _, token := range strings.SplitAfter(answer, " ") {
+			select {
+			case tokens <- token:
+			case <-ctx.Done():
+				err = ctx.Err()
+				return
+			}
+		}
+		if hang {
+			<-ctx.Done()
+			err = ctx.Err()
+		}
+	}()
+	return &provider.Stream{
+		Command: []string{"fake", call.Prompt},
+		Tokens:  tokens,
+		Wait: func() (provider.Result, error) {
+			<-done
+			return provider.Result{FinishReason: "stop", PromptTokens: 12, CompletionTokens: 3}, err
+		},
+	}, nil
+}
+
+// useFake isolates the data of asc and registers f as the provider
+// "fake".
+func useFake(t *testing.T, f *fakeProvider) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_DATA_HOME", filepath.Join(dir, "share"))
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	provider.Register("fake", f, provider.Capabilities{Streaming: true, SystemPrompt: true, Context: true, Model: true})
+}
+
+// onlyConversation returns the single saved conversation.
+func onlyConversation(t *testing.T, logger *log.Logger) Conversation {
+	t.Helper()
+	conversations, err := LoadConversations(logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conversations) != 1 {
+		t.Fatalf("%d conversations saved, want 1", len(conversations))
+	}
+	return conversations[0]
+}
+
+func TestConversationFlow(t *testing.T) {
+	logger := log.New(io.Discard)
+	fake := &fakeProvider{answer: "Use slices.Sort."}
+	useFake(t, fake)
+	var lines []string
+	opts := Options{Provider: "fake", Model: "fake-1", OnLine: func(line string) { lines = append(lines, line) }}
+
+	if err := StartNewConversation("How do I sort a slice?", opts, logger); err != nil {
+		t.Fatal(err)
+	}
+	conv := onlyConversation(t, logger)
+	if conv.Message != "How do I sort a slice?" || conv.Response != "Use slices.Sort." {
+		t.Errorf("saved %q / %q", conv.Message, conv.Response)
+	}
+	if strings.Join(lines, "\n") != "Use slices.Sort." {
+		t.Errorf("streamed lines %q", lines)
+	}
+	meta := conv.Meta
+	if meta == nil || meta.Provider != "fake" || meta.Model != "fake-1" || meta.FinishReason != "stop" {
+		t.Fatalf("saved meta %+v", meta)
+	}
+	if meta.Usage == nil || meta.Usage.PromptTokens != 12 || meta.Usage.CompletionTokens != 3 {
+		t.Errorf("saved usage %+v, want the tokens the provider reported", meta.Usage)
+	}
+	if conv.Title != "Fake title" {
+		t.Errorf("title %q, want the one the provider gave", conv.Title)
+	}
+
+	fake.answer = "Use slices.SortFunc."
+	if err := SendTurn(&conv, "And in reverse?", opts, logger); err != nil {
+		t.Fatal(err)
+	}
+	conv = onlyConversation(t, logger)
+	exchanges := conv.Exchanges()
+	if len(exchanges) != 2 || exchanges[1].Message != "And in reverse?" || exchanges[1].Response != "Use slices.SortFunc." {
+		t.Fatalf("saved exchanges %+v", exchanges)
+	}
+	if exchanges[1].Meta == nil || exchanges[1].Meta.Provider != "fake" {
+		t.Errorf("saved meta of the second turn %+v", exchanges[1].Meta)
+	}
+	// The earlier turn is sent as history
+	last := fake.prompts[len(fake.prompts)-1]
+	if !strings.Contains(last, "How do I sort a slice?") || !strings.Contains(last, "Use slices.Sort.") {
+		t.Errorf("follow-up prompt lacks the history: %q", last)
+	}
+}
+
+func TestConversationFlowStopped(t *testing.T) {
+	logger := log.New(io.Discard)
+	useFake(t, &fakeProvider{answer: "First line\nSecond", hang: true})
+	interrupt := make(chan struct{})
+	var once sync.Once
+	opts := Options{
+		Provider: "fake",
+		// Stop once the first line has arrived
+		OnLine:    func(string) { once.Do(func() { close(interrupt) }) },
+		Interrupt: interrupt,
+	}
+
+	if err := StartNewConversation("Count", opts, logger); err != nil {
+		t.Fatal(err)
+	}
+	conv := onlyConversation(t, logger)
+	if conv.Meta == nil || conv.Meta.FinishReason != FinishStoppedByUser {
+		t.Fatalf("saved meta %+v, want finish reason %q", conv.Meta, FinishStoppedByUser)
+	}
+	if !strings.HasPrefix(conv.Response, "First line\nSecond") || !strings.HasSuffix(conv.Response, stoppedMarker) {
+		t.Errorf("saved response %q, want the partial answer and the stop marker", conv.Response)
+	}
+}
@@ -0,0 +1,97 @@
+package conversation
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ParseMetadata parses key=value arguments. Keys may not contain spaces or
+// "=", and values may not be empty; UnsetMetadata removes keys.
+func ParseMetadata(args []string) (map[string]string, error) {
+	values := map[string]string{}
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid metadata %q, expected key=value", arg)
+		}
+		if err := checkMetadataKey(key); err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+// ParseMetadataFilter parses --meta arguments: key=value matches that value
+// and a bare key matches conversations that have the key.
+func ParseMetadataFilter(args []string) (map[string]string, error) {
+	values := map[string]string{}
+	for _, arg := range args {
+		key, value, _ := strings.Cut(arg, "=")
+		if err := checkMetadataKey(key); err != nil {
+			return nil, fmt.Errorf("invalid --meta %q: %w", arg, err)
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+func checkMetadataKey(key string) error {
+	if key == "" || strings.ContainsAny(key, " \t\n") {
+		return fmt.Errorf("invalid metadata key %q", key)
+	}
+	return nil
+}
+
+// SetMetadata adds values to the metadata of conv, replacing existing keys.
+func SetMetadata(conv *Conversation, values map[string]string) {
+	if conv.Metadata == nil {
+		conv.Metadata = map[string]string{}
+	}
+	for key, value := range values {
+		conv.Metadata[key] = value
+	}
+}
+
+// UnsetMetadata removes keys from the metadata of conv. It returns an
+// error naming the keys that were not set.
+func UnsetMetadata(conv *Conversation, keys []string) error {
+	var missing []string
+	for _, key := range keys {
+		if _, ok := conv.Metadata[key]; !ok {
+			missing = append(missing, key)
+			continue
+		}
+		delete(conv.Metadata, key)
+	}
+	if len(conv.Metadata) == 0 {
+		conv.Metadata = nil
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("no metadata %s in conversation %s", strings.Join(missing, ", "), conv.ID)
+	}
+	return nil
+}
+
+// MetadataKeys returns the keys of metadata, sorted.
+func MetadataKeys(metadata map[string]string) []string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// matchMetadata reports whether metadata has every key of want, with the
+// same value unless the wanted value is empty.
+func matchMetadata(metadata, want map[string]string) bool {
+	for key, value := range want {
+		got, ok := metadata[key]
+		if !ok || (value != "" && got != value) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,58 @@
+package conversation
+
+import (
+	"fmt"
+	"strings"
+
+	"asc/internal/config"
+)
+
+// PerplexityOptions are the search options of perplexity. They are saved
+// with conversations answered by perplexity and reused for follow-ups.
+type PerplexityOptions struct {
+	// NoCitations turns off the list of sources under the answer.
+	NoCitations bool `json:"no_citations,omitempty"`
+	// Focus restricts the search, e.g. to "scholar" or "youtube".
+	Focus string `json:"focus,omitempty"`
+	// Recency only searches pages from the last hour, day, week, month or
+	// year.
+	Recency string `json:"recency,omitempty"`
+}
+
+// Validate checks options given by the user.
+func (p PerplexityOptions) Validate() error {
+	if p.Recency != "" && !containsString(config.Recencies, p.Recency) {
+		return fmt.Errorf("invalid recency %q, expected one of %s", p.Recency, strings.Join(config.Recencies, ", "))
+	}
+	return nil
+}
+
+// IsZero reports whether p holds the defaults.
+func (p PerplexityOptions) IsZero() bool {
+	return p == PerplexityOptions{}
+}
+
+// recordPerplexity saves the search options with conv if meta comes from
+// perplexity.
+func (c *Conversation) recordPerplexity(meta *ResponseMeta, opts Options) {
+	if meta == nil || meta.Provider != "perplexity" {
+		return
+	}
+	p := opts.Perplexity
+	c.Perplexity = &p
+}
+
+// args returns the perplexity command line arguments for p.
+func (p PerplexityOptions) args() []string {
+	var args []string
+	if !p.NoCitations {
+		args = append(args, "--citation")
+	}
+	if p.Focus != "" {
+		args = append(args, "--focus", p.Focus)
+	}
+	if p.Recency != "" {
+		args = append(args, "--recency", p.Recency)
+	}
+	return args
+}
@@ -0,0 +1,94 @@
+package conversation
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"asc/internal/config"
+)
+
+// personaPath returns the file of the system prompt of persona.
+func personaPath(persona string) (string, error) {
+	if err := CheckPersonaName(persona); err != nil {
+		return "", err
+	}
+	shareDir, err := config.GetShareDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get share directory: %w", err)
+	}
+	return filepath.Join(shareDir, "personas", persona+".md"), nil
+}
+
+// PersonaPrompt returns the system prompt of persona, or "" if it has
+// none.
+func PersonaPrompt(persona string) (string, error) {
+	path, err := personaPath(persona)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read persona %s: %w", persona, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// SavePersona sets the system prompt of persona and returns its path.
+func SavePersona(persona, prompt string) (string, error) {
+	path, err := personaPath(persona)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create personas directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(strings.TrimSpace(prompt)+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("failed to write persona %s: %w", persona, err)
+	}
+	return path, nil
+}
+
+// DeletePersona removes the system prompt of persona. Its examples and
+// conversations are kept.
+func DeletePersona(persona string) error {
+	path, err := personaPath(persona)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("persona %s does not exist", persona)
+		}
+		return fmt.Errorf("failed to remove persona %s: %w", persona, err)
+	}
+	return nil
+}
+
+// ListPersonas returns the names of the personas with a system prompt.
+func ListPersonas() ([]string, error) {
+	shareDir, err := config.GetShareDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get share directory: %w", err)
+	}
+	entries, err := os.ReadDir(filepath.Join(shareDir, "personas"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read personas directory: %w", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".md") {
+			names = append(names, strings.TrimSuffix(entry.Name(), ".md"))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
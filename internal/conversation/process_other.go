@@ -0,0 +1,16 @@
+//go:build !unix
+
+package conversation
+
+import "os"
+
+// processAlive reports whether the process pid may still be running. On
+// Windows, finding a process fails once it has exited.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
@@ -0,0 +1,10 @@
+//go:build unix
+
+package conversation
+
+import "syscall"
+
+// processAlive reports whether the process pid may still be running.
+func processAlive(pid int) bool {
+	return syscall.Kill(pid, 0) != syscall.ESRCH
+}
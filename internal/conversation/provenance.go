@@ -0,0 +1,66 @@
+package conversation
+
+import (
+	"asc/internal/provider"
+
+	"github.com/charmbracelet/log"
+)
+
+// Provenance kinds
+const (
+	ProvenanceContext      = "context"
+	ProvenanceSystem       = "system"
+	ProvenanceConversation = "conversation"
+	ProvenanceLanguage     = "language"
+	ProvenanceExample      = "example"
+)
+
+// Provenance describes one source that was injected into the prompt, so
+// later readers know exactly what the model saw.
+type Provenance struct {
+	Kind string `json:"kind"`
+	// Ref is a file path, "stdin", or a conversation ID depending on Kind.
+	Ref string `json:"ref"`
+}
+
+// collectProvenance lists the sources that buildPrompt injects for opts.
+func collectProvenance(opts Options, context, system, providerName string, logger *log.Logger) []Provenance {
+	var sources []Provenance
+
+	// Context and system prompt are only sent to providers that take them
+	if caps, _ := provider.Lookup(providerName, ""); caps.Context {
+		if system != "" {
+			sources = append(sources, Provenance{Kind: ProvenanceSystem, Ref: inputRef(opts.SystemFile)})
+		}
+		for _, id := range opts.exampleIDs {
+			sources = append(sources, Provenance{Kind: ProvenanceExample, Ref: id})
+		}
+		if context != "" {
+			ref := inputRef(opts.ContextFile)
+			if opts.ContextCommand != "" {
+				ref = "$ " + opts.ContextCommand
+			} else if opts.ContextFile == "" {
+				if path, err := GetContextPath(logger); err == nil {
+					ref = path
+				}
+			}
+			sources = append(sources, Provenance{Kind: ProvenanceContext, Ref: ref})
+		}
+	}
+
+	if opts.Language != "" {
+		sources = append(sources, Provenance{Kind: ProvenanceLanguage, Ref: opts.Language})
+	}
+	for _, id := range opts.Recalled {
+		sources = append(sources, Provenance{Kind: ProvenanceConversation, Ref: id})
+	}
+	return sources
+}
+
+// inputRef describes a ReadInputFile path for the provenance footer.
+func inputRef(path string) string {
+	if path == "-" {
+		return "stdin"
+	}
+	return path
+}
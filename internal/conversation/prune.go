@@ -0,0 +1,135 @@
+package conversation
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"asc/internal/config"
+	"asc/internal/timeutil"
+
+	"github.com/charmbracelet/log"
+)
+
+// pruneStamp is touched in the data directory when conversations were
+// pruned automatically, which is done at most once per autoPruneInterval.
+const (
+	pruneStamp        = "pruned"
+	autoPruneInterval = 24 * time.Hour
+)
+
+// PruneOptions selects the conversations Prune deletes.
+type PruneOptions struct {
+	// OlderThan selects the conversations without activity for this long;
+	// 0 selects none by age.
+	OlderThan time.Duration
+	// Keep selects all but the Keep most recently active conversations; 0
+	// selects none by count.
+	Keep int
+	// Filter limits the selection to conversations started within its
+	// time range. Without OlderThan and Keep, it selects every
+	// conversation in the range.
+	Filter Filter
+	// DryRun only returns the selected conversations.
+	DryRun bool
+}
+
+// PruneOptionsFromConfig returns the options of the [prune] section of the
+// config file.
+func PruneOptionsFromConfig() (PruneOptions, error) {
+	cfg := config.Current().Prune
+	opts := PruneOptions{Keep: cfg.Keep}
+	if cfg.OlderThan != "" {
+		d, err := timeutil.ParseDuration(cfg.OlderThan)
+		if err != nil {
+			return opts, fmt.Errorf("invalid [prune] older_than: %w", err)
+		}
+		opts.OlderThan = d
+	}
+	return opts, nil
+}
+
+// lastActive returns when the conversation of entry was last saved with a
+// change, or started for those saved before changes were recorded.
+func lastActive(entry Entry) time.Time {
+	if entry.Changed != nil && entry.Changed.After(entry.Timestamp) {
+		return *entry.Changed
+	}
+	return entry.Timestamp
+}
+
+// prunable reports whether the conversation of entry may be pruned: unread
+// and pinned conversations and those on the reading queue are kept.
+func prunable(entry Entry) bool {
+	return !entry.Unread && !entry.Pinned && (entry.Queued == nil || entry.QueueDone != nil)
+}
+
+// Prune deletes the conversations selected by opts, least recently active
+// first, and returns them.
+func Prune(opts PruneOptions, logger *log.Logger) ([]Entry, error) {
+	byFilter := opts.OlderThan <= 0 && opts.Keep <= 0
+	if byFilter && !opts.Filter.HasTime() {
+		return nil, fmt.Errorf("nothing selects conversations to prune, give --older-than, --keep, --since or --until, or set older_than or keep in [prune] of the config file")
+	}
+	entries, err := LoadEntries(logger)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to load conversations: %w", err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return lastActive(entries[i]).After(lastActive(entries[j])) })
+	cutoff := time.Now().Add(-opts.OlderThan)
+	var selected []Entry
+	for i, entry := range entries {
+		tooMany := opts.Keep > 0 && i >= opts.Keep
+		tooOld := opts.OlderThan > 0 && lastActive(entry).Before(cutoff)
+		if (tooMany || tooOld || byFilter) && opts.Filter.MatchTime(entry.Timestamp) && prunable(entry) {
+			selected = append([]Entry{entry}, selected...)
+		}
+	}
+	if opts.DryRun {
+		return selected, nil
+	}
+	for i, entry := range selected {
+		if err := DeleteConversation(entry.ID, logger); err != nil {
+			return selected[:i], err
+		}
+	}
+	return selected, nil
+}
+
+// autoPrune prunes the conversations as set in the [prune] section of the
+// config file when auto is set, at most once per autoPruneInterval.
+// Failures are logged, as they do not affect the conversation at hand.
+func autoPrune(logger *log.Logger) {
+	if !config.Current().Prune.Auto {
+		return
+	}
+	dataDir, err := config.GetDataDir()
+	if err != nil {
+		return
+	}
+	path := filepath.Join(dataDir, pruneStamp)
+	if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) < autoPruneInterval {
+		return
+	}
+	opts, err := PruneOptionsFromConfig()
+	if err != nil {
+		logger.Warn("Not pruning conversations", "error", err)
+		return
+	}
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		logger.Debug("Failed to record pruning", "error", err)
+		return
+	}
+	pruned, err := Prune(opts, logger)
+	if err != nil {
+		logger.Warn("Failed to prune conversations", "error", err)
+	}
+	if len(pruned) > 0 {
+		logger.Info("Pruned old conversations", "count", len(pruned))
+	}
+}
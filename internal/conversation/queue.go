@@ -0,0 +1,57 @@
+package conversation
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// QueueAdd puts conv on the reading queue. A conversation that was marked
+// done goes back on it.
+func QueueAdd(conv *Conversation) {
+	if conv.Queued != nil && conv.QueueDone == nil {
+		return
+	}
+	now := time.Now()
+	conv.Queued = &now
+	conv.QueueDone = nil
+}
+
+// QueueDone marks conv as done on the reading queue. It stays listed with
+// asc queue --all until it is removed.
+func QueueDone(conv *Conversation) error {
+	if conv.Queued == nil {
+		return fmt.Errorf("conversation %s is not on the reading queue", conv.ID)
+	}
+	if conv.QueueDone == nil {
+		now := time.Now()
+		conv.QueueDone = &now
+	}
+	return nil
+}
+
+// QueueRemove takes conv off the reading queue.
+func QueueRemove(conv *Conversation) error {
+	if conv.Queued == nil {
+		return fmt.Errorf("conversation %s is not on the reading queue", conv.ID)
+	}
+	conv.Queued = nil
+	conv.QueueDone = nil
+	return nil
+}
+
+// Queue returns the entries on the reading queue in the order they were
+// added. Entries marked done are only included with all.
+func Queue(entries []Entry, all bool) []Entry {
+	var queue []Entry
+	for _, entry := range entries {
+		if entry.Queued == nil || (entry.QueueDone != nil && !all) {
+			continue
+		}
+		queue = append(queue, entry)
+	}
+	sort.SliceStable(queue, func(i, j int) bool {
+		return queue[i].Queued.Before(*queue[j].Queued)
+	})
+	return queue
+}
@@ -0,0 +1,66 @@
+package conversation
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Metadata keys of a rating set with asc rate. Keeping ratings in the
+// metadata lets --meta filter on them, e.g. --meta rating=down.
+const (
+	RatingKey     = "rating"
+	RatingNoteKey = "rating_note"
+)
+
+// Ratings of an answer.
+const (
+	RatingUp   = "up"
+	RatingDown = "down"
+)
+
+// ParseRating checks a rating given by the user.
+func ParseRating(s string) (string, error) {
+	switch strings.ToLower(s) {
+	case RatingUp, "+", "+1", "good":
+		return RatingUp, nil
+	case RatingDown, "-", "-1", "bad":
+		return RatingDown, nil
+	}
+	return "", fmt.Errorf("invalid rating %q, expected %s or %s", s, RatingUp, RatingDown)
+}
+
+// Rate records rating and an optional note on conv, replacing an earlier
+// rating.
+func Rate(conv *Conversation, rating, note string) {
+	SetMetadata(conv, map[string]string{RatingKey: rating})
+	if note != "" {
+		conv.Metadata[RatingNoteKey] = note
+	} else {
+		delete(conv.Metadata, RatingNoteKey)
+	}
+}
+
+// Unrate removes the rating of conv.
+func Unrate(conv *Conversation) error {
+	if _, ok := conv.Metadata[RatingKey]; !ok {
+		return fmt.Errorf("conversation %s is not rated", conv.ID)
+	}
+	delete(conv.Metadata, RatingKey)
+	delete(conv.Metadata, RatingNoteKey)
+	if len(conv.Metadata) == 0 {
+		conv.Metadata = nil
+	}
+	return nil
+}
+
+// RatedMeta returns the metadata of the answer a rating of conv refers
+// to: the last one that has metadata.
+func (c Conversation) RatedMeta() *ResponseMeta {
+	exchanges := c.Exchanges()
+	for i := len(exchanges) - 1; i >= 0; i-- {
+		if exchanges[i].Meta != nil {
+			return exchanges[i].Meta
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package conversation
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// RedactedPlaceholder replaces every redacted match.
+const RedactedPlaceholder = "[REDACTED]"
+
+// SecretPatterns match common credentials that tend to get pasted into
+// prompts by accident.
+var SecretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`sk-(?:proj-|ant-)?[A-Za-z0-9_\-]{20,}`),                                     // OpenAI / Anthropic
+	regexp.MustCompile(`pplx-[A-Za-z0-9]{20,}`),                                                     // Perplexity
+	regexp.MustCompile(`AIza[0-9A-Za-z_\-]{35}`),                                                    // Google
+	regexp.MustCompile(`AKIA[0-9A-Z]{16}`),                                                          // AWS access key ID
+	regexp.MustCompile(`gh[pousr]_[A-Za-z0-9]{36,}`),                                                // GitHub
+	regexp.MustCompile(`xox[abprs]-[A-Za-z0-9\-]{10,}`),                                             // Slack
+	regexp.MustCompile(`(?s)-----BEGIN [A-Z ]*PRIVATE KEY-----.*?-----END [A-Z ]*PRIVATE KEY-----`), // PEM keys
+}
+
+// Redactor scrubs literal strings and patterns from text.
+type Redactor struct {
+	patterns []*regexp.Regexp
+}
+
+// NewRedactor builds a Redactor for the given literal strings and regular
+// expressions, optionally including SecretPatterns.
+func NewRedactor(literals, patterns []string, secrets bool) (*Redactor, error) {
+	r := &Redactor{}
+	for _, literal := range literals {
+		if literal == "" {
+			continue
+		}
+		r.patterns = append(r.patterns, regexp.MustCompile(regexp.QuoteMeta(literal)))
+	}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	if secrets {
+		r.patterns = append(r.patterns, SecretPatterns...)
+	}
+	if len(r.patterns) == 0 {
+		return nil, fmt.Errorf("nothing to redact, specify strings, patterns or secrets")
+	}
+	return r, nil
+}
+
+// Redact returns text with every match replaced and the number of matches.
+func (r *Redactor) Redact(text string) (string, int) {
+	count := 0
+	for _, re := range r.patterns {
+		text = re.ReplaceAllStringFunc(text, func(string) string {
+			count++
+			return RedactedPlaceholder
+		})
+	}
+	return text, count
+}
+
+// RedactConversation scrubs every stored text of conv in place: title,
+// metadata values, messages, responses, errors, context, system prompt and
+// provenance. Attachments are references to files, so their paths are kept
+// and the files left unchanged; their content sent with a message is part
+// of the message. It returns the number of replacements made.
+func RedactConversation(conv *Conversation, r *Redactor) int {
+	total := redactText(&conv.Title, r)
+	for key, value := range conv.Metadata {
+		total += redactText(&value, r)
+		conv.Metadata[key] = value
+	}
+	total += redactText(&conv.Message, r)
+	total += redactText(&conv.Response, r)
+	total += redactMeta(conv.Meta, r)
+	total += redactText(&conv.Context, r)
+	total += redactText(&conv.System, r)
+	for i := range conv.Turns {
+		total += redactText(&conv.Turns[i].Message, r)
+		total += redactText(&conv.Turns[i].Response, r)
+		total += redactMeta(conv.Turns[i].Meta, r)
+	}
+	for i := range conv.Provenance {
+		total += redactText(&conv.Provenance[i].Ref, r)
+	}
+	return total
+}
+
+// redactText scrubs *s in place and returns the number of replacements.
+func redactText(s *string, r *Redactor) int {
+	var n int
+	*s, n = r.Redact(*s)
+	return n
+}
+
+// redactMeta scrubs the error message of meta, which may quote the
+// prompt, and returns the number of replacements.
+func redactMeta(meta *ResponseMeta, r *Redactor) int {
+	if meta == nil {
+		return 0
+	}
+	return redactText(&meta.Error, r)
+}
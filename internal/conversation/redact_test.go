@@ -0,0 +1,38 @@
+package conversation
+
+import "testing"
+
+func TestRedactConversation(t *testing.T) {
+	r, err := NewRedactor([]string{"hunter2"}, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv := Conversation{
+		Title:       "Login with hunter2",
+		Metadata:    map[string]string{"note": "password hunter2"},
+		Message:     "Is hunter2 a good password?",
+		Response:    "No, hunter2 is weak.",
+		Meta:        &ResponseMeta{Error: "rejected prompt: hunter2"},
+		Turns:       []Turn{{Message: "Why?", Response: "hunter2 is well known.", Meta: &ResponseMeta{Error: "hunter2"}}},
+		Attachments: []Attachment{{Path: "/home/user/hunter2.txt"}},
+	}
+	if n := RedactConversation(&conv, r); n != 7 {
+		t.Errorf("RedactConversation made %d replacements, want 7", n)
+	}
+	for name, got := range map[string]string{
+		"title":      conv.Title,
+		"metadata":   conv.Metadata["note"],
+		"message":    conv.Message,
+		"response":   conv.Response,
+		"error":      conv.Meta.Error,
+		"turn":       conv.Turns[0].Response,
+		"turn error": conv.Turns[0].Meta.Error,
+	} {
+		if r.patterns[0].MatchString(got) {
+			t.Errorf("%s was not redacted: %q", name, got)
+		}
+	}
+	if conv.Attachments[0].Path != "/home/user/hunter2.txt" {
+		t.Errorf("attachment path changed to %q", conv.Attachments[0].Path)
+	}
+}
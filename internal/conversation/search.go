@@ -0,0 +1,204 @@
+package conversation
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/log"
+)
+
+// snippetContext is how many characters a snippet shows on each side of
+// a match.
+const snippetContext = 40
+
+// maxSnippets is how many snippets a search result keeps.
+const maxSnippets = 3
+
+// SearchResult is a conversation that contains every term of a query.
+type SearchResult struct {
+	Entry    Entry
+	Snippets []Snippet
+	// Hits is the number of messages and answers that contain a term.
+	Hits int
+	// Turn is the 1-based turn of the first match and Prompt the message
+	// of the user there, without the history of follow-ups.
+	Turn   int
+	Prompt string
+}
+
+// Snippet is an excerpt of a message or answer around a match.
+type Snippet struct {
+	// Role is "User" or "AI".
+	Role string
+	Text string
+	// Spans are the byte ranges of Text that match a term.
+	Spans [][2]int
+}
+
+// SearchTerms splits a query into the lower-cased terms that must all occur
+// in a conversation. Double quotes keep a phrase together.
+func SearchTerms(query string) []string {
+	var terms []string
+	for i, part := range strings.Split(query, `"`) {
+		if i%2 == 1 {
+			if phrase := strings.TrimSpace(part); phrase != "" {
+				terms = append(terms, strings.ToLower(phrase))
+			}
+			continue
+		}
+		for _, word := range strings.Fields(part) {
+			terms = append(terms, strings.ToLower(word))
+		}
+	}
+	return terms
+}
+
+// Search returns the conversations matching filter whose messages or
+// answers contain every term of query, ignoring case, newest first.
+func Search(query string, filter Filter, logger *log.Logger) ([]SearchResult, error) {
+	terms := SearchTerms(query)
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("empty search query")
+	}
+
+	var conversations []Conversation
+	var err error
+	if usesSQLite() {
+		conversations, err = searchCandidatesSQLite(terms, logger)
+	} else {
+		conversations, err = loadAllJSON(logger)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load conversations: %w", err)
+	}
+
+	var results []SearchResult
+	for _, conv := range filter.Apply(conversations) {
+		if result, ok := searchConversation(conv, terms); ok {
+			results = append(results, result)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Entry.Timestamp.After(results[j].Entry.Timestamp)
+	})
+	logger.Debug("Searched conversations", "query", query, "results", len(results))
+	return results, nil
+}
+
+// searchConversation matches conv against terms and collects snippets.
+func searchConversation(conv Conversation, terms []string) (SearchResult, bool) {
+	body := strings.ToLower(searchBody(conv))
+	for _, term := range terms {
+		if !strings.Contains(body, term) {
+			return SearchResult{}, false
+		}
+	}
+
+	result := SearchResult{Entry: NewEntry(conv)}
+	for i, ex := range conv.Exchanges() {
+		for _, part := range []struct{ role, text string }{{"User", ex.Message}, {"AI", ex.Response}} {
+			snippet, ok := makeSnippet(part.text, terms)
+			if !ok {
+				continue
+			}
+			if result.Hits == 0 {
+				result.Turn, result.Prompt = i+1, FollowUpMessage(ex.Message)
+			}
+			result.Hits++
+			if len(result.Snippets) < maxSnippets {
+				snippet.Role = part.role
+				result.Snippets = append(result.Snippets, snippet)
+			}
+		}
+	}
+	return result, true
+}
+
+// followUpHeading separates the history from the message in the prompts of
+// asc append.
+const followUpHeading = "\n# Follow-up question\n"
+
+// FollowUpMessage returns message without the earlier conversation that
+// asc append puts before follow-up questions.
+func FollowUpMessage(message string) string {
+	if i := strings.LastIndex(message, followUpHeading); i >= 0 && strings.HasPrefix(message, "Previous conversation:") {
+		return message[i+len(followUpHeading):]
+	}
+	return message
+}
+
+// makeSnippet cuts text around the first match of any term, on one line.
+func makeSnippet(text string, terms []string) (Snippet, bool) {
+	lower := strings.ToLower(text)
+	// Lower-casing can change byte lengths, in which case offsets into lower
+	// do not apply to text
+	if len(lower) != len(text) {
+		text = lower
+	}
+	first := -1
+	for _, term := range terms {
+		if i := strings.Index(lower, term); i >= 0 && (first < 0 || i < first) {
+			first = i
+		}
+	}
+	if first < 0 {
+		return Snippet{}, false
+	}
+
+	start := first
+	for n := 0; n < snippetContext && start > 0; n++ {
+		_, size := utf8.DecodeLastRuneInString(text[:start])
+		start -= size
+	}
+	end := first
+	for n := 0; n < 2*snippetContext && end < len(text); n++ {
+		_, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+	}
+
+	excerpt := text[start:end]
+	lowerExcerpt := lower[start:end]
+	var spans [][2]int
+	for _, term := range terms {
+		for offset := 0; ; {
+			i := strings.Index(lowerExcerpt[offset:], term)
+			if i < 0 {
+				break
+			}
+			spans = append(spans, [2]int{offset + i, offset + i + len(term)})
+			offset += i + len(term)
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+	// Overlapping matches of different terms are merged
+	var merged [][2]int
+	for _, span := range spans {
+		if n := len(merged); n > 0 && span[0] <= merged[n-1][1] {
+			merged[n-1][1] = max(merged[n-1][1], span[1])
+			continue
+		}
+		merged = append(merged, span)
+	}
+	spans = merged
+
+	// Newlines and tabs become spaces, which keeps the byte offsets
+	excerpt = strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\r' || r == '\t' {
+			return ' '
+		}
+		return r
+	}, excerpt)
+	if start > 0 {
+		excerpt = "…" + excerpt
+		for i := range spans {
+			spans[i][0] += len("…")
+			spans[i][1] += len("…")
+		}
+	}
+	if end < len(text) {
+		excerpt += "…"
+	}
+	return Snippet{Text: excerpt, Spans: spans}, true
+}
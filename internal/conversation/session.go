@@ -0,0 +1,37 @@
+package conversation
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// newSGPTChat returns a new sgpt chat session ID.
+func newSGPTChat() string {
+	return fmt.Sprintf("asc-%d", time.Now().UnixNano())
+}
+
+// sgptChatExists reports whether sgpt still has the chat session id. sgpt
+// keeps sessions in a cache directory (/tmp by default) that may have been
+// cleaned up since the conversation was saved.
+func sgptChatExists(id string, logger *log.Logger) bool {
+	out, err := exec.Command("sgpt", "--show-chat", id).Output()
+	if err != nil {
+		logger.Debug("Failed to look up sgpt chat session", "chat", id, "error", err)
+		return false
+	}
+	return strings.TrimSpace(string(out)) != ""
+}
+
+// chatSession picks the sgpt chat session for the next turn of conv and
+// returns it with the number of exchanges it holds. The session of conv is
+// used if sgpt still has it; otherwise a new, empty session is returned.
+func chatSession(conv *Conversation, logger *log.Logger) (string, int) {
+	if conv.SGPTChat != "" && sgptChatExists(conv.SGPTChat, logger) {
+		return conv.SGPTChat, conv.SGPTChatTurns
+	}
+	return newSGPTChat(), 0
+}
@@ -0,0 +1,434 @@
+package conversation
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"asc/internal/config"
+	"asc/internal/pager"
+	"asc/internal/style"
+
+	"github.com/charmbracelet/lipgloss"
+	"golang.org/x/term"
+)
+
+// OutputMode selects how a streaming response is written to stdout.
+type OutputMode int
+
+const (
+	// OutputMarkdown renders the response as markdown as it arrives.
+	OutputMarkdown OutputMode = iota
+	// OutputJSON writes the response as JSON Lines events.
+	OutputJSON
+	// OutputRaw writes the response as plain text without rendering it.
+	OutputRaw
+	// OutputPlain writes the response as plain text between spoken
+	// markers, for screen readers.
+	OutputPlain
+	// OutputMinimal writes the response line by line without rendering
+	// it, with few escape codes and few writes, for slow links.
+	OutputMinimal
+)
+
+// minimalFlushInterval is how often the minimal output is written out.
+const minimalFlushInterval = 200 * time.Millisecond
+
+// streamSink receives a response while it streams.
+type streamSink interface {
+	// Line is called for every line received. buffer holds the whole
+	// response so far, including line.
+	Line(line, buffer string) error
+	// Flush is called once the provider has finished.
+	Flush() error
+	// Stopped is called when the user stopped the generation.
+	Stopped() error
+}
+
+// newStreamSink returns the sink for the output options.
+func newStreamSink(opts Options, renderer *style.Renderer) streamSink {
+	if opts.OnLine != nil {
+		return funcSink(opts.OnLine)
+	}
+	var sink streamSink
+	switch opts.Output {
+	case OutputJSON:
+		return jsonSink{}
+	case OutputRaw:
+		sink = rawSink{}
+	case OutputPlain:
+		sink = &plainSink{}
+	case OutputMinimal:
+		sink = &minimalSink{out: bufio.NewWriter(os.Stdout)}
+	default:
+		sink = &markdownSink{renderer: renderer}
+	}
+	if opts.StreamInterval > 0 {
+		sink = &throttledSink{sink: sink, interval: opts.StreamInterval}
+	}
+	if lines := config.Current().Paging.Lines; renderer != nil && lines > 0 && term.IsTerminal(int(os.Stdout.Fd())) {
+		sink = &pagingSink{sink: sink, renderer: renderer, limit: lines}
+	}
+	return sink
+}
+
+// pagingSink passes on the first limit lines of an answer. A longer answer
+// is shown in the pager by page once complete, so that it does not fill
+// the scrollback.
+type pagingSink struct {
+	sink     streamSink
+	renderer *style.Renderer
+	limit    int
+	lines    int
+	buffer   string
+}
+
+func (s *pagingSink) Line(line, buffer string) error {
+	s.lines++
+	s.buffer = buffer
+	if s.lines > s.limit {
+		return nil
+	}
+	return s.sink.Line(line, buffer)
+}
+
+func (s *pagingSink) Flush() error {
+	if err := s.sink.Flush(); err != nil {
+		return err
+	}
+	if s.lines > s.limit {
+		_, err := fmt.Printf("[%d more lines, shown in the pager]\n", s.lines-s.limit)
+		return err
+	}
+	return nil
+}
+
+func (s *pagingSink) Stopped() error {
+	return s.sink.Stopped()
+}
+
+// page shows the whole answer in the pager if it was longer than limit.
+func (s *pagingSink) page() error {
+	if s.lines <= s.limit {
+		return nil
+	}
+	rendered, err := s.renderer.Render(s.buffer)
+	if err != nil {
+		return err
+	}
+	return pager.Show(rendered)
+}
+
+// throttledSink passes lines on at most once per interval, joined into one
+// call, so that slow terminals are not flooded and the markdown is
+// rendered less often. Lines held back are passed on when the interval
+// has passed even if no more arrive.
+type throttledSink struct {
+	sink     streamSink
+	interval time.Duration
+
+	mu      sync.Mutex
+	last    time.Time
+	pending []string
+	buffer  string
+	timer   *time.Timer
+	// err is the error of a write done by the timer, returned by the next
+	// call.
+	err error
+}
+
+func (s *throttledSink) Line(line, buffer string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.pending = append(s.pending, line)
+	s.buffer = buffer
+	if wait := s.interval - time.Since(s.last); wait > 0 {
+		if s.timer == nil {
+			s.timer = time.AfterFunc(wait, s.tick)
+		}
+		return nil
+	}
+	return s.flushPending()
+}
+
+func (s *throttledSink) tick() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timer = nil
+	if s.err == nil {
+		s.err = s.flushPending()
+	}
+}
+
+// flushPending passes on the lines held back. s.mu must be held.
+func (s *throttledSink) flushPending() error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+	lines := strings.Join(s.pending, "\n")
+	s.pending = nil
+	s.last = time.Now()
+	return s.sink.Line(lines, s.buffer)
+}
+
+// stop cancels the timer and passes on the lines held back.
+func (s *throttledSink) stop() error {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if s.err != nil {
+		return s.err
+	}
+	return s.flushPending()
+}
+
+func (s *throttledSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.stop(); err != nil {
+		return err
+	}
+	return s.sink.Flush()
+}
+
+func (s *throttledSink) Stopped() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.stop(); err != nil {
+		return err
+	}
+	return s.sink.Stopped()
+}
+
+// heldOutLineCount is the number of rendered lines held back while
+// streaming, since the renderer may still reflow them.
+const heldOutLineCount = 4
+
+// markdownSink re-renders the whole buffer on each line and prints only
+// the lines that are not expected to change anymore.
+type markdownSink struct {
+	renderer *style.Renderer
+	previous string
+}
+
+func (s *markdownSink) Line(line, buffer string) error {
+	rendered, err := s.renderer.Render(buffer)
+	if err != nil {
+		return err
+	}
+	if s.previous != rendered {
+		previousLines := strings.Split(s.previous, "\n")
+		renderedLines := strings.Split(rendered, "\n")
+		for i := max(0, len(previousLines)-heldOutLineCount); i < len(renderedLines)-heldOutLineCount; i++ {
+			fmt.Println(renderedLines[i])
+		}
+		s.previous = rendered
+	}
+	return nil
+}
+
+func (s *markdownSink) Flush() error {
+	previousLines := strings.Split(s.previous, "\n")
+	for i := max(0, len(previousLines)-heldOutLineCount); i < len(previousLines); i++ {
+		fmt.Println(previousLines[i])
+	}
+	return nil
+}
+
+func (s *markdownSink) Stopped() error {
+	fmt.Println(stoppedMarker)
+	return nil
+}
+
+// rawSink prints each line as it arrives.
+type rawSink struct{}
+
+func (rawSink) Line(line, buffer string) error {
+	_, err := fmt.Println(line)
+	return err
+}
+
+func (rawSink) Flush() error { return nil }
+
+func (rawSink) Stopped() error {
+	fmt.Println(stoppedMarker)
+	return nil
+}
+
+// minimalSink prints each line as it arrives, without re-rendering the
+// answer, into a buffer written out every minimalFlushInterval so that a
+// slow link gets a few large writes instead of many small ones. Headings
+// are bold; no other styles are written.
+type minimalSink struct {
+	mu    sync.Mutex
+	out   *bufio.Writer
+	timer *time.Timer
+	// err is the error of a write done by the timer, returned by the next
+	// call.
+	err error
+}
+
+func (s *minimalSink) Line(line, buffer string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	if strings.HasPrefix(line, "#") {
+		line = lipgloss.NewStyle().Bold(true).Render(line)
+	}
+	if _, err := s.out.WriteString(line + "\n"); err != nil {
+		return err
+	}
+	if s.timer == nil {
+		s.timer = time.AfterFunc(minimalFlushInterval, s.tick)
+	}
+	return nil
+}
+
+func (s *minimalSink) tick() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timer = nil
+	if s.err == nil {
+		s.err = s.out.Flush()
+	}
+}
+
+func (s *minimalSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if s.err != nil {
+		return s.err
+	}
+	return s.out.Flush()
+}
+
+func (s *minimalSink) Stopped() error {
+	s.mu.Lock()
+	s.out.WriteString(stoppedMarker + "\n")
+	s.mu.Unlock()
+	return s.Flush()
+}
+
+// plainSink prints each line as it arrives, after a line announcing the
+// answer, and a line marking its end.
+type plainSink struct {
+	started bool
+}
+
+func (s *plainSink) Line(line, buffer string) error {
+	if !s.started {
+		s.started = true
+		if _, err := fmt.Println("Answer:"); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Println(line)
+	return err
+}
+
+func (s *plainSink) Flush() error {
+	_, err := fmt.Println("End of answer.")
+	return err
+}
+
+func (s *plainSink) Stopped() error {
+	_, err := fmt.Println("The answer was stopped by the user.")
+	return err
+}
+
+// funcSink passes each line to a function.
+type funcSink func(line string)
+
+func (f funcSink) Line(line, buffer string) error {
+	f(line)
+	return nil
+}
+
+func (funcSink) Flush() error { return nil }
+
+func (f funcSink) Stopped() error {
+	for _, line := range strings.Split(stoppedMarker, "\n") {
+		f(line)
+	}
+	return nil
+}
+
+// StreamEvent is a single line of the --stream-json output.
+type StreamEvent struct {
+	// Type is "delta", "phase", "usage", "done" or "error".
+	Type string `json:"type"`
+	// Phase is set for phase events, which mark the start of the
+	// "critique" or "revision" of a verification pass.
+	Phase string `json:"phase,omitempty"`
+	// Content is the text received, for delta events.
+	Content string `json:"content,omitempty"`
+	// Usage is set for usage events.
+	Usage *Usage `json:"usage,omitempty"`
+	// ID is the saved conversation, for done events. It is empty when the
+	// conversation was not saved.
+	ID           string `json:"id,omitempty"`
+	Provider     string `json:"provider,omitempty"`
+	FinishReason string `json:"finish_reason,omitempty"`
+	DurationMS   int64  `json:"duration_ms,omitempty"`
+	// Error is the error message, for error events.
+	Error string `json:"error,omitempty"`
+}
+
+// writeEvent writes event to stdout as one JSON line.
+func writeEvent(event StreamEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal stream event: %w", err)
+	}
+	if _, err := fmt.Fprintf(os.Stdout, "%s\n", data); err != nil {
+		return fmt.Errorf("failed to write stream event: %w", err)
+	}
+	return nil
+}
+
+// jsonSink writes each line as a delta event.
+type jsonSink struct{}
+
+func (jsonSink) Line(line, buffer string) error {
+	return writeEvent(StreamEvent{Type: "delta", Content: line + "\n"})
+}
+
+func (jsonSink) Flush() error { return nil }
+
+func (jsonSink) Stopped() error {
+	return writeEvent(StreamEvent{Type: "delta", Content: stoppedMarker})
+}
+
+// finishEvents writes the usage and done events that close a --stream-json
+// response. id is the saved conversation, or empty if it was not saved.
+func finishEvents(id string, meta *ResponseMeta, err error) error {
+	if meta != nil && meta.Usage != nil {
+		if err := writeEvent(StreamEvent{Type: "usage", Usage: meta.Usage}); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return writeEvent(StreamEvent{Type: "error", Error: err.Error()})
+	}
+	event := StreamEvent{Type: "done", ID: id}
+	if meta != nil {
+		event.Provider = meta.Provider
+		event.FinishReason = meta.FinishReason
+		event.DurationMS = meta.DurationMS
+	}
+	return writeEvent(event)
+}
@@ -0,0 +1,635 @@
+package conversation
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"asc/internal/config"
+
+	"github.com/charmbracelet/log"
+	_ "modernc.org/sqlite"
+)
+
+// Storage backends selected with the storage key of the config file.
+const (
+	StorageJSON   = "json"
+	StorageSQLite = "sqlite"
+)
+
+// databaseFile is the database of the sqlite storage, in the data
+// directory.
+const databaseFile = "conversations.db"
+
+// schema creates the tables of the sqlite storage. A conversation is kept
+// as its JSON document, with the columns lists need next to it so that
+// they can be read without decoding every conversation. The trigram
+// tokenizer of conversations_fts lets search match any part of a word.
+const schema = `
+CREATE TABLE IF NOT EXISTS conversations (
+	id         TEXT PRIMARY KEY,
+	created    INTEGER NOT NULL,
+	timestamp  TEXT NOT NULL,
+	title      TEXT NOT NULL DEFAULT '',
+	preview    TEXT NOT NULL DEFAULT '',
+	unread     INTEGER NOT NULL DEFAULT 0,
+	visibility TEXT NOT NULL DEFAULT '',
+	data       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS conversations_created ON conversations(created);
+CREATE TABLE IF NOT EXISTS metadata (
+	id    TEXT NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+	key   TEXT NOT NULL,
+	value TEXT NOT NULL,
+	PRIMARY KEY (id, key)
+);
+CREATE INDEX IF NOT EXISTS metadata_key_value ON metadata(key, value);
+CREATE TABLE IF NOT EXISTS tags (
+	id  TEXT NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+	tag TEXT NOT NULL,
+	PRIMARY KEY (id, tag)
+);
+CREATE INDEX IF NOT EXISTS tags_tag ON tags(tag);
+CREATE TABLE IF NOT EXISTS queue (
+	id     TEXT PRIMARY KEY REFERENCES conversations(id) ON DELETE CASCADE,
+	queued TEXT NOT NULL,
+	done   TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS archived (
+	id       TEXT PRIMARY KEY REFERENCES conversations(id) ON DELETE CASCADE,
+	archived TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS pinned (
+	id TEXT PRIMARY KEY REFERENCES conversations(id) ON DELETE CASCADE
+);
+CREATE TABLE IF NOT EXISTS checksums (
+	id       TEXT PRIMARY KEY REFERENCES conversations(id) ON DELETE CASCADE,
+	checksum TEXT NOT NULL,
+	changed  TEXT NOT NULL
+);
+CREATE VIRTUAL TABLE IF NOT EXISTS conversations_fts USING fts5(id UNINDEXED, body, tokenize = 'trigram');
+`
+
+var (
+	dbOnce sync.Once
+	db     *sql.DB
+	dbErr  error
+)
+
+// usesSQLite reports whether conversations are kept in the database.
+func usesSQLite() bool {
+	return config.Current().Storage == StorageSQLite
+}
+
+// openDB opens the database of the sqlite storage, creating it if needed.
+// It stays open until the process exits.
+func openDB() (*sql.DB, error) {
+	dbOnce.Do(func() {
+		dataDir, err := config.GetDataDir()
+		if err != nil {
+			dbErr = fmt.Errorf("failed to get data directory: %w", err)
+			return
+		}
+		if err := os.MkdirAll(dataDir, 0755); err != nil {
+			dbErr = fmt.Errorf("failed to create data directory: %w", err)
+			return
+		}
+		path := filepath.Join(dataDir, databaseFile)
+		// The driver is pure Go, so that asc builds without cgo
+		db, dbErr = sql.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+		if dbErr != nil {
+			dbErr = fmt.Errorf("failed to open database: %w", dbErr)
+			return
+		}
+		if _, err := db.Exec(schema); err != nil {
+			dbErr = fmt.Errorf("failed to create database schema: %w", err)
+		}
+	})
+	return db, dbErr
+}
+
+// searchBody is the text of conv that full-text search looks at.
+func searchBody(conv Conversation) string {
+	parts := []string{conv.Title}
+	for _, ex := range conv.Exchanges() {
+		parts = append(parts, ex.Message, ex.Response)
+	}
+	return strings.Join(parts, "\n")
+}
+
+// upsertSQLite inserts or replaces conv along with its index rows.
+func upsertSQLite(tx *sql.Tx, conv Conversation) error {
+	conv.FilePath = ""
+	stamp(&conv)
+	data, err := json.Marshal(conv)
+	if err != nil {
+		return fmt.Errorf("failed to marshal conversation: %w", err)
+	}
+	entry := NewEntry(conv)
+	_, err = tx.Exec(`INSERT INTO conversations (id, created, timestamp, title, preview, unread, visibility, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET created = excluded.created, timestamp = excluded.timestamp,
+			title = excluded.title, preview = excluded.preview, unread = excluded.unread,
+			visibility = excluded.visibility, data = excluded.data`,
+		conv.ID, conv.Timestamp.Unix(), conv.Timestamp.Format(time.RFC3339Nano),
+		conv.Title, entry.Message, conv.Unread, conv.Visibility, string(data))
+	if err != nil {
+		return fmt.Errorf("failed to save conversation: %w", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM metadata WHERE id = ?`, conv.ID); err != nil {
+		return fmt.Errorf("failed to update metadata: %w", err)
+	}
+	for key, value := range conv.Metadata {
+		if _, err := tx.Exec(`INSERT INTO metadata (id, key, value) VALUES (?, ?, ?)`, conv.ID, key, value); err != nil {
+			return fmt.Errorf("failed to update metadata: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM tags WHERE id = ?`, conv.ID); err != nil {
+		return fmt.Errorf("failed to update tags: %w", err)
+	}
+	for _, tag := range conv.Tags {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO tags (id, tag) VALUES (?, ?)`, conv.ID, tag); err != nil {
+			return fmt.Errorf("failed to update tags: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM queue WHERE id = ?`, conv.ID); err != nil {
+		return fmt.Errorf("failed to update reading queue: %w", err)
+	}
+	if conv.Queued != nil {
+		done := ""
+		if conv.QueueDone != nil {
+			done = conv.QueueDone.Format(time.RFC3339Nano)
+		}
+		if _, err := tx.Exec(`INSERT INTO queue (id, queued, done) VALUES (?, ?, ?)`,
+			conv.ID, conv.Queued.Format(time.RFC3339Nano), done); err != nil {
+			return fmt.Errorf("failed to update reading queue: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM archived WHERE id = ?`, conv.ID); err != nil {
+		return fmt.Errorf("failed to update archive: %w", err)
+	}
+	if conv.Archived != nil {
+		if _, err := tx.Exec(`INSERT INTO archived (id, archived) VALUES (?, ?)`,
+			conv.ID, conv.Archived.Format(time.RFC3339Nano)); err != nil {
+			return fmt.Errorf("failed to update archive: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM pinned WHERE id = ?`, conv.ID); err != nil {
+		return fmt.Errorf("failed to update pins: %w", err)
+	}
+	if conv.Pinned {
+		if _, err := tx.Exec(`INSERT INTO pinned (id) VALUES (?)`, conv.ID); err != nil {
+			return fmt.Errorf("failed to update pins: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(`INSERT INTO checksums (id, checksum, changed) VALUES (?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET checksum = excluded.checksum, changed = excluded.changed`,
+		conv.ID, conv.Checksum, conv.Changed.Format(time.RFC3339Nano)); err != nil {
+		return fmt.Errorf("failed to update checksum: %w", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM conversations_fts WHERE id = ?`, conv.ID); err != nil {
+		return fmt.Errorf("failed to update search index: %w", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO conversations_fts (id, body) VALUES (?, ?)`, conv.ID, searchBody(conv)); err != nil {
+		return fmt.Errorf("failed to update search index: %w", err)
+	}
+	return nil
+}
+
+// writeSQLite saves conversations in a single transaction.
+func writeSQLite(conversations ...Conversation) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	for _, conv := range conversations {
+		if err := upsertSQLite(tx, conv); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func saveNewSQLite(conv Conversation, logger *log.Logger) (Conversation, error) {
+	db, err := openDB()
+	if err != nil {
+		return conv, err
+	}
+	// As with files, IDs have a resolution of one second
+	now := time.Now()
+	for {
+		var exists int
+		err := db.QueryRow(`SELECT COUNT(*) FROM conversations WHERE id = ?`, now.Format("20060102150405")).Scan(&exists)
+		if err != nil {
+			return conv, fmt.Errorf("failed to check conversation ID: %w", err)
+		}
+		if exists == 0 {
+			break
+		}
+		now = now.Add(time.Second)
+	}
+	conversation := conv
+	conversation.ID = now.Format("20060102150405")
+	conversation.Timestamp = now
+	conversation.FilePath = ""
+	stamp(&conversation)
+	if err := writeSQLite(conversation); err != nil {
+		return conv, err
+	}
+	logger.Debug("Saved conversation", "id", conversation.ID, "storage", StorageSQLite)
+	return conversation, nil
+}
+
+func saveSQLite(conv Conversation, logger *log.Logger) error {
+	if err := writeSQLite(conv); err != nil {
+		return err
+	}
+	logger.Debug("Saved conversation", "id", conv.ID, "storage", StorageSQLite)
+	return nil
+}
+
+func loadSQLite(id string, logger *log.Logger) (Conversation, error) {
+	var conv Conversation
+	db, err := openDB()
+	if err != nil {
+		return conv, err
+	}
+	var data string
+	err = db.QueryRow(`SELECT data FROM conversations WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return conv, fmt.Errorf("conversation %s not found", id)
+	}
+	if err != nil {
+		return conv, fmt.Errorf("failed to read conversation: %w", err)
+	}
+	if err := json.Unmarshal([]byte(data), &conv); err != nil {
+		return conv, fmt.Errorf("failed to unmarshal conversation: %w", err)
+	}
+	logger.Debug("Loaded conversation", "id", id, "storage", StorageSQLite)
+	return conv, nil
+}
+
+func loadAllSQLite(logger *log.Logger) ([]Conversation, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`SELECT id, data FROM conversations ORDER BY created`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read conversations: %w", err)
+	}
+	defer rows.Close()
+
+	var conversations []Conversation
+	for rows.Next() {
+		var id, data string
+		if err := rows.Scan(&id, &data); err != nil {
+			return nil, fmt.Errorf("failed to read conversations: %w", err)
+		}
+		var conv Conversation
+		if err := json.Unmarshal([]byte(data), &conv); err != nil {
+			logger.Error("Failed to unmarshal conversation", "id", id, "error", err)
+			continue
+		}
+		conversations = append(conversations, conv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read conversations: %w", err)
+	}
+	return conversations, nil
+}
+
+// loadEntriesSQLite reads the list columns only; conversations are not
+// decoded.
+func loadEntriesSQLite(logger *log.Logger) ([]Entry, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	metadata := make(map[string]map[string]string)
+	metaRows, err := db.Query(`SELECT id, key, value FROM metadata`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	defer metaRows.Close()
+	for metaRows.Next() {
+		var id, key, value string
+		if err := metaRows.Scan(&id, &key, &value); err != nil {
+			return nil, fmt.Errorf("failed to read metadata: %w", err)
+		}
+		if metadata[id] == nil {
+			metadata[id] = make(map[string]string)
+		}
+		metadata[id][key] = value
+	}
+	if err := metaRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+
+	tags := make(map[string][]string)
+	tagRows, err := db.Query(`SELECT id, tag FROM tags ORDER BY tag`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tags: %w", err)
+	}
+	defer tagRows.Close()
+	for tagRows.Next() {
+		var id, tag string
+		if err := tagRows.Scan(&id, &tag); err != nil {
+			return nil, fmt.Errorf("failed to read tags: %w", err)
+		}
+		tags[id] = append(tags[id], tag)
+	}
+	if err := tagRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read tags: %w", err)
+	}
+
+	queue, err := loadQueueSQLite(db)
+	if err != nil {
+		return nil, err
+	}
+	archived, err := loadArchivedSQLite(db)
+	if err != nil {
+		return nil, err
+	}
+	pinned, err := loadPinnedSQLite(db)
+	if err != nil {
+		return nil, err
+	}
+	checksums, err := loadChecksumsSQLite(db)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT id, timestamp, title, preview, unread, visibility FROM conversations ORDER BY created`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read conversations: %w", err)
+	}
+	defer rows.Close()
+	var entries []Entry
+	for rows.Next() {
+		var entry Entry
+		var timestamp string
+		if err := rows.Scan(&entry.ID, &timestamp, &entry.Title, &entry.Message, &entry.Unread, &entry.Visibility); err != nil {
+			return nil, fmt.Errorf("failed to read conversations: %w", err)
+		}
+		if entry.Timestamp, err = time.Parse(time.RFC3339Nano, timestamp); err != nil {
+			logger.Error("Failed to parse timestamp", "id", entry.ID, "error", err)
+			continue
+		}
+		entry.Metadata = metadata[entry.ID]
+		entry.Tags = tags[entry.ID]
+		if state, ok := queue[entry.ID]; ok {
+			entry.Queued, entry.QueueDone = state[0], state[1]
+		}
+		entry.Archived = archived[entry.ID]
+		entry.Pinned = pinned[entry.ID]
+		if state, ok := checksums[entry.ID]; ok {
+			entry.Checksum, entry.Changed = state.Checksum, state.Changed
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read conversations: %w", err)
+	}
+	logger.Debug("Loaded conversation entries", "count", len(entries), "storage", StorageSQLite)
+	return entries, nil
+}
+
+// loadQueueSQLite returns when each conversation on the reading queue was
+// queued and marked done.
+func loadQueueSQLite(db *sql.DB) (map[string][2]*time.Time, error) {
+	rows, err := db.Query(`SELECT id, queued, done FROM queue`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reading queue: %w", err)
+	}
+	defer rows.Close()
+	queue := make(map[string][2]*time.Time)
+	for rows.Next() {
+		var id, queued, done string
+		if err := rows.Scan(&id, &queued, &done); err != nil {
+			return nil, fmt.Errorf("failed to read reading queue: %w", err)
+		}
+		var state [2]*time.Time
+		for i, s := range []string{queued, done} {
+			if s == "" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid reading queue time of %s: %w", id, err)
+			}
+			state[i] = &t
+		}
+		queue[id] = state
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read reading queue: %w", err)
+	}
+	return queue, nil
+}
+
+// loadArchivedSQLite returns when each archived conversation was archived.
+func loadArchivedSQLite(db *sql.DB) (map[string]*time.Time, error) {
+	rows, err := db.Query(`SELECT id, archived FROM archived`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	defer rows.Close()
+	archived := make(map[string]*time.Time)
+	for rows.Next() {
+		var id, s string
+		if err := rows.Scan(&id, &s); err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid archive time of %s: %w", id, err)
+		}
+		archived[id] = &t
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	return archived, nil
+}
+
+// loadPinnedSQLite returns the IDs of the pinned conversations.
+func loadPinnedSQLite(db *sql.DB) (map[string]bool, error) {
+	rows, err := db.Query(`SELECT id FROM pinned`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pins: %w", err)
+	}
+	defer rows.Close()
+	pinned := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to read pins: %w", err)
+		}
+		pinned[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read pins: %w", err)
+	}
+	return pinned, nil
+}
+
+// loadChecksumsSQLite returns the checksum and change time of each
+// conversation, as kept in Entry.
+func loadChecksumsSQLite(db *sql.DB) (map[string]Entry, error) {
+	rows, err := db.Query(`SELECT id, checksum, changed FROM checksums`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checksums: %w", err)
+	}
+	defer rows.Close()
+	checksums := make(map[string]Entry)
+	for rows.Next() {
+		var id, checksum, changed string
+		if err := rows.Scan(&id, &checksum, &changed); err != nil {
+			return nil, fmt.Errorf("failed to read checksums: %w", err)
+		}
+		t, err := time.Parse(time.RFC3339Nano, changed)
+		if err != nil {
+			return nil, fmt.Errorf("invalid change time of %s: %w", id, err)
+		}
+		checksums[id] = Entry{Checksum: checksum, Changed: &t}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read checksums: %w", err)
+	}
+	return checksums, nil
+}
+
+// searchCandidatesSQLite loads the conversations whose indexed text
+// contains every term of at least three characters, the shortest the
+// trigram index matches. Search checks the candidates for all terms.
+func searchCandidatesSQLite(terms []string, logger *log.Logger) ([]Conversation, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	var phrases []string
+	for _, term := range terms {
+		if utf8.RuneCountInString(term) >= 3 {
+			phrases = append(phrases, `"`+strings.ReplaceAll(term, `"`, `""`)+`"`)
+		}
+	}
+	query := `SELECT id, data FROM conversations`
+	var args []any
+	if len(phrases) > 0 {
+		query = `SELECT c.id, c.data FROM conversations_fts f JOIN conversations c ON c.id = f.id WHERE conversations_fts MATCH ?`
+		args = append(args, strings.Join(phrases, " AND "))
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search conversations: %w", err)
+	}
+	defer rows.Close()
+
+	var conversations []Conversation
+	for rows.Next() {
+		var id, data string
+		if err := rows.Scan(&id, &data); err != nil {
+			return nil, fmt.Errorf("failed to search conversations: %w", err)
+		}
+		var conv Conversation
+		if err := json.Unmarshal([]byte(data), &conv); err != nil {
+			logger.Error("Failed to unmarshal conversation", "id", id, "error", err)
+			continue
+		}
+		conversations = append(conversations, conv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to search conversations: %w", err)
+	}
+	return conversations, nil
+}
+
+func deleteSQLite(id string, logger *log.Logger) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	result, err := tx.Exec(`DELETE FROM conversations WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete conversation: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("conversation %s not found", id)
+	}
+	if _, err := tx.Exec(`DELETE FROM conversations_fts WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to update search index: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	logger.Debug("Deleted conversation", "id", id, "storage", StorageSQLite)
+	return nil
+}
+
+// MigrateStorage copies the conversations kept by the other backend into
+// the configured one, replacing conversations with the same ID. The source
+// is left as it is. It returns the number of conversations copied.
+func MigrateStorage(logger *log.Logger) (int, error) {
+	if usesSQLite() {
+		conversations, err := loadAllJSON(logger)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return 0, nil
+			}
+			return 0, fmt.Errorf("failed to load conversation files: %w", err)
+		}
+		if err := writeSQLite(conversations...); err != nil {
+			return 0, err
+		}
+		return len(conversations), nil
+	}
+
+	dataDir, err := config.GetDataDir()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get data directory: %w", err)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, databaseFile)); os.IsNotExist(err) {
+		return 0, nil
+	}
+	conversations, err := loadAllSQLite(logger)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Join(dataDir, "conversations"), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create conversations directory: %w", err)
+	}
+	for _, conv := range conversations {
+		if err := saveJSON(conv, logger); err != nil {
+			return 0, err
+		}
+	}
+	return len(conversations), nil
+}
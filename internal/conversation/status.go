@@ -0,0 +1,335 @@
+package conversation
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"asc/internal/config"
+
+	"github.com/charmbracelet/log"
+)
+
+// statusFile keeps what asc status-line shows, in the data directory, so
+// that it is read without loading the conversations.
+const statusFile = "status.json"
+
+// runningDir holds a file for each request in progress, named
+// <pid>-<n>, in the data directory.
+const runningDir = "running"
+
+// Status is the summary kept up to date as conversations are saved.
+type Status struct {
+	// Unread lists the IDs of the unread conversations.
+	Unread    []string `json:"unread"`
+	LastID    string   `json:"last_id,omitempty"`
+	LastTitle string   `json:"last_title,omitempty"`
+	// Running is the number of requests in progress. It is counted when
+	// the status is loaded.
+	Running int `json:"-"`
+}
+
+func statusPath() (string, error) {
+	dataDir, err := config.GetDataDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get data directory: %w", err)
+	}
+	return filepath.Join(dataDir, statusFile), nil
+}
+
+// LoadStatus reads the status, building it from the conversations the
+// first time or when rebuild is set.
+func LoadStatus(rebuild bool, logger *log.Logger) (Status, error) {
+	var status Status
+	path, err := statusPath()
+	if err != nil {
+		return status, err
+	}
+	data, err := os.ReadFile(path)
+	switch {
+	case rebuild || os.IsNotExist(err):
+		if status, err = rebuildStatus(logger); err != nil {
+			return status, err
+		}
+	case err != nil:
+		return status, fmt.Errorf("failed to read status: %w", err)
+	default:
+		if err := json.Unmarshal(data, &status); err != nil {
+			logger.Debug("Rebuilding invalid status", "error", err)
+			if status, err = rebuildStatus(logger); err != nil {
+				return status, err
+			}
+		}
+	}
+	status.Running = countRunning(logger)
+	return status, nil
+}
+
+// rebuildStatus builds the status from the conversations and saves it.
+func rebuildStatus(logger *log.Logger) (Status, error) {
+	status := Status{Unread: []string{}}
+	entries, err := LoadEntries(logger)
+	if err != nil && !os.IsNotExist(err) {
+		return status, fmt.Errorf("failed to load conversations: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.Unread {
+			status.Unread = append(status.Unread, entry.ID)
+		}
+		if entry.ID > status.LastID {
+			status.LastID, status.LastTitle = entry.ID, entryTitle(entry.Title, entry.Message)
+		}
+	}
+	sort.Strings(status.Unread)
+	return status, saveStatus(status)
+}
+
+func saveStatus(status Status) error {
+	path, err := statusPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(status)
+	if err != nil {
+		return fmt.Errorf("failed to marshal status: %w", err)
+	}
+	// Replaced atomically, as status lines read it at any time
+	tmp := fmt.Sprintf("%s.%d.tmp", path, os.Getpid())
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write status: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write status: %w", err)
+	}
+	return nil
+}
+
+// entryTitle returns the title of a conversation, or the first line of its
+// message.
+func entryTitle(title, message string) string {
+	if title != "" {
+		return title
+	}
+	return strings.TrimSpace(firstLine(strings.TrimSpace(message)))
+}
+
+// noteSaved updates the status after conv was saved. Failures only leave
+// the status line behind, so they are logged.
+func noteSaved(conv Conversation, logger *log.Logger) {
+	updateStatus(logger, func(status *Status) bool {
+		unread := removeString(status.Unread, conv.ID)
+		if conv.Unread {
+			unread = append(unread, conv.ID)
+			sort.Strings(unread)
+		}
+		status.Unread = unread
+		if conv.ID >= status.LastID {
+			status.LastID, status.LastTitle = conv.ID, entryTitle(conv.Title, conv.Message)
+		}
+		return true
+	})
+}
+
+// noteDeleted updates the status after the conversation id was deleted.
+func noteDeleted(id string, logger *log.Logger) {
+	updateStatus(logger, func(status *Status) bool {
+		status.Unread = removeString(status.Unread, id)
+		// The conversation before the last one is not known
+		return id != status.LastID
+	})
+}
+
+// updateStatus applies change to the saved status, or rebuilds it when
+// there is none yet or change returns false.
+func updateStatus(logger *log.Logger, change func(*Status) bool) {
+	path, err := statusPath()
+	if err != nil {
+		logger.Debug("Failed to update status", "error", err)
+		return
+	}
+	var status Status
+	data, err := os.ReadFile(path)
+	if err == nil && json.Unmarshal(data, &status) == nil && change(&status) {
+		err = saveStatus(status)
+	} else {
+		_, err = rebuildStatus(logger)
+	}
+	if err != nil {
+		logger.Debug("Failed to update status", "error", err)
+	}
+}
+
+func removeString(values []string, value string) []string {
+	result := []string{}
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// jobSeq numbers the requests of this process.
+var jobSeq atomic.Int64
+
+// jobWriteInterval is the minimum time between two updates of the progress
+// of a streaming request.
+const jobWriteInterval = time.Second
+
+// Job is a request in progress, as recorded in the running directory.
+type Job struct {
+	PID     int       `json:"pid"`
+	Started time.Time `json:"started"`
+	// Message is the first line of the message sent.
+	Message  string `json:"message,omitempty"`
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+	// Lines and Bytes are how much of the answer has arrived.
+	Lines   int       `json:"lines"`
+	Bytes   int       `json:"bytes"`
+	Updated time.Time `json:"updated"`
+}
+
+// runningJob is a request of this process recorded in the running
+// directory. A nil runningJob records nothing.
+type runningJob struct {
+	path    string
+	job     Job
+	written time.Time
+	logger  *log.Logger
+}
+
+// startJob records a request for message in progress until finish is
+// called.
+func startJob(message string, logger *log.Logger) *runningJob {
+	dataDir, err := config.GetDataDir()
+	if err != nil {
+		return nil
+	}
+	dir := filepath.Join(dataDir, runningDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		logger.Debug("Failed to record running request", "error", err)
+		return nil
+	}
+	now := time.Now()
+	j := &runningJob{
+		path:   filepath.Join(dir, fmt.Sprintf("%d-%d", os.Getpid(), jobSeq.Add(1))),
+		job:    Job{PID: os.Getpid(), Started: now, Updated: now, Message: firstLine(strings.TrimSpace(message))},
+		logger: logger,
+	}
+	if err := j.write(); err != nil {
+		logger.Debug("Failed to record running request", "error", err)
+		return nil
+	}
+	return j
+}
+
+// streaming records that the answer is streamed from spec, and resets
+// the progress, e.g. for a retry.
+func (j *runningJob) streaming(spec callSpec) {
+	if j == nil {
+		return
+	}
+	j.job.Provider, j.job.Model = spec.provider, spec.model
+	j.job.Lines, j.job.Bytes = 0, 0
+	j.update(true)
+}
+
+// progress records how much of the answer has arrived, at most once per
+// jobWriteInterval.
+func (j *runningJob) progress(lines, bytes int) {
+	if j == nil {
+		return
+	}
+	j.job.Lines, j.job.Bytes = lines, bytes
+	j.update(false)
+}
+
+func (j *runningJob) update(force bool) {
+	now := time.Now()
+	if !force && now.Sub(j.written) < jobWriteInterval {
+		return
+	}
+	j.job.Updated = now
+	if err := j.write(); err != nil {
+		j.logger.Debug("Failed to record progress", "error", err)
+	}
+}
+
+// write replaces the record atomically, as asc top reads it at any time.
+func (j *runningJob) write() error {
+	data, err := json.Marshal(j.job)
+	if err != nil {
+		return err
+	}
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	j.written = time.Now()
+	return nil
+}
+
+func (j *runningJob) finish() {
+	if j != nil {
+		os.Remove(j.path)
+	}
+}
+
+// RunningJobs returns the requests in progress, oldest first, removing
+// those left behind by processes that are gone.
+func RunningJobs(logger *log.Logger) []Job {
+	dataDir, err := config.GetDataDir()
+	if err != nil {
+		return nil
+	}
+	dir := filepath.Join(dataDir, runningDir)
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var jobs []Job
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), ".tmp") {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		pidText, _, _ := strings.Cut(file.Name(), "-")
+		pid, err := strconv.Atoi(pidText)
+		if err != nil || !processAlive(pid) {
+			logger.Debug("Removing stale running request", "file", file.Name())
+			os.Remove(path)
+			continue
+		}
+		job := Job{PID: pid}
+		data, err := os.ReadFile(path)
+		if err == nil {
+			// Records of older versions are empty
+			json.Unmarshal(data, &job)
+		}
+		if job.Started.IsZero() {
+			if info, err := file.Info(); err == nil {
+				job.Started, job.Updated = info.ModTime(), info.ModTime()
+			}
+		}
+		jobs = append(jobs, job)
+	}
+	sort.SliceStable(jobs, func(i, k int) bool { return jobs[i].Started.Before(jobs[k].Started) })
+	return jobs
+}
+
+// countRunning counts the requests in progress.
+func countRunning(logger *log.Logger) int {
+	return len(RunningJobs(logger))
+}
@@ -0,0 +1,230 @@
+package conversation
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"asc/internal/crash"
+	"asc/internal/provider"
+	"asc/internal/stopkey"
+	"asc/internal/style"
+	"asc/internal/suite"
+
+	"github.com/charmbracelet/log"
+)
+
+// FinishStoppedByUser is the finish reason of a response that was cut short
+// by the user pressing Ctrl-C.
+const FinishStoppedByUser = "stopped_by_user"
+
+// stoppedMarker is appended to responses stopped by the user.
+const stoppedMarker = "\n\n*[Stopped by user]*"
+
+// callSpec says where a prompt is sent.
+type callSpec struct {
+	provider string
+	model    string
+	// chat is the sgpt chat session to use, if any.
+	chat       string
+	perplexity PerplexityOptions
+	// images are base64-encoded images sent with the prompt.
+	images []string
+}
+
+// startCall sends prompt as described by spec through the provider
+// registry. The provider's own diagnostics are written to stderr and its
+// raw HTTP traffic to trace.
+func startCall(ctx context.Context, prompt string, spec callSpec, stderr, trace io.Writer) (*provider.Stream, error) {
+	p, err := provider.Get(spec.provider)
+	if err != nil {
+		return nil, err
+	}
+	call := provider.Call{Prompt: prompt, Model: spec.model, Chat: spec.chat, Images: spec.images, Stderr: stderr, Trace: trace}
+	if spec.provider == "perplexity" {
+		call.Args = spec.perplexity.args()
+	}
+	return p.Stream(ctx, call)
+}
+
+// streamResponse sends prompt to the AI provider and renders the answer
+// through the sink for opts.Output as it streams. It returns the accumulated response and the
+// metadata describing how the provider finished. A nil meta means nothing
+// was received and there is nothing to save. The call is dumped to
+// opts.Dump.Dir and recorded in the opts.Record suite if set. A panic
+// while streaming is returned as an error, with what was received so far
+// saved to a crash dump.
+func streamResponse(prompt string, spec callSpec, opts Options, logger *log.Logger) (response string, meta *ResponseMeta, err error) {
+	// Buffer for storing all output; the sink gets whole lines
+	var buffer strings.Builder
+	defer func() {
+		if r := recover(); r != nil {
+			response, meta, err = "", nil, crash.Recovered(r, buffer.String())
+		}
+	}()
+	// A long answer is paged once Ctrl-C no longer stops the generation
+	var paging *pagingSink
+	defer func() {
+		if paging != nil && meta != nil {
+			if err := paging.page(); err != nil {
+				logger.Warn("Failed to show the answer in the pager", "error", err)
+			}
+		}
+	}()
+	dumped := openDump(opts.Dump, spec.provider, logger)
+	defer dumped.close(nil, nil)
+	started := time.Now()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var stderr io.Writer = os.Stderr
+	if opts.OnLine != nil {
+		// The caller owns the screen, so diagnostics go through the logger
+		stderr = logger.StandardLog(log.StandardLogOptions{ForceLevel: log.WarnLevel}).Writer()
+	}
+	stream, err := startCall(ctx, prompt, spec, io.MultiWriter(stderr, dumped), dumped.trace())
+	if err != nil {
+		dumped.close(nil, err)
+		return "", nil, err
+	}
+	dumped.request(stream.Command)
+	opts.job.streaming(spec)
+	var firstToken time.Duration
+
+	var renderer *style.Renderer
+	if opts.Output == OutputMarkdown && opts.OnLine == nil {
+		if renderer, err = style.NewRenderer(getTerminalWidth(), logger); err != nil {
+			return "", nil, err
+		}
+	}
+
+	// Ctrl-C, or Esc on a terminal not owned by a TUI, stops the generation
+	// but keeps what has arrived so far
+	var stopped atomic.Bool
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt)
+	defer signal.Stop(interrupted)
+	var escaped <-chan struct{}
+	if opts.OnLine == nil {
+		var release func()
+		escaped, release = stopkey.Watch()
+		defer release()
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-interrupted:
+		case <-escaped:
+		case <-opts.Interrupt:
+		case <-done:
+			return
+		}
+		stopped.Store(true)
+		cancel()
+	}()
+	sink := newStreamSink(opts, renderer)
+	paging, _ = sink.(*pagingSink)
+
+	var pending string
+	lines := 0
+	line := func(text string) error {
+		buffer.WriteString(text + "\n")
+		lines++
+		return sink.Line(text, buffer.String())
+	}
+	var sinkErr error
+	for token := range stream.Tokens {
+		if firstToken == 0 {
+			firstToken = time.Since(started)
+		}
+		dumped.chunk(token)
+		pending += token
+		for sinkErr == nil {
+			i := strings.IndexByte(pending, '\n')
+			if i < 0 {
+				break
+			}
+			text := strings.TrimSuffix(pending[:i], "\r")
+			pending = pending[i+1:]
+			sinkErr = line(text)
+		}
+		if sinkErr != nil {
+			break
+		}
+		opts.job.progress(lines, buffer.Len()+len(pending))
+	}
+	if sinkErr == nil && pending != "" {
+		sinkErr = line(pending)
+	}
+	if sinkErr == nil {
+		sinkErr = sink.Flush()
+	}
+	// Output errors after an interrupt are expected
+	if sinkErr != nil && !stopped.Load() {
+		cancel()
+		stream.Wait()
+		return "", nil, sinkErr
+	}
+
+	// Record how the provider finished before saving
+	meta = &ResponseMeta{
+		Provider:     spec.provider,
+		Model:        spec.model,
+		FinishReason: "stop",
+	}
+	result, waitErr := stream.Wait()
+	if result.FinishReason != "" {
+		meta.FinishReason = result.FinishReason
+	}
+	if result.PromptTokens > 0 || result.CompletionTokens > 0 {
+		meta.Usage = &Usage{
+			PromptTokens:     result.PromptTokens,
+			CompletionTokens: result.CompletionTokens,
+			TotalTokens:      result.PromptTokens + result.CompletionTokens,
+		}
+	}
+	if meta.Usage == nil && buffer.Len() > 0 {
+		meta.Usage = estimateUsage(prompt, buffer.String())
+	}
+	meta.Cost = EstimateCost(spec.provider, spec.model, meta.Usage)
+	meta.DurationMS = time.Since(started).Milliseconds()
+	meta.FirstTokenMS = firstToken.Milliseconds()
+	if stopped.Load() {
+		logger.Info("Generation stopped by user, keeping partial response")
+		meta.FinishReason = FinishStoppedByUser
+		waitErr = nil
+	} else if waitErr != nil {
+		meta.FinishReason = "error"
+		meta.Error = waitErr.Error()
+		waitErr = fmt.Errorf("AI command failed: %w", waitErr)
+	}
+	dumped.close(meta, waitErr)
+
+	// Trim excessive trailing newlines before saving
+	response = strings.TrimRightFunc(buffer.String(), func(r rune) bool {
+		return r == '\n' || r == '\r'
+	})
+	// Prompts sent in an sgpt chat session lack the history, so they are
+	// not recorded
+	if opts.Record != "" && spec.chat == "" && waitErr == nil && meta.FinishReason != FinishStoppedByUser {
+		c := suite.Case{Recorded: started, Provider: spec.provider, Model: spec.model, Prompt: prompt, Response: response}
+		if spec.provider == "perplexity" {
+			c.Args = spec.perplexity.args()
+		}
+		if err := suite.Append(opts.Record, c); err != nil {
+			logger.Warn("Failed to record the call", "suite", opts.Record, "error", err)
+		}
+	}
+	if meta.FinishReason == FinishStoppedByUser {
+		response += stoppedMarker
+		if err := sink.Stopped(); err != nil {
+			logger.Debug("Failed to write stop marker", "error", err)
+		}
+	}
+	return response, meta, waitErr
+}
@@ -0,0 +1,89 @@
+package conversation
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ParseTags checks tags given on the command line. Tags may not be empty
+// or contain spaces or commas; a leading "#" is dropped.
+func ParseTags(args []string) ([]string, error) {
+	var tags []string
+	for _, arg := range args {
+		tag := strings.TrimPrefix(strings.TrimSpace(arg), "#")
+		if tag == "" || strings.ContainsAny(tag, " \t\n,") {
+			return nil, fmt.Errorf("invalid tag %q", arg)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// AddTags adds tags to conv, keeping the tags sorted and without
+// duplicates.
+func AddTags(conv *Conversation, tags []string) {
+	for _, tag := range tags {
+		if !HasTag(conv.Tags, tag) {
+			conv.Tags = append(conv.Tags, tag)
+		}
+	}
+	sort.Strings(conv.Tags)
+}
+
+// RemoveTags removes tags from conv. It returns an error naming the tags
+// that were not set.
+func RemoveTags(conv *Conversation, tags []string) error {
+	var missing []string
+	for _, tag := range tags {
+		if !HasTag(conv.Tags, tag) {
+			missing = append(missing, tag)
+			continue
+		}
+		var kept []string
+		for _, t := range conv.Tags {
+			if t != tag {
+				kept = append(kept, t)
+			}
+		}
+		conv.Tags = kept
+	}
+	if len(conv.Tags) == 0 {
+		conv.Tags = nil
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("conversation %s is not tagged %s", conv.ID, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// HasTag reports whether tags contains tag.
+func HasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// CountTags returns how many of entries carry each tag.
+func CountTags(entries []Entry) map[string]int {
+	counts := map[string]int{}
+	for _, entry := range entries {
+		for _, tag := range entry.Tags {
+			counts[tag]++
+		}
+	}
+	return counts
+}
+
+// matchTags reports whether tags contains every tag of want.
+func matchTags(tags, want []string) bool {
+	for _, tag := range want {
+		if !HasTag(tags, tag) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,226 @@
+package conversation
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"asc/internal/config"
+)
+
+// placeholderPattern matches the {{name}} placeholders of templates.
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_.-]*)\s*\}\}`)
+
+// templatePath returns the file of the prompt template name.
+func templatePath(name string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\ `) {
+		return "", fmt.Errorf("invalid template name %q", name)
+	}
+	shareDir, err := config.GetShareDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get share directory: %w", err)
+	}
+	return filepath.Join(shareDir, "templates", name+".md"), nil
+}
+
+// LoadTemplate returns the text of the prompt template name.
+func LoadTemplate(name string) (string, error) {
+	path, err := templatePath(name)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("template %s does not exist (see asc template list)", name)
+		}
+		return "", fmt.Errorf("failed to read template %s: %w", name, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// TemplateExists reports whether the prompt template name exists.
+func TemplateExists(name string) (bool, error) {
+	path, err := templatePath(name)
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to read template %s: %w", name, err)
+	}
+	return true, nil
+}
+
+// SaveTemplate sets the text of the prompt template name and returns its
+// path.
+func SaveTemplate(name, text string) (string, error) {
+	path, err := templatePath(name)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create templates directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(strings.TrimSpace(text)+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("failed to write template %s: %w", name, err)
+	}
+	return path, nil
+}
+
+// DeleteTemplate removes the prompt template name.
+func DeleteTemplate(name string) error {
+	path, err := templatePath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("template %s does not exist", name)
+		}
+		return fmt.Errorf("failed to remove template %s: %w", name, err)
+	}
+	return nil
+}
+
+// ListTemplates returns the names of the prompt templates.
+func ListTemplates() ([]string, error) {
+	shareDir, err := config.GetShareDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get share directory: %w", err)
+	}
+	entries, err := os.ReadDir(filepath.Join(shareDir, "templates"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read templates directory: %w", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".md") {
+			names = append(names, strings.TrimSuffix(entry.Name(), ".md"))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Placeholders returns the names of the placeholders of text, in the order
+// they first appear.
+func Placeholders(text string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, match := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			names = append(names, match[1])
+		}
+	}
+	return names
+}
+
+// ParseVars parses the name=value pairs of --var.
+func ParseVars(pairs []string) (map[string]string, error) {
+	vars := map[string]string{}
+	for _, pair := range pairs {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid variable %q, expected name=value", pair)
+		}
+		vars[strings.TrimSpace(name)] = value
+	}
+	return vars, nil
+}
+
+// ExpandTemplate replaces the placeholders of text with vars. Every
+// placeholder needs a value.
+func ExpandTemplate(text string, vars map[string]string) (string, error) {
+	var missing []string
+	for _, name := range Placeholders(text) {
+		if _, ok := vars[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("missing value for %s (use --var name=value)", strings.Join(missing, ", "))
+	}
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		return vars[placeholderPattern.FindStringSubmatch(placeholder)[1]]
+	}), nil
+}
+
+// Suggestion is a value of a prompt made a placeholder by Templatize.
+type Suggestion struct {
+	Name  string
+	Value string
+}
+
+// valuePattern matches the values of a prompt that likely change from one
+// use to the next: URLs, paths, file names with a known extension, and
+// short quoted or inline code values, whose quotes are kept.
+var valuePattern = regexp.MustCompile("https?://[^\\s)>\\]\"'`]+" +
+	"|(?:~|\\.{1,2})?/[\\w.-]+(?:/[\\w.-]+)*" +
+	`|(?:[\w.-]+/)*[\w-][\w.-]*\.(?:go|py|js|jsx|ts|tsx|rb|rs|java|kt|c|h|cc|cpp|hpp|cs|swift|php|sh|bash|zsh|md|txt|json|ya?ml|toml|xml|html|css|scss|sql|csv|log|ini|conf|cfg|env|lock|mod|proto|tf|lua|pdf|png|jpe?g|gif|svg)\b` +
+	"|`[^`\\n]{1,60}`" +
+	`|"[^"\n]{1,60}"`)
+
+// Templatize replaces the values of text that valuePattern matches with
+// placeholders named after their kind, e.g. {{file}} and {{file2}}, and
+// returns the values it replaced. The same value gets the same placeholder.
+func Templatize(text string) (string, []Suggestion) {
+	var suggestions []Suggestion
+	names := map[string]string{}
+	counts := map[string]int{}
+	var b strings.Builder
+	last := 0
+	for _, match := range valuePattern.FindAllStringIndex(text, -1) {
+		start, end := match[0], match[1]
+		// Parts of longer words are not values, nor are placeholders
+		if start > 0 && isWordByte(text[start-1]) || end < len(text) && isWordByte(text[end]) ||
+			end+1 < len(text) && text[end] == '.' && isWordByte(text[end+1]) || strings.HasPrefix(text[start:], "{{") {
+			continue
+		}
+		value, quote := text[start:end], ""
+		kind := "file"
+		switch {
+		case strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://"):
+			kind = "url"
+			value = strings.TrimRight(value, ".,;:")
+			end = start + len(value)
+		case value[0] == '`' || value[0] == '"':
+			kind, quote = "value", value[:1]
+			value = value[1 : len(value)-1]
+			if strings.TrimSpace(value) == "" || strings.Contains(value, "{{") {
+				continue
+			}
+		default:
+			value = strings.TrimRight(value, ".")
+			end = start + len(value)
+		}
+		name, ok := names[value]
+		if !ok {
+			counts[kind]++
+			name = kind
+			if counts[kind] > 1 {
+				name = fmt.Sprintf("%s%d", kind, counts[kind])
+			}
+			names[value] = name
+			suggestions = append(suggestions, Suggestion{Name: name, Value: value})
+		}
+		b.WriteString(text[last:start])
+		b.WriteString(quote + "{{" + name + "}}" + quote)
+		last = end
+	}
+	b.WriteString(text[last:])
+	return b.String(), suggestions
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '/' || c >= '0' && c <= '9' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z'
+}
@@ -0,0 +1,427 @@
+package conversation
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"asc/internal/config"
+	"asc/internal/provider"
+	"asc/internal/render"
+
+	"github.com/charmbracelet/log"
+)
+
+// Turn is a single user message and the AI response to it.
+type Turn struct {
+	Timestamp time.Time `json:"timestamp"`
+	Message   string    `json:"message"`
+	Response  string    `json:"response"`
+	// Source is the ID of the conversation this turn was merged from.
+	Source string        `json:"source,omitempty"`
+	Meta   *ResponseMeta `json:"meta,omitempty"`
+	// Kind is TurnCritique or TurnRevision for turns added by the
+	// verification pass, and empty for messages of the user.
+	Kind string `json:"kind,omitempty"`
+}
+
+// Exchanges returns every turn of the conversation in order, starting with
+// the initial Message/Response pair followed by the follow-up Turns.
+func (c Conversation) Exchanges() []Turn {
+	first := Turn{
+		Timestamp: c.Timestamp,
+		Message:   c.Message,
+		Response:  c.Response,
+		Source:    c.Source,
+		Meta:      c.Meta,
+	}
+	return append([]Turn{first}, c.Turns...)
+}
+
+// newThreadConversation builds a conversation whose exchanges are history
+// followed by turn. The new turn is stamped with the current time.
+func newThreadConversation(history []Turn, turn Turn) Conversation {
+	turn.Timestamp = time.Now()
+	return threadConversation(append(append([]Turn{}, history...), turn))
+}
+
+// threadConversation builds a conversation whose exchanges are turns.
+func threadConversation(turns []Turn) Conversation {
+	return Conversation{
+		Message:  turns[0].Message,
+		Response: turns[0].Response,
+		Source:   turns[0].Source,
+		Meta:     turns[0].Meta,
+		Turns:    turns[1:],
+	}
+}
+
+// defaultHistoryTokens is how many tokens of earlier turns are sent when
+// the context window of the model is not known.
+const defaultHistoryTokens = 16000
+
+// historyBudget returns how many tokens of earlier turns can be sent to
+// the model along with a prompt of promptTokens.
+func historyBudget(providerName, model string, promptTokens int) int {
+	if tokens := config.Current().HistoryTokens; tokens > 0 {
+		return tokens
+	}
+	if caps, _ := provider.Lookup(providerName, model); caps.MaxContext > 0 {
+		// Leave a quarter of the window for the answer
+		return max(0, caps.MaxContext*3/4-promptTokens)
+	}
+	return defaultHistoryTokens
+}
+
+// fitHistory returns the turns of history that fit in budget tokens and
+// how many were left out. The first turn, which usually sets the topic, is
+// kept if it is small, then as many of the latest turns as fit, with a
+// marker in place of the ones in between. The latest turn is always kept.
+func fitHistory(history []Turn, budget int) ([]Turn, int) {
+	tokens := func(turn Turn) int {
+		return provider.EstimateTokens(turn.Message) + provider.EstimateTokens(turn.Response)
+	}
+	total := 0
+	for _, turn := range history {
+		total += tokens(turn)
+	}
+	if total <= budget || len(history) < 2 {
+		return history, 0
+	}
+
+	used, keepFirst := 0, false
+	if first := tokens(history[0]); first <= budget/4 {
+		used, keepFirst = first, true
+	}
+	start := len(history) - 1
+	used += tokens(history[start])
+	for start > 1 && used+tokens(history[start-1]) <= budget {
+		start--
+		used += tokens(history[start])
+	}
+	if start == 1 && keepFirst {
+		return history, 0
+	}
+
+	var fitted []Turn
+	omitted := start
+	if keepFirst {
+		fitted = append(fitted, history[0])
+		omitted--
+	}
+	fitted = append(fitted, Turn{Kind: render.KindOmitted, Message: fmt.Sprintf("%d earlier exchanges omitted", omitted)})
+	return append(fitted, history[start:]...), omitted
+}
+
+// threadMessage prefixes message with the earlier turns of the thread.
+func threadMessage(history []Turn, message string) string {
+	return render.Thread(renderExchanges(history), message)
+}
+
+// renderExchanges converts turns for the render package.
+func renderExchanges(turns []Turn) []render.Exchange {
+	exchanges := make([]render.Exchange, len(turns))
+	for i, turn := range turns {
+		exchanges[i] = render.Exchange{Kind: turn.Kind, Message: turn.Message, Response: turn.Response, Source: turn.Source}
+	}
+	return exchanges
+}
+
+// ReplayBranch creates a new branch of conv in which the user message of the
+// turn at index (0-based, as in Exchanges) is replaced by edited. The edited
+// message and every later user message are sent again in order, each with
+// the branch so far as history. The original conversation is left intact.
+func ReplayBranch(conv Conversation, index int, edited string, opts Options, logger *log.Logger) (Conversation, error) {
+	exchanges := conv.Exchanges()
+	if index < 0 || index >= len(exchanges) {
+		return Conversation{}, fmt.Errorf("turn %d does not exist (conversation has %d turns)", index+1, len(exchanges))
+	}
+
+	history := append([]Turn{}, exchanges[:index]...)
+	messages := []string{edited}
+	for _, turn := range exchanges[index+1:] {
+		messages = append(messages, turn.Message)
+	}
+
+	var branch Conversation
+	var sendErr error
+	for i, message := range messages {
+		if i > 0 {
+			fmt.Printf("\n--- Replaying turn %d ---\n\n", index+i+1)
+		}
+		turnOpts := opts
+		turnOpts.History = history
+		result, err := sendMessage(message, turnOpts, logger)
+		if result == nil {
+			sendErr = err
+			break
+		}
+		history = append(history, Turn{
+			Timestamp: time.Now(),
+			Message:   message,
+			Response:  result.response,
+			Meta:      result.meta,
+		})
+		branch.Context = result.context
+		branch.System = result.system
+		branch.Provenance = result.provenance
+		branch.Attachments = result.attachments
+		if err != nil {
+			sendErr = err
+			break
+		}
+		if result.meta.FinishReason == FinishStoppedByUser {
+			logger.Info("Replay stopped by user", "turn", index+i+1)
+			break
+		}
+	}
+
+	// Keep whatever was replayed, even if a later turn failed
+	if len(history) <= index {
+		return Conversation{}, sendErr
+	}
+	thread := threadConversation(history)
+	thread.Context = branch.Context
+	thread.System = branch.System
+	thread.Provenance = branch.Provenance
+	thread.Attachments = branch.Attachments
+	thread.BranchOf = conv.ID
+	thread.BranchTurn = index + 1
+	thread.Visibility = conv.Visibility
+	thread.Provider, thread.Model = conv.Provider, conv.Model
+	thread.recordModel(opts)
+	if opts.Private {
+		thread.Visibility = VisibilityPrivate
+	}
+
+	if opts.Ephemeral {
+		return thread, sendErr
+	}
+	saved, err := SaveNewConversation(thread, logger)
+	if err != nil {
+		return thread, fmt.Errorf("failed to save branch: %w", err)
+	}
+	return saved, sendErr
+}
+
+// FormatConversation renders the conversation, with all of its turns,
+// as the markdown document shown by asc show, the view, the pager and exports.
+func FormatConversation(conv Conversation) string {
+	return render.Markdown(document(conv))
+}
+
+// FormatPlain renders the conversation as plain text for screen readers.
+func FormatPlain(conv Conversation) string {
+	return render.Plain(document(conv))
+}
+
+// FormatHTML renders the conversation as a self-contained HTML page.
+func FormatHTML(conv Conversation) (string, error) {
+	return render.HTML(document(conv))
+}
+
+// document converts conv for the render package.
+func document(conv Conversation) render.Document {
+	sources := make([]render.Source, len(conv.Provenance))
+	for i, src := range conv.Provenance {
+		sources[i] = render.Source{Kind: src.Kind, Ref: src.Ref}
+	}
+	files := make([]render.File, len(conv.Attachments))
+	for i, attachment := range conv.Attachments {
+		files[i] = render.File{Path: attachment.Path, Size: attachment.Size}
+	}
+	return render.Document{
+		ID:          conv.ID,
+		Title:       conv.Title,
+		Metadata:    conv.Metadata,
+		Tags:        conv.Tags,
+		System:      conv.System,
+		Context:     conv.Context,
+		Attachments: files,
+		Exchanges:   renderExchanges(conv.Exchanges()),
+		Sources:     sources,
+	}
+}
+
+// MergeConversations concatenates the turns of the given conversations into
+// a new conversation ordered by timestamp. Each turn is marked with the ID of
+// the conversation it came from. The source conversations are left intact.
+func MergeConversations(ids []string, logger *log.Logger) (Conversation, error) {
+	var merged Conversation
+	if len(ids) < 2 {
+		return merged, fmt.Errorf("at least two conversations are required")
+	}
+
+	var turns []Turn
+	var contexts []string
+	private := false
+	for _, id := range ids {
+		conv, err := LoadConversation(id, logger)
+		if err != nil {
+			return merged, err
+		}
+		for _, turn := range conv.Exchanges() {
+			// Keep the original source when merging an already merged thread
+			if turn.Source == "" {
+				turn.Source = conv.ID
+			}
+			turns = append(turns, turn)
+		}
+		if conv.Context != "" && !containsString(contexts, conv.Context) {
+			contexts = append(contexts, conv.Context)
+		}
+		private = private || conv.IsPrivate()
+	}
+
+	sort.SliceStable(turns, func(i, j int) bool {
+		return turns[i].Timestamp.Before(turns[j].Timestamp)
+	})
+
+	merged = Conversation{
+		Message:    turns[0].Message,
+		Response:   turns[0].Response,
+		Source:     turns[0].Source,
+		Turns:      turns[1:],
+		Context:    strings.Join(contexts, "\n\n"),
+		MergedFrom: ids,
+	}
+	// A merge containing a private conversation stays private
+	if private {
+		merged.Visibility = VisibilityPrivate
+	}
+	return merged, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// SendTurn sends message as the next turn of conv, with the earlier turns
+// as history, and stores the answer in conv. The first turn of an unsaved
+// conversation saves it as a new conversation; later turns rewrite it.
+// Nothing is saved with opts.Ephemeral. conv is left unchanged when nothing
+// was received.
+func SendTurn(conv *Conversation, message string, opts Options, logger *log.Logger) error {
+	if conv.Message != "" {
+		opts.History = conv.Exchanges()
+	}
+	if opts.providerName() == "sgpt" {
+		opts.SGPTChat, opts.SGPTChatTurns = chatSession(conv, logger)
+	}
+	result, err := sendMessage(message, opts, logger)
+	if result == nil {
+		if err != nil && opts.Output == OutputJSON {
+			if err := finishEvents("", nil, err); err != nil {
+				logger.Debug("Failed to write error event", "error", err)
+			}
+		}
+		return err
+	}
+
+	turn := Turn{
+		Timestamp: time.Now(),
+		Message:   message,
+		Response:  result.response,
+		Meta:      result.meta,
+	}
+	if conv.Message == "" {
+		conv.Message = turn.Message
+		conv.Response = turn.Response
+		conv.Meta = turn.Meta
+	} else {
+		conv.Turns = append(conv.Turns, turn)
+	}
+	conv.Context = result.context
+	conv.System = result.system
+	conv.Provenance = result.provenance
+	conv.Attachments = append(conv.Attachments, result.attachments...)
+	conv.recordPerplexity(result.meta, opts)
+	conv.recordModel(opts)
+	conv.recordPersona(opts)
+	conv.Unread = !shownOnTerminal(opts)
+	if opts.Private {
+		conv.Visibility = VisibilityPrivate
+	}
+	// A turn answered outside the session leaves it incomplete
+	conv.SGPTChat, conv.SGPTChatTurns = result.sgptChat, 0
+	if result.sgptChat != "" {
+		conv.SGPTChatTurns = len(conv.Exchanges())
+	}
+
+	if !opts.Ephemeral {
+		if conv.ID == "" {
+			saved, saveErr := SaveNewConversation(*conv, logger)
+			if saveErr != nil {
+				return fmt.Errorf("failed to save conversation: %w", saveErr)
+			}
+			autoTitle(&saved, logger)
+			*conv = saved
+		} else if saveErr := SaveConversation(*conv, logger); saveErr != nil {
+			return fmt.Errorf("failed to save conversation: %w", saveErr)
+		}
+	}
+
+	if opts.Output == OutputJSON {
+		if err := finishEvents(conv.ID, result.meta, err); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// PopTurn removes the last exchange of conv and returns it. It returns
+// false if conv has no exchanges. The sgpt chat session, which still holds
+// the exchange, is dropped.
+func PopTurn(conv *Conversation) (Turn, bool) {
+	conv.SGPTChat, conv.SGPTChatTurns = "", 0
+	if n := len(conv.Turns); n > 0 {
+		last := conv.Turns[n-1]
+		conv.Turns = conv.Turns[:n-1]
+		return last, true
+	}
+	if conv.Message == "" {
+		return Turn{}, false
+	}
+	first := conv.Exchanges()[0]
+	conv.Message = ""
+	conv.Response = ""
+	conv.Meta = nil
+	return first, true
+}
+
+// Fork copies the first turns exchanges of conv, or all of them when turns
+// is 0, as a new conversation branched from it. The original is kept, so
+// the copy can take another direction.
+func Fork(conv Conversation, turns int) (Conversation, error) {
+	exchanges := conv.Exchanges()
+	if turns == 0 {
+		turns = len(exchanges)
+	}
+	if turns < 1 || turns > len(exchanges) {
+		return Conversation{}, fmt.Errorf("turn %d does not exist (conversation %s has %d turns)", turns, conv.ID, len(exchanges))
+	}
+	fork := conv
+	fork.Turns = append([]Turn{}, exchanges[1:turns]...)
+	fork.Tags = append([]string{}, conv.Tags...)
+	fork.Metadata = nil
+	for key, value := range conv.Metadata {
+		if fork.Metadata == nil {
+			fork.Metadata = map[string]string{}
+		}
+		fork.Metadata[key] = value
+	}
+	fork.ID = ""
+	fork.BranchOf = conv.ID
+	fork.BranchTurn = turns
+	// Both would otherwise add their turns to the same sgpt session
+	fork.SGPTChat, fork.SGPTChatTurns = "", 0
+	fork.Unread, fork.Queued, fork.QueueDone = false, nil, nil
+	fork.Checksum, fork.Changed = "", nil
+	return fork, nil
+}
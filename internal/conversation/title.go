@@ -0,0 +1,123 @@
+package conversation
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"asc/internal/config"
+	"asc/internal/provider"
+
+	"github.com/charmbracelet/log"
+)
+
+// titleTimeout bounds a title request, which runs after the answer of
+// every new conversation, so that a slow provider does not hold up the
+// command.
+const titleTimeout = 8 * time.Second
+
+// titleExcerpt is how much of the first message and answer a title
+// request sends, and maxTitle how long a title may be.
+const (
+	titleExcerpt = 2000
+	maxTitle     = 80
+)
+
+// autoTitle asks for a title of conv, which was just saved as new, and
+// saves it, unless auto of [titles] is false. Conversations with a title
+// and private ones are left alone. Failures are only logged, since the
+// conversation is saved already and can be titled with asc rename.
+func autoTitle(conv *Conversation, logger *log.Logger) {
+	if auto := config.Current().Titles.Auto; auto != nil && !*auto || conv.Title != "" || conv.IsPrivate() {
+		return
+	}
+	title, err := GenerateTitle(*conv, logger)
+	if err != nil {
+		logger.Debug("Failed to generate a title", "id", conv.ID, "error", err)
+		return
+	}
+	conv.Title = title
+	if err := SaveConversation(*conv, logger); err != nil {
+		logger.Debug("Failed to save the title", "id", conv.ID, "error", err)
+	}
+}
+
+// GenerateTitle asks the provider and model of [titles], or else the
+// provider that answered conv with its default model, for a short title of
+// its first exchange.
+func GenerateTitle(conv Conversation, logger *log.Logger) (string, error) {
+	cfg := config.Current().Titles
+	spec := callSpec{provider: cfg.Provider, model: cfg.Model}
+	if spec.provider == "" {
+		spec.provider = DefaultProvider
+		if first := conv.Exchanges()[0]; first.Meta != nil && first.Meta.Provider != "" && first.Meta.Provider != "perplexity" {
+			// Perplexity would search the web for the title
+			spec.provider = first.Meta.Provider
+		}
+	}
+	if spec.model != "" {
+		if err := provider.Require(spec.provider, spec.model, provider.FeatureModel); err != nil {
+			return "", err
+		}
+	}
+	logger.Debug("Generating a title", "id", conv.ID, "provider", spec.provider, "model", spec.model)
+
+	ctx, cancel := context.WithTimeout(context.Background(), titleTimeout)
+	defer cancel()
+	stream, err := startCall(ctx, titlePrompt(conv), spec, io.Discard, nil)
+	if err != nil {
+		return "", err
+	}
+	var answer strings.Builder
+	for token := range stream.Tokens {
+		answer.WriteString(token)
+	}
+	if _, err := stream.Wait(); err != nil {
+		return "", err
+	}
+	title := cleanTitle(answer.String())
+	if title == "" {
+		return "", fmt.Errorf("the provider answered no title")
+	}
+	return title, nil
+}
+
+// titlePrompt asks for the title of the first exchange of conv.
+func titlePrompt(conv Conversation) string {
+	excerpt := func(s string) string {
+		if runes := []rune(s); len(runes) > titleExcerpt {
+			return string(runes[:titleExcerpt]) + "…"
+		}
+		return s
+	}
+	first := conv.Exchanges()[0]
+	return "Write a title of at most six words for the conversation below, " +
+		"in the language of the question. Reply with the title only.\n\n" +
+		"# Question\n" + excerpt(WithoutAttachments(first.Message)) + "\n\n" +
+		"# Answer\n" + excerpt(first.Response)
+}
+
+// cleanTitle takes the title from the first line of answer with text,
+// without quotes, markup or a "Title:" label.
+func cleanTitle(answer string) string {
+	for _, line := range strings.Split(answer, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "```") {
+			continue
+		}
+		if label, rest, ok := strings.Cut(line, ":"); ok && strings.EqualFold(strings.Trim(label, "*# "), "title") {
+			line = rest
+		}
+		line = strings.Trim(line, "\"'`*#“”「」 ")
+		line = strings.TrimRight(line, ".。")
+		if runes := []rune(line); len(runes) > maxTitle {
+			line = strings.TrimSpace(string(runes[:maxTitle-1])) + "…"
+		}
+		if line != "" {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,118 @@
+package conversation
+
+import (
+	"fmt"
+	"strings"
+
+	"asc/internal/provider"
+	"asc/internal/render"
+
+	"github.com/charmbracelet/log"
+)
+
+// VerifyMode selects what the verification pass does with the critique.
+type VerifyMode string
+
+const (
+	VerifyNone VerifyMode = ""
+	// VerifyCritique appends the critique to the conversation.
+	VerifyCritique VerifyMode = "critique"
+	// VerifyRevise also asks the first model to revise its answer.
+	VerifyRevise VerifyMode = "revise"
+)
+
+// Kinds of turns added by the verification pass.
+const (
+	TurnCritique = render.KindCritique
+	TurnRevision = render.KindRevision
+)
+
+// noIssues is the reply requested from the reviewer for a correct answer.
+const noIssues = "No issues found."
+
+// ParseVerifyMode checks a --verify value.
+func ParseVerifyMode(s string) (VerifyMode, error) {
+	switch mode := VerifyMode(s); mode {
+	case VerifyNone, VerifyCritique, VerifyRevise:
+		return mode, nil
+	}
+	return VerifyNone, fmt.Errorf("invalid verify mode %q, expected critique or revise", s)
+}
+
+// critiquePrompt asks a reviewer to check answer for errors.
+func critiquePrompt(question, answer string) string {
+	return "You are reviewing an answer for factual and code errors.\n\n" +
+		"# Question\n" + question + "\n\n" +
+		"# Answer\n" + answer + "\n\n" +
+		"# Instruction\nList every concrete factual or code error in the answer " +
+		"with a correction. If the answer is correct, reply with exactly: " + noIssues
+}
+
+// revisePrompt asks the first model to fix answer according to critique.
+func revisePrompt(question, answer, critique string) string {
+	return "# Question\n" + question + "\n\n" +
+		"# Your answer\n" + answer + "\n\n" +
+		"# Review\n" + critique + "\n\n" +
+		"# Instruction\nRevise your answer to fix the issues raised in the review. " +
+		"Reply with the complete revised answer only."
+}
+
+// verify runs the verification pass over the answer in result and returns
+// the turns to store after it: the critique, and the revision when asked
+// for and the reviewer found issues.
+func verify(result *sendResult, opts Options, logger *log.Logger) ([]Turn, error) {
+	if err := provider.Require(opts.providerName(), opts.VerifyModel, opts.verifyFeatures()...); err != nil {
+		return nil, fmt.Errorf("cannot verify: %w", err)
+	}
+
+	if err := writePhase(opts.Output, TurnCritique); err != nil {
+		return nil, err
+	}
+	prompt := critiquePrompt(result.question, result.response)
+	reviewer := opts.callSpec(opts.providerName(), "")
+	reviewer.model = opts.VerifyModel
+	critique, meta, err := streamResponse(buildPrompt(prompt, result.context, result.system, opts.Language, opts.providerName()), reviewer, opts, logger)
+	if meta == nil {
+		return nil, err
+	}
+	// The prompts repeat the question and answer, so only what was asked
+	// is stored
+	turns := []Turn{{Kind: TurnCritique, Message: "Review the answer for errors.", Response: critique, Meta: meta}}
+	if err != nil || meta.FinishReason == FinishStoppedByUser {
+		return turns, err
+	}
+	if opts.Verify != VerifyRevise || strings.Contains(critique, noIssues) {
+		return turns, nil
+	}
+
+	if err := writePhase(opts.Output, TurnRevision); err != nil {
+		return turns, err
+	}
+	// The revision comes from the provider and model that answered, which
+	// may differ from the selected ones after a fallback or routing
+	prompt = revisePrompt(result.question, result.response, critique)
+	author := opts.callSpec(result.meta.Provider, "")
+	author.model = result.meta.Model
+	revision, meta, err := streamResponse(buildPrompt(prompt, result.context, result.system, opts.Language, author.provider), author, opts, logger)
+	if meta == nil {
+		return turns, err
+	}
+	return append(turns, Turn{Kind: TurnRevision, Message: "Revise the answer according to the review.", Response: revision, Meta: meta}), err
+}
+
+// verifyFeatures lists the provider features the verification pass needs.
+func (opts Options) verifyFeatures() []provider.Feature {
+	if opts.VerifyModel != "" {
+		return []provider.Feature{provider.FeatureModel}
+	}
+	return nil
+}
+
+// writePhase announces the start of a verification phase on stdout.
+func writePhase(output OutputMode, phase string) error {
+	if output == OutputJSON {
+		return writeEvent(StreamEvent{Type: "phase", Phase: phase})
+	}
+	fmt.Printf("\n--- %s ---\n\n", strings.ToUpper(phase[:1])+phase[1:])
+	return nil
+}
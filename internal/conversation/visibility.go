@@ -0,0 +1,36 @@
+package conversation
+
+import (
+	"fmt"
+)
+
+// Visibility levels of a conversation. Conversations without a level are
+// shareable.
+const (
+	VisibilityPrivate   = "private"
+	VisibilityShareable = "shareable"
+)
+
+// ParseVisibility checks a visibility level given by the user.
+func ParseVisibility(s string) (string, error) {
+	switch s {
+	case VisibilityPrivate, VisibilityShareable:
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid visibility %q, expected %s or %s", s, VisibilityPrivate, VisibilityShareable)
+}
+
+// IsPrivate reports whether the conversation must not leave this machine
+// without being forced to.
+func (c Conversation) IsPrivate() bool {
+	return c.Visibility == VisibilityPrivate
+}
+
+// CheckShareable returns an error if conv is private. Commands that write
+// conversations for others to read call it first.
+func CheckShareable(conv Conversation) error {
+	if conv.IsPrivate() {
+		return fmt.Errorf("conversation %s is private", conv.ID)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+// Package crash turns panics into dump files, so that a bug leaves the
+// terminal usable and keeps the answer that was being streamed.
+package crash
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"asc/internal/config"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"golang.org/x/term"
+)
+
+// crashDir holds the dumps, in the data directory.
+const crashDir = "crashes"
+
+// Write saves the panic value r with its stack and the response received
+// so far, if any, and returns the path of the dump.
+func Write(r any, stack []byte, partial string) (string, error) {
+	dataDir, err := config.GetDataDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get data directory: %w", err)
+	}
+	dir := filepath.Join(dataDir, crashDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create crash directory: %w", err)
+	}
+	now := time.Now()
+	f, err := os.CreateTemp(dir, "crash-"+now.Format("20060102150405")+"-*.txt")
+	if err != nil {
+		return "", fmt.Errorf("failed to create crash dump: %w", err)
+	}
+	defer f.Close()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "asc crashed at %s\n", now.Format(time.RFC3339))
+	fmt.Fprintf(&b, "command: %s\n\n", strings.Join(os.Args, " "))
+	fmt.Fprintf(&b, "panic: %v\n\n%s", r, stack)
+	if partial != "" {
+		fmt.Fprintf(&b, "\n--- response received so far ---\n%s\n", partial)
+	}
+	if _, err := f.WriteString(b.String()); err != nil {
+		return "", fmt.Errorf("failed to write crash dump: %w", err)
+	}
+	return f.Name(), nil
+}
+
+// Recovered dumps the panic value r of a deferred recover and returns the
+// error to report instead of crashing.
+func Recovered(r any, partial string) error {
+	ResetTerminal()
+	path, err := Write(r, debug.Stack(), partial)
+	if err != nil {
+		return fmt.Errorf("internal error: %v (%v)", r, err)
+	}
+	if partial != "" {
+		return fmt.Errorf("internal error: %v; the response so far and the details were saved to %s", r, path)
+	}
+	return fmt.Errorf("internal error: %v; the details were saved to %s", r, path)
+}
+
+// ResetTerminal resets the colors and shows the cursor again, in case a
+// panic interrupted styled output.
+func ResetTerminal() {
+	if term.IsTerminal(int(os.Stdout.Fd())) {
+		fmt.Print("\x1b[0m\x1b[?25h\n")
+	}
+}
+
+// InFlight is implemented by models that stream a response, to have it
+// saved in the dump.
+type InFlight interface {
+	InFlight() string
+}
+
+// Program is a Bubble Tea program whose model is guarded: a panic in it or
+// in its commands is dumped, then Bubble Tea restores the terminal and Run
+// returns an error saying where the dump is.
+type Program struct {
+	*tea.Program
+	state *state
+}
+
+// state is shared by the copies of the guarded model.
+type state struct {
+	mu   sync.Mutex
+	path string
+	err  error
+}
+
+// NewProgram returns a program running model.
+func NewProgram(model tea.Model, opts ...tea.ProgramOption) *Program {
+	s := &state{}
+	return &Program{Program: tea.NewProgram(guarded{model, s}, opts...), state: s}
+}
+
+// Run runs the program and returns its final model.
+func (p *Program) Run() (tea.Model, error) {
+	final, err := p.Program.Run()
+	if g, ok := final.(guarded); ok {
+		final = g.Model
+	}
+	if errors.Is(err, tea.ErrProgramPanic) {
+		p.state.mu.Lock()
+		defer p.state.mu.Unlock()
+		if p.state.err != nil {
+			return final, fmt.Errorf("internal error; failed to save the details: %w", p.state.err)
+		}
+		return final, fmt.Errorf("internal error; the details were saved to %s", p.state.path)
+	}
+	return final, err
+}
+
+// guarded wraps a model to dump its panics.
+type guarded struct {
+	tea.Model
+	state *state
+}
+
+// catch dumps a panic of model, then panics again for Bubble Tea to
+// restore the terminal.
+func (g guarded) catch(model tea.Model) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	var partial string
+	if f, ok := model.(InFlight); ok {
+		partial = f.InFlight()
+	}
+	path, err := Write(r, debug.Stack(), partial)
+	g.state.mu.Lock()
+	if g.state.path == "" && g.state.err == nil {
+		g.state.path, g.state.err = path, err
+	}
+	g.state.mu.Unlock()
+	panic(r)
+}
+
+func (g guarded) Init() tea.Cmd {
+	defer g.catch(g.Model)
+	return g.cmd(g.Model, g.Model.Init())
+}
+
+func (g guarded) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	defer g.catch(g.Model)
+	next, cmd := g.Model.Update(msg)
+	return guarded{next, g.state}, g.cmd(next, cmd)
+}
+
+func (g guarded) View() string {
+	defer g.catch(g.Model)
+	return g.Model.View()
+}
+
+// cmd guards cmd, and the commands of the batch it returns.
+func (g guarded) cmd(model tea.Model, cmd tea.Cmd) tea.Cmd {
+	if cmd == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		defer g.catch(model)
+		msg := cmd()
+		if batch, ok := msg.(tea.BatchMsg); ok {
+			for i, c := range batch {
+				batch[i] = g.cmd(model, c)
+			}
+		}
+		return msg
+	}
+}
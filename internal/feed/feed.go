@@ -0,0 +1,54 @@
+package feed
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/log"
+)
+
+// splitNull splits NUL-terminated records for bufio.Scanner.
+func splitNull(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// Tail reads prompts from the FIFO at path, creating it if needed, and
+// passes each one to handle in order. Prompts are separated by newlines,
+// or by NUL bytes with null so that they can span lines. Blank prompts are
+// skipped, and an error from handle is logged without stopping. Tail runs
+// until reading the FIFO fails.
+func Tail(path string, null bool, handle func(prompt string) error, logger *log.Logger) error {
+	f, err := openFIFO(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	logger.Info("Reading prompts", "fifo", path)
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	if null {
+		scanner.Split(splitNull)
+	}
+	for scanner.Scan() {
+		prompt := strings.TrimSpace(scanner.Text())
+		if prompt == "" {
+			continue
+		}
+		if err := handle(prompt); err != nil {
+			logger.Error("Failed to answer prompt", "error", err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read FIFO: %w", err)
+	}
+	return nil
+}
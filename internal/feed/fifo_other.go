@@ -0,0 +1,14 @@
+//go:build !unix
+
+package feed
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// openFIFO fails, since FIFOs are only supported on Unix.
+func openFIFO(path string) (*os.File, error) {
+	return nil, fmt.Errorf("reading prompts from a FIFO is unsupported on %s", runtime.GOOS)
+}
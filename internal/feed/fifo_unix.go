@@ -0,0 +1,32 @@
+//go:build unix
+
+package feed
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// openFIFO creates the FIFO at path if it does not exist and opens it.
+// The FIFO is opened for reading and writing so that it stays open when
+// writers come and go, instead of reporting EOF after each of them.
+func openFIFO(path string) (*os.File, error) {
+	info, err := os.Stat(path)
+	switch {
+	case os.IsNotExist(err):
+		if err := syscall.Mkfifo(path, 0600); err != nil {
+			return nil, fmt.Errorf("failed to create FIFO: %w", err)
+		}
+	case err != nil:
+		return nil, fmt.Errorf("failed to stat %s: %w", path, err)
+	case info.Mode()&os.ModeNamedPipe == 0:
+		return nil, fmt.Errorf("%s exists and is not a FIFO", path)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open FIFO: %w", err)
+	}
+	return f, nil
+}
@@ -0,0 +1,147 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"asc/internal/config"
+)
+
+// MaxEntries is the number of prompts kept; older ones are dropped.
+const MaxEntries = 1000
+
+// Entry is a prompt sent to AI.
+type Entry struct {
+	Timestamp time.Time `json:"timestamp"`
+	Prompt    string    `json:"prompt"`
+}
+
+// Path returns the path of the prompt history file. It holds one JSON
+// object per line, oldest first.
+func Path() (string, error) {
+	shareDir, err := config.GetShareDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get share directory: %w", err)
+	}
+	return filepath.Join(shareDir, "prompt_history.jsonl"), nil
+}
+
+// Load returns the recorded prompts, oldest first. Lines that cannot be
+// parsed are skipped.
+func Load() ([]Entry, error) {
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open prompt history: %w", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read prompt history: %w", err)
+	}
+	return entries, nil
+}
+
+// Add records prompt. Blank prompts and repeats of the last prompt are not
+// recorded, like in shell history. The file is rewritten to drop the
+// oldest entries once it grows past MaxEntries.
+func Add(prompt string) error {
+	if strings.TrimSpace(prompt) == "" {
+		return nil
+	}
+	entries, err := Load()
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 && entries[len(entries)-1].Prompt == prompt {
+		return nil
+	}
+	entries = append(entries, Entry{Timestamp: time.Now(), Prompt: prompt})
+	if len(entries) > MaxEntries {
+		entries = entries[len(entries)-MaxEntries:]
+	}
+	return save(entries)
+}
+
+// Redact rewrites every recorded prompt with redact, which returns the
+// prompt and how many replacements it made, and returns the total. With
+// dryRun the file is left unchanged.
+func Redact(redact func(string) (string, int), dryRun bool) (int, error) {
+	entries, err := Load()
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for i := range entries {
+		var n int
+		entries[i].Prompt, n = redact(entries[i].Prompt)
+		total += n
+	}
+	if total == 0 || dryRun {
+		return total, nil
+	}
+	return total, save(entries)
+}
+
+// save replaces the prompt history with entries.
+func save(entries []Entry) error {
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create share directory: %w", err)
+	}
+	var b strings.Builder
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to marshal prompt: %w", err)
+		}
+		b.Write(data)
+		b.WriteByte('\n')
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(b.String()), 0600); err != nil {
+		return fmt.Errorf("failed to write prompt history: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace prompt history: %w", err)
+	}
+	return nil
+}
+
+// Prompts returns the recorded prompts, oldest first, for recall in
+// interactive input.
+func Prompts() ([]string, error) {
+	entries, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	prompts := make([]string, len(entries))
+	for i, entry := range entries {
+		prompts[i] = entry.Prompt
+	}
+	return prompts, nil
+}
@@ -0,0 +1,128 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"asc/internal/conversation"
+)
+
+// chatgptConversation is a conversation of a ChatGPT data export. Its
+// messages form a tree, since edited messages branch off; current_node is
+// the last message of the branch that was shown.
+type chatgptConversation struct {
+	ID             string                 `json:"id"`
+	ConversationID string                 `json:"conversation_id"`
+	Title          string                 `json:"title"`
+	CreateTime     float64                `json:"create_time"`
+	CurrentNode    string                 `json:"current_node"`
+	Mapping        map[string]chatgptNode `json:"mapping"`
+}
+
+type chatgptNode struct {
+	Parent  string          `json:"parent"`
+	Message *chatgptMessage `json:"message"`
+}
+
+type chatgptMessage struct {
+	Author struct {
+		Role string `json:"role"`
+	} `json:"author"`
+	CreateTime *float64 `json:"create_time"`
+	Content    struct {
+		ContentType string            `json:"content_type"`
+		Parts       []json.RawMessage `json:"parts"`
+	} `json:"content"`
+	Metadata struct {
+		ModelSlug string `json:"model_slug"`
+	} `json:"metadata"`
+}
+
+// parseChatGPT converts the conversations of a ChatGPT export, either the
+// whole conversations.json or a single conversation.
+func parseChatGPT(data []byte) ([]conversation.Conversation, error) {
+	var exported []chatgptConversation
+	if err := json.Unmarshal(data, &exported); err != nil {
+		var single chatgptConversation
+		if err := json.Unmarshal(data, &single); err != nil {
+			return nil, fmt.Errorf("invalid ChatGPT export: %w", err)
+		}
+		exported = []chatgptConversation{single}
+	}
+
+	var convs []conversation.Conversation
+	for _, c := range exported {
+		created := epoch(c.CreateTime)
+		var p pair
+		for _, msg := range c.branch() {
+			text := msg.text()
+			if text == "" {
+				continue
+			}
+			at := created
+			if msg.CreateTime != nil {
+				at = epoch(*msg.CreateTime)
+			}
+			switch msg.Author.Role {
+			case "user":
+				p.user(text, at)
+			case "assistant":
+				meta := &conversation.ResponseMeta{Provider: FormatChatGPT, Model: msg.Metadata.ModelSlug}
+				p.assistant(text, at, meta)
+			}
+		}
+		conv := p.conversation()
+		conv.Timestamp = created
+		conv.Title = c.Title
+		id := c.ID
+		if id == "" {
+			id = c.ConversationID
+		}
+		conv.Metadata = map[string]string{SourceKey: FormatChatGPT + ":" + id}
+		convs = append(convs, conv)
+	}
+	return convs, nil
+}
+
+// branch returns the messages from the root to the current node.
+func (c chatgptConversation) branch() []chatgptMessage {
+	var messages []chatgptMessage
+	seen := map[string]bool{}
+	for id := c.CurrentNode; id != "" && !seen[id]; id = c.Mapping[id].Parent {
+		seen[id] = true
+		if msg := c.Mapping[id].Message; msg != nil {
+			messages = append(messages, *msg)
+		}
+	}
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages
+}
+
+// text returns the text parts of a message. Images, code run by tools and
+// other content are left out.
+func (m chatgptMessage) text() string {
+	switch m.Content.ContentType {
+	case "text", "multimodal_text":
+	default:
+		return ""
+	}
+	var parts []string
+	for _, raw := range m.Content.Parts {
+		var part string
+		if json.Unmarshal(raw, &part) == nil && strings.TrimSpace(part) != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// epoch converts the fractional Unix time of ChatGPT exports.
+func epoch(seconds float64) time.Time {
+	whole, frac := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(frac*1e9)).Local()
+}
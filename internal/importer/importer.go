@@ -0,0 +1,231 @@
+// Package importer converts the history of other chat tools, ChatGPT data
+// exports and sgpt chat caches, into asc conversations.
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"asc/internal/conversation"
+
+	"github.com/charmbracelet/log"
+)
+
+// SourceKey is the metadata key that records where an imported
+// conversation came from, e.g. "chatgpt:<id>". Importing the same file
+// again skips the conversations that carry it.
+const SourceKey = "imported_from"
+
+// Formats of the files that can be imported.
+const (
+	FormatChatGPT = "chatgpt"
+	FormatSGPT    = "sgpt"
+)
+
+// chatgptArchiveFile is the file of a ChatGPT data export archive that
+// holds the conversations.
+const chatgptArchiveFile = "conversations.json"
+
+// Stats reports what an import did.
+type Stats struct {
+	Format        string
+	Conversations int
+	// Skipped lists the sources that were imported before.
+	Skipped []string
+	// Empty counts the conversations without any message.
+	Empty int
+}
+
+// Import reads the ChatGPT export (conversations.json or the zip archive)
+// or sgpt chat cache (a chat file or the chat_cache directory) at path and
+// saves its conversations. IDs and timestamps follow the original
+// creation times.
+func Import(path string, logger *log.Logger) (Stats, error) {
+	var stats Stats
+	convs, format, err := Read(path)
+	if err != nil {
+		return stats, err
+	}
+	stats.Format = format
+
+	used := map[string]bool{}
+	imported := map[string]bool{}
+	entries, err := conversation.LoadEntries(logger)
+	if err != nil && !os.IsNotExist(err) {
+		return stats, fmt.Errorf("failed to load conversations: %w", err)
+	}
+	for _, entry := range entries {
+		used[entry.ID] = true
+		if source := entry.Metadata[SourceKey]; source != "" {
+			imported[source] = true
+		}
+	}
+
+	sort.SliceStable(convs, func(i, j int) bool {
+		return convs[i].Timestamp.Before(convs[j].Timestamp)
+	})
+	for _, conv := range convs {
+		source := conv.Metadata[SourceKey]
+		if imported[source] {
+			stats.Skipped = append(stats.Skipped, source)
+			continue
+		}
+		if conv.Message == "" && conv.Response == "" && len(conv.Turns) == 0 {
+			stats.Empty++
+			continue
+		}
+		// IDs have a resolution of one second, so skip ahead on collisions
+		// as new conversations do
+		for used[conv.Timestamp.Format("20060102150405")] {
+			conv.Timestamp = conv.Timestamp.Add(time.Second)
+		}
+		conv.ID = conv.Timestamp.Format("20060102150405")
+		used[conv.ID] = true
+		if err := conversation.SaveConversation(conv, logger); err != nil {
+			return stats, err
+		}
+		imported[source] = true
+		stats.Conversations++
+		logger.Debug("Imported conversation", "id", conv.ID, "source", source)
+	}
+	return stats, nil
+}
+
+// Read converts the conversations of the file or directory at path without
+// saving them, and returns the detected format.
+func Read(path string) ([]conversation.Conversation, string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	if info.IsDir() {
+		convs, err := readSGPTDir(path)
+		return convs, FormatSGPT, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		if data, err = readArchive(data); err != nil {
+			return nil, "", err
+		}
+	}
+
+	switch detect(data) {
+	case FormatChatGPT:
+		convs, err := parseChatGPT(data)
+		return convs, FormatChatGPT, err
+	case FormatSGPT:
+		conv, err := parseSGPT(data, filepath.Base(path), info.ModTime())
+		return []conversation.Conversation{conv}, FormatSGPT, err
+	}
+	return nil, "", fmt.Errorf("%s is neither a ChatGPT export nor an sgpt chat", path)
+}
+
+// readArchive returns the conversations file of a ChatGPT export archive.
+func readArchive(data []byte) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	for _, f := range zr.File {
+		if filepath.Base(f.Name) != chatgptArchiveFile {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", f.Name, err)
+		}
+		defer rc.Close()
+		content, err := io.ReadAll(rc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+		}
+		return content, nil
+	}
+	return nil, fmt.Errorf("archive has no %s", chatgptArchiveFile)
+}
+
+// detect tells the format of a JSON document: ChatGPT exports are
+// conversations with a message tree ("mapping"), sgpt chats are lists of
+// messages with a role.
+func detect(data []byte) string {
+	var items []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		var single map[string]json.RawMessage
+		if json.Unmarshal(data, &single) == nil && single["mapping"] != nil {
+			return FormatChatGPT
+		}
+		return ""
+	}
+	if len(items) == 0 {
+		return ""
+	}
+	if items[0]["mapping"] != nil {
+		return FormatChatGPT
+	}
+	if items[0]["role"] != nil {
+		return FormatSGPT
+	}
+	return ""
+}
+
+// pair collects messages into exchanges: consecutive messages of the same
+// side are joined, and an answer without a question gets an empty message.
+type pair struct {
+	turns []conversation.Turn
+}
+
+func (p *pair) user(text string, at time.Time) {
+	if n := len(p.turns); n > 0 && p.turns[n-1].Response == "" {
+		p.turns[n-1].Message = joinText(p.turns[n-1].Message, text)
+		return
+	}
+	p.turns = append(p.turns, conversation.Turn{Timestamp: at, Message: text})
+}
+
+func (p *pair) assistant(text string, at time.Time, meta *conversation.ResponseMeta) {
+	n := len(p.turns)
+	if n == 0 {
+		p.turns = append(p.turns, conversation.Turn{Timestamp: at})
+		n = 1
+	}
+	p.turns[n-1].Response = joinText(p.turns[n-1].Response, text)
+	if meta != nil {
+		p.turns[n-1].Meta = meta
+	}
+}
+
+// conversation builds the conversation of the collected exchanges.
+func (p *pair) conversation() conversation.Conversation {
+	if len(p.turns) == 0 {
+		return conversation.Conversation{}
+	}
+	first := p.turns[0]
+	return conversation.Conversation{
+		Timestamp: first.Timestamp,
+		Message:   first.Message,
+		Response:  first.Response,
+		Meta:      first.Meta,
+		Turns:     p.turns[1:],
+	}
+}
+
+func joinText(a, b string) string {
+	if a == "" {
+		return b
+	}
+	if b == "" {
+		return a
+	}
+	return a + "\n\n" + b
+}
@@ -0,0 +1,73 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"asc/internal/conversation"
+)
+
+// sgptMessage is a message of an sgpt chat cache file.
+type sgptMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// parseSGPT converts the sgpt chat named name. Chat files do not record
+// times, so every exchange gets the modification time of the file.
+func parseSGPT(data []byte, name string, modified time.Time) (conversation.Conversation, error) {
+	var messages []sgptMessage
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return conversation.Conversation{}, fmt.Errorf("invalid sgpt chat %s: %w", name, err)
+	}
+	var p pair
+	var system string
+	for _, msg := range messages {
+		switch msg.Role {
+		case "system":
+			system = joinText(system, msg.Content)
+		case "user":
+			p.user(msg.Content, modified)
+		case "assistant":
+			p.assistant(msg.Content, modified, &conversation.ResponseMeta{Provider: FormatSGPT})
+		}
+	}
+	conv := p.conversation()
+	conv.Timestamp = modified
+	conv.Title = name
+	conv.System = system
+	conv.Metadata = map[string]string{SourceKey: FormatSGPT + ":" + name}
+	return conv, nil
+}
+
+// readSGPTDir converts every chat of an sgpt chat cache directory, by
+// default ~/.config/shell_gpt/chat_cache.
+func readSGPTDir(dir string) ([]conversation.Conversation, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	var convs []conversation.Conversation
+	for _, file := range files {
+		if file.IsDir() || file.Name()[0] == '.' {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file.Name(), err)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file.Name(), err)
+		}
+		conv, err := parseSGPT(data, file.Name(), info.ModTime())
+		if err != nil {
+			return nil, err
+		}
+		convs = append(convs, conv)
+	}
+	return convs, nil
+}
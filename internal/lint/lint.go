@@ -0,0 +1,107 @@
+package lint
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Input is a prompt together with what will be sent along with it.
+type Input struct {
+	Prompt string
+	// HasContext reports whether a context or system prompt is sent.
+	HasContext bool
+	// Attachments is the number of attached files.
+	Attachments int
+	// FollowUp reports whether earlier turns are sent as history.
+	FollowUp bool
+}
+
+// Issue is a possible problem with a prompt.
+type Issue struct {
+	Rule       string
+	Message    string
+	Suggestion string
+}
+
+// String formats the issue for the terminal.
+func (i Issue) String() string {
+	return fmt.Sprintf("%s: %s\n  → %s", i.Rule, i.Message, i.Suggestion)
+}
+
+// largePaste is the length above which an unstructured prompt is hard to
+// follow.
+const largePaste = 2000
+
+var (
+	leadingPronoun = regexp.MustCompile(`(?i)^\s*(it|this|that|these|those|they|them|he|she)\b`)
+	deictic        = regexp.MustCompile(`(?i)\b(this|the above|the following|attached|my) (code|error|file|function|log|output|script|message|snippet|diff)\b`)
+)
+
+// Check analyzes the prompt locally and returns the issues found.
+func Check(in Input) []Issue {
+	var issues []Issue
+	prompt := strings.TrimSpace(in.Prompt)
+	supplied := in.HasContext || in.Attachments > 0 || in.FollowUp || strings.Contains(prompt, "```")
+
+	if words := len(strings.Fields(prompt)); words < 3 && utf8.RuneCountInString(prompt) < 15 {
+		issues = append(issues, Issue{
+			Rule:       "too-short",
+			Message:    "the prompt is very short",
+			Suggestion: "say what you want to know and why, e.g. the goal and the constraints",
+		})
+	}
+
+	// "This error ..." names what it refers to; missing-context covers it
+	loc := deictic.FindStringIndex(prompt)
+	startsDeictic := loc != nil && loc[0] == 0
+	if m := leadingPronoun.FindStringSubmatch(prompt); m != nil && !in.FollowUp && !startsDeictic {
+		issues = append(issues, Issue{
+			Rule:       "ambiguous-pronoun",
+			Message:    fmt.Sprintf("the prompt starts with %q but there is no earlier turn it could refer to", m[1]),
+			Suggestion: "name the thing explicitly, or use 'asc append' to follow up on a conversation",
+		})
+	}
+
+	if m := deictic.FindString(prompt); m != "" && !supplied {
+		issues = append(issues, Issue{
+			Rule:       "missing-context",
+			Message:    fmt.Sprintf("the prompt mentions %q but nothing is attached", m),
+			Suggestion: "attach it with -f/--file, pass --context-file, or paste it in a ``` block",
+		})
+	}
+
+	if utf8.RuneCountInString(prompt) > largePaste && !strings.Contains(prompt, "```") {
+		issues = append(issues, Issue{
+			Rule:       "unstructured-paste",
+			Message:    fmt.Sprintf("the prompt is a large paste (%d characters) without structure", utf8.RuneCountInString(prompt)),
+			Suggestion: "state the question first and wrap the pasted text in a ``` block (--fix does this)",
+		})
+	}
+
+	return issues
+}
+
+// Fix applies the cleanup template to prompt: the question comes first,
+// followed by the pasted material in a fenced block. The first paragraph
+// is taken as the question, unless the last one is shorter, which is
+// typical for a paste followed by a question. Prompts that are short or
+// already fenced are returned unchanged.
+func Fix(prompt string) string {
+	prompt = strings.TrimSpace(prompt)
+	if utf8.RuneCountInString(prompt) <= largePaste || strings.Contains(prompt, "```") {
+		return prompt
+	}
+
+	paragraphs := strings.Split(prompt, "\n\n")
+	if len(paragraphs) < 2 {
+		return "# Question\nPlease look at the text below.\n\n# Input\n```\n" + prompt + "\n```"
+	}
+	first, last := paragraphs[0], paragraphs[len(paragraphs)-1]
+	question, input := first, strings.Join(paragraphs[1:], "\n\n")
+	if len(last) < len(first) {
+		question, input = last, strings.Join(paragraphs[:len(paragraphs)-1], "\n\n")
+	}
+	return "# Question\n" + strings.TrimSpace(question) + "\n\n# Input\n```\n" + strings.TrimSpace(input) + "\n```"
+}
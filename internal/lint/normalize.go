@@ -0,0 +1,233 @@
+package lint
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// typos maps common misspellings to their correction. Only words that are
+// never right as typed are listed, so that fixing them needs no review of
+// the meaning; "cant" and "wont" are words, so they are left out.
+var typos = map[string]string{
+	"teh":           "the",
+	"hte":           "the",
+	"taht":          "that",
+	"thier":         "their",
+	"waht":          "what",
+	"wiht":          "with",
+	"whcih":         "which",
+	"adn":           "and",
+	"jsut":          "just",
+	"becuase":       "because",
+	"beacuse":       "because",
+	"recieve":       "receive",
+	"recieved":      "received",
+	"reciever":      "receiver",
+	"seperate":      "separate",
+	"seperately":    "separately",
+	"definately":    "definitely",
+	"occured":       "occurred",
+	"occurence":     "occurrence",
+	"untill":        "until",
+	"wich":          "which",
+	"doesnt":        "doesn't",
+	"dont":          "don't",
+	"isnt":          "isn't",
+	"didnt":         "didn't",
+	"shoudl":        "should",
+	"woudl":         "would",
+	"coudl":         "could",
+	"funtion":       "function",
+	"fucntion":      "function",
+	"functoin":      "function",
+	"retrun":        "return",
+	"reutrn":        "return",
+	"varaible":      "variable",
+	"variabel":      "variable",
+	"paramter":      "parameter",
+	"arguement":     "argument",
+	"enviroment":    "environment",
+	"enviornment":   "environment",
+	"dependancy":    "dependency",
+	"dependancies":  "dependencies",
+	"compatability": "compatibility",
+	"accross":       "across",
+	"adress":        "address",
+	"alot":          "a lot",
+	"existant":      "existent",
+	"explaination":  "explanation",
+	"independant":   "independent",
+	"neccessary":    "necessary",
+	"necesary":      "necessary",
+	"occurance":     "occurrence",
+	"refered":       "referred",
+	"succesful":     "successful",
+	"sucessful":     "successful",
+	"tommorow":      "tomorrow",
+	"wierd":         "weird",
+}
+
+// doubled are the short words that are only ever repeated by mistake.
+var doubled = map[string]bool{
+	"the": true, "a": true, "an": true, "to": true, "of": true, "and": true,
+	"in": true, "is": true, "it": true, "for": true, "on": true, "with": true,
+}
+
+var (
+	tokenPattern = regexp.MustCompile(`\S+`)
+	wordPattern  = regexp.MustCompile(`^[A-Za-z']+$`)
+	spaceRun     = regexp.MustCompile(`[ \t]{2,}`)
+	inlineCode   = regexp.MustCompile("`[^`]*`")
+)
+
+// splitToken splits a token of text between spaces into the word and the
+// quotes, brackets and sentence punctuation around it. ok is false when
+// the rest is not a plain word, e.g. in identifiers such as my_dont_var,
+// paths or URLs, which are not corrected.
+func splitToken(token string) (lead, word, trail string, ok bool) {
+	word = strings.TrimLeft(token, `"'([{*`)
+	lead = token[:len(token)-len(word)]
+	trimmed := strings.TrimRight(word, `"'.,;:!?)]}*`)
+	trail = word[len(trimmed):]
+	return lead, trimmed, trail, wordPattern.MatchString(trimmed)
+}
+
+// Normalize fixes obvious typos and normalizes whitespace in prompt:
+// trailing spaces, runs of spaces inside lines, repeated blank lines and
+// doubled short words. Fenced code blocks and inline code are left as
+// they are.
+func Normalize(prompt string) string {
+	var out []string
+	inFence := false
+	blank := false
+	for _, line := range strings.Split(strings.TrimSpace(prompt), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+			out = append(out, strings.TrimRight(line, " \t"))
+			blank = false
+			continue
+		}
+		if inFence {
+			out = append(out, line)
+			continue
+		}
+		line = strings.TrimRight(line, " \t")
+		if line == "" {
+			if !blank {
+				out = append(out, "")
+			}
+			blank = true
+			continue
+		}
+		blank = false
+		out = append(out, normalizeLine(line))
+	}
+	return strings.Join(out, "\n")
+}
+
+// normalizeLine fixes a line of prose, skipping its inline code spans.
+func normalizeLine(line string) string {
+	indent := len(line) - len(strings.TrimLeft(line, " \t"))
+	var b strings.Builder
+	b.WriteString(line[:indent])
+	rest := line[indent:]
+	for _, span := range inlineCode.FindAllStringIndex(rest, -1) {
+		b.WriteString(normalizeProse(rest[:span[0]]))
+		b.WriteString(rest[span[0]:span[1]])
+		rest = rest[span[1]:]
+	}
+	b.WriteString(normalizeProse(rest))
+	return b.String()
+}
+
+// normalizeProse fixes text without code.
+func normalizeProse(text string) string {
+	text = spaceRun.ReplaceAllString(text, " ")
+	text = tokenPattern.ReplaceAllStringFunc(text, func(token string) string {
+		lead, word, trail, ok := splitToken(token)
+		fixed, typo := typos[strings.ToLower(word)]
+		if !ok || !typo {
+			return token
+		}
+		return lead + matchCase(word, fixed) + trail
+	})
+	return removeDoubled(text)
+}
+
+// removeDoubled drops the second of two equal short words in a row,
+// keeping the punctuation after it.
+func removeDoubled(text string) string {
+	var b strings.Builder
+	last, end := "", 0
+	for _, loc := range tokenPattern.FindAllStringIndex(text, -1) {
+		lead, word, trail, ok := splitToken(text[loc[0]:loc[1]])
+		if ok && lead == "" && strings.EqualFold(word, last) && doubled[strings.ToLower(word)] {
+			b.WriteString(trail)
+			end = loc[1]
+			if trail != "" {
+				last = ""
+			}
+			continue
+		}
+		b.WriteString(text[end:loc[1]])
+		end = loc[1]
+		// Only a bare word can be followed by its repetition
+		last = ""
+		if ok && trail == "" {
+			last = word
+		}
+	}
+	b.WriteString(text[end:])
+	return b.String()
+}
+
+// matchCase capitalizes fixed like word: all upper case or a capital
+// first letter.
+func matchCase(word, fixed string) string {
+	switch {
+	case len(word) > 1 && strings.ToUpper(word) == word:
+		return strings.ToUpper(fixed)
+	case unicode.IsUpper([]rune(word)[0]):
+		r := []rune(fixed)
+		r[0] = unicode.ToUpper(r[0])
+		return string(r)
+	}
+	return fixed
+}
+
+// Diff lists the lines of before and after that differ, prefixed with
+// "-" and "+", with the unchanged lines around them left out.
+func Diff(before, after string) []string {
+	a, b := strings.Split(before, "\n"), strings.Split(after, "\n")
+	// Longest common subsequence of lines; prompts are small
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var lines []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, "- "+a[i])
+			i++
+		default:
+			lines = append(lines, "+ "+b[j])
+			j++
+		}
+	}
+	return lines
+}
@@ -0,0 +1,29 @@
+package lint
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name, prompt, want string
+	}{
+		{"typo", "Explain teh difference", "Explain the difference"},
+		{"typo case", "Teh answer, HTE END", "The answer, THE END"},
+		{"typo punctuation", `Why "dont" it work (becuase of teh cache)?`, `Why "don't" it work (because of the cache)?`},
+		{"real words", "I cant stop and it wont start", "I cant stop and it wont start"},
+		{"doubled", "Move the the file to to the folder", "Move the file to the folder"},
+		{"doubled punctuation", "Read the the. The end", "Read the. The end"},
+		{"not doubled across sentences", "It is. Is it?", "It is. Is it?"},
+		{"identifier", "Rename my_dont_var and teh_count", "Rename my_dont_var and teh_count"},
+		{"path", "Open src/adress.go and adress.go", "Open src/adress.go and adress.go"},
+		{"url", "See https://example.com/teh/adress-book", "See https://example.com/teh/adress-book"},
+		{"hyphenated", "A seperate-file option", "A seperate-file option"},
+		{"inline code", "Use `teh the the` in teh code", "Use `teh the the` in the code"},
+		{"fenced code", "Fix teh bug:\n```\nteh  the the\n```", "Fix the bug:\n```\nteh  the the\n```"},
+		{"whitespace", "one  two   \n\n\n\nthree", "one two\n\nthree"},
+	}
+	for _, test := range tests {
+		if got := Normalize(test.prompt); got != test.want {
+			t.Errorf("%s: Normalize(%q) = %q, want %q", test.name, test.prompt, got, test.want)
+		}
+	}
+}
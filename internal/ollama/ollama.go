@@ -0,0 +1,176 @@
+package ollama
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultHost is the address of a local Ollama server.
+const DefaultHost = "http://localhost:11434"
+
+// Host returns the server address from $OLLAMA_HOST, as used by the ollama
+// command, or DefaultHost.
+func Host() string {
+	host := os.Getenv("OLLAMA_HOST")
+	if host == "" {
+		return DefaultHost
+	}
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	return strings.TrimSuffix(host, "/")
+}
+
+// Result describes how a generation finished.
+type Result struct {
+	// DoneReason is "stop", or "length" for answers cut off at the limit.
+	DoneReason string
+	// PromptTokens and CompletionTokens are the token counts reported by
+	// the server.
+	PromptTokens     int
+	CompletionTokens int
+}
+
+type generateRequest struct {
+	Model     string `json:"model"`
+	Prompt    string `json:"prompt"`
+	Stream    bool   `json:"stream"`
+	KeepAlive any    `json:"keep_alive,omitempty"`
+	// Images are base64-encoded images for multimodal models.
+	Images []string `json:"images,omitempty"`
+}
+
+type generateChunk struct {
+	Response        string `json:"response"`
+	Done            bool   `json:"done"`
+	DoneReason      string `json:"done_reason"`
+	PromptEvalCount int    `json:"prompt_eval_count"`
+	EvalCount       int    `json:"eval_count"`
+	Error           string `json:"error"`
+}
+
+// CheckKeepAlive validates a keep_alive value: a duration such as "30m",
+// or a number of seconds, where a negative one keeps the model loaded
+// until the server stops.
+func CheckKeepAlive(keepAlive string) error {
+	if _, err := keepAliveValue(keepAlive); err != nil {
+		return fmt.Errorf("invalid keep_alive %q, expected a duration such as 30m or a number of seconds", keepAlive)
+	}
+	return nil
+}
+
+// keepAliveValue converts keepAlive to what the server expects: plain
+// numbers are seconds, anything else must be a duration.
+func keepAliveValue(keepAlive string) (any, error) {
+	if keepAlive == "" {
+		return nil, nil
+	}
+	if n, err := strconv.Atoi(keepAlive); err == nil {
+		return n, nil
+	}
+	if _, err := time.ParseDuration(keepAlive); err != nil {
+		return nil, err
+	}
+	return keepAlive, nil
+}
+
+// Generate sends prompt, with images encoded in base64 for multimodal
+// models, to model on the server at host and writes the answer to w as it
+// streams. keepAlive is how long the server keeps the model loaded
+// afterwards, empty for its default. The raw request and response bodies
+// are copied to trace unless it is nil. Cancelling ctx aborts the request.
+func Generate(ctx context.Context, host, model, prompt string, images []string, keepAlive string, w, trace io.Writer) (*Result, error) {
+	if trace == nil {
+		trace = io.Discard
+	}
+	resp, err := post(ctx, host, generateRequest{Model: model, Prompt: prompt, Stream: true, Images: images}, keepAlive, trace)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// The answer arrives as one JSON object per line
+	result := &Result{}
+	scanner := bufio.NewScanner(io.TeeReader(resp.Body, trace))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var chunk generateChunk
+		if err := json.Unmarshal(scanner.Bytes(), &chunk); err != nil {
+			return result, fmt.Errorf("failed to decode ollama response: %w", err)
+		}
+		if chunk.Error != "" {
+			return result, fmt.Errorf("ollama: %s", chunk.Error)
+		}
+		if _, err := io.WriteString(w, chunk.Response); err != nil {
+			return result, err
+		}
+		if chunk.Done {
+			result.DoneReason = chunk.DoneReason
+			result.PromptTokens = chunk.PromptEvalCount
+			result.CompletionTokens = chunk.EvalCount
+			return result, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return result, fmt.Errorf("failed to read ollama response: %w", err)
+	}
+	return result, fmt.Errorf("ollama response ended early")
+}
+
+// Load loads model into memory on the server at host without generating
+// anything, so that the next request does not wait for it. keepAlive is
+// as for Generate.
+func Load(ctx context.Context, host, model, keepAlive string) error {
+	resp, err := post(ctx, host, generateRequest{Model: model}, keepAlive, io.Discard)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// post sends a generate request and checks its status. The request body,
+// and the status line of the response, are written to trace.
+func post(ctx context.Context, host string, request generateRequest, keepAlive string, trace io.Writer) (*http.Response, error) {
+	keep, err := keepAliveValue(keepAlive)
+	if err != nil {
+		return nil, CheckKeepAlive(keepAlive)
+	}
+	request.KeepAlive = keep
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, host+"/api/generate", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	fmt.Fprintf(trace, "%s %s\n%s\n\n", req.Method, req.URL, body)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ollama at %s: %w", host, err)
+	}
+	fmt.Fprintf(trace, "%s %s\n", resp.Proto, resp.Status)
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var chunk generateChunk
+		data, _ := io.ReadAll(resp.Body)
+		trace.Write(data)
+		if json.Unmarshal(data, &chunk) == nil && chunk.Error != "" {
+			return nil, fmt.Errorf("ollama: %s", chunk.Error)
+		}
+		return nil, fmt.Errorf("ollama: %s", resp.Status)
+	}
+	return resp, nil
+}
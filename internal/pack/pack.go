@@ -0,0 +1,317 @@
+// Package pack copies personas, styles and prompt templates between the
+// share directory and a pack: a directory that can be kept in a dotfiles
+// repository or shared with a team. Imported items are renamed into a
+// namespace so that packs do not overwrite each other or local items.
+package pack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"asc/internal/config"
+)
+
+// manifestFile lists the items of a pack, at its top.
+const manifestFile = "pack.json"
+
+// NamespaceSeparator joins the namespace and the name of imported items,
+// e.g. "team.reviewer".
+const NamespaceSeparator = "."
+
+// Manifest describes a pack.
+type Manifest struct {
+	// Name is the default namespace of the items on import.
+	Name    string    `json:"name"`
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	// Items are the exported items as "kind/name", e.g. "persona/reviewer".
+	Items []string `json:"items"`
+}
+
+// Kind is a kind of item. An item is made of the files <Dir>/<name><Ext>
+// of the share directory, and of a pack, that exist.
+type Kind struct {
+	Name  string
+	Files []File
+}
+
+// File is a file that is part of an item.
+type File struct {
+	Dir string
+	Ext string
+}
+
+// Kinds lists the kinds of items a pack can hold. A persona is its system
+// prompt and its bank of few-shot examples.
+var Kinds = []Kind{
+	{Name: "persona", Files: []File{{Dir: "personas", Ext: ".md"}, {Dir: "examples", Ext: ".json"}}},
+	{Name: "style", Files: []File{{Dir: "styles", Ext: ".json"}}},
+	{Name: "template", Files: []File{{Dir: "templates", Ext: ".md"}}},
+}
+
+// Item is an item of a pack.
+type Item struct {
+	Kind Kind
+	Name string
+}
+
+// String returns the item as "kind/name".
+func (i Item) String() string {
+	return i.Kind.Name + "/" + i.Name
+}
+
+func (i Item) path(root string, f File) string {
+	return filepath.Join(root, f.Dir, i.Name+f.Ext)
+}
+
+// read returns the content of the files of the item under root, keyed by
+// file; files that do not exist are left out.
+func (i Item) read(root string) (map[File][]byte, error) {
+	contents := map[File][]byte{}
+	for _, f := range i.Kind.Files {
+		data, err := os.ReadFile(i.path(root, f))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read %s: %w", i, err)
+		}
+		contents[f] = data
+	}
+	return contents, nil
+}
+
+// Imported reports what happened to an item of an imported pack.
+type Imported struct {
+	From Item
+	To   Item
+	// Unchanged is set when the item was installed with the same content
+	// before.
+	Unchanged bool
+}
+
+// ParseItem parses an item given as "kind/name".
+func ParseItem(ref string) (Item, error) {
+	kindName, name, ok := strings.Cut(ref, "/")
+	if !ok {
+		return Item{}, fmt.Errorf("invalid item %q, expected kind/name (kinds: %s)", ref, kindNames())
+	}
+	kind, ok := lookupKind(kindName)
+	if !ok {
+		return Item{}, fmt.Errorf("unknown kind %q (kinds: %s)", kindName, kindNames())
+	}
+	if err := checkName(name); err != nil {
+		return Item{}, err
+	}
+	return Item{Kind: kind, Name: name}, nil
+}
+
+func lookupKind(name string) (Kind, bool) {
+	for _, kind := range Kinds {
+		if kind.Name == name {
+			return kind, true
+		}
+	}
+	return Kind{}, false
+}
+
+func kindNames() string {
+	names := make([]string, len(Kinds))
+	for i, kind := range Kinds {
+		names[i] = kind.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// checkName rejects names that cannot be used as file names.
+func checkName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\ `) {
+		return fmt.Errorf("invalid item name %q", name)
+	}
+	return nil
+}
+
+// Installed lists the items in the share directory, by kind and name.
+func Installed() ([]Item, error) {
+	shareDir, err := config.GetShareDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get share directory: %w", err)
+	}
+	return list(shareDir)
+}
+
+// list returns the items kept under root.
+func list(root string) ([]Item, error) {
+	var items []Item
+	for _, kind := range Kinds {
+		seen := map[string]bool{}
+		for _, f := range kind.Files {
+			entries, err := os.ReadDir(filepath.Join(root, f.Dir))
+			if err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return nil, fmt.Errorf("failed to read %s: %w", f.Dir, err)
+			}
+			for _, entry := range entries {
+				name := strings.TrimSuffix(entry.Name(), f.Ext)
+				if !entry.IsDir() && strings.HasSuffix(entry.Name(), f.Ext) && !seen[name] {
+					seen[name] = true
+					items = append(items, Item{Kind: kind, Name: name})
+				}
+			}
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].String() < items[j].String() })
+	return items, nil
+}
+
+// Export copies items from the share directory to the pack directory
+// dest, which is created if needed, and writes its manifest under name.
+// Without items, every installed item is exported. Exporting to the same
+// directory again replaces the pack.
+func Export(dest, name string, items []Item) (Manifest, error) {
+	manifest := Manifest{Name: name, Version: 1, Created: time.Now()}
+	if err := checkName(name); err != nil {
+		return manifest, fmt.Errorf("invalid pack name %q", name)
+	}
+	shareDir, err := config.GetShareDir()
+	if err != nil {
+		return manifest, fmt.Errorf("failed to get share directory: %w", err)
+	}
+	if len(items) == 0 {
+		if items, err = list(shareDir); err != nil {
+			return manifest, err
+		}
+	}
+	if len(items) == 0 {
+		return manifest, fmt.Errorf("nothing to export")
+	}
+
+	for _, item := range items {
+		contents, err := item.read(shareDir)
+		if err != nil {
+			return manifest, err
+		}
+		if len(contents) == 0 {
+			return manifest, fmt.Errorf("%s does not exist", item)
+		}
+		for f, data := range contents {
+			path := item.path(dest, f)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return manifest, fmt.Errorf("failed to create pack directory: %w", err)
+			}
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				return manifest, fmt.Errorf("failed to write %s: %w", path, err)
+			}
+		}
+		manifest.Items = append(manifest.Items, item.String())
+	}
+	sort.Strings(manifest.Items)
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dest, manifestFile), append(data, '\n'), 0644); err != nil {
+		return manifest, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// ReadManifest reads the manifest of the pack directory src.
+func ReadManifest(src string) (Manifest, error) {
+	var manifest Manifest
+	data, err := os.ReadFile(filepath.Join(src, manifestFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return manifest, fmt.Errorf("%s is not a pack: %s is missing", src, manifestFile)
+		}
+		return manifest, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("invalid manifest in %s: %w", src, err)
+	}
+	return manifest, nil
+}
+
+// Import installs the items of the pack directory src in the share
+// directory, named "<namespace>.<name>", or by their own name when
+// namespace is empty. Nothing is installed if an item would replace a
+// different one, unless force is set.
+func Import(src, namespace string, force bool) ([]Imported, error) {
+	manifest, err := ReadManifest(src)
+	if err != nil {
+		return nil, err
+	}
+	if namespace != "" {
+		if err := checkName(namespace); err != nil {
+			return nil, fmt.Errorf("invalid namespace %q", namespace)
+		}
+	}
+	shareDir, err := config.GetShareDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get share directory: %w", err)
+	}
+
+	var imported []Imported
+	var contents []map[File][]byte
+	var collisions []string
+	for _, ref := range manifest.Items {
+		from, err := ParseItem(ref)
+		if err != nil {
+			return nil, fmt.Errorf("invalid manifest in %s: %w", src, err)
+		}
+		files, err := from.read(src)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("%s is missing from %s", from, src)
+		}
+		to := from
+		if namespace != "" {
+			to.Name = namespace + NamespaceSeparator + from.Name
+		}
+		existing, err := to.read(shareDir)
+		if err != nil {
+			return nil, err
+		}
+		unchanged := len(existing) == len(files)
+		for f, data := range files {
+			if !bytes.Equal(existing[f], data) {
+				unchanged = false
+			}
+		}
+		if len(existing) > 0 && !unchanged {
+			collisions = append(collisions, to.String())
+		}
+		imported = append(imported, Imported{From: from, To: to, Unchanged: unchanged})
+		contents = append(contents, files)
+	}
+	if len(collisions) > 0 && !force {
+		return nil, fmt.Errorf("would replace %s; use --force or another --namespace", strings.Join(collisions, ", "))
+	}
+
+	for i, item := range imported {
+		if item.Unchanged {
+			continue
+		}
+		for f, data := range contents[i] {
+			path := item.To.path(shareDir, f)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return imported[:i], fmt.Errorf("failed to create %s directory: %w", f.Dir, err)
+			}
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				return imported[:i], fmt.Errorf("failed to write %s: %w", item.To, err)
+			}
+		}
+	}
+	return imported, nil
+}
@@ -0,0 +1,112 @@
+// Package pager shows long text full screen, in the pager of the user or
+// in a built-in viewer, as selected by [paging] viewer in the config.
+package pager
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+
+	"asc/internal/config"
+	"asc/internal/crash"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"golang.org/x/term"
+)
+
+// Values of [paging] viewer; empty is ViewerPager.
+const (
+	ViewerPager   = "pager"
+	ViewerBuiltin = "builtin"
+)
+
+// Show shows text, which may hold ANSI styles, in the configured viewer.
+func Show(text string) error {
+	if config.Current().Paging.Viewer == ViewerBuiltin {
+		return showBuiltin(text)
+	}
+	return showPager(text)
+}
+
+// showPager pipes text into the pager. Ctrl-C is left to the pager, which
+// uses it to stop a search, instead of ending asc.
+func showPager(text string) error {
+	signal.Ignore(os.Interrupt)
+	defer signal.Reset(os.Interrupt)
+	pager := config.GetPager()
+	cmd := exec.Command(pager[0], pager[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to run pager: %w", err)
+	}
+	return nil
+}
+
+// showBuiltin shows text in a full-screen viewport.
+func showBuiltin(text string) error {
+	m := model{text: strings.TrimRight(text, "\n")}
+	opts := []tea.ProgramOption{tea.WithAltScreen(), tea.WithMouseCellMotion()}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		// The message was piped, so read the keys from the terminal
+		opts = append(opts, tea.WithInputTTY())
+	}
+	if _, err := crash.NewProgram(m, opts...).Run(); err != nil {
+		return fmt.Errorf("failed to run viewer: %w", err)
+	}
+	return nil
+}
+
+// model is the built-in viewer: the text above a status line.
+type model struct {
+	text     string
+	viewport viewport.Model
+	ready    bool
+}
+
+func (m model) Init() tea.Cmd {
+	return nil
+}
+
+func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		height := max(1, msg.Height-1)
+		if !m.ready {
+			m.viewport = viewport.New(msg.Width, height)
+			m.viewport.SetContent(m.text)
+			m.ready = true
+		} else {
+			m.viewport.Width, m.viewport.Height = msg.Width, height
+		}
+		return m, nil
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "esc", "ctrl+c":
+			return m, tea.Quit
+		case "g", "home":
+			m.viewport.GotoTop()
+			return m, nil
+		case "G", "end":
+			m.viewport.GotoBottom()
+			return m, nil
+		}
+	}
+	var cmd tea.Cmd
+	m.viewport, cmd = m.viewport.Update(msg)
+	return m, cmd
+}
+
+func (m model) View() string {
+	if !m.ready {
+		return ""
+	}
+	muted := lipgloss.NewStyle().Foreground(lipgloss.Color(config.Colors().Muted))
+	status := fmt.Sprintf("%3.0f%%  ↑/↓ scroll, space/b page, g/G top/bottom, q quit", m.viewport.ScrollPercent()*100)
+	return m.viewport.View() + "\n" + muted.Render(status)
+}
@@ -0,0 +1,160 @@
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Feature is an optional capability a request may need.
+type Feature string
+
+const (
+	FeatureStreaming    Feature = "streaming"
+	FeatureSystemPrompt Feature = "system prompt"
+	FeatureContext      Feature = "context"
+	FeatureVision       Feature = "vision"
+	FeatureTools        Feature = "tools"
+	FeatureCitations    Feature = "citations"
+	FeatureModel        Feature = "model selection"
+)
+
+// Capabilities describes what a provider (or one of its models) supports.
+type Capabilities struct {
+	Streaming    bool
+	SystemPrompt bool
+	// Context reports whether the context file can be prepended.
+	Context   bool
+	Vision    bool
+	Tools     bool
+	Citations bool
+	// Model reports whether a model can be selected per request.
+	Model bool
+	// MaxContext is the context window in tokens, 0 if unknown.
+	MaxContext int
+}
+
+// Supports reports whether the capabilities include feature.
+func (c Capabilities) Supports(feature Feature) bool {
+	switch feature {
+	case FeatureStreaming:
+		return c.Streaming
+	case FeatureSystemPrompt:
+		return c.SystemPrompt
+	case FeatureContext:
+		return c.Context
+	case FeatureVision:
+		return c.Vision
+	case FeatureTools:
+		return c.Tools
+	case FeatureCitations:
+		return c.Citations
+	case FeatureModel:
+		return c.Model
+	}
+	return false
+}
+
+// Features lists the supported features in a stable order.
+func (c Capabilities) Features() []Feature {
+	var features []Feature
+	for _, f := range []Feature{FeatureStreaming, FeatureSystemPrompt, FeatureContext, FeatureVision, FeatureTools, FeatureCitations, FeatureModel} {
+		if c.Supports(f) {
+			features = append(features, f)
+		}
+	}
+	return features
+}
+
+// capabilities holds the known providers, keyed by provider name. Entries
+// keyed by "provider/model" override the provider defaults for that model.
+var capabilities = map[string]Capabilities{
+	"sgpt": {
+		Streaming:    true,
+		SystemPrompt: true,
+		Context:      true,
+		Model:        true,
+	},
+	"perplexity": {
+		Streaming: true,
+		Citations: true,
+	},
+	// Images reach multimodal models such as llava; others ignore them
+	"ollama": {
+		Streaming:    true,
+		SystemPrompt: true,
+		Context:      true,
+		Vision:       true,
+		Model:        true,
+	},
+}
+
+// Lookup returns the capabilities of provider, refined for model if the
+// model is known. The context window comes from the model registry.
+func Lookup(provider, model string) (Capabilities, bool) {
+	caps, ok := capabilities[provider]
+	if model != "" {
+		if modelCaps, known := capabilities[provider+"/"+model]; known {
+			caps, ok = modelCaps, true
+		}
+	}
+	if m, known := LookupModel(provider, model); ok && known && caps.MaxContext == 0 {
+		caps.MaxContext = m.ContextWindow
+	}
+	return caps, ok
+}
+
+// Names returns the known provider names.
+func Names() []string {
+	var names []string
+	for name := range capabilities {
+		if !strings.Contains(name, "/") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Require returns an error if provider/model lacks one of features. The
+// error names the missing features and suggests providers that have them.
+func Require(provider, model string, features ...Feature) error {
+	caps, ok := Lookup(provider, model)
+	if !ok {
+		return fmt.Errorf("unknown provider %q (known: %s)", provider, strings.Join(Names(), ", "))
+	}
+
+	var missing []string
+	for _, f := range features {
+		if !caps.Supports(f) {
+			missing = append(missing, string(f))
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	var capable []string
+	for _, name := range Names() {
+		if name == provider {
+			continue
+		}
+		if other, _ := Lookup(name, ""); supportsAll(other, features) {
+			capable = append(capable, name)
+		}
+	}
+	err := fmt.Errorf("%s does not support %s", provider, strings.Join(missing, ", "))
+	if len(capable) > 0 {
+		err = fmt.Errorf("%w; try %s", err, strings.Join(capable, " or "))
+	}
+	return err
+}
+
+func supportsAll(caps Capabilities, features []Feature) bool {
+	for _, f := range features {
+		if !caps.Supports(f) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+// sgpt runs shell-gpt.
+type sgpt struct{}
+
+func (sgpt) Stream(ctx context.Context, call Call) (*Stream, error) {
+	args := []string{"--stream"}
+	if call.Model != "" {
+		args = append(args, "--model", call.Model)
+	}
+	if call.Chat != "" {
+		args = append(args, "--chat", call.Chat)
+	}
+	args = append(args, call.Args...)
+	return startCommand(ctx, "sgpt", append(args, call.Prompt), call.Stderr)
+}
+
+func (sgpt) Available() error {
+	_, err := exec.LookPath("sgpt")
+	return err
+}
+
+// perplexity runs the perplexity command, which searches the web.
+type perplexity struct{}
+
+func (perplexity) Stream(ctx context.Context, call Call) (*Stream, error) {
+	args := append([]string{"-g", "--stream"}, call.Args...)
+	return startCommand(ctx, "perplexity", append(args, call.Prompt), call.Stderr)
+}
+
+func (perplexity) Available() error {
+	_, err := exec.LookPath("perplexity")
+	return err
+}
+
+// startCommand runs name with args and streams its output.
+func startCommand(ctx context.Context, name string, args []string, stderr io.Writer) (*Stream, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start AI command: %w", err)
+	}
+
+	tokens := make(chan string)
+	var readErr error
+	go func() {
+		defer close(tokens)
+		buf := make([]byte, 4096)
+		for {
+			n, err := stdout.Read(buf)
+			if n > 0 {
+				if send(ctx, tokens, string(buf[:n])) != nil {
+					return
+				}
+			}
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					readErr = fmt.Errorf("error reading AI output: %w", err)
+				}
+				return
+			}
+		}
+	}()
+
+	return &Stream{
+		Command: cmd.Args,
+		Tokens:  tokens,
+		Wait: func() (Result, error) {
+			// The output must be read to the end before waiting
+			for range tokens {
+			}
+			if err := cmd.Wait(); err != nil {
+				return Result{}, err
+			}
+			return Result{}, readErr
+		},
+	}, nil
+}
@@ -0,0 +1,251 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"asc/internal/config"
+)
+
+// DefaultModelsURL is where `asc models update` fetches the registry from
+// unless models_url is set. The file is maintained by the LiteLLM project.
+const DefaultModelsURL = "https://raw.githubusercontent.com/BerriAI/litellm/main/model_prices_and_context_window.json"
+
+// modelsFile holds the registry fetched by UpdateModels, in the share
+// directory.
+const modelsFile = "models.json"
+
+// Model describes a known model of a provider.
+type Model struct {
+	Provider string `json:"provider"`
+	Name     string `json:"name"`
+	// ContextWindow is the number of input tokens the model accepts.
+	ContextWindow int `json:"context_window"`
+	// InputPrice and OutputPrice are in USD per million tokens, 0 for
+	// local models.
+	InputPrice  float64 `json:"input_price"`
+	OutputPrice float64 `json:"output_price"`
+}
+
+// Registry is the list of known models.
+type Registry struct {
+	// Source is the URL or file the registry was updated from, empty for
+	// the built-in list.
+	Source  string    `json:"source,omitempty"`
+	Updated time.Time `json:"updated,omitempty"`
+	Models  []Model   `json:"models"`
+}
+
+// builtinModels is used until `asc models update` is run. Prices are as of
+// mid 2025.
+var builtinModels = []Model{
+	{Provider: "sgpt", Name: "gpt-4o", ContextWindow: 128000, InputPrice: 2.5, OutputPrice: 10},
+	{Provider: "sgpt", Name: "gpt-4o-mini", ContextWindow: 128000, InputPrice: 0.15, OutputPrice: 0.6},
+	{Provider: "sgpt", Name: "gpt-4.1", ContextWindow: 1047576, InputPrice: 2, OutputPrice: 8},
+	{Provider: "sgpt", Name: "gpt-4.1-mini", ContextWindow: 1047576, InputPrice: 0.4, OutputPrice: 1.6},
+	{Provider: "sgpt", Name: "gpt-4.1-nano", ContextWindow: 1047576, InputPrice: 0.1, OutputPrice: 0.4},
+	{Provider: "sgpt", Name: "gpt-4-turbo", ContextWindow: 128000, InputPrice: 10, OutputPrice: 30},
+	{Provider: "sgpt", Name: "gpt-3.5-turbo", ContextWindow: 16385, InputPrice: 0.5, OutputPrice: 1.5},
+	{Provider: "sgpt", Name: "o1", ContextWindow: 200000, InputPrice: 15, OutputPrice: 60},
+	{Provider: "sgpt", Name: "o3", ContextWindow: 200000, InputPrice: 2, OutputPrice: 8},
+	{Provider: "sgpt", Name: "o3-mini", ContextWindow: 200000, InputPrice: 1.1, OutputPrice: 4.4},
+	{Provider: "sgpt", Name: "o4-mini", ContextWindow: 200000, InputPrice: 1.1, OutputPrice: 4.4},
+	{Provider: "perplexity", Name: "sonar", ContextWindow: 127072, InputPrice: 1, OutputPrice: 1},
+	{Provider: "perplexity", Name: "sonar-pro", ContextWindow: 200000, InputPrice: 3, OutputPrice: 15},
+	{Provider: "ollama", Name: "llama3", ContextWindow: 8192},
+	{Provider: "ollama", Name: "llama3.1", ContextWindow: 131072},
+	{Provider: "ollama", Name: "llama3.2", ContextWindow: 131072},
+	{Provider: "ollama", Name: "mistral", ContextWindow: 32768},
+	{Provider: "ollama", Name: "qwen2.5", ContextWindow: 32768},
+	{Provider: "ollama", Name: "gemma2", ContextWindow: 8192},
+}
+
+var (
+	registryOnce sync.Once
+	registry     Registry
+	registryErr  error
+)
+
+// Models returns the model registry: the one saved by UpdateModels, or the
+// built-in list.
+func Models() (Registry, error) {
+	registryOnce.Do(func() {
+		registry, registryErr = loadRegistry()
+	})
+	return registry, registryErr
+}
+
+func loadRegistry() (Registry, error) {
+	builtin := Registry{Models: builtinModels}
+	path, err := modelsPath()
+	if err != nil {
+		return builtin, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return builtin, nil
+		}
+		return builtin, fmt.Errorf("failed to read model registry: %w", err)
+	}
+	var saved Registry
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return builtin, fmt.Errorf("failed to parse model registry %s: %w", path, err)
+	}
+	return saved, nil
+}
+
+// LookupModel returns the registry entry of model. An empty provider
+// matches any provider. Ollama tags such as ":8b" are ignored if the
+// tagged name is not known.
+func LookupModel(provider, model string) (Model, bool) {
+	if model == "" {
+		return Model{}, false
+	}
+	reg, _ := Models()
+	names := []string{model}
+	if base, _, ok := strings.Cut(model, ":"); ok {
+		names = append(names, base)
+	}
+	for _, name := range names {
+		for _, m := range reg.Models {
+			if m.Name == name && (provider == "" || m.Provider == provider) {
+				return m, true
+			}
+		}
+	}
+	return Model{}, false
+}
+
+// EstimateTokens returns a rough token count of text, about four
+// characters per token.
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// UpdateModels fetches the registry from source, a URL or a file in the
+// LiteLLM format, and saves it in the share directory.
+func UpdateModels(ctx context.Context, source string) (Registry, error) {
+	var data []byte
+	var err error
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		data, err = fetch(ctx, source)
+	} else {
+		data, err = os.ReadFile(source)
+	}
+	if err != nil {
+		return Registry{}, fmt.Errorf("failed to read %s: %w", source, err)
+	}
+	models, err := parseLiteLLM(data)
+	if err != nil {
+		return Registry{}, fmt.Errorf("failed to parse %s: %w", source, err)
+	}
+	if len(models) == 0 {
+		return Registry{}, fmt.Errorf("no models of a known provider in %s", source)
+	}
+
+	reg := Registry{Source: source, Updated: time.Now(), Models: models}
+	path, err := modelsPath()
+	if err != nil {
+		return Registry{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return Registry{}, fmt.Errorf("failed to create share directory: %w", err)
+	}
+	out, err := json.MarshalIndent(reg, "", "  ")
+	if err != nil {
+		return Registry{}, fmt.Errorf("failed to marshal model registry: %w", err)
+	}
+	if err := os.WriteFile(path, out, 0644); err != nil {
+		return Registry{}, fmt.Errorf("failed to save model registry: %w", err)
+	}
+	registryOnce.Do(func() {})
+	registry, registryErr = reg, nil
+	return reg, nil
+}
+
+func fetch(ctx context.Context, url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// liteLLMProviders maps the providers of the LiteLLM file to ours.
+var liteLLMProviders = map[string]string{
+	"openai":     "sgpt",
+	"perplexity": "perplexity",
+	"ollama":     "ollama",
+}
+
+type liteLLMModel struct {
+	Provider           string  `json:"litellm_provider"`
+	Mode               string  `json:"mode"`
+	MaxInputTokens     int     `json:"max_input_tokens"`
+	InputCostPerToken  float64 `json:"input_cost_per_token"`
+	OutputCostPerToken float64 `json:"output_cost_per_token"`
+}
+
+// parseLiteLLM converts the chat models of known providers in a LiteLLM
+// model file.
+func parseLiteLLM(data []byte) ([]Model, error) {
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	var models []Model
+	for key, raw := range entries {
+		var entry liteLLMModel
+		// Entries that do not describe a model, like sample_spec, are skipped
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			continue
+		}
+		provider, ok := liteLLMProviders[entry.Provider]
+		if !ok || entry.Mode != "chat" || entry.MaxInputTokens == 0 {
+			continue
+		}
+		models = append(models, Model{
+			Provider:      provider,
+			Name:          strings.TrimPrefix(key, entry.Provider+"/"),
+			ContextWindow: entry.MaxInputTokens,
+			InputPrice:    entry.InputCostPerToken * 1e6,
+			OutputPrice:   entry.OutputCostPerToken * 1e6,
+		})
+	}
+	sort.Slice(models, func(i, j int) bool {
+		if models[i].Provider != models[j].Provider {
+			return models[i].Provider < models[j].Provider
+		}
+		return models[i].Name < models[j].Name
+	})
+	return models, nil
+}
+
+func modelsPath() (string, error) {
+	shareDir, err := config.GetShareDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(shareDir, modelsFile), nil
+}
@@ -0,0 +1,76 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"asc/internal/config"
+	"asc/internal/ollama"
+)
+
+// ollamaServer talks to a local Ollama server over HTTP.
+type ollamaServer struct{}
+
+func (ollamaServer) Stream(ctx context.Context, call Call) (*Stream, error) {
+	if call.Model == "" {
+		return nil, fmt.Errorf("ollama needs a model, pass --model (e.g. --model llama3)")
+	}
+	host := ollama.Host()
+	tokens := make(chan string)
+	var result *ollama.Result
+	var err error
+	go func() {
+		defer close(tokens)
+		result, err = ollama.Generate(ctx, host, call.Model, call.Prompt, call.Images, config.Current().Ollama.KeepAlive, tokenWriter{ctx, tokens}, call.Trace)
+	}()
+
+	command := []string{"ollama", host, "--model", call.Model}
+	if len(call.Images) > 0 {
+		command = append(command, "--images", strconv.Itoa(len(call.Images)))
+	}
+	return &Stream{
+		Command: append(command, call.Prompt),
+		Tokens:  tokens,
+		Wait: func() (Result, error) {
+			for range tokens {
+			}
+			if result == nil {
+				return Result{}, err
+			}
+			return Result{
+				FinishReason:     result.DoneReason,
+				PromptTokens:     result.PromptTokens,
+				CompletionTokens: result.CompletionTokens,
+			}, err
+		},
+	}, nil
+}
+
+// Warm loads model on the server and keeps it loaded for the configured
+// keep_alive.
+func (ollamaServer) Warm(ctx context.Context, model string) error {
+	if model == "" {
+		return fmt.Errorf("ollama needs a model, pass --model (e.g. --model llama3)")
+	}
+	return ollama.Load(ctx, ollama.Host(), model, config.Current().Ollama.KeepAlive)
+}
+
+// Available always succeeds; an unreachable server is reported when
+// sending.
+func (ollamaServer) Available() error {
+	return nil
+}
+
+// tokenWriter sends what is written to it as tokens.
+type tokenWriter struct {
+	ctx    context.Context
+	tokens chan<- string
+}
+
+func (w tokenWriter) Write(p []byte) (int, error) {
+	if err := send(w.ctx, w.tokens, string(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
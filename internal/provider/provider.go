@@ -0,0 +1,109 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Call is a prompt and the options it is sent with.
+type Call struct {
+	Prompt string
+	// Model selects the model, empty for the provider default.
+	Model string
+	// Chat is the session of providers that keep the history themselves.
+	Chat string
+	// Args are extra provider-specific command line arguments.
+	Args []string
+	// Images are base64-encoded images for providers with vision support.
+	Images []string
+	// Stderr receives the provider's own diagnostics.
+	Stderr io.Writer
+	// Trace receives the raw HTTP request and response bodies of providers
+	// that talk HTTP, nil to discard them.
+	Trace io.Writer
+}
+
+// Result describes how a call finished.
+type Result struct {
+	// FinishReason is empty when the provider does not report it.
+	FinishReason string
+	// PromptTokens and CompletionTokens are 0 when not reported.
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// Stream is a running call.
+type Stream struct {
+	// Command is the command line of the call, or a description of the
+	// request for HTTP providers. The prompt is always the last element.
+	Command []string
+	// Tokens delivers the answer as it arrives and is closed at the end.
+	Tokens <-chan string
+	// Wait returns how the call finished. It may be called before Tokens
+	// is drained, in which case the rest of the answer is discarded.
+	Wait func() (Result, error)
+}
+
+// Provider is an AI backend.
+type Provider interface {
+	// Stream sends call. Cancelling ctx aborts it.
+	Stream(ctx context.Context, call Call) (*Stream, error)
+	// Available returns an error if the provider cannot be used, e.g.
+	// because its command is not installed.
+	Available() error
+}
+
+// Warmer is implemented by providers that run models locally, which take
+// a while to load before the first answer.
+type Warmer interface {
+	// Warm loads model so that the next call does not wait for it.
+	Warm(ctx context.Context, model string) error
+}
+
+// Warm loads model of the provider called name ahead of use.
+func Warm(ctx context.Context, name, model string) error {
+	p, err := Get(name)
+	if err != nil {
+		return err
+	}
+	w, ok := p.(Warmer)
+	if !ok {
+		return fmt.Errorf("provider %s does not run models locally, nothing to warm up", name)
+	}
+	return w.Warm(ctx, model)
+}
+
+// providers holds the registered backends, keyed by provider name.
+var providers = map[string]Provider{
+	"sgpt":       sgpt{},
+	"perplexity": perplexity{},
+	"ollama":     ollamaServer{},
+}
+
+// Register adds p under name with the given capabilities, replacing a
+// provider of the same name.
+func Register(name string, p Provider, caps Capabilities) {
+	providers[name] = p
+	capabilities[name] = caps
+}
+
+// Get returns the provider registered under name.
+func Get(name string) (Provider, error) {
+	p, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown provider %q (known: %s)", name, strings.Join(Names(), ", "))
+	}
+	return p, nil
+}
+
+// send delivers token unless ctx is cancelled first.
+func send(ctx context.Context, tokens chan<- string, token string) error {
+	select {
+	case tokens <- token:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,67 @@
+package provider
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"asc/internal/config"
+)
+
+// Request describes a message for choosing a route.
+type Request struct {
+	Message string
+	// Attachments is the number of attached files.
+	Attachments int
+	// Quality is the requested quality: low, normal or high. Empty means
+	// normal.
+	Quality string
+}
+
+// containsCode reports whether the request carries code: a fenced code
+// block in the message or an attached file.
+func (r Request) containsCode() bool {
+	return r.Attachments > 0 || strings.Contains(r.Message, "```")
+}
+
+// Matches reports whether route applies to req. Routes to a model whose
+// context window is known to be too small for the message never apply.
+func Matches(route config.Route, req Request) bool {
+	if m, ok := LookupModel(route.Provider, route.Model); ok && EstimateTokens(req.Message) > m.ContextWindow {
+		return false
+	}
+	length := utf8.RuneCountInString(req.Message)
+	if route.MaxChars > 0 && length > route.MaxChars {
+		return false
+	}
+	if route.MinChars > 0 && length < route.MinChars {
+		return false
+	}
+	if route.ContainsCode && !req.containsCode() {
+		return false
+	}
+	quality := req.Quality
+	if quality == "" {
+		quality = "normal"
+	}
+	if route.Quality != "" && route.Quality != quality {
+		return false
+	}
+	if route.Pattern != "" {
+		re, err := regexp.Compile(route.Pattern)
+		if err != nil || !re.MatchString(req.Message) {
+			return false
+		}
+	}
+	return true
+}
+
+// ChooseRoute returns the first of routes that matches req.
+func ChooseRoute(routes []config.Route, req Request) (config.Route, bool) {
+	for _, route := range routes {
+		if Matches(route, req) {
+			return route, true
+		}
+	}
+	return config.Route{}, false
+}
@@ -0,0 +1,95 @@
+// Package remote tells whether asc runs on a terminal reached over a slow
+// link, e.g. SSH to a far away machine, where re-rendering answers while
+// they stream makes the output choppy.
+package remote
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"asc/internal/termrestore"
+
+	"github.com/charmbracelet/log"
+	"golang.org/x/term"
+)
+
+// slowRoundTrip is the round trip to the terminal from which the link is
+// slow, and probeTimeout how long the terminal is given to answer.
+const (
+	slowRoundTrip = 150 * time.Millisecond
+	probeTimeout  = time.Second
+)
+
+var (
+	once sync.Once
+	slow bool
+)
+
+// SSH reports whether asc runs in an SSH session.
+func SSH() bool {
+	return os.Getenv("SSH_CONNECTION") != "" || os.Getenv("SSH_TTY") != ""
+}
+
+// Slow reports whether asc runs in an SSH session whose terminal takes at
+// least slowRoundTrip to answer a query. The round trip is measured once.
+func Slow(logger *log.Logger) bool {
+	once.Do(func() {
+		if !SSH() {
+			return
+		}
+		rtt, err := roundTrip()
+		if err != nil {
+			logger.Debug("Failed to measure the round trip to the terminal", "error", err)
+			return
+		}
+		slow = rtt >= slowRoundTrip
+		logger.Debug("Measured the round trip to the terminal", "rtt", rtt, "slow", slow)
+	})
+	return slow
+}
+
+// roundTrip times the answer of the terminal to a cursor position query.
+func roundTrip() (time.Duration, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer tty.Close()
+	// Fd would make the file blocking and disable the deadline
+	conn, err := tty.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var state *term.State
+	var rawErr error
+	if err := conn.Control(func(fd uintptr) { state, rawErr = term.MakeRaw(int(fd)) }); err != nil {
+		return 0, err
+	}
+	if rawErr != nil {
+		return 0, rawErr
+	}
+	restore := func() { conn.Control(func(fd uintptr) { term.Restore(int(fd), state) }) }
+	defer termrestore.OnSignal(restore)()
+	defer restore()
+
+	if err := tty.SetReadDeadline(time.Now().Add(probeTimeout)); err != nil {
+		return 0, err
+	}
+	started := time.Now()
+	if _, err := tty.WriteString("\x1b[6n"); err != nil {
+		return 0, err
+	}
+	var reply []byte
+	buf := make([]byte, 32)
+	for !bytes.ContainsRune(reply, 'R') {
+		n, err := tty.Read(buf)
+		if err != nil {
+			return 0, fmt.Errorf("no answer from the terminal: %w", err)
+		}
+		reply = append(reply, buf[:n]...)
+	}
+	return time.Since(started), nil
+}
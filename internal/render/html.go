@@ -0,0 +1,126 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+// codeStyle is the chroma style of code blocks in HTML exports.
+const codeStyle = "github"
+
+// page wraps an exported conversation. The styles are embedded so that the
+// file can be opened or mailed on its own.
+var page = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { max-width: 50rem; margin: 2rem auto; padding: 0 1rem; font: 16px/1.6 -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #1f2328; }
+h1 { font-size: 1.6rem; border-bottom: 1px solid #d0d7de; padding-bottom: .3rem; }
+h2 { font-size: 1.2rem; margin-top: 2rem; }
+a { color: #0969da; }
+code { font: .9em ui-monospace, SFMono-Regular, Menlo, Consolas, monospace; background: #f6f8fa; padding: .1em .3em; border-radius: 4px; }
+pre { padding: 1rem; overflow-x: auto; border-radius: 6px; border: 1px solid #d0d7de; }
+pre code { background: none; padding: 0; }
+blockquote { margin: 0; padding: 0 1rem; color: #59636e; border-left: 4px solid #d0d7de; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #d0d7de; padding: .3rem .7rem; }
+hr { border: 0; border-top: 1px solid #d0d7de; }
+{{.CodeCSS}}
+</style>
+</head>
+<body>
+{{.Body}}
+</body>
+</html>
+`))
+
+// HTML renders doc as a self-contained HTML page with highlighted code
+// blocks. Raw HTML in messages and answers is escaped.
+func HTML(doc Document) (string, error) {
+	style := styles.Get(codeStyle)
+	formatter := chromahtml.New(chromahtml.WithClasses(true))
+	md := goldmark.New(
+		goldmark.WithExtensions(extension.GFM),
+		goldmark.WithRendererOptions(renderer.WithNodeRenderers(
+			util.Prioritized(codeRenderer{style: style, formatter: formatter}, 200),
+		)),
+	)
+	var body bytes.Buffer
+	if err := md.Convert([]byte(Markdown(doc)), &body); err != nil {
+		return "", fmt.Errorf("failed to convert markdown: %w", err)
+	}
+	var css bytes.Buffer
+	if err := formatter.WriteCSS(&css, style); err != nil {
+		return "", fmt.Errorf("failed to write code styles: %w", err)
+	}
+
+	title := "Conversation " + doc.ID
+	if doc.Title != "" {
+		title += ": " + doc.Title
+	}
+	var out strings.Builder
+	err := page.Execute(&out, struct {
+		Title   string
+		CodeCSS template.CSS
+		Body    template.HTML
+	}{title, template.CSS(css.String()), template.HTML(body.String())})
+	if err != nil {
+		return "", fmt.Errorf("failed to render page: %w", err)
+	}
+	return out.String(), nil
+}
+
+// codeRenderer highlights fenced code blocks with chroma, guessing the
+// language when the fence does not name one.
+type codeRenderer struct {
+	style     *chroma.Style
+	formatter *chromahtml.Formatter
+}
+
+func (r codeRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindFencedCodeBlock, r.renderFencedCodeBlock)
+}
+
+func (r codeRenderer) renderFencedCodeBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*ast.FencedCodeBlock)
+	var code strings.Builder
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		code.Write(segment.Value(source))
+	}
+
+	lexer := lexers.Get(string(n.Language(source)))
+	if lexer == nil {
+		lexer = lexers.Analyse(code.String())
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, code.String())
+	if err != nil {
+		return ast.WalkStop, fmt.Errorf("failed to highlight code: %w", err)
+	}
+	if err := r.formatter.Format(w, r.style, iterator); err != nil {
+		return ast.WalkStop, fmt.Errorf("failed to highlight code: %w", err)
+	}
+	return ast.WalkSkipChildren, nil
+}
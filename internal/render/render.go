@@ -0,0 +1,252 @@
+// Package render composes the text asc sends to providers and the
+// markdown it shows and exports. It works on plain values so that every
+// output path formats conversations the same way.
+package render
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Kinds of exchanges that are not a message of the user.
+const (
+	KindCritique   = "critique"
+	KindRevision   = "revision"
+	KindToolResult = "tool-result"
+	// KindOmitted stands for exchanges left out of a thread to fit the
+	// context window of the model; its message says how many.
+	KindOmitted = "omitted"
+)
+
+// Exchange is one turn of a conversation.
+type Exchange struct {
+	// Kind is empty for messages of the user.
+	Kind     string
+	Message  string
+	Response string
+	// Source is the ID of the conversation the exchange was merged from.
+	Source string
+}
+
+// Source is an input that was injected into the prompt.
+type Source struct {
+	Kind string
+	Ref  string
+}
+
+// File is a file attached to a conversation.
+type File struct {
+	Path string
+	Size int64
+}
+
+// Document is a conversation as rendered in the terminal, the pager and exports.
+type Document struct {
+	ID          string
+	Title       string
+	Metadata    map[string]string
+	Tags        []string
+	System      string
+	Context     string
+	Attachments []File
+	Exchanges   []Exchange
+	Sources     []Source
+}
+
+// Markdown renders doc as a markdown document.
+func Markdown(doc Document) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Conversation %s", doc.ID)
+	if doc.Title != "" {
+		fmt.Fprintf(&b, ": %s", doc.Title)
+	}
+	if len(doc.Tags) > 0 {
+		fmt.Fprintf(&b, "\n\nTags: `%s`", strings.Join(doc.Tags, "`, `"))
+	}
+	if len(doc.Metadata) > 0 {
+		keys := make([]string, 0, len(doc.Metadata))
+		for key := range doc.Metadata {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		b.WriteString("\n\n## Metadata\n")
+		for _, key := range keys {
+			fmt.Fprintf(&b, "\n- %s: %s", key, doc.Metadata[key])
+		}
+	}
+	if doc.System != "" {
+		fmt.Fprintf(&b, "\n\n## System\n%s", doc.System)
+	}
+	if doc.Context != "" {
+		fmt.Fprintf(&b, "\n\n## Context\n%s", doc.Context)
+	}
+	if len(doc.Attachments) > 0 {
+		b.WriteString("\n\n## Attachments\n")
+		for _, file := range doc.Attachments {
+			fmt.Fprintf(&b, "\n- `%s` (%d bytes)", file.Path, file.Size)
+		}
+	}
+	for _, ex := range doc.Exchanges {
+		switch ex.Kind {
+		case KindCritique:
+			fmt.Fprintf(&b, "\n\n## Verification\n%s", ex.Response)
+			continue
+		case KindRevision:
+			fmt.Fprintf(&b, "\n\n## AI (revised)\n%s", ex.Response)
+			continue
+		case KindToolResult:
+			fmt.Fprintf(&b, "\n\n## Command output\n`$ %s`\n\n%s", ex.Message, ex.Response)
+			continue
+		}
+		if ex.Source != "" {
+			fmt.Fprintf(&b, "\n\n## User (from %s)\n%s", ex.Source, ex.Message)
+		} else {
+			fmt.Fprintf(&b, "\n\n## User\n%s", ex.Message)
+		}
+		fmt.Fprintf(&b, "\n\n## AI\n%s", ex.Response)
+	}
+	if footer := Sources(doc.Sources); footer != "" {
+		fmt.Fprintf(&b, "\n\n%s", footer)
+	}
+	return b.String()
+}
+
+// Plain renders doc as linear plain text for screen readers and braille
+// displays: no markup, and every section opens with a sentence that says
+// what follows.
+func Plain(doc Document) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Conversation %s", doc.ID)
+	if doc.Title != "" {
+		fmt.Fprintf(&b, ": %s", doc.Title)
+	}
+	b.WriteString(".\n")
+	if len(doc.Tags) > 0 {
+		fmt.Fprintf(&b, "Tags: %s.\n", strings.Join(doc.Tags, ", "))
+	}
+	if len(doc.Metadata) > 0 {
+		keys := make([]string, 0, len(doc.Metadata))
+		for key := range doc.Metadata {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		b.WriteString("\nMetadata:\n")
+		for _, key := range keys {
+			fmt.Fprintf(&b, "%s: %s\n", key, doc.Metadata[key])
+		}
+	}
+	if doc.System != "" {
+		fmt.Fprintf(&b, "\nSystem prompt:\n%s\n", doc.System)
+	}
+	if doc.Context != "" {
+		fmt.Fprintf(&b, "\nContext:\n%s\n", doc.Context)
+	}
+	if len(doc.Attachments) > 0 {
+		fmt.Fprintf(&b, "\n%d attached files:\n", len(doc.Attachments))
+		for _, file := range doc.Attachments {
+			fmt.Fprintf(&b, "%s, %d bytes\n", file.Path, file.Size)
+		}
+	}
+	n := 0
+	for _, ex := range doc.Exchanges {
+		switch ex.Kind {
+		case KindCritique:
+			fmt.Fprintf(&b, "\nVerification of answer %d:\n%s\n", n, ex.Response)
+			continue
+		case KindRevision:
+			fmt.Fprintf(&b, "\nRevised answer %d:\n%s\n", n, ex.Response)
+			continue
+		case KindToolResult:
+			fmt.Fprintf(&b, "\nOutput of the command %s:\n%s\n", ex.Message, ex.Response)
+			continue
+		}
+		n++
+		if ex.Source != "" {
+			fmt.Fprintf(&b, "\nMessage %d, from conversation %s:\n%s\n", n, ex.Source, ex.Message)
+		} else {
+			fmt.Fprintf(&b, "\nMessage %d:\n%s\n", n, ex.Message)
+		}
+		fmt.Fprintf(&b, "\nAnswer %d:\n%s\n", n, ex.Response)
+	}
+	if len(doc.Sources) > 0 {
+		b.WriteString("\nSources included in the prompt:\n")
+		for _, src := range doc.Sources {
+			fmt.Fprintf(&b, "%s: %s\n", src.Kind, src.Ref)
+		}
+	}
+	b.WriteString("\nEnd of conversation.\n")
+	return b.String()
+}
+
+// Sources renders the footer listing what was injected into the prompt,
+// or "" if nothing was.
+func Sources(sources []Source) string {
+	if len(sources) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("---\n\n**Sources included in the prompt**\n")
+	for _, src := range sources {
+		fmt.Fprintf(&b, "\n- %s: `%s`", src.Kind, src.Ref)
+	}
+	return b.String()
+}
+
+// Prompt combines the system prompt, context and question into the text
+// sent to a provider that supports context.
+func Prompt(question, context, system string) string {
+	if context == "" && system == "" {
+		return question
+	}
+	var b strings.Builder
+	if system != "" {
+		fmt.Fprintf(&b, "# System\n%s\n\n", system)
+	}
+	if context != "" {
+		fmt.Fprintf(&b, "# Context\n%s\n\n", context)
+	}
+	fmt.Fprintf(&b, "# Question\n%s", question)
+	return b.String()
+}
+
+// Thread prefixes message with the earlier exchanges of a conversation.
+func Thread(history []Exchange, message string) string {
+	if len(history) == 0 {
+		return message
+	}
+	var b strings.Builder
+	b.WriteString("Previous conversation:\n")
+	for _, ex := range history {
+		switch ex.Kind {
+		case KindToolResult:
+			fmt.Fprintf(&b, "Command run: %s\n%s\n", ex.Message, ex.Response)
+			continue
+		case KindOmitted:
+			fmt.Fprintf(&b, "[%s]\n", ex.Message)
+			continue
+		case KindCritique:
+			// The revision, if any, already follows the review
+			continue
+		case KindRevision:
+			fmt.Fprintf(&b, "AI (revised): %s\n", ex.Response)
+			continue
+		}
+		fmt.Fprintf(&b, "User: %s\nAI: %s\n", ex.Message, ex.Response)
+	}
+	fmt.Fprintf(&b, "\n# Follow-up question\n%s", message)
+	return b.String()
+}
+
+// Attachment renders the file at path with content as a fenced block to
+// append to a message. The fence is longer than any fence in content.
+func Attachment(path, content string) string {
+	fence := "```"
+	for strings.Contains(content, fence) {
+		fence += "`"
+	}
+	lang := strings.TrimPrefix(filepath.Ext(path), ".")
+	return fmt.Sprintf("\n\n# Attachment: %s\n%s%s\n%s\n%s",
+		filepath.Base(path), fence, lang, strings.TrimRight(content, "\n"), fence)
+}
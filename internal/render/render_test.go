@@ -0,0 +1,100 @@
+package render
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// golden compares got with testdata/name.golden, or rewrites the file
+// with -update.
+func golden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test with -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs from %s:\n--- got\n%s\n--- want\n%s", name, path, got, want)
+	}
+}
+
+// document is a conversation using every part of a Document.
+var document = Document{
+	ID:       "20250131120000",
+	Title:    "Sorting in Go",
+	Metadata: map[string]string{"ticket": "ASC-42", "project": "asc"},
+	Tags:     []string{"go", "sort"},
+	System:   "Answer briefly.",
+	Context:  "The code base uses Go 1.24.",
+	Attachments: []File{
+		{Path: "/home/user/src/main.go", Size: 1234},
+	},
+	Exchanges: []Exchange{
+		{Message: "How do I sort a slice?", Response: "Use `slices.Sort`."},
+		{Kind: KindCritique, Response: "The answer is correct."},
+		{Kind: KindRevision, Response: "Use `slices.Sort`, or `sort.Slice` for a custom order."},
+		{Kind: KindToolResult, Message: "go version", Response: "go version go1.24.2 linux/amd64"},
+		{Message: "And in reverse?", Response: "Use `slices.SortFunc` with a reversed comparison.", Source: "20250130090000"},
+	},
+	Sources: []Source{
+		{Kind: "file", Ref: "main.go"},
+		{Kind: "url", Ref: "https://pkg.go.dev/slices"},
+	},
+}
+
+func TestMarkdown(t *testing.T) {
+	golden(t, "markdown", Markdown(document))
+	golden(t, "markdown_minimal", Markdown(Document{
+		ID:        "20250131120000",
+		Exchanges: []Exchange{{Message: "Hello", Response: "Hi."}},
+	}))
+}
+
+func TestPlain(t *testing.T) {
+	golden(t, "plain", Plain(document))
+}
+
+func TestSources(t *testing.T) {
+	golden(t, "sources", Sources(document.Sources))
+	if got := Sources(nil); got != "" {
+		t.Errorf("Sources(nil) = %q, want empty", got)
+	}
+}
+
+func TestPrompt(t *testing.T) {
+	golden(t, "prompt", Prompt("How do I sort a slice?", document.Context, document.System))
+	if got := Prompt("Hello", "", ""); got != "Hello" {
+		t.Errorf("Prompt without context = %q, want the question", got)
+	}
+}
+
+func TestThread(t *testing.T) {
+	history := []Exchange{
+		{Kind: KindOmitted, Message: "2 earlier exchanges omitted"},
+		{Message: "How do I sort a slice?", Response: "Use `slices.Sort`."},
+		{Kind: KindCritique, Message: "Review the answer for errors.", Response: "The answer misses custom orders."},
+		{Kind: KindRevision, Message: "Revise the answer according to the review.", Response: "Use `slices.Sort`, or `slices.SortFunc` for a custom order."},
+		{Kind: KindToolResult, Message: "go version", Response: "go version go1.24.2 linux/amd64"},
+	}
+	golden(t, "thread", Thread(history, "And in reverse?"))
+	if got := Thread(nil, "Hello"); got != "Hello" {
+		t.Errorf("Thread without history = %q, want the message", got)
+	}
+}
+
+func TestAttachment(t *testing.T) {
+	golden(t, "attachment", Attachment("/home/user/src/main.go", "package main\n\nfunc main() {}\n"))
+	// The fence must be longer than any in the content
+	golden(t, "attachment_fenced", Attachment("README.md", "# Usage\n\n```sh\nasc new\n```\n"))
+}
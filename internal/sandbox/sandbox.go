@@ -0,0 +1,424 @@
+// Package sandbox enforces the [sandbox] policy of the config on the shell
+// commands asc runs for the AI: the programs a command runs must be
+// allowed, and it can be run with paths made read-only and without
+// network access.
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"asc/internal/config"
+)
+
+// builtins are shell builtins that cannot run other programs, so they
+// need not be allowed.
+var builtins = []string{":", "[", "cd", "echo", "exit", "export", "false", "local", "printf", "pwd", "read", "return", "set", "shift", "test", "true", "unset", "wait"}
+
+// keywords are shell reserved words after which a command follows.
+var keywords = []string{"!", "{", "}", "do", "done", "elif", "else", "fi", "if", "then", "time", "until", "while"}
+
+var assignment = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+
+// Check returns an error if command runs a program that policy does not
+// allow, or if the programs it runs cannot be told, e.g. when one is
+// named by a variable.
+func Check(policy config.Sandbox, command string) error {
+	if len(policy.Allow) == 0 {
+		return nil
+	}
+	programs, err := Programs(command)
+	if err != nil {
+		return err
+	}
+	for _, program := range programs {
+		if !allowed(policy.Allow, program) {
+			return fmt.Errorf("%s is not an allowed program (allowed: %s)", program, strings.Join(policy.Allow, ", "))
+		}
+	}
+	return nil
+}
+
+// allowed reports whether program is in allow, by name, or by path for
+// absolute entries.
+func allowed(allow []string, program string) bool {
+	if slices.Contains(builtins, program) {
+		return true
+	}
+	for _, entry := range allow {
+		if entry == program || !filepath.IsAbs(entry) && !strings.Contains(program, "/") && entry == filepath.Base(program) {
+			return true
+		}
+	}
+	return false
+}
+
+// Programs returns the programs command runs with sh, including those of
+// command substitutions, in order.
+func Programs(command string) ([]string, error) {
+	tokens, nested, err := tokenize(command)
+	if err != nil {
+		return nil, err
+	}
+	var programs []string
+	expectCommand, redirectTarget, inFor := true, false, false
+	for _, t := range tokens {
+		if t.operator {
+			if strings.ContainsAny(t.text, "<>") {
+				redirectTarget = true
+			} else {
+				expectCommand = true
+			}
+			continue
+		}
+		switch {
+		case redirectTarget:
+			redirectTarget = false
+		case inFor:
+			// The loop variable and words come before do
+			if t.text == "do" {
+				inFor = false
+				expectCommand = true
+			}
+		case !expectCommand:
+		case t.text == "for" || t.text == "select":
+			inFor = true
+		case t.text == "case":
+			return nil, fmt.Errorf("case statements are not supported in the sandbox")
+		case slices.Contains(keywords, t.text), assignment.MatchString(t.text):
+		case t.dynamic:
+			return nil, fmt.Errorf("cannot tell which program %s runs", t.text)
+		default:
+			programs = append(programs, t.text)
+			expectCommand = false
+		}
+	}
+	for _, inner := range nested {
+		innerPrograms, err := Programs(inner)
+		if err != nil {
+			return nil, err
+		}
+		programs = append(programs, innerPrograms...)
+	}
+	return programs, nil
+}
+
+// token is a word, without its quotes, or an operator of a shell command.
+type token struct {
+	text     string
+	operator bool
+	// dynamic words hold expansions, so their value is only known when
+	// the command runs.
+	dynamic bool
+}
+
+// heredoc is a pending here-document: the word ending it, and whether
+// the word was quoted, which leaves the text unexpanded.
+type heredoc struct {
+	delimiter string
+	quoted    bool
+}
+
+// tokenize splits command into words and operators, and returns the
+// commands of its substitutions separately, including those in the text
+// of here-documents with an unquoted delimiter.
+func tokenize(command string) ([]token, []string, error) {
+	var tokens []token
+	var nested []string
+	var word strings.Builder
+	inWord, dynamic, quoted := false, false, false
+	var heredocs []heredoc
+	wantDelimiter := false
+	flush := func() {
+		if !inWord {
+			return
+		}
+		if wantDelimiter {
+			heredocs = append(heredocs, heredoc{delimiter: word.String(), quoted: quoted})
+			wantDelimiter = false
+		}
+		tokens = append(tokens, token{text: word.String(), dynamic: dynamic})
+		word.Reset()
+		inWord, dynamic, quoted = false, false, false
+	}
+	// substitution reads the command between the parenthesis at i and
+	// its match, and returns the index after it.
+	substitution := func(i int) (int, error) {
+		end, err := matchParen(command, i)
+		if err != nil {
+			return 0, err
+		}
+		nested = append(nested, command[i+1:end])
+		inWord, dynamic = true, true
+		return end + 1, nil
+	}
+
+	for i := 0; i < len(command); {
+		c := command[i]
+		switch {
+		case c == '\n':
+			flush()
+			tokens = append(tokens, token{text: ";", operator: true})
+			i++
+			for _, h := range heredocs {
+				end, substitutions, err := readHeredoc(command, i, h)
+				if err != nil {
+					return nil, nil, err
+				}
+				nested = append(nested, substitutions...)
+				i = end
+			}
+			heredocs = nil
+		case c == ' ' || c == '\t':
+			flush()
+			i++
+		case c == '#' && !inWord:
+			for i < len(command) && command[i] != '\n' {
+				i++
+			}
+		case c == '\\':
+			if i+1 < len(command) && command[i+1] != '\n' {
+				word.WriteByte(command[i+1])
+				inWord = true
+			}
+			quoted = true
+			i += 2
+		case c == '\'':
+			end := strings.IndexByte(command[i+1:], '\'')
+			if end < 0 {
+				return nil, nil, fmt.Errorf("unterminated quote")
+			}
+			word.WriteString(command[i+1 : i+1+end])
+			inWord, quoted = true, true
+			i += end + 2
+		case c == '"':
+			i++
+			quoted = true
+			for i < len(command) && command[i] != '"' {
+				switch {
+				case command[i] == '\\' && i+1 < len(command):
+					word.WriteByte(command[i+1])
+					i += 2
+				case strings.HasPrefix(command[i:], "$("):
+					var err error
+					if i, err = substitution(i + 1); err != nil {
+						return nil, nil, err
+					}
+				case command[i] == '`':
+					return nil, nil, fmt.Errorf("backquote substitutions are not supported in the sandbox, use $(...)")
+				default:
+					if command[i] == '$' {
+						dynamic = true
+					}
+					word.WriteByte(command[i])
+					i++
+				}
+			}
+			if i >= len(command) {
+				return nil, nil, fmt.Errorf("unterminated quote")
+			}
+			inWord = true
+			i++
+		case c == '`':
+			return nil, nil, fmt.Errorf("backquote substitutions are not supported in the sandbox, use $(...)")
+		case strings.HasPrefix(command[i:], "$(("):
+			// Arithmetic runs no program
+			end, err := matchParen(command, i+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			inWord, dynamic = true, true
+			i = end + 1
+		case strings.HasPrefix(command[i:], "$("):
+			var err error
+			if i, err = substitution(i + 1); err != nil {
+				return nil, nil, err
+			}
+		case c == '$':
+			word.WriteByte(c)
+			inWord, dynamic = true, true
+			i++
+		case (c == '<' || c == '>') && i+1 < len(command) && command[i+1] == '(' && !inWord:
+			var err error
+			if i, err = substitution(i + 1); err != nil {
+				return nil, nil, err
+			}
+		case strings.IndexByte(";&|()<>", c) >= 0:
+			// A number right before a redirection is a file descriptor
+			if (c == '<' || c == '>') && inWord && !dynamic {
+				if _, err := strconv.Atoi(word.String()); err == nil {
+					word.Reset()
+					inWord = false
+				}
+			}
+			flush()
+			op := operator(command[i:])
+			if op == "<<" || op == "<<-" {
+				wantDelimiter = true
+			}
+			tokens = append(tokens, token{text: op, operator: true})
+			i += len(op)
+		default:
+			word.WriteByte(c)
+			inWord = true
+			i++
+		}
+	}
+	flush()
+	return tokens, nested, nil
+}
+
+// operators lists the shell operators, longest first.
+var operators = []string{"<<<", "<<-", "&&", "||", ";;", "|&", "<<", ">>", ">&", "<&", "&>", ">|", "<>", ";", "&", "|", "(", ")", "<", ">"}
+
+// operator returns the operator s starts with.
+func operator(s string) string {
+	for _, op := range operators {
+		if strings.HasPrefix(s, op) {
+			return op
+		}
+	}
+	return s[:1]
+}
+
+// matchParen returns the index of the parenthesis closing the one at i of
+// s, skipping quoted text.
+func matchParen(s string, i int) (int, error) {
+	depth := 0
+	for ; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '\'', '"':
+			end := strings.IndexByte(s[i+1:], s[i])
+			if end < 0 {
+				return 0, fmt.Errorf("unterminated quote")
+			}
+			i += end + 1
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unterminated substitution")
+}
+
+// readHeredoc returns the index after the here-document h that starts at
+// i, and the commands of the substitutions in its text. The shell expands
+// the text unless the delimiter was quoted.
+func readHeredoc(s string, i int, h heredoc) (int, []string, error) {
+	var nested []string
+	for i < len(s) {
+		end := strings.IndexByte(s[i:], '\n')
+		if end < 0 {
+			end = len(s) - i
+		}
+		if strings.TrimLeft(s[i:i+end], "\t") == h.delimiter {
+			return min(i+end+1, len(s)), nested, nil
+		}
+		if h.quoted {
+			i += end + 1
+			continue
+		}
+		// A substitution may span lines, so the line ends after it
+		j := i
+		for ; j < len(s) && s[j] != '\n'; j++ {
+			switch {
+			case s[j] == '\\':
+				j++
+			case s[j] == '`':
+				return 0, nil, fmt.Errorf("backquote substitutions are not supported in the sandbox, use $(...)")
+			case strings.HasPrefix(s[j:], "$(("):
+				// Arithmetic runs no program
+				closing, err := matchParen(s, j+1)
+				if err != nil {
+					return 0, nil, err
+				}
+				j = closing
+			case strings.HasPrefix(s[j:], "$("):
+				closing, err := matchParen(s, j+1)
+				if err != nil {
+					return 0, nil, err
+				}
+				nested = append(nested, s[j+2:closing])
+				j = closing
+			}
+		}
+		i = j + 1
+	}
+	return len(s), nested, nil
+}
+
+// Command returns the command that runs command with sh under policy.
+// Read-only paths and the loss of network are set up with unshare(1) of
+// util-linux, in user and mount namespaces, so they need Linux.
+func Command(policy config.Sandbox, command string) (*exec.Cmd, error) {
+	if len(policy.ReadOnly) == 0 && !policy.NoNetwork {
+		return exec.Command("sh", "-c", command), nil
+	}
+	if runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("read_only and no_network of the sandbox are only supported on Linux")
+	}
+	unshare, err := exec.LookPath("unshare")
+	if err != nil {
+		return nil, fmt.Errorf("read_only and no_network of the sandbox need unshare of util-linux: %w", err)
+	}
+	var paths []string
+	for _, path := range policy.ReadOnly {
+		if rest, ok := strings.CutPrefix(path, "~/"); ok {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get home directory: %w", err)
+			}
+			path = filepath.Join(home, rest)
+		}
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid read-only path: %w", err)
+		}
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("cannot make %s read-only: %w", path, err)
+		}
+		paths = append(paths, path)
+	}
+
+	// Mounting needs to be root of the namespaces, then the command runs
+	// as the user in a nested user namespace
+	args := []string{"--user", "--map-root-user", "--mount"}
+	if policy.NoNetwork {
+		args = append(args, "--net")
+	}
+	script := `command=$1; shift
+for path; do
+	mount --bind "$path" "$path" && mount -o remount,bind,ro "$path" "$path" || exit 126
+done
+exec unshare --user --map-user=` + strconv.Itoa(os.Getuid()) + ` --map-group=` + strconv.Itoa(os.Getgid()) + ` -- sh -c "$command"`
+	args = append(args, "--", "sh", "-c", script, "sh", command)
+	return exec.Command(unshare, append(args, paths...)...), nil
+}
+
+// Describe summarizes policy, e.g. for the confirmation of a command.
+func Describe(policy config.Sandbox) string {
+	var parts []string
+	if len(policy.Allow) > 0 {
+		parts = append(parts, "only "+strings.Join(policy.Allow, ", "))
+	}
+	if len(policy.ReadOnly) > 0 {
+		parts = append(parts, "read-only "+strings.Join(policy.ReadOnly, ", "))
+	}
+	if policy.NoNetwork {
+		parts = append(parts, "no network")
+	}
+	return strings.Join(parts, "; ")
+}
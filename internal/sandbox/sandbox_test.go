@@ -0,0 +1,50 @@
+package sandbox
+
+import (
+	"slices"
+	"testing"
+
+	"asc/internal/config"
+)
+
+func TestProgramsHeredoc(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{"cat <<EOF\nhello\nEOF\nls\n", []string{"cat", "ls"}},
+		{"cat <<EOF\n$(rm -rf /tmp/x)\nEOF\n", []string{"cat", "rm"}},
+		{"cat <<EOF\nbefore ${HOME:-$(whoami)} after\nEOF\n", []string{"cat", "whoami"}},
+		{"cat <<EOF\n$(echo a |\ngrep a)\nEOF\n", []string{"cat", "echo", "grep"}},
+		{"cat <<-EOF\n\t$(date)\n\tEOF\n", []string{"cat", "date"}},
+		{"cat <<EOF\n\\$(rm x) $((1 + 2))\nEOF\n", []string{"cat"}},
+		{"cat <<'EOF'\n$(rm -rf /tmp/x)\nEOF\n", []string{"cat"}},
+		{"cat <<\"EOF\"\n$(rm -rf /tmp/x)\nEOF\n", []string{"cat"}},
+		{"cat <<\\EOF\n$(rm -rf /tmp/x)\nEOF\n", []string{"cat"}},
+	}
+	for _, test := range tests {
+		got, err := Programs(test.command)
+		if err != nil {
+			t.Errorf("Programs(%q) failed: %v", test.command, err)
+			continue
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("Programs(%q) = %q, want %q", test.command, got, test.want)
+		}
+	}
+}
+
+func TestCheckHeredoc(t *testing.T) {
+	policy := config.Sandbox{Allow: []string{"cat", "ls"}}
+	for _, command := range []string{
+		"cat <<EOF\n$(rm -rf /tmp/x)\nEOF\n",
+		"cat <<EOF\n`rm -rf /tmp/x`\nEOF\n",
+	} {
+		if err := Check(policy, command); err == nil {
+			t.Errorf("Check(%q) allowed the command", command)
+		}
+	}
+	if err := Check(policy, "cat <<'EOF'\n$(rm -rf /tmp/x)\nEOF\n"); err != nil {
+		t.Errorf("Check of a quoted here-document failed: %v", err)
+	}
+}
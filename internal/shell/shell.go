@@ -0,0 +1,70 @@
+package shell
+
+import (
+	"fmt"
+	"sort"
+)
+
+// suggestPrompt is prepended to the command line sent by the widgets.
+const suggestPrompt = "Reply with a single shell command and nothing else, no explanation. Task: "
+
+// zshScript defines the _asc_suggest ZLE widget, bound to Ctrl-X a. It
+// replaces the command line buffer with the suggested command.
+const zshScript = `# asc shell integration for zsh
+# Add to ~/.zshrc: eval "$(asc init zsh)"
+_asc_suggest() {
+  [[ -z $BUFFER ]] && return
+  local suggestion
+  zle -I
+  print -n "\e[2m(asking asc...)\e[0m"
+  suggestion=$(asc prompt --raw "` + suggestPrompt + `$BUFFER" </dev/null 2>/dev/null | sed -e '/^` + "```" + `/d' -e '/^[[:space:]]*$/d')
+  print -n "\r\e[K"
+  if [[ -n $suggestion ]]; then
+    BUFFER=$suggestion
+    CURSOR=${#BUFFER}
+  fi
+  zle reset-prompt
+}
+zle -N _asc_suggest
+bindkey '^Xa' _asc_suggest
+`
+
+// bashScript binds _asc_suggest to Ctrl-X a with bind -x. It replaces
+// READLINE_LINE with the suggested command.
+const bashScript = `# asc shell integration for bash
+# Add to ~/.bashrc: eval "$(asc init bash)"
+_asc_suggest() {
+  [[ -z $READLINE_LINE ]] && return
+  local suggestion
+  suggestion=$(asc prompt --raw "` + suggestPrompt + `$READLINE_LINE" </dev/null 2>/dev/null | sed -e '/^` + "```" + `/d' -e '/^[[:space:]]*$/d')
+  if [[ -n $suggestion ]]; then
+    READLINE_LINE=$suggestion
+    READLINE_POINT=${#READLINE_LINE}
+  fi
+}
+bind -x '"\C-xa": _asc_suggest'
+`
+
+var scripts = map[string]string{
+	"zsh":  zshScript,
+	"bash": bashScript,
+}
+
+// Script returns the integration script for the named shell.
+func Script(name string) (string, error) {
+	script, ok := scripts[name]
+	if !ok {
+		return "", fmt.Errorf("unsupported shell %q (supported: %v)", name, Shells())
+	}
+	return script, nil
+}
+
+// Shells lists the shells that have an integration script.
+func Shells() []string {
+	var names []string
+	for name := range scripts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
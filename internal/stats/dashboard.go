@@ -0,0 +1,217 @@
+package stats
+
+import (
+	"fmt"
+	"strings"
+
+	"asc/internal/config"
+	"asc/internal/conversation"
+	"asc/internal/crash"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Metrics the dashboard charts.
+const (
+	MetricCost          = "cost"
+	MetricTokens        = "tokens"
+	MetricConversations = "conversations"
+)
+
+// Metrics lists the metrics in the order the dashboard cycles through them.
+var Metrics = []string{MetricCost, MetricTokens, MetricConversations}
+
+// Dashboard holds the usage of conversations charted by one dimension and
+// metric.
+type Dashboard struct {
+	conversations []conversation.Conversation
+	totals        Totals
+	dimension     int
+	metric        int
+	width         int
+}
+
+// NewDashboard returns the dashboard of conversations, starting with
+// dimension and metric.
+func NewDashboard(conversations []conversation.Conversation, dimension, metric string, width int) (Dashboard, error) {
+	d := Dashboard{conversations: conversations, totals: UsageTotals(conversations), width: width}
+	var ok bool
+	if d.dimension, ok = indexOf(Dimensions, dimension); !ok {
+		return d, fmt.Errorf("invalid dimension %q (use %s)", dimension, strings.Join(Dimensions, ", "))
+	}
+	if d.metric, ok = indexOf(Metrics, metric); !ok {
+		return d, fmt.Errorf("invalid metric %q (use %s)", metric, strings.Join(Metrics, ", "))
+	}
+	return d, nil
+}
+
+func indexOf(values []string, value string) (int, bool) {
+	for i, v := range values {
+		if v == value {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Run shows the dashboard until it is quit. Tab, the arrow keys and the
+// first letters switch the dimension, m the metric.
+func (d Dashboard) Run() error {
+	_, err := crash.NewProgram(d, tea.WithAltScreen()).Run()
+	return err
+}
+
+func (d Dashboard) Init() tea.Cmd {
+	return nil
+}
+
+func (d Dashboard) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		d.width = msg.Width
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "esc", "ctrl+c":
+			return d, tea.Quit
+		case "tab", "right", "l":
+			d.dimension = (d.dimension + 1) % len(Dimensions)
+		case "shift+tab", "left", "h":
+			d.dimension = (d.dimension + len(Dimensions) - 1) % len(Dimensions)
+		case "m":
+			d.metric = (d.metric + 1) % len(Metrics)
+		case "d":
+			d.dimension, _ = indexOf(Dimensions, DimensionDay)
+		case "w":
+			d.dimension, _ = indexOf(Dimensions, DimensionWeek)
+		case "o":
+			d.dimension, _ = indexOf(Dimensions, DimensionModel)
+		case "p":
+			d.dimension, _ = indexOf(Dimensions, DimensionProvider)
+		}
+	}
+	return d, nil
+}
+
+func (d Dashboard) View() string {
+	colors := config.Colors()
+	accent := lipgloss.NewStyle().Foreground(lipgloss.Color(colors.Accent))
+	muted := lipgloss.NewStyle().Foreground(lipgloss.Color(colors.Muted))
+	box := lipgloss.NewStyle().
+		BorderStyle(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color(colors.Border)).
+		Padding(0, 1)
+
+	var tabs []string
+	for i, dimension := range Dimensions {
+		if i == d.dimension {
+			tabs = append(tabs, accent.Bold(true).Render("["+dimension+"]"))
+		} else {
+			tabs = append(tabs, muted.Render(" "+dimension+" "))
+		}
+	}
+	header := fmt.Sprintf("%s  by %s\n%s", accent.Bold(true).Render(strings.ToUpper(Metrics[d.metric][:1])+Metrics[d.metric][1:]),
+		Dimensions[d.dimension], strings.Join(tabs, " "))
+	help := muted.Render("tab/←→: dimension  d/w/o/p: day, week, model, provider  m: metric  q: quit")
+	chartWidth := max(d.width-4, 40)
+	return lipgloss.JoinVertical(lipgloss.Left,
+		box.Render(d.summary()),
+		header,
+		"",
+		d.chart(chartWidth, accent),
+		"",
+		help,
+	)
+}
+
+// Static renders the dashboard as plain text, for output that is not a
+// terminal.
+func (d Dashboard) Static() string {
+	return d.summary() + "\n\n" + Metrics[d.metric] + " by " + Dimensions[d.dimension] + "\n" +
+		d.chart(max(d.width, 60), lipgloss.NewStyle())
+}
+
+// summary describes the totals.
+func (d Dashboard) summary() string {
+	t := d.totals
+	s := fmt.Sprintf("%d conversations  %d responses  %s tokens  %s", t.Conversations, t.Responses, formatCount(t.Tokens), formatDollars(t.Cost))
+	if t.Unpriced > 0 {
+		s += fmt.Sprintf("  (%d responses without a price)", t.Unpriced)
+	}
+	return s
+}
+
+// chart draws the buckets of the dimension as horizontal bars of the
+// metric in width columns.
+func (d Dashboard) chart(width int, bar lipgloss.Style) string {
+	buckets := Usage(d.conversations, Dimensions[d.dimension])
+	if len(buckets) == 0 {
+		return "No usage recorded"
+	}
+	metric := Metrics[d.metric]
+	labelWidth, valueWidth, top := 0, 0, 0.0
+	for _, b := range buckets {
+		labelWidth = max(labelWidth, lipgloss.Width(b.Label))
+		valueWidth = max(valueWidth, len(formatMetric(b, metric)))
+		top = max(top, metricValue(b, metric))
+	}
+	labelWidth = min(labelWidth, width/3)
+	barWidth := max(width-labelWidth-valueWidth-2, 10)
+
+	var lines []string
+	for _, b := range buckets {
+		n := 0
+		if top > 0 {
+			n = int(metricValue(b, metric) / top * float64(barWidth))
+			if n == 0 && metricValue(b, metric) > 0 {
+				n = 1
+			}
+		}
+		label := b.Label
+		if lipgloss.Width(label) > labelWidth {
+			label = label[:labelWidth-1] + "…"
+		}
+		lines = append(lines, fmt.Sprintf("%-*s %s%s %s", labelWidth, label,
+			bar.Render(strings.Repeat("█", n)), strings.Repeat(" ", barWidth-n), formatMetric(b, metric)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func metricValue(b Bucket, metric string) float64 {
+	switch metric {
+	case MetricTokens:
+		return float64(b.Tokens)
+	case MetricConversations:
+		return float64(b.Conversations)
+	}
+	return b.Cost
+}
+
+func formatMetric(b Bucket, metric string) string {
+	switch metric {
+	case MetricTokens:
+		return formatCount(b.Tokens)
+	case MetricConversations:
+		return fmt.Sprint(b.Conversations)
+	}
+	return formatDollars(b.Cost)
+}
+
+// formatDollars shows cents, and more digits for amounts below a dollar.
+func formatDollars(cost float64) string {
+	if cost > 0 && cost < 1 {
+		return fmt.Sprintf("$%.4f", cost)
+	}
+	return fmt.Sprintf("$%.2f", cost)
+}
+
+// formatCount abbreviates large counts, e.g. 12.3k.
+func formatCount(n int) string {
+	switch {
+	case n >= 1000000:
+		return fmt.Sprintf("%.1fM", float64(n)/1e6)
+	case n >= 1000:
+		return fmt.Sprintf("%.1fk", float64(n)/1e3)
+	}
+	return fmt.Sprint(n)
+}
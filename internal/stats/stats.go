@@ -0,0 +1,200 @@
+package stats
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"asc/internal/conversation"
+)
+
+// Group aggregates the responses of one provider/model combination.
+type Group struct {
+	Provider string
+	Model    string
+	Count    int
+	// Timed counts the responses that have latency measurements.
+	Timed             int
+	TotalDuration     time.Duration
+	TotalFirstToken   time.Duration
+	medianDurations   []time.Duration
+	medianFirstTokens []time.Duration
+}
+
+// AvgDuration returns the mean request duration.
+func (g Group) AvgDuration() time.Duration {
+	if g.Timed == 0 {
+		return 0
+	}
+	return g.TotalDuration / time.Duration(g.Timed)
+}
+
+// AvgFirstToken returns the mean time to first token.
+func (g Group) AvgFirstToken() time.Duration {
+	if g.Timed == 0 {
+		return 0
+	}
+	return g.TotalFirstToken / time.Duration(g.Timed)
+}
+
+// MedianFirstToken returns the median time to first token.
+func (g Group) MedianFirstToken() time.Duration {
+	return median(g.medianFirstTokens)
+}
+
+// MedianDuration returns the median request duration.
+func (g Group) MedianDuration() time.Duration {
+	return median(g.medianDurations)
+}
+
+func median(values []time.Duration) time.Duration {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration{}, values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[len(sorted)/2]
+}
+
+// ByModel groups every exchange of the conversations by provider and model.
+func ByModel(conversations []conversation.Conversation) []Group {
+	groups := map[string]*Group{}
+	for _, conv := range conversations {
+		for _, turn := range conv.Exchanges() {
+			meta := turn.Meta
+			if meta == nil {
+				meta = &conversation.ResponseMeta{Provider: "unknown"}
+			}
+			key := meta.Provider + "\x00" + meta.Model
+			g, ok := groups[key]
+			if !ok {
+				g = &Group{Provider: meta.Provider, Model: meta.Model}
+				groups[key] = g
+			}
+			g.Count++
+			if meta.DurationMS > 0 {
+				d := time.Duration(meta.DurationMS) * time.Millisecond
+				ft := time.Duration(meta.FirstTokenMS) * time.Millisecond
+				g.Timed++
+				g.TotalDuration += d
+				g.TotalFirstToken += ft
+				g.medianDurations = append(g.medianDurations, d)
+				g.medianFirstTokens = append(g.medianFirstTokens, ft)
+			}
+		}
+	}
+
+	var result []Group
+	for _, g := range groups {
+		result = append(result, *g)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Provider+result[i].Model < result[j].Provider+result[j].Model
+	})
+	return result
+}
+
+// PrintLatency writes a latency table grouped by provider and model.
+func PrintLatency(w io.Writer, groups []Group) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROVIDER\tMODEL\tRESPONSES\tAVG FIRST TOKEN\tMEDIAN FIRST TOKEN\tAVG DURATION\tMEDIAN DURATION")
+	for _, g := range groups {
+		model := g.Model
+		if model == "" {
+			model = "-"
+		}
+		if g.Timed == 0 {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t-\t-\t-\t-\n", g.Provider, model, g.Count)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\t%s\n", g.Provider, model, g.Count,
+			formatDuration(g.AvgFirstToken()), formatDuration(g.MedianFirstToken()),
+			formatDuration(g.AvgDuration()), formatDuration(g.MedianDuration()))
+	}
+	return tw.Flush()
+}
+
+func formatDuration(d time.Duration) string {
+	return d.Round(10 * time.Millisecond).String()
+}
+
+// RatingGroup counts the ratings of the answers of one provider/model
+// combination.
+type RatingGroup struct {
+	Provider string
+	Model    string
+	Up       int
+	Down     int
+}
+
+// Share returns the fraction of up ratings.
+func (g RatingGroup) Share() float64 {
+	if g.Up+g.Down == 0 {
+		return 0
+	}
+	return float64(g.Up) / float64(g.Up+g.Down)
+}
+
+// ByRating groups the rated conversations by the provider and model of the
+// rated answer, best rated first.
+func ByRating(conversations []conversation.Conversation) []RatingGroup {
+	groups := map[string]*RatingGroup{}
+	for _, conv := range conversations {
+		rating, ok := conv.Metadata[conversation.RatingKey]
+		if !ok {
+			continue
+		}
+		meta := conv.RatedMeta()
+		if meta == nil {
+			meta = &conversation.ResponseMeta{Provider: "unknown"}
+		}
+		key := meta.Provider + "\x00" + meta.Model
+		g, ok := groups[key]
+		if !ok {
+			g = &RatingGroup{Provider: meta.Provider, Model: meta.Model}
+			groups[key] = g
+		}
+		switch rating {
+		case conversation.RatingUp:
+			g.Up++
+		case conversation.RatingDown:
+			g.Down++
+		}
+	}
+
+	var result []RatingGroup
+	for _, g := range groups {
+		if g.Up+g.Down > 0 {
+			result = append(result, *g)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Share() != result[j].Share() {
+			return result[i].Share() > result[j].Share()
+		}
+		if result[i].Up+result[i].Down != result[j].Up+result[j].Down {
+			return result[i].Up+result[i].Down > result[j].Up+result[j].Down
+		}
+		return result[i].Provider+result[i].Model < result[j].Provider+result[j].Model
+	})
+	return result
+}
+
+// PrintRatings writes a table of ratings grouped by provider and model.
+func PrintRatings(w io.Writer, groups []RatingGroup) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROVIDER\tMODEL\tRATED\tUP\tDOWN\tUP SHARE")
+	for _, g := range groups {
+		model := g.Model
+		if model == "" {
+			model = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%.0f%%\n", g.Provider, model, g.Up+g.Down, g.Up, g.Down, 100*g.Share())
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,271 @@
+package stats
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"asc/internal/config"
+	"asc/internal/conversation"
+	"asc/internal/crash"
+	"asc/internal/provider"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/log"
+)
+
+// usageRefresh is how often Top reloads the conversations for the usage
+// of the day, besides when a request finishes.
+const usageRefresh = 30 * time.Second
+
+// Top is the live view of asc top: the requests in progress, the usage of
+// the day and whether the providers can be used.
+type Top struct {
+	interval time.Duration
+	logger   *log.Logger
+	snapshot Snapshot
+	// usageLoaded is when the usage of the day was last computed, and
+	// finished is set when a request finished since.
+	usageLoaded time.Time
+	finished    bool
+	width       int
+}
+
+// Snapshot is what Top shows at one time.
+type Snapshot struct {
+	Taken  time.Time
+	Jobs   []conversation.Job
+	Today  Bucket
+	Health []Health
+	// Err is set when the conversations could not be loaded.
+	Err error
+}
+
+// Health tells whether a provider can be used; Err says why not.
+type Health struct {
+	Provider string
+	Err      error
+}
+
+// snapshotMsg carries a new snapshot; usage is set when the usage of the
+// day was recomputed.
+type snapshotMsg struct {
+	snapshot Snapshot
+	usage    bool
+}
+
+type topTickMsg struct{}
+
+// NewTop returns the view, refreshed every interval.
+func NewTop(interval time.Duration, width int, logger *log.Logger) Top {
+	return Top{interval: interval, width: width, logger: logger}
+}
+
+// TakeSnapshot reads the requests in progress and checks the providers,
+// and computes the usage of the day when usage is set.
+func TakeSnapshot(usage bool, logger *log.Logger) Snapshot {
+	s := Snapshot{Taken: time.Now(), Jobs: conversation.RunningJobs(logger)}
+	for _, name := range provider.Names() {
+		p, err := provider.Get(name)
+		if err == nil {
+			err = p.Available()
+		}
+		s.Health = append(s.Health, Health{Provider: name, Err: err})
+	}
+	if usage {
+		conversations, err := conversation.LoadConversations(logger)
+		if err != nil {
+			s.Err = fmt.Errorf("failed to load conversations: %w", err)
+		}
+		s.Today = dayUsage(conversations, s.Taken)
+	}
+	return s
+}
+
+// dayUsage adds up the exchanges of conversations on the day of t.
+func dayUsage(conversations []conversation.Conversation, t time.Time) Bucket {
+	day := t.Local().Format("2006-01-02")
+	b := Bucket{Label: day}
+	for _, conv := range conversations {
+		counted := false
+		for _, turn := range conv.Exchanges() {
+			if usageLabel(turn, DimensionDay) != day {
+				continue
+			}
+			if !counted {
+				counted = true
+				b.Conversations++
+			}
+			b.Responses++
+			var cost conversation.CostSummary
+			cost.Add(turn.Meta)
+			b.Tokens += cost.TotalTokens()
+			b.Cost += cost.Cost
+		}
+	}
+	return b
+}
+
+// Run shows the view until it is quit.
+func (t Top) Run() error {
+	_, err := crash.NewProgram(t, tea.WithAltScreen()).Run()
+	return err
+}
+
+func (t Top) refresh(usage bool) tea.Cmd {
+	return func() tea.Msg {
+		return snapshotMsg{snapshot: TakeSnapshot(usage, t.logger), usage: usage}
+	}
+}
+
+func (t Top) tick() tea.Cmd {
+	return tea.Tick(t.interval, func(time.Time) tea.Msg { return topTickMsg{} })
+}
+
+func (t Top) Init() tea.Cmd {
+	return tea.Batch(t.refresh(true), t.tick())
+}
+
+func (t Top) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		t.width = msg.Width
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "esc", "ctrl+c":
+			return t, tea.Quit
+		case "r":
+			t.usageLoaded = time.Now()
+			return t, t.refresh(true)
+		}
+	case topTickMsg:
+		usage := t.finished || time.Since(t.usageLoaded) >= usageRefresh
+		if usage {
+			t.usageLoaded, t.finished = time.Now(), false
+		}
+		return t, tea.Batch(t.refresh(usage), t.tick())
+	case snapshotMsg:
+		if !msg.usage {
+			msg.snapshot.Today, msg.snapshot.Err = t.snapshot.Today, t.snapshot.Err
+		}
+		// The usage changes when a request finishes
+		if len(msg.snapshot.Jobs) < len(t.snapshot.Jobs) {
+			t.finished = true
+		}
+		t.snapshot = msg.snapshot
+	}
+	return t, nil
+}
+
+func (t Top) View() string {
+	colors := config.Colors()
+	accent := lipgloss.NewStyle().Foreground(lipgloss.Color(colors.Accent))
+	muted := lipgloss.NewStyle().Foreground(lipgloss.Color(colors.Muted))
+	box := lipgloss.NewStyle().
+		BorderStyle(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color(colors.Border)).
+		Padding(0, 1)
+	if t.snapshot.Taken.IsZero() {
+		return "Loading…"
+	}
+	s := t.snapshot
+	help := muted.Render(fmt.Sprintf("Updated %s, every %s  r: refresh  q: quit", s.Taken.Format("15:04:05"), t.interval))
+	return lipgloss.JoinVertical(lipgloss.Left,
+		box.Render(s.today()),
+		"",
+		accent.Bold(true).Render(fmt.Sprintf("Running (%d)", len(s.Jobs))),
+		s.jobs(max(t.width, 60), s.Taken),
+		"",
+		accent.Bold(true).Render("Providers"),
+		s.health(),
+		"",
+		help,
+	)
+}
+
+// String renders the snapshot as plain text, for output that is not a
+// terminal.
+func (s Snapshot) String() string {
+	return s.today() + "\n\n" +
+		fmt.Sprintf("Running (%d)\n", len(s.Jobs)) + s.jobs(100, s.Taken) + "\n\n" +
+		"Providers\n" + s.health()
+}
+
+// today describes the usage of the day.
+func (s Snapshot) today() string {
+	if s.Err != nil {
+		return fmt.Sprintf("Today: %v", s.Err)
+	}
+	b := s.Today
+	return fmt.Sprintf("Today  %d conversations  %d responses  %s tokens  %s",
+		b.Conversations, b.Responses, formatCount(b.Tokens), formatDollars(b.Cost))
+}
+
+// jobs lists the requests in progress in width columns, with how long
+// they have been running and how much of the answer has arrived at now.
+func (s Snapshot) jobs(width int, now time.Time) string {
+	if len(s.Jobs) == 0 {
+		return "No requests in progress"
+	}
+	lines := []string{fmt.Sprintf("%-8s %-8s %-28s %-18s %s", "PID", "TIME", "MODEL", "PROGRESS", "MESSAGE")}
+	for _, job := range s.Jobs {
+		model := job.Provider
+		if job.Model != "" {
+			model += "/" + job.Model
+		}
+		if model == "" {
+			model = "-"
+		}
+		progress := "waiting"
+		if job.Bytes > 0 {
+			progress = fmt.Sprintf("%d lines %s", job.Lines, formatBytes(job.Bytes))
+		}
+		line := fmt.Sprintf("%-8d %-8s %-28s %-18s %s", job.PID, formatElapsed(now.Sub(job.Started)),
+			truncate(model, 28), progress, job.Message)
+		lines = append(lines, truncate(line, width))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// health lists the providers with why those that cannot be used cannot.
+func (s Snapshot) health() string {
+	var lines []string
+	for _, h := range s.Health {
+		state := "ok"
+		if h.Err != nil {
+			state = "unavailable: " + h.Err.Error()
+		}
+		lines = append(lines, fmt.Sprintf("%-12s %s", h.Provider, state))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatElapsed shows a duration as 1m05s.
+func formatElapsed(d time.Duration) string {
+	d = d.Round(time.Second)
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+	return fmt.Sprintf("%dm%02ds", int(d.Minutes()), int(d.Seconds())%60)
+}
+
+// formatBytes abbreviates a size, e.g. 1.2 KB.
+func formatBytes(n int) string {
+	if n >= 1024 {
+		return fmt.Sprintf("%.1f KB", float64(n)/1024)
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// truncate shortens s to width columns, ending it with an ellipsis.
+func truncate(s string, width int) string {
+	if lipgloss.Width(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && lipgloss.Width(string(runes))+1 > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
@@ -0,0 +1,163 @@
+package stats
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"asc/internal/conversation"
+)
+
+// Dimensions the usage can be grouped by.
+const (
+	DimensionDay      = "day"
+	DimensionWeek     = "week"
+	DimensionModel    = "model"
+	DimensionProvider = "provider"
+)
+
+// Dimensions lists the dimensions in the order the dashboard shows them.
+var Dimensions = []string{DimensionDay, DimensionWeek, DimensionModel, DimensionProvider}
+
+// usageDays and usageWeeks are how many days and weeks the time
+// dimensions show, up to the newest exchange.
+const (
+	usageDays  = 14
+	usageWeeks = 12
+)
+
+// Bucket is the usage of one day, week, model or provider.
+type Bucket struct {
+	Label         string
+	Conversations int
+	Responses     int
+	Tokens        int
+	Cost          float64
+	ids           map[string]bool
+}
+
+// Totals is the usage of all the conversations.
+type Totals struct {
+	Conversations int
+	Responses     int
+	Tokens        int
+	Cost          float64
+	// Unpriced counts the responses of models without a known price.
+	Unpriced int
+}
+
+// UsageTotals adds up the usage of conversations.
+func UsageTotals(conversations []conversation.Conversation) Totals {
+	var totals Totals
+	for _, conv := range conversations {
+		sum := conversation.ConversationCost(conv)
+		totals.Conversations++
+		totals.Responses += len(conv.Exchanges())
+		totals.Tokens += sum.TotalTokens()
+		totals.Cost += sum.Cost
+		totals.Unpriced += sum.Unpriced
+	}
+	return totals
+}
+
+// Usage groups the exchanges of conversations by dimension. Days and weeks
+// are the most recent ones up to the newest exchange, oldest first and
+// including those without use; models and providers are ordered by cost,
+// then by tokens.
+func Usage(conversations []conversation.Conversation, dimension string) []Bucket {
+	buckets := map[string]*Bucket{}
+	var newest time.Time
+	for _, conv := range conversations {
+		for _, turn := range conv.Exchanges() {
+			if turn.Timestamp.After(newest) {
+				newest = turn.Timestamp
+			}
+			label := usageLabel(turn, dimension)
+			b, ok := buckets[label]
+			if !ok {
+				b = &Bucket{Label: label, ids: map[string]bool{}}
+				buckets[label] = b
+			}
+			if !b.ids[conv.ID] {
+				b.ids[conv.ID] = true
+				b.Conversations++
+			}
+			b.Responses++
+			var cost conversation.CostSummary
+			cost.Add(turn.Meta)
+			b.Tokens += cost.TotalTokens()
+			b.Cost += cost.Cost
+		}
+	}
+
+	var result []Bucket
+	switch dimension {
+	case DimensionDay, DimensionWeek:
+		if newest.IsZero() {
+			return nil
+		}
+		for _, label := range timeLabels(newest, dimension) {
+			if b, ok := buckets[label]; ok {
+				result = append(result, *b)
+			} else {
+				result = append(result, Bucket{Label: label})
+			}
+		}
+	default:
+		for _, b := range buckets {
+			result = append(result, *b)
+		}
+		sort.Slice(result, func(i, j int) bool {
+			if result[i].Cost != result[j].Cost {
+				return result[i].Cost > result[j].Cost
+			}
+			if result[i].Tokens != result[j].Tokens {
+				return result[i].Tokens > result[j].Tokens
+			}
+			return result[i].Label < result[j].Label
+		})
+	}
+	return result
+}
+
+// usageLabel returns the bucket of turn in dimension.
+func usageLabel(turn conversation.Turn, dimension string) string {
+	meta := turn.Meta
+	if meta == nil {
+		meta = &conversation.ResponseMeta{Provider: "unknown"}
+	}
+	switch dimension {
+	case DimensionDay:
+		return turn.Timestamp.Local().Format("2006-01-02")
+	case DimensionWeek:
+		return weekLabel(turn.Timestamp)
+	case DimensionProvider:
+		return meta.Provider
+	}
+	if meta.Model == "" {
+		return meta.Provider + "/-"
+	}
+	return meta.Provider + "/" + meta.Model
+}
+
+// weekLabel names the ISO week of t, e.g. "2025-W27".
+func weekLabel(t time.Time) string {
+	year, week := t.Local().ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// timeLabels returns the labels of the days or weeks up to newest, oldest
+// first.
+func timeLabels(newest time.Time, dimension string) []string {
+	var labels []string
+	if dimension == DimensionDay {
+		for i := usageDays - 1; i >= 0; i-- {
+			labels = append(labels, newest.Local().AddDate(0, 0, -i).Format("2006-01-02"))
+		}
+		return labels
+	}
+	for i := usageWeeks - 1; i >= 0; i-- {
+		labels = append(labels, weekLabel(newest.AddDate(0, 0, -7*i)))
+	}
+	return labels
+}
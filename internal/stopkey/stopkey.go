@@ -0,0 +1,93 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+// Package stopkey lets Esc stop an answer streamed to the terminal, like
+// Ctrl-C. While it watches, the terminal reads keys one by one without
+// echoing them; output and Ctrl-C work as usual.
+package stopkey
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"asc/internal/termrestore"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// esc is what the terminal sends for the Esc key on its own. Other keys,
+// e.g. arrows, send longer sequences starting with it.
+const esc = "\x1b"
+
+// Watch returns a channel that is closed when Esc is pressed, and the
+// function that stops watching and restores the terminal. When stdin or
+// stdout is not a terminal the channel is never closed, since asc is then
+// part of a pipeline that may end it before the terminal is restored.
+func Watch() (<-chan struct{}, func()) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return nil, func() {}
+	}
+	// Unlike stdin, the terminal opened anew supports read deadlines
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, func() {}
+	}
+	conn, err := tty.SyscallConn()
+	if err != nil {
+		tty.Close()
+		return nil, func() {}
+	}
+	var saved *unix.Termios
+	conn.Control(func(fd uintptr) {
+		termios, err := unix.IoctlGetTermios(int(fd), ioctlGetTermios)
+		if err != nil {
+			return
+		}
+		cbreak := *termios
+		cbreak.Lflag &^= unix.ICANON | unix.ECHO
+		cbreak.Cc[unix.VMIN], cbreak.Cc[unix.VTIME] = 1, 0
+		if unix.IoctlSetTermios(int(fd), ioctlSetTermios, &cbreak) == nil {
+			saved = termios
+		}
+	})
+	if saved == nil {
+		tty.Close()
+		return nil, func() {}
+	}
+
+	restore := func() {
+		conn.Control(func(fd uintptr) {
+			unix.IoctlSetTermios(int(fd), ioctlSetTermios, saved)
+		})
+	}
+	stopRestoring := termrestore.OnSignal(restore)
+
+	pressed := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 16)
+		for {
+			n, err := tty.Read(buf)
+			if err != nil {
+				return
+			}
+			if string(buf[:n]) == esc {
+				close(pressed)
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return pressed, func() {
+		once.Do(func() {
+			tty.SetReadDeadline(time.Now())
+			<-done
+			restore()
+			stopRestoring()
+			tty.Close()
+		})
+	}
+}
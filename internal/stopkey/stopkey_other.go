@@ -0,0 +1,11 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+// Package stopkey lets Esc stop an answer streamed to the terminal, like
+// Ctrl-C. It is only supported on Unix terminals.
+package stopkey
+
+// Watch returns a channel that is never closed, and a function that does
+// nothing.
+func Watch() (<-chan struct{}, func()) {
+	return nil, func() {}
+}
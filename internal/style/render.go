@@ -0,0 +1,45 @@
+package style
+
+import (
+	"fmt"
+
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/log"
+)
+
+// Renderer renders markdown in the selected style.
+type Renderer struct {
+	tr *glamour.TermRenderer
+}
+
+// NewRenderer returns a renderer for the selected style that wraps text at
+// width columns.
+func NewRenderer(width int, logger *log.Logger) (*Renderer, error) {
+	glowStyle, err := GlowStyle(logger)
+	if err != nil {
+		return nil, err
+	}
+	return NewRendererFor(glowStyle, width)
+}
+
+// NewRendererFor returns a renderer for glowStyle, a built-in style name or
+// the path of a style file as returned by Resolve.
+func NewRendererFor(glowStyle string, width int) (*Renderer, error) {
+	tr, err := glamour.NewTermRenderer(
+		glamour.WithStylePath(glowStyle),
+		glamour.WithWordWrap(max(20, width-2)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load style %s: %w", glowStyle, err)
+	}
+	return &Renderer{tr: tr}, nil
+}
+
+// Render renders markdown for the terminal.
+func (r *Renderer) Render(markdown string) (string, error) {
+	out, err := r.tr.Render(markdown)
+	if err != nil {
+		return "", fmt.Errorf("failed to render markdown: %w", err)
+	}
+	return out, nil
+}
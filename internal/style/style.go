@@ -0,0 +1,221 @@
+package style
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"asc/assets"
+	"asc/internal/config"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/log"
+)
+
+// Auto picks the default style on dark terminals and the built-in light
+// style on light ones.
+const Auto = "auto"
+
+// Builtin lists the styles that come with glamour.
+var Builtin = []string{"ascii", "dark", "dracula", "light", "notty", "pink", "tokyo-night"}
+
+// legacyFile is the style file that was used before styles could be
+// installed by name. It is still honored when no style is selected.
+const legacyFile = "ggpt_glow_style.json"
+
+// currentFile records the style selected with `asc style set`.
+const currentFile = "current"
+
+// Default is the name the embedded style is installed under.
+const Default = "asc"
+
+// Dir returns the directory installed styles are kept in.
+func Dir() (string, error) {
+	shareDir, err := config.GetShareDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get share directory: %w", err)
+	}
+	return filepath.Join(shareDir, "styles"), nil
+}
+
+// Installed returns the names of the styles installed in Dir.
+func Installed() ([]string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read styles directory: %w", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			names = append(names, strings.TrimSuffix(entry.Name(), ".json"))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Selected returns the name of the selected style. The style key of the
+// config file wins over the style chosen with `asc style set`; Auto is
+// returned when neither is set.
+func Selected() (string, error) {
+	if cfg := config.Current(); cfg != nil && cfg.Style != "" {
+		return cfg.Style, nil
+	}
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, currentFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Auto, nil
+		}
+		return "", fmt.Errorf("failed to read selected style: %w", err)
+	}
+	if name := strings.TrimSpace(string(data)); name != "" {
+		return name, nil
+	}
+	return Auto, nil
+}
+
+// Resolve turns a style name into the value passed to NewRendererFor: the
+// name of a built-in style or the path of a style file.
+func Resolve(name string, logger *log.Logger) (string, error) {
+	if name == Auto {
+		// Keep using the old style file until a style is selected
+		shareDir, err := config.GetShareDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get share directory: %w", err)
+		}
+		legacyPath := filepath.Join(shareDir, legacyFile)
+		if _, err := os.Stat(legacyPath); err == nil {
+			logger.Debug("Using legacy style file", "path", legacyPath)
+			return legacyPath, nil
+		}
+		if background(logger) == "light" {
+			return "light", nil
+		}
+		dir, err := Dir()
+		if err != nil {
+			return "", err
+		}
+		path := filepath.Join(dir, Default+".json")
+		if _, err := os.Stat(path); err != nil {
+			return "dark", nil
+		}
+		return path, nil
+	}
+	for _, builtin := range Builtin {
+		if name == builtin {
+			return name, nil
+		}
+	}
+
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name+".json")
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("style %q is not installed (see 'asc style list')", name)
+	}
+	return path, nil
+}
+
+// GlowStyle returns the value to pass to glow --style for the selected
+// style.
+func GlowStyle(logger *log.Logger) (string, error) {
+	name, err := Selected()
+	if err != nil {
+		return "", err
+	}
+	return Resolve(name, logger)
+}
+
+// background returns "dark" or "light" from the background key of the
+// config file, or by querying the terminal.
+func background(logger *log.Logger) string {
+	if cfg := config.Current(); cfg != nil && cfg.Background != "" && cfg.Background != Auto {
+		return cfg.Background
+	}
+	if lipgloss.HasDarkBackground() {
+		logger.Debug("Detected dark terminal background")
+		return "dark"
+	}
+	logger.Debug("Detected light terminal background")
+	return "light"
+}
+
+// Materialize installs the embedded default style in Dir unless a style
+// of that name is already installed. It is called on every run so that
+// a fresh install, or one whose share directory was removed, works
+// without any files besides the binary.
+func Materialize(logger *log.Logger) error {
+	dir, err := Dir()
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, Default+".json")
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create styles directory: %w", err)
+	}
+	if err := os.WriteFile(path, assets.GlowStyle, 0644); err != nil {
+		return fmt.Errorf("failed to install default style: %w", err)
+	}
+	logger.Debug("Installed default style", "path", path)
+	return nil
+}
+
+// Install copies the style file at path into Dir and returns its name.
+func Install(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read style file: %w", err)
+	}
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create styles directory: %w", err)
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if err := os.WriteFile(filepath.Join(dir, name+".json"), data, 0644); err != nil {
+		return "", fmt.Errorf("failed to install style: %w", err)
+	}
+	return name, nil
+}
+
+// Select records name as the selected style.
+func Select(name string) error {
+	dir, err := Dir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create styles directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, currentFile), []byte(name+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to save selected style: %w", err)
+	}
+	return nil
+}
+
+// Sample is the markdown rendered by `asc style preview`.
+const Sample = "# Heading\n\nSome *emphasis*, **strong** text and `inline code`.\n\n" +
+	"## List\n\n- First item\n- Second item\n  1. Nested\n\n" +
+	"> A quotation\n\n" +
+	"```go\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n```\n\n" +
+	"| Column | Value |\n|--------|-------|\n| a      | 1     |\n"
@@ -0,0 +1,157 @@
+// Package suite records the prompts sent to providers together with their
+// answers, and replays them against another model to compare the answers.
+package suite
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"asc/internal/provider"
+)
+
+// Case is a recorded provider call.
+type Case struct {
+	Recorded time.Time `json:"recorded"`
+	Provider string    `json:"provider"`
+	Model    string    `json:"model,omitempty"`
+	// Args are the provider-specific arguments of the call, e.g. the
+	// search options of perplexity.
+	Args     []string `json:"args,omitempty"`
+	Prompt   string   `json:"prompt"`
+	Response string   `json:"response"`
+}
+
+// Append adds c to the suite file at path, one JSON object per line.
+func Append(path string, c Case) error {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create suite directory: %w", err)
+		}
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to marshal case: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open suite: %w", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write case: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write case: %w", err)
+	}
+	return nil
+}
+
+// Load reads the cases of the suite file at path.
+func Load(path string) ([]Case, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open suite: %w", err)
+	}
+	defer f.Close()
+
+	var cases []Case
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var c Case
+		if err := json.Unmarshal([]byte(line), &c); err != nil {
+			return nil, fmt.Errorf("invalid case on line %d of %s: %w", n, path, err)
+		}
+		cases = append(cases, c)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read suite: %w", err)
+	}
+	return cases, nil
+}
+
+// Replay sends the prompt of c to providerName and model, which default
+// to the recorded ones, and returns the answer.
+func Replay(ctx context.Context, c Case, providerName, model string, stderr io.Writer) (string, error) {
+	if providerName == "" {
+		providerName = c.Provider
+		if model == "" {
+			model = c.Model
+		}
+	}
+	p, err := provider.Get(providerName)
+	if err != nil {
+		return "", err
+	}
+	call := provider.Call{Prompt: c.Prompt, Model: model, Stderr: stderr}
+	if providerName == c.Provider {
+		call.Args = c.Args
+	}
+	stream, err := p.Stream(ctx, call)
+	if err != nil {
+		return "", err
+	}
+	var answer strings.Builder
+	for token := range stream.Tokens {
+		answer.WriteString(token)
+	}
+	if _, err := stream.Wait(); err != nil {
+		return "", fmt.Errorf("AI command failed: %w", err)
+	}
+	return strings.TrimRight(answer.String(), "\r\n"), nil
+}
+
+// Diff returns the lines of old and new as a unified listing: unchanged
+// lines start with a space, removed ones with "-" and added ones with "+".
+// It returns "" if both are the same.
+func Diff(old, new string) string {
+	if old == new {
+		return ""
+	}
+	a, b := strings.Split(old, "\n"), strings.Split(new, "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			fmt.Fprintf(&out, " %s\n", a[i])
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			fmt.Fprintf(&out, "-%s\n", a[i])
+			i++
+		default:
+			fmt.Fprintf(&out, "+%s\n", b[j])
+			j++
+		}
+	}
+	return out.String()
+}
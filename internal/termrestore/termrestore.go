@@ -0,0 +1,49 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+// Package termrestore puts back a terminal that asc switched to another
+// mode when asc is ended by a signal, which skips deferred calls.
+package termrestore
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// signals end asc without running deferred calls. SIGPIPE is caught too,
+// so that writing to a closed pipe fails with EPIPE and the caller returns
+// through its deferred calls instead of dying.
+var signals = []os.Signal{unix.SIGTERM, unix.SIGHUP, unix.SIGPIPE}
+
+// OnSignal calls restore if asc is terminated or hung up before the
+// returned function is called, and then ends asc with the same signal.
+func OnSignal(restore func()) func() {
+	caught := make(chan os.Signal, 1)
+	signal.Notify(caught, signals...)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-caught:
+				if sig == unix.SIGPIPE {
+					continue
+				}
+				restore()
+				signal.Reset(sig)
+				unix.Kill(unix.Getpid(), sig.(unix.Signal))
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(caught)
+			close(done)
+		})
+	}
+}
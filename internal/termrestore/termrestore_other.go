@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+// Package termrestore puts back a terminal that asc switched to another
+// mode when asc is ended by a signal. It is only needed on Unix terminals.
+package termrestore
+
+// OnSignal does nothing and returns a function that does nothing.
+func OnSignal(restore func()) func() {
+	return func() {}
+}
@@ -0,0 +1,252 @@
+package tidy
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"asc/internal/conversation"
+	"asc/internal/timeutil"
+
+	"github.com/charmbracelet/log"
+)
+
+// Change is what the review decided for one conversation.
+type Change struct {
+	ID      string
+	Title   string
+	Tags    []string
+	Archive bool
+	Delete  bool
+}
+
+// Plan holds the changes decided in a review, in the order they were
+// decided. Nothing is saved until it is applied.
+type Plan struct {
+	changes []*Change
+}
+
+// change returns the change of id, adding it if needed.
+func (p *Plan) change(id string) *Change {
+	for _, c := range p.changes {
+		if c.ID == id {
+			return c
+		}
+	}
+	c := &Change{ID: id}
+	p.changes = append(p.changes, c)
+	return c
+}
+
+// Len returns how many conversations the plan changes.
+func (p *Plan) Len() int {
+	return len(p.changes)
+}
+
+// String lists the changes, one conversation per line.
+func (p *Plan) String() string {
+	var b strings.Builder
+	for _, c := range p.changes {
+		var parts []string
+		switch {
+		case c.Delete:
+			parts = append(parts, "delete")
+		default:
+			if c.Title != "" {
+				parts = append(parts, fmt.Sprintf("title %q", c.Title))
+			}
+			if len(c.Tags) > 0 {
+				parts = append(parts, "tag "+strings.Join(c.Tags, ", "))
+			}
+			if c.Archive {
+				parts = append(parts, "archive")
+			}
+		}
+		fmt.Fprintf(&b, "%s  %s\n", c.ID, strings.Join(parts, "; "))
+	}
+	return b.String()
+}
+
+// Apply saves the changes. It stops at the first that fails and returns
+// how many conversations were changed.
+func (p *Plan) Apply(logger *log.Logger) (int, error) {
+	for i, c := range p.changes {
+		if c.Delete {
+			if err := conversation.DeleteConversation(c.ID, logger); err != nil {
+				return i, err
+			}
+			continue
+		}
+		conv, err := conversation.LoadConversation(c.ID, logger)
+		if err != nil {
+			return i, err
+		}
+		if c.Title != "" {
+			conv.Title = c.Title
+		}
+		conversation.AddTags(&conv, c.Tags)
+		if c.Archive {
+			conversation.Archive(&conv)
+		}
+		if err := conversation.SaveConversation(conv, logger); err != nil {
+			return i, err
+		}
+	}
+	return len(p.changes), nil
+}
+
+// errStop ends the review early, keeping the changes decided so far.
+var errStop = errors.New("review stopped")
+
+// Review asks on w what to do with each finding, reading the answers from
+// in, and returns the decided changes. Findings of conversations already
+// set to be archived or deleted are skipped. The review ends early when
+// "." is answered or in ends.
+func Review(in *bufio.Reader, w io.Writer, findings []Finding) (*Plan, error) {
+	plan := &Plan{}
+	fmt.Fprintln(w, `Enter accepts the suggestion in brackets, "-" skips, "." ends the review.`)
+	for i, finding := range findings {
+		c := plan.change(finding.Entry.ID)
+		if c.Archive || c.Delete {
+			continue
+		}
+		description := finding.Entry.Title
+		if description == "" {
+			description = strings.Join(strings.Fields(conversation.WithoutAttachments(finding.Entry.Message)), " ")
+		}
+		fmt.Fprintf(w, "\n[%d/%d] %s  %s  %s\n", i+1, len(findings), finding.Entry.ID, timeutil.Format(finding.Entry.Timestamp), finding.Kind)
+		fmt.Fprintf(w, "  %s\n", truncate(description, 100))
+
+		var err error
+		switch finding.Kind {
+		case KindDuplicate, KindHuge:
+			err = reviewCleanup(in, w, finding, c)
+		case KindUntitled:
+			err = reviewTitle(in, w, finding, c)
+		case KindUntagged:
+			err = reviewTags(in, w, finding, c)
+		}
+		if errors.Is(err, errStop) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Drop the conversations that were only looked at
+	var changes []*Change
+	for _, c := range plan.changes {
+		if c.Title != "" || len(c.Tags) > 0 || c.Archive || c.Delete {
+			changes = append(changes, c)
+		}
+	}
+	plan.changes = changes
+	return plan, nil
+}
+
+// ask prints prompt with the suggestion and returns the answer: the
+// suggestion for an empty line, "" for "-", or errStop.
+func ask(in *bufio.Reader, w io.Writer, prompt, suggestion string) (string, error) {
+	if suggestion != "" {
+		prompt += " [" + suggestion + "]"
+	}
+	fmt.Fprintf(w, "  %s: ", prompt)
+	line, err := in.ReadString('\n')
+	if err == io.EOF && line == "" {
+		fmt.Fprintln(w)
+		return "", errStop
+	}
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to read answer: %w", err)
+	}
+	switch answer := strings.TrimSpace(line); answer {
+	case ".":
+		return "", errStop
+	case "-":
+		return "", nil
+	case "":
+		return suggestion, nil
+	default:
+		return answer, nil
+	}
+}
+
+// reviewCleanup asks whether to archive or delete a near-duplicate or a
+// huge conversation. Near-duplicates are suggested to be archived, huge
+// conversations to be deleted.
+func reviewCleanup(in *bufio.Reader, w io.Writer, finding Finding, c *Change) error {
+	suggestion := "archive"
+	if finding.Kind == KindDuplicate {
+		fmt.Fprintf(w, "  repeats %s, which is kept\n", finding.Of)
+	} else {
+		fmt.Fprintf(w, "  holds %s of text\n", formatSize(finding.Size))
+		suggestion = "delete"
+	}
+	for {
+		answer, err := ask(in, w, "archive, delete or skip", suggestion)
+		if err != nil {
+			return err
+		}
+		switch answer {
+		case "archive", "a":
+			c.Archive = true
+			return nil
+		case "delete", "d":
+			c.Delete = true
+			return nil
+		case "skip", "s", "":
+			return nil
+		}
+		fmt.Fprintf(w, "  unknown action %q\n", answer)
+	}
+}
+
+// reviewTitle asks for the title of an untitled conversation.
+func reviewTitle(in *bufio.Reader, w io.Writer, finding Finding, c *Change) error {
+	title, err := ask(in, w, "Title", finding.Title)
+	if err != nil {
+		return err
+	}
+	c.Title = title
+	return nil
+}
+
+// reviewTags asks for the tags of an untagged conversation, separated by
+// spaces.
+func reviewTags(in *bufio.Reader, w io.Writer, finding Finding, c *Change) error {
+	for {
+		answer, err := ask(in, w, "Tags", strings.Join(finding.Tags, " "))
+		if err != nil {
+			return err
+		}
+		tags, err := conversation.ParseTags(strings.Fields(answer))
+		if err != nil {
+			fmt.Fprintf(w, "  %v\n", err)
+			continue
+		}
+		c.Tags = tags
+		return nil
+	}
+}
+
+// truncate shortens s to n runes, ending it with an ellipsis.
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// formatSize abbreviates a size in bytes, e.g. 1.2 MB.
+func formatSize(n int) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -0,0 +1,191 @@
+// Package tidy finds conversations worth cleaning up, for asc tidy:
+// near-duplicates, huge ones, and those without a title or tags, each with
+// a suggested change.
+package tidy
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"asc/internal/conversation"
+
+	"github.com/charmbracelet/log"
+)
+
+// Kinds of findings, in the order they are reviewed. Duplicates and huge
+// conversations come first, so that those deleted are not titled.
+const (
+	KindDuplicate = "near-duplicate"
+	KindHuge      = "huge"
+	KindUntitled  = "untitled"
+	KindUntagged  = "untagged"
+)
+
+// maxTitle is the length of suggested titles.
+const maxTitle = 60
+
+// minDuplicateWords is how many distinct words messages need to be
+// compared for similarity; shorter ones must be equal.
+const minDuplicateWords = 4
+
+// duplicateSimilarity is the share of words two messages have in common
+// from which they count as near-duplicates.
+const duplicateSimilarity = 0.8
+
+// Options selects what counts as a finding.
+type Options struct {
+	// HugeSize is the size in bytes from which a conversation is huge; 0
+	// finds none.
+	HugeSize int
+}
+
+// Finding is a conversation to clean up and the suggested change.
+type Finding struct {
+	Kind  string
+	Entry conversation.Entry
+	// Of is the newer conversation a near-duplicate repeats, and Size the
+	// size of a huge conversation.
+	Of   string
+	Size int
+	// Title and Tags are suggested for untitled and untagged
+	// conversations; they may be empty.
+	Title string
+	Tags  []string
+}
+
+// Find returns the findings among entries, by kind and then oldest first.
+// Archived conversations are left out. Huge conversations are found by
+// loading each conversation in turn.
+func Find(entries []conversation.Entry, opts Options, logger *log.Logger) []Finding {
+	entries = conversation.Archived(entries, false)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+
+	findings := duplicates(entries)
+	if opts.HugeSize > 0 {
+		for _, entry := range entries {
+			conv, err := conversation.LoadConversation(entry.ID, logger)
+			if err != nil {
+				logger.Warn("Failed to load conversation", "id", entry.ID, "error", err)
+				continue
+			}
+			if size := conv.Size(); size >= opts.HugeSize {
+				findings = append(findings, Finding{Kind: KindHuge, Entry: entry, Size: size})
+			}
+		}
+	}
+	for _, entry := range entries {
+		if entry.Title == "" {
+			findings = append(findings, Finding{Kind: KindUntitled, Entry: entry, Title: suggestTitle(entry.Message)})
+		}
+	}
+	counts := conversation.CountTags(entries)
+	for _, entry := range entries {
+		if len(entry.Tags) == 0 {
+			findings = append(findings, Finding{Kind: KindUntagged, Entry: entry, Tags: suggestTags(entry.Message, counts)})
+		}
+	}
+	return findings
+}
+
+// duplicates finds the conversations whose first message is about the same
+// as that of a newer one, which is kept. entries are sorted oldest first.
+func duplicates(entries []conversation.Entry) []Finding {
+	words := make([]map[string]bool, len(entries))
+	for i, entry := range entries {
+		words[i] = wordSet(conversation.WithoutAttachments(entry.Message))
+	}
+	var findings []Finding
+	for i, entry := range entries {
+		if len(words[i]) == 0 {
+			continue
+		}
+		// The newest similar conversation is the one to keep
+		for j := len(entries) - 1; j > i; j-- {
+			if similar(words[i], words[j]) {
+				findings = append(findings, Finding{Kind: KindDuplicate, Entry: entry, Of: entries[j].ID})
+				break
+			}
+		}
+	}
+	return findings
+}
+
+// wordSet returns the distinct lowercase words of s.
+func wordSet(s string) map[string]bool {
+	set := map[string]bool{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		set[word] = true
+	}
+	return set
+}
+
+// similar reports whether the word sets a and b are near-duplicates.
+func similar(a, b map[string]bool) bool {
+	if len(a) < minDuplicateWords || len(b) < minDuplicateWords {
+		if len(a) != len(b) {
+			return false
+		}
+		for word := range a {
+			if !b[word] {
+				return false
+			}
+		}
+		return true
+	}
+	common := 0
+	for word := range a {
+		if b[word] {
+			common++
+		}
+	}
+	return float64(common)/float64(len(a)+len(b)-common) >= duplicateSimilarity
+}
+
+// suggestTitle derives a title from the first line of message, cut at a
+// word to maxTitle characters.
+func suggestTitle(message string) string {
+	message = conversation.WithoutAttachments(message)
+	var line string
+	for _, l := range strings.Split(message, "\n") {
+		if line = strings.Join(strings.Fields(strings.TrimLeft(l, "#>*- ")), " "); line != "" {
+			break
+		}
+	}
+	line = strings.TrimRight(line, "?.!:;, ")
+	runes := []rune(line)
+	if len(runes) <= maxTitle {
+		return line
+	}
+	cut := string(runes[:maxTitle])
+	if i := strings.LastIndexByte(cut, ' '); i > maxTitle/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, "?.!:;, ")
+}
+
+// suggestTags returns the tags in use, most used first, that are words of
+// message.
+func suggestTags(message string, counts map[string]int) []string {
+	words := wordSet(conversation.WithoutAttachments(message))
+	var tags []string
+	for tag := range counts {
+		if words[strings.ToLower(tag)] {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if counts[tags[i]] != counts[tags[j]] {
+			return counts[tags[i]] > counts[tags[j]]
+		}
+		return tags[i] < tags[j]
+	})
+	if len(tags) > 3 {
+		tags = tags[:3]
+	}
+	return tags
+}
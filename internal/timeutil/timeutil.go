@@ -0,0 +1,134 @@
+package timeutil
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Layout returns the timestamp layout for the user's locale.
+// The locale is taken from LC_ALL, LC_TIME or LANG, in that order,
+// and falls back to an ISO-like layout.
+func Layout() string {
+	locale := ""
+	for _, name := range []string{"LC_ALL", "LC_TIME", "LANG"} {
+		if v := os.Getenv(name); v != "" {
+			locale = v
+			break
+		}
+	}
+
+	// Strip encoding and modifier (e.g. ja_JP.UTF-8@foo -> ja_JP)
+	if i := strings.IndexAny(locale, ".@"); i >= 0 {
+		locale = locale[:i]
+	}
+	lang, region, _ := strings.Cut(locale, "_")
+
+	switch lang {
+	case "ja", "zh", "ko":
+		return "2006/01/02 15:04:05"
+	case "de", "ru", "pl", "cs", "fi", "nb", "da", "tr":
+		return "02.01.2006 15:04:05"
+	case "fr", "es", "it", "pt", "nl":
+		return "02/01/2006 15:04:05"
+	case "en":
+		switch region {
+		case "US":
+			return "01/02/2006 03:04:05 PM"
+		case "GB", "AU", "NZ", "IE", "IN":
+			return "02/01/2006 15:04:05"
+		}
+	}
+	return "2006-01-02 15:04:05"
+}
+
+// Format renders t in the local timezone (honoring TZ) using the locale layout.
+func Format(t time.Time) string {
+	return t.In(time.Local).Format(Layout())
+}
+
+// dateLayouts are the absolute formats accepted by Parse, interpreted in
+// the local timezone unless they carry their own offset.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"20060102150405",
+}
+
+// Parse interprets s relative to now. It accepts keywords ("now", "today",
+// "yesterday"), durations in the past ("90m", "3h", "7d", "2w") and
+// absolute dates such as "2025-07-06" or RFC3339 timestamps.
+func Parse(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	now = now.In(time.Local)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+
+	switch strings.ToLower(s) {
+	case "now":
+		return now, nil
+	case "today":
+		return today, nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), nil
+	}
+
+	if d, err := ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (use e.g. 2025-07-06, yesterday, 7d or 3h)", s)
+}
+
+// ParseEnd is Parse for the end of a range: a day given without a time of
+// day, such as "2025-07-31" or "yesterday", stands for its last instant so
+// that the day itself is included.
+func ParseEnd(s string, now time.Time) (time.Time, error) {
+	t, err := Parse(s, now)
+	if err != nil {
+		return t, err
+	}
+	s = strings.TrimSpace(s)
+	switch strings.ToLower(s) {
+	case "today", "yesterday":
+	default:
+		if _, err := time.Parse("2006-01-02", s); err != nil {
+			return t, nil
+		}
+	}
+	return t.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+}
+
+// ParseDuration extends time.ParseDuration with day ("d") and week ("w") units.
+func ParseDuration(s string) (time.Duration, error) {
+	if n := len(s); n > 1 {
+		unit := time.Duration(0)
+		switch s[n-1] {
+		case 'd':
+			unit = 24 * time.Hour
+		case 'w':
+			unit = 7 * 24 * time.Hour
+		}
+		if unit != 0 {
+			v, err := strconv.Atoi(s[:n-1])
+			if err != nil || v < 0 {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			return time.Duration(v) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,31 @@
+package timeutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseEnd(t *testing.T) {
+	now := time.Date(2025, 8, 15, 10, 30, 0, 0, time.Local)
+	tests := []struct {
+		s    string
+		want time.Time
+	}{
+		{"2025-07-31", time.Date(2025, 7, 31, 23, 59, 59, 999999999, time.Local)},
+		{"today", time.Date(2025, 8, 15, 23, 59, 59, 999999999, time.Local)},
+		{"yesterday", time.Date(2025, 8, 14, 23, 59, 59, 999999999, time.Local)},
+		{"2025-07-31 12:00", time.Date(2025, 7, 31, 12, 0, 0, 0, time.Local)},
+		{"now", now},
+		{"1d", now.AddDate(0, 0, -1)},
+	}
+	for _, test := range tests {
+		got, err := ParseEnd(test.s, now)
+		if err != nil {
+			t.Errorf("ParseEnd(%q) failed: %v", test.s, err)
+			continue
+		}
+		if !got.Equal(test.want) {
+			t.Errorf("ParseEnd(%q) = %v, want %v", test.s, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package view
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"asc/internal/config"
+	"asc/internal/conversation"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/log"
+)
+
+// reloadedMsg carries a conversation that changed outside the TUI, e.g.
+// in a chat started from it.
+type reloadedMsg struct {
+	conv conversation.Conversation
+}
+
+// openAttachments shows the attachments of the selected conversation.
+func (m model) openAttachments() (tea.Model, tea.Cmd) {
+	conv, err := m.selected()
+	if err != nil {
+		m.status = fmt.Sprintf("Failed to load conversation: %v", err)
+		return m, nil
+	}
+	attachments := conversation.ListAttachments(conv)
+	if len(attachments) == 0 {
+		m.status = fmt.Sprintf("%s has no attachments", conv.ID)
+		return m, nil
+	}
+	m.attachments, m.attachmentsOf, m.attachmentCursor = attachments, conv.ID, 0
+	m.showAttachments = true
+	return m, nil
+}
+
+// updateAttachments handles key input while the attachments are shown.
+func (m model) updateAttachments(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.exportingAttachment {
+		return m.updateAttachmentExport(msg)
+	}
+	m.status = ""
+	attachment := m.attachments[m.attachmentCursor]
+	switch msg.String() {
+	case "esc", "q", "a":
+		m.showAttachments = false
+	case "up", "k":
+		m.attachmentCursor = max(m.attachmentCursor-1, 0)
+	case "down", "j":
+		m.attachmentCursor = min(m.attachmentCursor+1, len(m.attachments)-1)
+	case "enter", "o":
+		return m, openAttachment(attachment, m.logger)
+	case "r":
+		return m, reattach(m.attachmentsOf, attachment, m.logger)
+	case "x":
+		name := attachment.Name
+		if filepath.Ext(name) == "" {
+			name += ".txt"
+		}
+		m.attachmentInput = textinput.New()
+		m.attachmentInput.Prompt = "Export to: "
+		m.attachmentInput.SetValue(name)
+		m.attachmentInput.CursorEnd()
+		m.attachmentInput.Focus()
+		m.exportingAttachment = true
+		return m, textinput.Blink
+	}
+	return m, nil
+}
+
+// updateAttachmentExport handles key input while the export path of an
+// attachment is typed.
+func (m model) updateAttachmentExport(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.exportingAttachment = false
+		return m, nil
+	case "enter":
+		m.exportingAttachment = false
+		path := strings.TrimSpace(m.attachmentInput.Value())
+		if path == "" {
+			return m, nil
+		}
+		if err := conversation.ExportAttachment(m.attachments[m.attachmentCursor], path); err != nil {
+			m.status = fmt.Sprintf("Export failed: %v", err)
+			return m, nil
+		}
+		m.status = fmt.Sprintf("Exported %s to %s", m.attachments[m.attachmentCursor].Name, path)
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.attachmentInput, cmd = m.attachmentInput.Update(msg)
+	return m, cmd
+}
+
+// openAttachment shows the content of a text attachment in the pager, or
+// opens an image with the program of the desktop.
+func openAttachment(attachment conversation.StoredAttachment, logger *log.Logger) tea.Cmd {
+	if attachment.Stored {
+		return openDocument(attachment.Content, logger)
+	}
+	if attachment.Path == "" {
+		return statusCmd(fmt.Sprintf("The content of %s is not stored", attachment.Name))
+	}
+	if _, err := os.Stat(attachment.Path); err != nil {
+		return statusCmd(fmt.Sprintf("%s is not stored and cannot be opened: %v", attachment.Name, err))
+	}
+	opener := "xdg-open"
+	if runtime.GOOS == "darwin" {
+		opener = "open"
+	}
+	return newExternalCommand(opener, attachment.Path).run(opener, nil, nil)
+}
+
+// reattach continues the conversation id in a chat, with attachment
+// attached to the first message. Stored content that differs from the
+// file, or whose file is gone, is attached from a temporary copy.
+func reattach(id string, attachment conversation.StoredAttachment, logger *log.Logger) tea.Cmd {
+	flag, path := "--file", attachment.Path
+	if attachment.MediaType != "" {
+		flag = "--image"
+	}
+	var cleanup func()
+	if attachment.Stored {
+		current, err := os.ReadFile(path)
+		if path == "" || err != nil || !bytes.Equal(current, []byte(attachment.Content)) {
+			dir, err := os.MkdirTemp("", "asc-attachment-*")
+			if err != nil {
+				return statusCmd(fmt.Sprintf("Failed to create temp directory: %v", err))
+			}
+			cleanup = func() { os.RemoveAll(dir) }
+			path = filepath.Join(dir, filepath.Base(attachment.Name))
+			if err := os.WriteFile(path, []byte(attachment.Content), 0600); err != nil {
+				cleanup()
+				return statusCmd(fmt.Sprintf("Failed to write temp file: %v", err))
+			}
+		}
+	} else if path == "" {
+		return statusCmd(fmt.Sprintf("The content of %s is not stored", attachment.Name))
+	}
+	c := newExternalCommand("asc", "chat", "--id", id, flag, path)
+	return c.run("asc chat", func() tea.Msg {
+		conv, err := conversation.LoadConversation(id, logger)
+		if err != nil {
+			return statusMsg(fmt.Sprintf("Failed to reload %s: %v", id, err))
+		}
+		return reloadedMsg{conv}
+	}, cleanup)
+}
+
+// attachmentsView lists the attachments with the one under the cursor
+// highlighted.
+func (m model) attachmentsView() string {
+	colors := config.Colors()
+	style := lipgloss.NewStyle().
+		BorderStyle(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color(colors.Border)).
+		Padding(1, 2)
+	selected := lipgloss.NewStyle().
+		Foreground(lipgloss.Color(colors.SelectedForeground)).
+		Background(lipgloss.Color(colors.SelectedBackground))
+	muted := lipgloss.NewStyle().Foreground(lipgloss.Color(colors.Muted))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Attachments of %s\n\n", m.attachmentsOf)
+	for i, attachment := range m.attachments {
+		line := fmt.Sprintf("%-24s turn %d  %s", truncateString(attachment.Name, 24), attachment.Turn, attachmentDetails(attachment))
+		if i == m.attachmentCursor {
+			line = selected.Render(line)
+		}
+		b.WriteString(line + "\n")
+		if attachment.Path != "" {
+			b.WriteString(muted.Render("  "+attachment.Path) + "\n")
+		}
+	}
+	b.WriteString("\n")
+	if m.exportingAttachment {
+		b.WriteString(m.attachmentInput.View() + "\n\nEnter to export, Esc to cancel")
+	} else {
+		b.WriteString("enter/o: open  r: attach to a follow-up in a chat  x: export  esc: back")
+	}
+	parts := []string{style.Render(b.String())}
+	if m.status != "" {
+		parts = append(parts, m.status)
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, parts...)
+}
+
+// attachmentDetails describes the size and kind of attachment.
+func attachmentDetails(attachment conversation.StoredAttachment) string {
+	size := fmt.Sprintf("%d B", attachment.Size)
+	if attachment.Size >= 1024 {
+		size = fmt.Sprintf("%.1f KB", float64(attachment.Size)/1024)
+	}
+	switch {
+	case attachment.MediaType != "":
+		return size + ", " + attachment.MediaType + ", file only"
+	case attachment.Encoding != "":
+		return size + ", from " + attachment.Encoding
+	}
+	return size
+}
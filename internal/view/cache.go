@@ -0,0 +1,62 @@
+package view
+
+import (
+	"container/list"
+
+	"asc/internal/conversation"
+
+	"github.com/charmbracelet/log"
+)
+
+// maxCachedBytes caps the memory held by conversations loaded for viewing.
+// The most recently used conversation is always kept, however large.
+const maxCachedBytes = 32 << 20
+
+// bodyCache keeps the most recently used full conversations, evicting the
+// least recently used ones beyond maxCachedBytes.
+type bodyCache struct {
+	order *list.List // of conversation.Conversation, most recent first
+	items map[string]*list.Element
+	size  int
+}
+
+func newBodyCache() *bodyCache {
+	return &bodyCache{order: list.New(), items: map[string]*list.Element{}}
+}
+
+// get returns the conversation with id, loading it if it is not cached.
+func (c *bodyCache) get(id string, logger *log.Logger) (conversation.Conversation, error) {
+	if elem, ok := c.items[id]; ok {
+		c.order.MoveToFront(elem)
+		return elem.Value.(conversation.Conversation), nil
+	}
+	conv, err := conversation.LoadConversation(id, logger)
+	if err != nil {
+		return conv, err
+	}
+	c.put(conv)
+	return conv, nil
+}
+
+// put stores conv, replacing an older copy.
+func (c *bodyCache) put(conv conversation.Conversation) {
+	c.remove(conv.ID)
+	c.items[conv.ID] = c.order.PushFront(conv)
+	c.size += conv.Size()
+	for c.size > maxCachedBytes && c.order.Len() > 1 {
+		c.removeElement(c.order.Back())
+	}
+}
+
+// remove drops the conversation with id, e.g. after it was deleted.
+func (c *bodyCache) remove(id string) {
+	if elem, ok := c.items[id]; ok {
+		c.removeElement(elem)
+	}
+}
+
+func (c *bodyCache) removeElement(elem *list.Element) {
+	conv := c.order.Remove(elem).(conversation.Conversation)
+	delete(c.items, conv.ID)
+	c.size -= conv.Size()
+}
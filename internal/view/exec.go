@@ -0,0 +1,89 @@
+package view
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// statusMsg is shown in the status line, e.g. when a pager or the editor
+// failed.
+type statusMsg string
+
+// externalCommand is a pager, the editor or asc itself run from the TUI.
+// What it writes to stderr is kept to explain a failure, and a failed
+// command may have left the terminal in its alternate screen or with
+// styles set, so the terminal is reset before the TUI takes it back.
+type externalCommand struct {
+	cmd    *exec.Cmd
+	stdout io.Writer
+	stderr bytes.Buffer
+}
+
+func newExternalCommand(name string, args ...string) *externalCommand {
+	return &externalCommand{cmd: exec.Command(name, args...)}
+}
+
+func (c *externalCommand) SetStdin(r io.Reader) { c.cmd.Stdin = r }
+
+func (c *externalCommand) SetStdout(w io.Writer) {
+	c.cmd.Stdout = w
+	c.stdout = w
+}
+
+func (c *externalCommand) SetStderr(w io.Writer) {
+	c.cmd.Stderr = io.MultiWriter(w, &c.stderr)
+}
+
+func (c *externalCommand) Run() error {
+	err := c.cmd.Run()
+	if err != nil {
+		out := c.stdout
+		if out == nil {
+			out = os.Stdout
+		}
+		// Leave the alternate screen, reset styles and show the cursor
+		fmt.Fprint(out, "\x1b[?1049l\x1b[0m\x1b[?25h")
+	}
+	return err
+}
+
+// failure describes how the command failed, with the last line it wrote
+// to stderr.
+func (c *externalCommand) failure(what string, err error) string {
+	status := fmt.Sprintf("%s failed: %v", what, err)
+	lines := strings.Split(strings.TrimSpace(c.stderr.String()), "\n")
+	if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+		status += ": " + last
+	}
+	return status
+}
+
+// run runs c from the TUI, then cleanup if set. done returns the message
+// sent when c succeeded; a failure is shown in the status line.
+func (c *externalCommand) run(what string, done func() tea.Msg, cleanup func()) tea.Cmd {
+	return tea.Exec(c, func(err error) tea.Msg {
+		if cleanup != nil {
+			defer cleanup()
+		}
+		if err != nil {
+			return statusMsg(c.failure(what, err))
+		}
+		if done == nil {
+			return nil
+		}
+		return done()
+	})
+}
+
+// statusCmd shows status in the status line.
+func statusCmd(status string) tea.Cmd {
+	return func() tea.Msg {
+		return statusMsg(status)
+	}
+}
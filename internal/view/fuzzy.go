@@ -0,0 +1,83 @@
+package view
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"asc/internal/conversation"
+	"asc/internal/timeutil"
+)
+
+// fuzzyScore reports whether the runes of pattern occur in text in order,
+// ignoring case, and scores the match: consecutive runes and runes at the
+// start of a word score higher, so "dkcmp" ranks "docker compose" above
+// text where the letters are scattered.
+func fuzzyScore(pattern, text string) (int, bool) {
+	pattern = strings.ToLower(pattern)
+	text = strings.ToLower(text)
+	score := 0
+	consecutive := 0
+	prev := ' '
+	for _, p := range pattern {
+		if unicode.IsSpace(p) {
+			continue
+		}
+		found := false
+		for len(text) > 0 {
+			r, size := utf8.DecodeRuneInString(text)
+			text = text[size:]
+			if r == p {
+				score++
+				if consecutive > 0 {
+					score += 2 * consecutive
+				}
+				if !unicode.IsLetter(prev) && !unicode.IsDigit(prev) {
+					score += 3
+				}
+				consecutive++
+				prev = r
+				found = true
+				break
+			}
+			consecutive = 0
+			prev = r
+		}
+		if !found {
+			return 0, false
+		}
+	}
+	return score, true
+}
+
+// filterEntries returns the entries whose ID, date, tags, title or message match
+// pattern, best matches first. Entries with the same score keep their
+// order. An empty pattern returns entries as they are.
+func filterEntries(entries []conversation.Entry, pattern string) []conversation.Entry {
+	if strings.TrimSpace(pattern) == "" {
+		return entries
+	}
+	type scored struct {
+		entry conversation.Entry
+		score int
+	}
+	var matches []scored
+	for _, entry := range entries {
+		text := entry.ID + " " + timeutil.Format(entry.Timestamp) + " " + entry.Title + " " + entry.Message
+		for _, tag := range entry.Tags {
+			text += " #" + tag
+		}
+		if score, ok := fuzzyScore(pattern, text); ok {
+			matches = append(matches, scored{entry, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+	filtered := make([]conversation.Entry, len(matches))
+	for i, match := range matches {
+		filtered[i] = match.entry
+	}
+	return filtered
+}
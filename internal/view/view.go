@@ -2,15 +2,19 @@ package view
 
 import (
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
-	"path/filepath"
 	"sort"
+	"strings"
 
 	"asc/internal/config"
 	"asc/internal/conversation"
+	"asc/internal/crash"
+	"asc/internal/style"
+	"asc/internal/timeutil"
 
 	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/log"
@@ -18,12 +22,41 @@ import (
 )
 
 type model struct {
-	table         table.Model
-	conversations []conversation.Conversation
+	table table.Model
+	// all holds every listed conversation and entries those shown, which
+	// differ while a filter is typed.
+	all           []conversation.Entry
+	entries       []conversation.Entry
+	bodies        *bodyCache
 	logger        *log.Logger
 	showConfirm   bool
 	selectedID    string
 	terminalWidth int
+	showExport    bool
+	exportInput   textinput.Model
+	showTags      bool
+	tagInput      textinput.Model
+	status        string
+	glowStyle     string
+	// filtering is set while the filter input has the focus.
+	filtering   bool
+	filterInput textinput.Model
+	// showAttachments is set while the attachments of the conversation
+	// attachmentsOf are listed.
+	showAttachments     bool
+	attachments         []conversation.StoredAttachment
+	attachmentsOf       string
+	attachmentCursor    int
+	exportingAttachment bool
+	attachmentInput     textinput.Model
+	// archived is set when the archived conversations are listed, and
+	// pickedByID when the list holds given conversations whether archived
+	// or not, so that they stay listed when archived.
+	archived   bool
+	pickedByID bool
+	// startCmd is run when the program starts, e.g. to open a conversation
+	// given with --id.
+	startCmd tea.Cmd
 }
 
 type editCompleteMsg struct {
@@ -34,17 +67,17 @@ type editCompleteMsg struct {
 func calculateColumnWidths(terminalWidth int) (idWidth, dateWidth, messageWidth int) {
 	// Account for borders and table internal spacing
 	// Each column seems to have additional padding in the table component
-	availableWidth := terminalWidth - 8  // Increased from 4 to account for table padding
-	
+	availableWidth := terminalWidth - 8 // Increased from 4 to account for table padding
+
 	// Fixed widths for ID and Date columns
-	idWidth = 14  // Full ID: 20250706023320
-	dateWidth = 19 // Full date: 2025-07-06 02:33:20
+	idWidth = 14                       // Full ID: 20250706023320
+	dateWidth = len(timeutil.Layout()) // Full date in the user's locale
 	messageWidth = availableWidth - idWidth - dateWidth
-	
+
 	return idWidth, dateWidth, messageWidth
 }
 
-func initialModel(logger *log.Logger, terminalWidth int) model {
+func initialModel(logger *log.Logger, terminalWidth, height int) model {
 	// Calculate column widths
 	idWidth, dateWidth, messageWidth := calculateColumnWidths(terminalWidth)
 
@@ -57,167 +90,267 @@ func initialModel(logger *log.Logger, terminalWidth int) model {
 	t := table.New(
 		table.WithColumns(columns),
 		table.WithFocused(true),
-		table.WithHeight(15),
+		table.WithHeight(height),
 	)
 
+	colors := config.Colors()
 	s := table.DefaultStyles()
 	s.Header = s.Header.
 		BorderStyle(lipgloss.RoundedBorder()).
-		BorderForeground(lipgloss.Color("240"))
+		BorderForeground(lipgloss.Color(colors.Border))
 	s.Cell = s.Cell.
 		Padding(0, 2)
 	s.Selected = s.Selected.
-		Foreground(lipgloss.Color("229")).
-		Background(lipgloss.Color("57")).
+		Foreground(lipgloss.Color(colors.SelectedForeground)).
+		Background(lipgloss.Color(colors.SelectedBackground)).
 		Bold(false)
 	t.SetStyles(s)
 
+	filterInput := textinput.New()
+	filterInput.Prompt = "/"
+	filterInput.Placeholder = "filter by ID, date or message"
+
 	return model{
 		table:         t,
 		logger:        logger,
 		terminalWidth: terminalWidth,
+		bodies:        newBodyCache(),
+		filterInput:   filterInput,
 	}
 }
 
 func (m model) Init() tea.Cmd {
-	return nil
+	return m.startCmd
 }
 
-func openGlow(selected conversation.Conversation, logger *log.Logger, terminalWidth int) tea.Cmd {
-	// Create a temporary file to save the conversation message
+// openDocument writes content to a temporary file and opens it in the
+// pager. Failures are shown in the status line.
+func openDocument(content string, logger *log.Logger) tea.Cmd {
 	tempFile, err := os.CreateTemp("", "conversation-*.md")
 	if err != nil {
-		logger.Error("Failed to create temp file", "error", err)
-		return nil
-	}
-
-	// Format the content with context if it exists
-	var content string
-	if selected.Context != "" {
-		content = fmt.Sprintf("# Conversation %s\n\n## Context\n%s\n\n## User\n%s\n\n## AI\n%s",
-			selected.ID, selected.Context, selected.Message, selected.Response)
-	} else {
-		content = fmt.Sprintf("# Conversation %s\n\n## User\n%s\n\n## AI\n%s",
-			selected.ID, selected.Message, selected.Response)
+		return statusCmd(fmt.Sprintf("Failed to create temp file: %v", err))
 	}
 
 	if _, err := tempFile.WriteString(content); err != nil {
-		logger.Error("Failed to write to temp file", "error", err)
-		return nil
+		tempFile.Close()
+		os.Remove(tempFile.Name())
+		return statusCmd(fmt.Sprintf("Failed to write temp file: %v", err))
 	}
 	tempFile.Close()
 
-	// Execute glow command with terminal width
-	c := exec.Command("glow", "-p", "-w", fmt.Sprintf("%d", terminalWidth-2), tempFile.Name())
-	
-	// Check if style file exists and add it if available
-	shareDir, err := config.GetShareDir()
-	if err == nil {
-		stylePath := filepath.Join(shareDir, "ggpt_glow_style.json")
-		if _, err := os.Stat(stylePath); err == nil {
-			c.Args = append(c.Args, "--style", stylePath)
-		}
-	}
-	return tea.ExecProcess(c, func(err error) tea.Msg {
+	pager := config.GetPager()
+	c := newExternalCommand(pager[0], append(pager[1:], tempFile.Name())...)
+	return c.run("Pager "+pager[0], nil, func() {
 		// Clean up the temporary file
 		if err := os.Remove(tempFile.Name()); err != nil {
-			logger.Error("Failed to remove temporary file", "error", err)
+			logger.Debug("Failed to remove temporary file", "error", err)
 		}
-		return nil
 	})
 }
 
-func openPager(selected conversation.Conversation, logger *log.Logger) tea.Cmd {
-	// Create a temporary file to save the conversation message
-	tempFile, err := os.CreateTemp("", "conversation-*.md")
+// openRendered shows the conversation rendered as markdown in the pager.
+func openRendered(selected conversation.Conversation, logger *log.Logger, terminalWidth int, glowStyle string) tea.Cmd {
+	renderer, err := style.NewRendererFor(glowStyle, terminalWidth)
 	if err != nil {
-		logger.Error("Failed to create temp file", "error", err)
-		return nil
-	}
-
-	// Format the content with context if it exists
-	var content string
-	if selected.Context != "" {
-		content = fmt.Sprintf("# Conversation %s\n\n## Context\n%s\n\n## User\n%s\n\n## AI\n%s",
-			selected.ID, selected.Context, selected.Message, selected.Response)
-	} else {
-		content = fmt.Sprintf("# Conversation %s\n\n## User\n%s\n\n## AI\n%s",
-			selected.ID, selected.Message, selected.Response)
+		return statusCmd(fmt.Sprintf("Failed to load style: %v", err))
 	}
-
-	if _, err := tempFile.WriteString(content); err != nil {
-		logger.Error("Failed to write to temp file", "error", err)
-		return nil
+	rendered, err := renderer.Render(conversation.FormatConversation(selected))
+	if err != nil {
+		return statusCmd(fmt.Sprintf("Failed to render conversation: %v", err))
 	}
-	tempFile.Close()
+	return openDocument(rendered, logger)
+}
 
-	// Execute less command
-	c := exec.Command("less", "-SR", tempFile.Name())
-	return tea.ExecProcess(c, func(err error) tea.Msg {
-		// Clean up the temporary file
-		if err := os.Remove(tempFile.Name()); err != nil {
-			logger.Error("Failed to remove temporary file", "error", err)
-		}
-		return nil
-	})
+// openPager shows the conversation as plain markdown in the pager.
+func openPager(selected conversation.Conversation, logger *log.Logger) tea.Cmd {
+	return openDocument(conversation.FormatConversation(selected), logger)
 }
 
 func editConversation(selected conversation.Conversation, logger *log.Logger) tea.Cmd {
+	// Get editor from environment variable
+	editor := config.GetEditor()
+	if editor == "" {
+		return statusCmd("EDITOR environment variable is not set")
+	}
+
 	// Create a temporary file with the message
 	tmpFile, err := os.CreateTemp("", "edit-*.txt")
 	if err != nil {
-		logger.Error("Failed to create temp file", "error", err)
-		return nil
+		return statusCmd(fmt.Sprintf("Failed to create temp file: %v", err))
 	}
 
 	if _, err := tmpFile.WriteString(selected.Message); err != nil {
-		logger.Error("Failed to write to temp file", "error", err)
-		return nil
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+		return statusCmd(fmt.Sprintf("Failed to write temp file: %v", err))
 	}
 	tmpFile.Close()
 
-	// Get editor from environment variable
-	editor := os.Getenv("EDITOR")
-	if editor == "" {
-		logger.Error("EDITOR environment variable is not set")
-		return nil
-	}
-
 	// Open the file in the editor
-	editCmd := exec.Command(editor, tmpFile.Name())
-	editCmd.Stdin = os.Stdin
-	editCmd.Stdout = os.Stdout
-	editCmd.Stderr = os.Stderr
-	logger.Info("Opening editor", "editor", editor, "file", tmpFile.Name())
-
-	return tea.ExecProcess(editCmd, func(err error) tea.Msg {
-		defer os.Remove(tmpFile.Name())
-		if err != nil {
-			logger.Error("Failed to open editor", "error", err)
-			return err
-		}
+	logger.Debug("Opening editor", "editor", editor, "file", tmpFile.Name())
+	c := newExternalCommand(editor, tmpFile.Name())
+	return c.run("Editor "+editor, func() tea.Msg {
 		// Read the edited message
 		editedMessageByte, err := os.ReadFile(tmpFile.Name())
 		if err != nil {
-			logger.Error("Failed to read edited message", "error", err)
-			return err
+			return statusMsg(fmt.Sprintf("Failed to read edited message: %v", err))
 		}
 		editedMessageString := string(editedMessageByte)
-		logger.Info("Edited message", "message", editedMessageString)
+		logger.Debug("Edited message", "message", editedMessageString)
 		return editCompleteMsg{message: editedMessageString}
+	}, func() {
+		os.Remove(tmpFile.Name())
 	})
 }
 
+// updateExport handles key input while the export path prompt is shown.
+func (m model) updateExport(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.showExport = false
+		return m, nil
+	case "enter":
+		m.showExport = false
+		path := strings.TrimSpace(m.exportInput.Value())
+		if path == "" || len(m.entries) == 0 {
+			return m, nil
+		}
+		selected, err := m.selected()
+		if err != nil {
+			m.status = fmt.Sprintf("Export failed: %v", err)
+			return m, nil
+		}
+		if err := conversation.CheckShareable(selected); err != nil {
+			m.status = fmt.Sprintf("Not exported: %v (press p to make it shareable)", err)
+			return m, nil
+		}
+		if err := conversation.WriteTranscript(selected, path, ""); err != nil {
+			m.logger.Error("Failed to export conversation", "error", err)
+			m.status = fmt.Sprintf("Export failed: %v", err)
+			return m, nil
+		}
+		m.status = fmt.Sprintf("Exported %s to %s (%s)", selected.ID, path, conversation.TranscriptFormat(path))
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.exportInput, cmd = m.exportInput.Update(msg)
+	return m, cmd
+}
+
+// updateTags handles key input while the tag prompt is shown. Enter
+// replaces the tags of the selected conversation with the ones typed.
+func (m model) updateTags(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.showTags = false
+		return m, nil
+	case "enter":
+		m.showTags = false
+		if len(m.entries) == 0 {
+			return m, nil
+		}
+		tags, err := conversation.ParseTags(strings.Fields(m.tagInput.Value()))
+		if err != nil {
+			m.status = fmt.Sprintf("Tags not changed: %v", err)
+			return m, nil
+		}
+		conv, err := m.selected()
+		if err != nil {
+			m.status = fmt.Sprintf("Failed to change tags: %v", err)
+			return m, nil
+		}
+		conv.Tags = nil
+		conversation.AddTags(&conv, tags)
+		if err := conversation.SaveConversation(conv, m.logger); err != nil {
+			m.status = fmt.Sprintf("Failed to change tags: %v", err)
+			return m, nil
+		}
+		m.update(m.table.Cursor(), conv)
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.tagInput, cmd = m.tagInput.Update(msg)
+	return m, cmd
+}
+
+// updateFilter handles key input while the filter input has the focus.
+// The table narrows with every key; the cursor keys still move in it.
+func (m model) updateFilter(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.filtering = false
+		m.filterInput.Blur()
+		m.filterInput.Reset()
+		m.applyFilter()
+		return m, nil
+	case "enter":
+		m.filtering = false
+		m.filterInput.Blur()
+		return m, nil
+	case "up", "down", "ctrl+p", "ctrl+n", "pgup", "pgdown":
+		switch msg.String() {
+		case "ctrl+p":
+			m.table.MoveUp(1)
+		case "ctrl+n":
+			m.table.MoveDown(1)
+		default:
+			var cmd tea.Cmd
+			m.table, cmd = m.table.Update(msg)
+			return m, cmd
+		}
+		return m, nil
+	}
+	var cmd tea.Cmd
+	previous := m.filterInput.Value()
+	m.filterInput, cmd = m.filterInput.Update(msg)
+	if m.filterInput.Value() != previous {
+		m.applyFilter()
+	}
+	return m, cmd
+}
+
+// applyFilter shows the entries matching the filter input, best first.
+func (m *model) applyFilter() {
+	m.entries = filterEntries(m.all, m.filterInput.Value())
+	m.table.SetRows(tableRows(m.entries, m.terminalWidth))
+	m.table.SetCursor(0)
+}
+
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if m.showExport {
+			return m.updateExport(msg)
+		}
+		if m.showTags {
+			return m.updateTags(msg)
+		}
+		if m.showAttachments {
+			return m.updateAttachments(msg)
+		}
+		if m.filtering {
+			return m.updateFilter(msg)
+		}
+		m.status = ""
 		switch msg.String() {
+		case "/":
+			if !m.showConfirm {
+				m.filtering = true
+				m.filterInput.Focus()
+				return m, textinput.Blink
+			}
+			return m, nil
 		case "esc", "q":
 			if m.showConfirm {
 				m.showConfirm = false
 				return m, nil
 			}
+			if msg.String() == "esc" && m.filterInput.Value() != "" {
+				m.filterInput.Reset()
+				m.applyFilter()
+				return m, nil
+			}
 			return m, tea.Quit
 		case "enter", "v":
 			if m.showConfirm {
@@ -227,48 +360,119 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					return m, nil
 				}
 				// Remove from the list
-				for i, conv := range m.conversations {
-					if conv.ID == m.selectedID {
-						m.conversations = append(m.conversations[:i], m.conversations[i+1:]...)
-						break
-					}
-				}
-				// Update table rows with consistent width calculations
-				idWidth, dateWidth, messageWidth := calculateColumnWidths(m.terminalWidth)
-				
-				var rows []table.Row
-				for _, conv := range m.conversations {
-					rows = append(rows, table.Row{
-						truncateString(conv.ID, idWidth),
-						truncateString(conv.Timestamp.Format("2006-01-02 15:04:05"), dateWidth),
-						truncateString(conv.Message, messageWidth),
-					})
-				}
-				m.table.SetRows(rows)
+				m.all = removeEntry(m.all, m.selectedID)
+				m.entries = removeEntry(m.entries, m.selectedID)
+				m.bodies.remove(m.selectedID)
+				m.table.SetRows(tableRows(m.entries, m.terminalWidth))
 				m.showConfirm = false
 				return m, nil
 			}
-			if len(m.conversations) > 0 {
-				selected := m.conversations[m.table.Cursor()]
-				return m, openGlow(selected, m.logger, m.terminalWidth)
+			if len(m.entries) > 0 {
+				selected, err := m.markRead(m.table.Cursor())
+				if err != nil {
+					m.status = fmt.Sprintf("Failed to load conversation: %v", err)
+					return m, nil
+				}
+				return m, openRendered(selected, m.logger, m.terminalWidth, m.glowStyle)
 			}
 			return m, nil
 		case "V":
-			if len(m.conversations) > 0 {
-				selected := m.conversations[m.table.Cursor()]
+			if len(m.entries) > 0 {
+				selected, err := m.markRead(m.table.Cursor())
+				if err != nil {
+					m.status = fmt.Sprintf("Failed to load conversation: %v", err)
+					return m, nil
+				}
 				return m, openPager(selected, m.logger)
 			}
 			return m, nil
 		case "e":
-			if len(m.conversations) > 0 {
-				selected := m.conversations[m.table.Cursor()]
+			if len(m.entries) > 0 {
+				selected, err := m.selected()
+				if err != nil {
+					m.status = fmt.Sprintf("Failed to load conversation: %v", err)
+					return m, nil
+				}
 				return m, editConversation(selected, m.logger)
 			}
 			return m, nil
+		case "x":
+			if !m.showConfirm && len(m.entries) > 0 {
+				selected := m.entries[m.table.Cursor()]
+				m.exportInput = textinput.New()
+				m.exportInput.Prompt = "Export to: "
+				m.exportInput.SetValue(fmt.Sprintf("conversation-%s.md", selected.ID))
+				m.exportInput.Focus()
+				m.showExport = true
+				return m, textinput.Blink
+			}
+			return m, nil
+		case "t":
+			if !m.showConfirm && len(m.entries) > 0 {
+				selected := m.entries[m.table.Cursor()]
+				m.tagInput = textinput.New()
+				m.tagInput.Prompt = "Tags: "
+				m.tagInput.SetValue(strings.Join(selected.Tags, " "))
+				m.tagInput.CursorEnd()
+				m.tagInput.Focus()
+				m.showTags = true
+				return m, textinput.Blink
+			}
+			return m, nil
+		case "s":
+			if !m.showConfirm && len(m.entries) > 0 {
+				conv, err := m.selected()
+				if err != nil {
+					m.status = fmt.Sprintf("Failed to change visibility: %v", err)
+					return m, nil
+				}
+				if conv.IsPrivate() {
+					conv.Visibility = conversation.VisibilityShareable
+				} else {
+					conv.Visibility = conversation.VisibilityPrivate
+				}
+				if err := conversation.SaveConversation(conv, m.logger); err != nil {
+					m.status = fmt.Sprintf("Failed to change visibility: %v", err)
+					return m, nil
+				}
+				m.update(m.table.Cursor(), conv)
+				m.status = fmt.Sprintf("%s is now %s", conv.ID, conv.Visibility)
+			}
+			return m, nil
+		case "a":
+			if !m.showConfirm && len(m.entries) > 0 {
+				return m.openAttachments()
+			}
+			return m, nil
+		case "p":
+			if !m.showConfirm && len(m.entries) > 0 {
+				return m.togglePinned()
+			}
+			return m, nil
+		case "A":
+			if !m.showConfirm && len(m.entries) > 0 {
+				return m.toggleArchived()
+			}
+			return m, nil
+		case "f":
+			if !m.showConfirm && len(m.entries) > 0 {
+				return m.fork()
+			}
+			return m, nil
+		case "c":
+			if !m.showConfirm && len(m.entries) > 0 {
+				conv, err := m.selected()
+				if err != nil {
+					m.status = fmt.Sprintf("Failed to load conversation: %v", err)
+					return m, nil
+				}
+				m.status = costStatus(conv)
+			}
+			return m, nil
 		case "d":
-			if !m.showConfirm && len(m.conversations) > 0 {
+			if !m.showConfirm && len(m.entries) > 0 {
 				m.showConfirm = true
-				m.selectedID = m.conversations[m.table.Cursor()].ID
+				m.selectedID = m.entries[m.table.Cursor()].ID
 				return m, nil
 			}
 			return m, nil
@@ -281,12 +485,24 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 	case editCompleteMsg:
 		// Start new conversation with edited message
-		return m, tea.ExecProcess(exec.Command("asc", "new", msg.message), func(err error) tea.Msg {
-			if err != nil {
-				m.logger.Error("Failed to execute asc new", "error", err)
+		c := newExternalCommand("asc", "new", msg.message)
+		return m, c.run("asc new", func() tea.Msg {
+			return tea.Quit()
+		}, nil)
+	case statusMsg:
+		m.status = string(msg)
+		return m, nil
+	case reloadedMsg:
+		for i, entry := range m.entries {
+			if entry.ID == msg.conv.ID {
+				m.update(i, msg.conv)
+				if m.showAttachments && m.attachmentsOf == msg.conv.ID {
+					m.attachments = conversation.ListAttachments(msg.conv)
+					m.attachmentCursor = min(m.attachmentCursor, len(m.attachments)-1)
+				}
 			}
-			return tea.Quit
-		})
+		}
+		return m, nil
 	}
 	m.table, cmd = m.table.Update(msg)
 	return m, cmd
@@ -296,7 +512,7 @@ func (m model) View() string {
 	if m.showConfirm {
 		style := lipgloss.NewStyle().
 			BorderStyle(lipgloss.RoundedBorder()).
-			BorderForeground(lipgloss.Color("240")).
+			BorderForeground(lipgloss.Color(config.Colors().Border)).
 			Padding(1, 2)
 
 		content := fmt.Sprintf("Delete conversation %s?\n\n", m.selectedID)
@@ -304,23 +520,70 @@ func (m model) View() string {
 		return style.Render(content)
 	}
 
+	if m.showExport {
+		style := lipgloss.NewStyle().
+			BorderStyle(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.Color(config.Colors().Border)).
+			Padding(1, 2)
+
+		content := m.exportInput.View() + "\n\n"
+		content += "The format follows the extension (.md, .html or .json). Enter to export, Esc to cancel"
+		return style.Render(content)
+	}
+
+	if m.showAttachments {
+		return m.attachmentsView()
+	}
+
+	if m.showTags {
+		style := lipgloss.NewStyle().
+			BorderStyle(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.Color(config.Colors().Border)).
+			Padding(1, 2)
+
+		content := m.tagInput.View() + "\n\n"
+		content += "Separate tags with spaces. Enter to save, Esc to cancel"
+		return style.Render(content)
+	}
+
 	// Create help message
 	helpStyle := lipgloss.NewStyle().
 		BorderStyle(lipgloss.RoundedBorder()).
-		BorderForeground(lipgloss.Color("240")).
+		BorderForeground(lipgloss.Color(config.Colors().Border)).
 		Padding(1, 2)
 
 	helpContent := "Keybindings:\n" +
-		"  v: View conversation with glow\n" +
-		"  V: View conversation with less\n" +
+		"  /: Filter conversations\n" +
+		"  v: View conversation rendered\n" +
+		"  V: View conversation with the pager\n" +
 		"  e: Edit conversation\n" +
+		"  x: Export conversation\n" +
+		"  t: Edit tags\n" +
+		"  p: Pin to the top or unpin\n" +
+		"  s: Toggle private (not shareable)\n" +
+		"  a: Show attachments\n" +
+		"  A: Archive or unarchive conversation\n" +
+		"  f: Fork conversation as a new thread\n" +
+		"  c: Show tokens and cost\n" +
 		"  d: Delete conversation\n" +
 		"  q: Quit"
 
 	helpBox := helpStyle.Render(helpContent)
 
-	// Combine table and help message
-	return lipgloss.JoinVertical(lipgloss.Left, m.table.View(), helpBox)
+	// Combine filter, table, status line and help message
+	parts := []string{m.table.View()}
+	if m.filtering || m.filterInput.Value() != "" {
+		filterLine := m.filterInput.View()
+		if !m.filtering {
+			filterLine += fmt.Sprintf("  (%d of %d, Esc clears)", len(m.entries), len(m.all))
+		}
+		parts = append([]string{filterLine}, parts...)
+	}
+	if m.status != "" {
+		parts = append(parts, m.status)
+	}
+	parts = append(parts, helpBox)
+	return lipgloss.JoinVertical(lipgloss.Left, parts...)
 }
 
 func truncateString(s string, maxLen int) string {
@@ -330,7 +593,280 @@ func truncateString(s string, maxLen int) string {
 	return s[:maxLen-3] + "..."
 }
 
-func StartView(logger *log.Logger) error {
+// unreadMarker prefixes the message of conversations whose answer has not
+// been viewed yet, and pinnedMarker that of pinned conversations.
+const (
+	unreadMarker = "● "
+	pinnedMarker = "★ "
+)
+
+// tableRows builds the table rows with consistent width calculations.
+func tableRows(entries []conversation.Entry, terminalWidth int) []table.Row {
+	idWidth, dateWidth, messageWidth := calculateColumnWidths(terminalWidth)
+
+	var rows []table.Row
+	for _, entry := range entries {
+		message := entry.Title
+		if message == "" {
+			message = entry.Message
+		}
+		if len(entry.Tags) > 0 {
+			message = "#" + strings.Join(entry.Tags, " #") + " " + message
+		}
+		if entry.Unread {
+			message = unreadMarker + message
+		}
+		if entry.Pinned {
+			message = pinnedMarker + message
+		}
+		rows = append(rows, table.Row{
+			truncateString(entry.ID, idWidth),
+			truncateString(timeutil.Format(entry.Timestamp), dateWidth),
+			truncateString(message, messageWidth),
+		})
+	}
+	return rows
+}
+
+// costStatus describes the token usage and cost of conv for the status
+// line.
+func costStatus(conv conversation.Conversation) string {
+	total := conversation.ConversationCost(conv)
+	if total.TotalTokens() == 0 {
+		return fmt.Sprintf("%s: no token usage recorded", conv.ID)
+	}
+	status := fmt.Sprintf("%s: %d prompt + %d completion tokens, $%.4f",
+		conv.ID, total.PromptTokens, total.CompletionTokens, total.Cost)
+	if total.Estimated > 0 {
+		status += " (estimated)"
+	}
+	if total.Unpriced > 0 {
+		status += fmt.Sprintf(", %d exchange(s) without a price", total.Unpriced)
+	}
+	return status
+}
+
+// selected loads the conversation under the cursor.
+func (m *model) selected() (conversation.Conversation, error) {
+	return m.bodies.get(m.entries[m.table.Cursor()].ID, m.logger)
+}
+
+// removeEntry returns entries without the one with id.
+func removeEntry(entries []conversation.Entry, id string) []conversation.Entry {
+	for i, entry := range entries {
+		if entry.ID == id {
+			return append(entries[:i:i], entries[i+1:]...)
+		}
+	}
+	return entries
+}
+
+// update replaces the conversation at index after it was saved.
+func (m *model) update(index int, conv conversation.Conversation) {
+	m.entries[index] = conversation.NewEntry(conv)
+	for i, entry := range m.all {
+		if entry.ID == conv.ID {
+			m.all[i] = m.entries[index]
+		}
+	}
+	m.bodies.put(conv)
+	m.table.SetRows(tableRows(m.entries, m.terminalWidth))
+}
+
+// togglePinned pins the selected conversation, or unpins it, and moves it
+// with the cursor to its place in the list.
+func (m model) togglePinned() (tea.Model, tea.Cmd) {
+	conv, err := m.selected()
+	if err != nil {
+		m.status = fmt.Sprintf("Failed to load conversation: %v", err)
+		return m, nil
+	}
+	conv.Pinned = !conv.Pinned
+	if err := conversation.SaveConversation(conv, m.logger); err != nil {
+		m.status = fmt.Sprintf("Failed to pin %s: %v", conv.ID, err)
+		return m, nil
+	}
+	m.update(m.table.Cursor(), conv)
+	sortEntries(m.all)
+	m.applyFilter()
+	for i, entry := range m.entries {
+		if entry.ID == conv.ID {
+			m.table.SetCursor(i)
+		}
+	}
+	m.status = fmt.Sprintf("Pinned %s", conv.ID)
+	if !conv.Pinned {
+		m.status = fmt.Sprintf("Unpinned %s", conv.ID)
+	}
+	return m, nil
+}
+
+// toggleArchived archives the selected conversation, or unarchives it if
+// it is archived. It leaves the list unless the list was picked by ID.
+func (m model) toggleArchived() (tea.Model, tea.Cmd) {
+	conv, err := m.selected()
+	if err != nil {
+		m.status = fmt.Sprintf("Failed to load conversation: %v", err)
+		return m, nil
+	}
+	status := fmt.Sprintf("Archived %s; see it with asc view --archived", conv.ID)
+	if conv.Archived != nil {
+		conv.Archived = nil
+		status = fmt.Sprintf("Unarchived %s", conv.ID)
+	} else {
+		conversation.Archive(&conv)
+	}
+	if err := conversation.SaveConversation(conv, m.logger); err != nil {
+		m.status = fmt.Sprintf("Failed to archive %s: %v", conv.ID, err)
+		return m, nil
+	}
+	if m.pickedByID {
+		m.update(m.table.Cursor(), conv)
+	} else {
+		m.all = removeEntry(m.all, conv.ID)
+		m.entries = removeEntry(m.entries, conv.ID)
+		m.bodies.remove(conv.ID)
+		m.table.SetRows(tableRows(m.entries, m.terminalWidth))
+		if m.table.Cursor() >= len(m.entries) {
+			m.table.SetCursor(max(len(m.entries)-1, 0))
+		}
+	}
+	m.status = status
+	return m, nil
+}
+
+// fork copies the selected conversation as a new one and selects the
+// copy, which is the newest.
+func (m model) fork() (tea.Model, tea.Cmd) {
+	conv, err := m.selected()
+	if err != nil {
+		m.status = fmt.Sprintf("Failed to load conversation: %v", err)
+		return m, nil
+	}
+	fork, err := conversation.Fork(conv, 0)
+	if err != nil {
+		m.status = fmt.Sprintf("Failed to fork %s: %v", conv.ID, err)
+		return m, nil
+	}
+	saved, err := conversation.SaveNewConversation(fork, m.logger)
+	if err != nil {
+		m.status = fmt.Sprintf("Failed to fork %s: %v", conv.ID, err)
+		return m, nil
+	}
+	m.all = append([]conversation.Entry{conversation.NewEntry(saved)}, m.all...)
+	m.bodies.put(saved)
+	m.applyFilter()
+	for i, entry := range m.entries {
+		if entry.ID == saved.ID {
+			m.table.SetCursor(i)
+		}
+	}
+	m.status = fmt.Sprintf("Forked %s as %s; continue it with asc chat --id %s", conv.ID, saved.ID, saved.ID)
+	return m, nil
+}
+
+// markRead marks the conversation at index as read and returns it.
+func (m *model) markRead(index int) (conversation.Conversation, error) {
+	conv, err := m.bodies.get(m.entries[index].ID, m.logger)
+	if err != nil {
+		return conv, err
+	}
+	if conv.Unread {
+		if err := conversation.MarkRead(&conv, m.logger); err != nil {
+			m.logger.Error("Failed to mark conversation as read", "error", err)
+		}
+		m.update(index, conv)
+	}
+	return conv, nil
+}
+
+// listEntries returns the entries matching filter, pinned ones first and
+// then newest first. Archived
+// conversations are listed alone with archived, and otherwise only when
+// filter picks conversations by ID.
+func listEntries(filter conversation.Filter, unreadOnly, archived bool, logger *log.Logger) ([]conversation.Entry, error) {
+	entries, err := conversation.LoadEntries(logger)
+	if err != nil {
+		return nil, err
+	}
+	entries = filter.ApplyEntries(entries)
+	if archived || filter.IDs == nil {
+		entries = conversation.Archived(entries, archived)
+	}
+	if unreadOnly {
+		var unread []conversation.Entry
+		for _, entry := range entries {
+			if entry.Unread {
+				unread = append(unread, entry)
+			}
+		}
+		entries = unread
+	}
+
+	sortEntries(entries)
+	return entries, nil
+}
+
+// sortEntries sorts pinned conversations first, then newest first.
+func sortEntries(entries []conversation.Entry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Pinned != entries[j].Pinned {
+			return entries[i].Pinned
+		}
+		return entries[i].Timestamp.After(entries[j].Timestamp)
+	})
+}
+
+// PrintList writes the conversations matching filter to w as plain text,
+// one per line, pinned ones first and then newest first, for screen
+// readers.
+func PrintList(w io.Writer, filter conversation.Filter, unreadOnly, archived bool, logger *log.Logger) error {
+	entries, err := listEntries(filter, unreadOnly, archived, logger)
+	if err != nil {
+		return err
+	}
+	switch len(entries) {
+	case 0:
+		fmt.Fprintln(w, "No conversations.")
+		return nil
+	case 1:
+		fmt.Fprintln(w, "1 conversation.")
+	default:
+		order := "newest first"
+		if entries[0].Pinned {
+			order = "pinned first, then newest first"
+		}
+		fmt.Fprintf(w, "%d conversations, %s.\n", len(entries), order)
+	}
+	for _, entry := range entries {
+		message := entry.Title
+		if message == "" {
+			message = truncateString(strings.Join(strings.Fields(entry.Message), " "), 100)
+		}
+		state := ""
+		if entry.Unread {
+			state = ", unread"
+		}
+		if entry.Pinned {
+			state += ", pinned"
+		}
+		if entry.Archived != nil {
+			state += ", archived"
+		}
+		if len(entry.Tags) > 0 {
+			state += ", tagged " + strings.Join(entry.Tags, ", ")
+		}
+		fmt.Fprintf(w, "%s, %s%s: %s\n", entry.ID, timeutil.Format(entry.Timestamp), state, message)
+	}
+	fmt.Fprintln(w, "End of list. Show a conversation with asc show and its ID.")
+	return nil
+}
+
+// StartView shows the conversations matching filter, pinned ones first and
+// then newest first, or the
+// archived ones with archived. If openID is set, that conversation is
+// selected and opened in the pager.
+func StartView(filter conversation.Filter, unreadOnly, archived bool, height int, openID string, logger *log.Logger) error {
 	logger.Debug("Viewing conversation history")
 
 	// Get terminal width using term.GetSize with fallback
@@ -343,34 +879,50 @@ func StartView(logger *log.Logger) error {
 		logger.Debug("Terminal width", "width", width, "source", "term.GetSize")
 	}
 
-	conversations, err := conversation.LoadConversations(logger)
+	// Only list entries are kept; conversations are loaded when opened
+	entries, err := listEntries(filter, unreadOnly, archived, logger)
 	if err != nil {
 		return err
 	}
 
-	// Sort conversations by timestamp (newest first)
-	sort.Slice(conversations, func(i, j int) bool {
-		return conversations[i].Timestamp.After(conversations[j].Timestamp)
-	})
-
-	// Create table rows with consistent width calculations
-	idWidth, dateWidth, messageWidth := calculateColumnWidths(width)
-	
-	var rows []table.Row
-	for _, conv := range conversations {
-		rows = append(rows, table.Row{
-			truncateString(conv.ID, idWidth),
-			truncateString(conv.Timestamp.Format("2006-01-02 15:04:05"), dateWidth),
-			truncateString(conv.Message, messageWidth),
-		})
+	// Initialize and run the table UI
+	m := initialModel(logger, width, height)
+	m.table.SetRows(tableRows(entries, width))
+	m.all = entries
+	m.entries = entries
+	m.archived, m.pickedByID = archived, filter.IDs != nil && !archived
+
+	// Resolve the style before the TUI takes over the terminal, since
+	// detecting the background queries the terminal
+	m.glowStyle, err = style.GlowStyle(logger)
+	if err != nil {
+		logger.Warn("Using the dark style", "error", err)
+		m.glowStyle = "dark"
 	}
 
-	// Initialize and run the table UI
-	m := initialModel(logger, width)
-	m.table.SetRows(rows)
-	m.conversations = conversations
+	if openID != "" {
+		index := -1
+		for i, entry := range entries {
+			if entry.ID == openID {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			if _, err := conversation.LoadConversation(openID, logger); err != nil {
+				return err
+			}
+			return fmt.Errorf("conversation %s is not in the list, check --since, --until, --meta, --unread and --archived", openID)
+		}
+		m.table.SetCursor(index)
+		selected, err := m.markRead(index)
+		if err != nil {
+			return err
+		}
+		m.startCmd = openRendered(selected, logger, width, m.glowStyle)
+	}
 
-	p := tea.NewProgram(m)
+	p := crash.NewProgram(m)
 	if _, err := p.Run(); err != nil {
 		return err
 	}